@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/app"
+	"ledger.api/pkg/auth"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/rates"
+)
+
+// maskedDBURL returns db url with password masked so it can be printed
+func maskedDBURL(rawDBURL string) string {
+	dbURL, err := url.Parse(rawDBURL)
+	if err != nil || dbURL.User == nil {
+		return rawDBURL
+	}
+	if _, ok := dbURL.User.Password(); ok {
+		dbURL.User = url.UserPassword(dbURL.User.Username(), "xxxxx")
+	}
+	return dbURL.String()
+}
+
+func runCheckConfig(cfg app.Config, logger logging.Logger, args []string) error {
+	fmt.Printf("APP_ENV=%v\n", cfg.GetString("APP_ENV"))
+	fmt.Printf("PORT=%v\n", cfg.GetInt("PORT"))
+	fmt.Printf("DB_URL=%v\n", maskedDBURL(cfg.GetString("DB_URL")))
+	fmt.Printf("AUTH0_ISS=%v\n", cfg.GetString("AUTH0_ISS"))
+	fmt.Printf("AUTH0_AUD=%v\n", cfg.GetString("AUTH0_AUD"))
+	fmt.Printf("RATES_FILE=%v\n", cfg.GetString("RATES_FILE"))
+	fmt.Printf("SCOPE_POLICY_FILE=%v\n", cfg.GetString("SCOPE_POLICY_FILE"))
+	fmt.Printf("AUTH0_JWKS_FILE=%v\n", cfg.GetString("AUTH0_JWKS_FILE"))
+	if cfg.GetString("INVITATIONS_SECRET") != "" {
+		fmt.Println("INVITATIONS_SECRET=xxxxx")
+	} else {
+		fmt.Println("INVITATIONS_SECRET=")
+	}
+	for _, key := range []string{
+		"HTTP_READ_TIMEOUT", "HTTP_WRITE_TIMEOUT", "HTTP_IDLE_TIMEOUT", "SHUTDOWN_TIMEOUT",
+		"TRACING_EXPORTER", "TRACING_OTLP_ENDPOINT", "BEANSTALKD_URL",
+	} {
+		fmt.Printf("%v=%v\n", key, cfg.GetString(key))
+	}
+	fmt.Println()
+
+	problems := app.ValidateConfig(cfg)
+	if ratesFile := cfg.GetString("RATES_FILE"); ratesFile != "" {
+		if _, err := rates.CreateFileRateProvider(ratesFile); err != nil {
+			problems = append(problems, fmt.Errorf("RATES_FILE can not be loaded: %v", err))
+		}
+	}
+	if policyFile := cfg.GetString("SCOPE_POLICY_FILE"); policyFile != "" {
+		if _, err := auth.LoadScopePolicy(policyFile); err != nil {
+			problems = append(problems, fmt.Errorf("SCOPE_POLICY_FILE can not be loaded: %v", err))
+		}
+	}
+	if jwksFile := cfg.GetString("AUTH0_JWKS_FILE"); jwksFile != "" {
+		if err := auth.CreateJWKSCache(auth.CreateFileKeySource(jwksFile), auth.DefaultJWKSRefreshInterval).Load(); err != nil {
+			problems = append(problems, fmt.Errorf("AUTH0_JWKS_FILE can not be loaded: %v", err))
+		}
+	}
+	if len(problems) == 0 {
+		db, err := gorm.Open("postgres", cfg.GetString("DB_URL"))
+		if err != nil {
+			problems = append(problems, fmt.Errorf("Failed to connect to db: %v", err))
+		} else {
+			db.Close()
+		}
+	}
+
+	for _, problem := range problems {
+		fmt.Printf("FAIL: %v\n", problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("Config has %v problem(s)", len(problems))
+	}
+	fmt.Println("OK")
+	return nil
+}
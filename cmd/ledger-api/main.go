@@ -2,53 +2,66 @@ package main
 
 import (
 	"fmt"
-	"net/http"
-
-	"ledger.api/pkg/ledgers"
-	"ledger.api/pkg/transactions"
+	"os"
+	"sort"
 
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 	"ledger.api/pkg/app"
-	"ledger.api/pkg/auth"
 	"ledger.api/pkg/logging"
-	"ledger.api/pkg/server"
 )
 
-func createAuthMiddleware(cfg app.Config) server.RouterMiddlewareFunc {
-	validator := auth.CreateAuth0Validator(
-		cfg.GetString("AUTH0_ISS"),
-		cfg.GetString("AUTH0_AUD"),
-	)
-	return server.CreateAuthMiddlewareFunc(server.AuthMiddlewareParams{
-		Validator: validator,
-		WhitelistedRoutes: map[string]bool{
-			"/v2/healthcheck/ping": true,
-		},
-	})
+// command - a ledger-api subcommand
+type command struct {
+	description string
+	run         func(cfg app.Config, logger logging.Logger, args []string) error
 }
 
-func main() {
-	cfg := app.GetConfig()
-	env := cfg.GetString("APP_ENV")
-	logger := logging.NewLogger(env)
-	db := app.OpenGormConnection(cfg.GetString("DB_URL"), logger)
-	defer db.Close()
+var commands = map[string]command{
+	"serve":        command{description: "Start http server (default)", run: runServe},
+	"migrate":      command{description: "Apply, revert or show schema migrations", run: runMigrate},
+	"project":      command{description: "Build projections from the v1 event store", run: runProject},
+	"seed":         command{description: "Seed the db with random ledgers data", run: runSeed},
+	"check-config": command{description: "Validate config and db connectivity", run: runCheckConfig},
+	"version":      command{description: "Print version and build info", run: runVersion},
+	"routes":       command{description: "Print registered routes and their scopes", run: runRoutes},
+}
 
-	ledgersSvc := ledgers.CreateQueryService(db)
-	transactonsQuerySvc := transactions.CreateQueryService(db)
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "Usage: ledger-api <command> [args]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14v%v\n", name, commands[name].description)
+	}
+}
 
-	handler := server.
-		CreateHTTPApp(server.HTTPAppConfig{Env: env, Logger: logger}).
-		Use(server.CreateCorsMiddlewareFunc()).
-		Use(createAuthMiddleware(cfg)).
-		RegisterRoutes(app.Routes).
-		RegisterRoutes(ledgers.CreateRoutes(ledgersSvc)).
-		RegisterRoutes(transactions.CreateRoutes(transactonsQuerySvc)).
-		CreateHandler()
+func main() {
+	name := "serve"
+	args := []string{}
+	if len(os.Args) > 1 {
+		name = os.Args[1]
+		args = os.Args[2:]
+	}
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command: %v\n\n", name)
+		printUsage()
+		os.Exit(2)
+	}
 
-	port := cfg.GetInt("PORT")
-	logger.Infof("Starting server on port: %v", port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%v", port), handler); err != nil {
-		logger.Error(err, "Failed to start server")
+	cfg := app.GetConfig()
+	logger := logging.NewLogger(cfg.GetString("APP_ENV"))
+	if err := cmd.run(cfg, logger, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"ledger.api/pkg/app"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/migrations"
+)
+
+const migrateUsage = `Usage: ledger-api migrate <command>
+
+Commands:
+  up            Apply all pending migrations
+  down [steps]  Revert given number of most recent migrations, defaults to 1
+  status        Show migrations and their status`
+
+// runMigrate applies, reverts or shows schema migrations depending on given args
+func runMigrate(cfg app.Config, logger logging.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	db := app.OpenGormConnection(cfg.GetString("DB_URL"), logger)
+	defer db.Close()
+	ctx := logging.CreateContext(context.Background(), logger)
+	migrator, err := migrations.CreateMigrator(db, migrations.All())
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		logger.Infof("Applied %v migrations", len(applied))
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return fmt.Errorf("Steps should be a positive number, got: %v", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		logger.Infof("Reverted %v migrations", len(reverted))
+		return err
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED AT")
+		for _, migration := range status {
+			appliedAt := "pending"
+			if migration.AppliedAt != nil {
+				appliedAt = migration.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(writer, "%v\t%v\t%v\n", migration.Version, migration.Name, appliedAt)
+		}
+		return writer.Flush()
+	}
+	return fmt.Errorf("Unknown migrate command: %v\n\n%v", args[0], migrateUsage)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"ledger.api/pkg/app"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/projections"
+)
+
+func runProject(cfg app.Config, logger logging.Logger, args []string) error {
+	flags := flag.NewFlagSet("project", flag.ContinueOnError)
+	rebuild := flags.Bool("rebuild", false, "clean projections and apply all events from scratch")
+	once := flags.Bool("once", false, "apply pending events and exit")
+	interval := flags.Duration("interval", 1*time.Second, "event store poll interval")
+	name := flags.String("name", projections.DefaultName, "name of the projector checkpoint")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db := app.OpenGormConnection(cfg.GetString("DB_URL"), logger)
+	defer db.Close()
+
+	ctx, cancel := app.CreateSignalContext(logging.CreateContext(context.Background(), logger), logger)
+	defer cancel()
+
+	projector := projections.CreateProjector(db, *name)
+	if *rebuild {
+		processed, err := projector.Rebuild(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rebuilt projections from %v commits\n", processed)
+	}
+	if *once {
+		processed, err := projector.ProcessPending(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %v commits\n", processed)
+		return nil
+	}
+	return projector.Run(ctx, *interval)
+}
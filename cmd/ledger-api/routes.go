@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"ledger.api/pkg/app"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/rates"
+)
+
+func runRoutes(cfg app.Config, logger logging.Logger, args []string) error {
+	// Routes are only registered so services are not connected to the db
+	httpApp := createHTTPApp(cfg, httpAppParams{
+		rateProvider: rates.CreateStaticRateProvider(nil),
+		logger:       logging.NewTestLogger(),
+	})
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "METHOD\tPATH\tSCOPES")
+	for _, route := range httpApp.Routes() {
+		scopes := strings.Join(route.Scopes, " ")
+		if scopes == "" {
+			scopes = "-"
+		}
+		fmt.Fprintf(writer, "%v\t%v\t%v\n", route.Method, route.Path, scopes)
+	}
+	return writer.Flush()
+}
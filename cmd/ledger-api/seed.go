@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"ledger.api/pkg/app"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/seed"
+)
+
+func runSeed(cfg app.Config, logger logging.Logger, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	opts := seed.Options{}
+	flags.StringVar(&opts.Subject, "subject", "", "auth0 subject of a user to share seeded ledgers with. A random user is created if empty")
+	flags.IntVar(&opts.Ledgers, "ledgers", 1, "number of ledgers to seed")
+	flags.IntVar(&opts.Transactions, "transactions", 200, "number of transactions to seed per ledger")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db := app.OpenGormConnection(cfg.GetString("DB_URL"), logger)
+	defer db.Close()
+
+	result, err := seed.Run(logging.CreateContext(context.Background(), logger), db, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("User: %v (id: %v)\n", result.User.Subject, result.User.ID)
+	for _, ledgerID := range result.LedgerIDs {
+		fmt.Printf("Ledger: %v\n", ledgerID)
+	}
+	return nil
+}
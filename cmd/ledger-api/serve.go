@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel"
+	"ledger.api/pkg/accountcategories"
+	"ledger.api/pkg/accounts"
+	"ledger.api/pkg/apikeys"
+	"ledger.api/pkg/app"
+	"ledger.api/pkg/audit"
+	"ledger.api/pkg/auth"
+	"ledger.api/pkg/eventstore"
+	"ledger.api/pkg/healthcheck"
+	"ledger.api/pkg/ledgers"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/metrics"
+	"ledger.api/pkg/rates"
+	"ledger.api/pkg/server"
+	"ledger.api/pkg/tags"
+	"ledger.api/pkg/tracing"
+	"ledger.api/pkg/transactions"
+	"ledger.api/pkg/users"
+	"ledger.api/version"
+)
+
+// createJWKSCache creates a cache of keys auth0 tokens are signed with. Keys are loaded from AUTH0_JWKS_FILE on
+// startup if configured so the issuer does not have to be reachable (e.g air-gapped environments)
+func createJWKSCache(cfg app.Config, logger logging.Logger) (*auth.JWKSCache, error) {
+	jwksFile := cfg.GetString("AUTH0_JWKS_FILE")
+	if jwksFile == "" {
+		return auth.CreateAuth0JWKSCache(cfg.GetString("AUTH0_ISS")), nil
+	}
+	logger.WithField("file", jwksFile).Info("Loading JWKS")
+	cache := auth.CreateJWKSCache(auth.CreateFileKeySource(jwksFile), auth.DefaultJWKSRefreshInterval)
+	if err := cache.Load(); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// createAuthMiddleware creates middleware that accepts auth0 tokens and API keys
+func createAuthMiddleware(tokenValidator auth.RequestValidator, apiKeysSvc apikeys.Service) server.RouterMiddlewareFunc {
+	validator := apikeys.CreateRequestValidator(apiKeysSvc, tokenValidator)
+	return server.CreateAuthMiddlewareFunc(server.AuthMiddlewareParams{
+		Validator: validator,
+		WhitelistedRoutes: map[string]bool{
+			"/v2/healthcheck/ping":  true,
+			"/v2/healthcheck/live":  true,
+			"/v2/healthcheck/ready": true,
+			"/metrics":              true,
+		},
+	})
+}
+
+// createRateProvider creates a provider that serves rates from RATES_FILE if configured
+// or from exchange_rates table otherwise
+func createRateProvider(cfg app.Config, db *gorm.DB, logger logging.Logger) (rates.RateProvider, error) {
+	ratesFile := cfg.GetString("RATES_FILE")
+	if ratesFile == "" {
+		return rates.CreateDBRateProvider(db), nil
+	}
+	logger.WithField("file", ratesFile).Info("Loading exchange rates")
+	return rates.CreateFileRateProvider(ratesFile)
+}
+
+// createScopePolicy loads scope policy from SCOPE_POLICY_FILE if configured
+// or returns the default policy otherwise
+func createScopePolicy(cfg app.Config, logger logging.Logger) (*auth.ScopePolicy, error) {
+	policyFile := cfg.GetString("SCOPE_POLICY_FILE")
+	if policyFile == "" {
+		return auth.DefaultScopePolicy(), nil
+	}
+	logger.WithField("file", policyFile).Info("Loading scope policy")
+	return auth.LoadScopePolicy(policyFile)
+}
+
+// createInvitationsKey returns a key invitation tokens are signed with. A random key is
+// generated if INVITATIONS_SECRET is not configured so invitations are valid until restart
+func createInvitationsKey(cfg app.Config, logger logging.Logger) []byte {
+	if secret := cfg.GetString("INVITATIONS_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	logger.Warn("INVITATIONS_SECRET is not configured. Invitations will not be valid after restart")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// createHealthcheckRegistry creates a registry of dependencies the app readiness depends on.
+// The db is checked first, then JWKS keys tokens are validated with and beanstalkd if configured
+func createHealthcheckRegistry(cfg app.Config, db *gorm.DB, jwksCache *auth.JWKSCache) *healthcheck.Registry {
+	registry := healthcheck.CreateRegistry(healthcheck.DefaultTimeout)
+	if db != nil {
+		registry.Register("db", healthcheck.CreateDBChecker(db.DB()))
+	}
+	registry.Register("jwks", jwksCache)
+	if beanstalkdURL := cfg.GetString("BEANSTALKD_URL"); beanstalkdURL != "" {
+		registry.Register("beanstalkd", healthcheck.CreateBeanstalkdChecker(beanstalkdURL))
+	}
+	return registry
+}
+
+// createTracer creates a tracer with exporter configured via TRACING_EXPORTER
+func createTracer(cfg app.Config, logger logging.Logger) (*tracing.Tracer, error) {
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.WithError(err).Warn("Tracing failed")
+	}))
+	switch cfg.GetString("TRACING_EXPORTER") {
+	case "log":
+		return tracing.CreateTracer(version.AppName, tracing.CreateLogExporter(logger)), nil
+	case "otlp":
+		endpoint := cfg.GetString("TRACING_OTLP_ENDPOINT")
+		logger.WithField("endpoint", endpoint).Info("Exporting traces")
+		exporter, err := tracing.CreateOTLPExporter(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return tracing.CreateTracer(version.AppName, exporter), nil
+	default:
+		return tracing.CreateTracer(version.AppName, nil), nil
+	}
+}
+
+// httpAppParams - dependencies of the http app
+type httpAppParams struct {
+	db           *gorm.DB
+	rateProvider rates.RateProvider
+	logger       logging.Logger
+
+	// tracer, scopePolicy and auditRecorder are optional
+	tracer        *tracing.Tracer
+	scopePolicy   *auth.ScopePolicy
+	auditRecorder audit.Recorder
+
+	// jwksCache defaults to keys of auth0 issuer if not set
+	jwksCache *auth.JWKSCache
+}
+
+// createHTTPApp creates http app with all services and routes registered
+func createHTTPApp(cfg app.Config, params httpAppParams) *server.HTTPApp {
+	db := params.db
+	rateProvider := params.rateProvider
+	usersSvc := users.CreateQueryService(db)
+	eventStore := eventstore.CreateStore(db)
+	ledgersSvc := ledgers.CreateQueryService(db)
+	ledgersCmdSvc := ledgers.CreateCommandService(db, eventStore, createInvitationsKey(cfg, params.logger))
+	ledgerAccess := ledgers.CreateLedgerAccessChecker(db)
+	accountsSvc := accounts.CreateQueryService(db, rateProvider)
+	categoriesQuerySvc := accountcategories.CreateQueryService(db)
+	categoriesCmdSvc := accountcategories.CreateCommandService(db, eventStore)
+	tagsQuerySvc := tags.CreateQueryService(db)
+	tagsCmdSvc := tags.CreateCommandService(db, eventStore)
+	transactonsQuerySvc := transactions.CreateQueryService(db, rateProvider)
+	transactionsCmdSvc := transactions.CreateCommandService(db, eventStore)
+	apiKeysSvc := apikeys.CreateService(db)
+	auditSvc := audit.CreateQueryService(db)
+
+	registry := metrics.CreateRegistry()
+	if db != nil {
+		registry.MustRegister(metrics.CreateDBStatsCollector(db.DB()))
+	}
+
+	httpApp := server.CreateHTTPApp(server.HTTPAppConfig{
+		Env:         cfg.GetString("APP_ENV"),
+		Logger:      params.logger,
+		Tracer:      params.tracer,
+		ScopePolicy: params.scopePolicy,
+	})
+	jwksCache := params.jwksCache
+	if jwksCache == nil {
+		jwksCache = auth.CreateAuth0JWKSCache(cfg.GetString("AUTH0_ISS"))
+	}
+	tokenValidator := auth.CreateJWKSValidator(jwksCache, cfg.GetString("AUTH0_ISS"), cfg.GetString("AUTH0_AUD"))
+	httpApp.
+		Use(server.CreateMetricsMiddlewareFunc(registry)).
+		Use(server.CreateCorsMiddlewareFunc(httpApp.AllowedMethods)).
+		Use(createAuthMiddleware(tokenValidator, apiKeysSvc))
+	if params.auditRecorder != nil {
+		httpApp.Use(audit.CreateAuditMiddlewareFunc(params.auditRecorder))
+	}
+	return httpApp.
+		Use(server.CreateUserMiddlewareFunc(usersSvc)).
+		RegisterRoutes(app.Routes).
+		RegisterRoutes(healthcheck.CreateRoutes(createHealthcheckRegistry(cfg, db, jwksCache))).
+		RegisterRoutes(metrics.CreateRoutes(registry)).
+		RegisterRoutes(apikeys.CreateRoutes(apiKeysSvc)).
+		RegisterRoutes(ledgers.CreateRoutes(ledgersSvc)).
+		RegisterRoutes(ledgers.CreateMembersRoutes(ledgersSvc, ledgerAccess)).
+		RegisterRoutes(ledgers.CreateCommandRoutes(ledgersCmdSvc, ledgerAccess)).
+		RegisterRoutes(audit.CreateRoutes(auditSvc, ledgerAccess)).
+		RegisterRoutes(accounts.CreateRoutes(accountsSvc, ledgerAccess)).
+		RegisterRoutes(accountcategories.CreateRoutes(categoriesQuerySvc, ledgerAccess)).
+		RegisterRoutes(accountcategories.CreateCommandRoutes(categoriesCmdSvc, ledgerAccess)).
+		RegisterRoutes(tags.CreateRoutes(tagsQuerySvc, ledgerAccess)).
+		RegisterRoutes(tags.CreateCommandRoutes(tagsCmdSvc, ledgerAccess)).
+		RegisterRoutes(transactions.CreateRoutes(transactonsQuerySvc, ledgerAccess)).
+		RegisterRoutes(transactions.CreateCommandRoutes(transactionsCmdSvc, ledgerAccess))
+}
+
+// createLifecycleConfig reads http server timeouts from config
+func createLifecycleConfig(cfg app.Config, logger logging.Logger) (server.LifecycleConfig, error) {
+	lifecycleCfg := server.LifecycleConfig{
+		Addr:   fmt.Sprintf(":%v", cfg.GetInt("PORT")),
+		Logger: logger,
+	}
+	durations := map[string]*time.Duration{
+		"HTTP_READ_TIMEOUT":  &lifecycleCfg.ReadTimeout,
+		"HTTP_WRITE_TIMEOUT": &lifecycleCfg.WriteTimeout,
+		"HTTP_IDLE_TIMEOUT":  &lifecycleCfg.IdleTimeout,
+		"SHUTDOWN_TIMEOUT":   &lifecycleCfg.ShutdownTimeout,
+	}
+	for key, target := range durations {
+		duration, err := app.GetDuration(cfg, key)
+		if err != nil {
+			return lifecycleCfg, err
+		}
+		*target = duration
+	}
+	return lifecycleCfg, nil
+}
+
+func runServe(cfg app.Config, logger logging.Logger, args []string) error {
+	lifecycleCfg, err := createLifecycleConfig(cfg, logger)
+	if err != nil {
+		return err
+	}
+	scopePolicy, err := createScopePolicy(cfg, logger)
+	if err != nil {
+		return err
+	}
+	jwksCache, err := createJWKSCache(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	db := app.OpenGormConnection(cfg.GetString("DB_URL"), logger)
+	rateProvider, err := createRateProvider(cfg, db, logger)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	tracer, err := createTracer(cfg, logger)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	tracing.RegisterGormCallbacks(db)
+	auditOpts := audit.DefaultWriterOptions()
+	auditOpts.Tracer = tracer
+	auditWriter := audit.CreateWriter(db, logger, auditOpts)
+	handler := createHTTPApp(cfg, httpAppParams{
+		db:            db,
+		rateProvider:  rateProvider,
+		logger:        logger,
+		tracer:        tracer,
+		scopePolicy:   scopePolicy,
+		auditRecorder: auditWriter,
+		jwksCache:     jwksCache,
+	}).CreateHandler()
+
+	ctx, cancel := app.CreateSignalContext(context.Background(), logger)
+	defer cancel()
+	return server.CreateLifecycle(handler, lifecycleCfg).
+		OnShutdown("db", db.Close).
+		OnShutdown("audit", auditWriter.Shutdown).
+		OnShutdown("tracing", tracer.Shutdown).
+		ListenAndServe(ctx)
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"ledger.api/pkg/app"
+	"ledger.api/pkg/logging"
+	"ledger.api/version"
+)
+
+func runVersion(cfg app.Config, logger logging.Logger, args []string) error {
+	fmt.Printf("%v %v\n", version.AppName, version.VERSION)
+	fmt.Printf("Git hash: %v\n", version.GitHash)
+	fmt.Printf("Git ref: %v\n", version.GitRef)
+	fmt.Printf("Git url: %v\n", version.GitURL)
+	fmt.Printf("Go: %v\n", runtime.Version())
+	return nil
+}
@@ -0,0 +1,381 @@
+package accountcategories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/eventstore"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
+	"ledger.api/pkg/users"
+)
+
+var (
+	errCategoryNotFound  = errors.New("Category not found")
+	errAccountNotFound   = errors.New("Account not found")
+	errIncompleteOrder   = errors.New("Order should include every category of the ledger exactly once")
+	errCategoryNameTaken = errors.New("Category with the same name already exists")
+)
+
+// Events below are emitted by v1 ledger aggregate. Stream id is a ledger id.
+
+type categoryCreated struct {
+	AggregateID  string `json:"aggregate_id"`
+	CategoryID   int    `json:"category_id"`
+	DisplayOrder int    `json:"display_order"`
+	Name         string `json:"name"`
+}
+
+func (categoryCreated) EventType() string { return "Domain::Events::CategoryCreated" }
+
+type categoryRenamed struct {
+	AggregateID string `json:"aggregate_id"`
+	CategoryID  int    `json:"category_id"`
+	Name        string `json:"name"`
+}
+
+func (categoryRenamed) EventType() string { return "Domain::Events::CategoryRenamed" }
+
+type categoryDisplayOrderChanged struct {
+	AggregateID  string `json:"aggregate_id"`
+	CategoryID   int    `json:"category_id"`
+	DisplayOrder int    `json:"display_order"`
+}
+
+func (categoryDisplayOrderChanged) EventType() string {
+	return "Domain::Events::CategoryDisplayOrderChanged"
+}
+
+type accountCategoryAssigned struct {
+	AggregateID string `json:"aggregate_id"`
+	CategoryID  int    `json:"category_id"`
+	AccountID   string `json:"account_id"`
+}
+
+func (accountCategoryAssigned) EventType() string { return "Domain::Events::AccountCategoryAssigned" }
+
+type categoryRef struct {
+	ID int `jsonapi:"primary,account-categories" validate:"required"`
+}
+
+type accountRef struct {
+	ID string `jsonapi:"primary,accounts" validate:"required"`
+}
+
+// categoryPayload is a JSON API representation of the category
+// submitted by clients to create or rename categories
+type categoryPayload struct {
+	ID   int    `jsonapi:"primary,account-categories"`
+	Name string `jsonapi:"attr,name" validate:"required,max=255"`
+}
+
+// categoriesOrderPayload holds all categories of the ledger in a desired order
+type categoriesOrderPayload struct {
+	ID         string         `jsonapi:"primary,account-categories-order"`
+	Categories []*categoryRef `jsonapi:"relation,categories" validate:"required,dive,required"`
+}
+
+func (payload *categoriesOrderPayload) categoryIDs() []int {
+	result := make([]int, len(payload.Categories))
+	for i, category := range payload.Categories {
+		result[i] = category.ID
+	}
+	return result
+}
+
+type createCategoryCommand struct {
+	ledgerID string
+	user     *users.User
+	name     string
+}
+
+type renameCategoryCommand struct {
+	ledgerID   string
+	categoryID int
+	user       *users.User
+	name       string
+}
+
+type reorderCategoriesCommand struct {
+	ledgerID    string
+	user        *users.User
+	categoryIDs []int
+}
+
+type moveAccountCommand struct {
+	ledgerID   string
+	categoryID int
+	accountID  string
+	user       *users.User
+}
+
+// CommandService is a service to process commands that change account categories
+type CommandService interface {
+	processCreateCategoryCommand(ctx context.Context, cmd *createCategoryCommand) (int, error)
+	processRenameCategoryCommand(ctx context.Context, cmd *renameCategoryCommand) error
+	processReorderCategoriesCommand(ctx context.Context, cmd *reorderCategoriesCommand) error
+	processMoveAccountCommand(ctx context.Context, cmd *moveAccountCommand) error
+}
+
+type dbCommandService struct {
+	db    *gorm.DB
+	store eventstore.Store
+}
+
+func commandHeaders(user *users.User) eventstore.Headers {
+	return eventstore.Headers{"user_id": user.ID}
+}
+
+type existingCategory struct {
+	categoryID   int
+	name         string
+	displayOrder int
+}
+
+// categoryEventData includes fields of all events the categories state is built from
+type categoryEventData struct {
+	CategoryID   int    `json:"category_id"`
+	DisplayOrder int    `json:"display_order"`
+	Name         string `json:"name"`
+}
+
+// loadCategories builds categories of the ledger from events of the ledger stream.
+// The stream is locked so ids and names can not be taken concurrently
+func loadCategories(tx eventstore.Tx, ledgerID string) ([]existingCategory, error) {
+	events, err := tx.ReadEvents(ledgerID, "Domain::Events::Category")
+	if err != nil {
+		return nil, err
+	}
+	result := []existingCategory{}
+	indexByID := make(map[int]int)
+	for _, evt := range events {
+		var data categoryEventData
+		switch evt.Type {
+		case categoryCreated{}.EventType(), categoryRenamed{}.EventType(), categoryDisplayOrderChanged{}.EventType():
+			if err := evt.Decode(&data); err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+		index, ok := indexByID[data.CategoryID]
+		if evt.Type == (categoryCreated{}).EventType() {
+			indexByID[data.CategoryID] = len(result)
+			result = append(result, existingCategory{
+				categoryID:   data.CategoryID,
+				name:         data.Name,
+				displayOrder: data.DisplayOrder,
+			})
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if evt.Type == (categoryRenamed{}).EventType() {
+			result[index].name = data.Name
+		} else {
+			result[index].displayOrder = data.DisplayOrder
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].displayOrder != result[j].displayOrder {
+			return result[i].displayOrder < result[j].displayOrder
+		}
+		return result[i].categoryID < result[j].categoryID
+	})
+	return result, nil
+}
+
+func findCategory(categories []existingCategory, categoryID int) (*existingCategory, error) {
+	for i := range categories {
+		if categories[i].categoryID == categoryID {
+			return &categories[i], nil
+		}
+	}
+	return nil, errCategoryNotFound
+}
+
+// validateCategoryName checks that the name is not taken by other category of the ledger
+func validateCategoryName(categories []existingCategory, categoryID int, name string) error {
+	for _, category := range categories {
+		if category.categoryID != categoryID && category.name == name {
+			return errCategoryNameTaken
+		}
+	}
+	return nil
+}
+
+func validateCommandParams(ledgerID string, user *users.User) error {
+	if ledgerID == "" {
+		return errors.New("Please provide ledgerID")
+	}
+	if user == nil {
+		return errors.New("Please provide user")
+	}
+	return nil
+}
+
+func (svc *dbCommandService) processCreateCategoryCommand(ctx context.Context, cmd *createCategoryCommand) (int, error) {
+	if err := validateCommandParams(cmd.ledgerID, cmd.user); err != nil {
+		return 0, err
+	}
+	logger := logging.FromContext(ctx)
+
+	categoryID := 1
+	if err := svc.store.Transaction(ctx, commandHeaders(cmd.user), func(tx eventstore.Tx) error {
+		categories, err := loadCategories(tx, cmd.ledgerID)
+		if err != nil {
+			return err
+		}
+		if err := validateCategoryName(categories, 0, cmd.name); err != nil {
+			return err
+		}
+		displayOrder := 0
+		for _, category := range categories {
+			if category.categoryID >= categoryID {
+				categoryID = category.categoryID + 1
+			}
+			if category.displayOrder >= displayOrder {
+				displayOrder = category.displayOrder + 1
+			}
+		}
+
+		logger.Debugf("Creating category %v. Ledger: %v", categoryID, cmd.ledgerID)
+		return tx.Append(cmd.ledgerID, &categoryCreated{
+			AggregateID:  cmd.ledgerID,
+			CategoryID:   categoryID,
+			DisplayOrder: displayOrder,
+			Name:         cmd.name,
+		})
+	}); err != nil {
+		return 0, err
+	}
+	return categoryID, nil
+}
+
+func (svc *dbCommandService) processRenameCategoryCommand(ctx context.Context, cmd *renameCategoryCommand) error {
+	if err := validateCommandParams(cmd.ledgerID, cmd.user); err != nil {
+		return err
+	}
+	logger := logging.FromContext(ctx)
+
+	return svc.store.Transaction(ctx, commandHeaders(cmd.user), func(tx eventstore.Tx) error {
+		categories, err := loadCategories(tx, cmd.ledgerID)
+		if err != nil {
+			return err
+		}
+		category, err := findCategory(categories, cmd.categoryID)
+		if err != nil {
+			return err
+		}
+		if category.name == cmd.name {
+			logger.Debugf("Category %v has not been changed", cmd.categoryID)
+			return nil
+		}
+		if err := validateCategoryName(categories, cmd.categoryID, cmd.name); err != nil {
+			return err
+		}
+
+		logger.Debugf("Renaming category %v. Ledger: %v", cmd.categoryID, cmd.ledgerID)
+		return tx.Append(cmd.ledgerID,
+			&categoryRenamed{AggregateID: cmd.ledgerID, CategoryID: cmd.categoryID, Name: cmd.name},
+		)
+	})
+}
+
+func (svc *dbCommandService) processReorderCategoriesCommand(ctx context.Context, cmd *reorderCategoriesCommand) error {
+	if err := validateCommandParams(cmd.ledgerID, cmd.user); err != nil {
+		return err
+	}
+	logger := logging.FromContext(ctx)
+
+	return svc.store.Transaction(ctx, commandHeaders(cmd.user), func(tx eventstore.Tx) error {
+		categories, err := loadCategories(tx, cmd.ledgerID)
+		if err != nil {
+			return err
+		}
+		if len(categories) != len(cmd.categoryIDs) {
+			return errIncompleteOrder
+		}
+		displayOrderByID := make(map[int]int)
+		for _, category := range categories {
+			displayOrderByID[category.categoryID] = category.displayOrder
+		}
+
+		events := []eventstore.Event{}
+		seen := make(map[int]bool)
+		for displayOrder, categoryID := range cmd.categoryIDs {
+			currentOrder, ok := displayOrderByID[categoryID]
+			if !ok || seen[categoryID] {
+				return errIncompleteOrder
+			}
+			seen[categoryID] = true
+			if currentOrder != displayOrder {
+				events = append(events, &categoryDisplayOrderChanged{
+					AggregateID:  cmd.ledgerID,
+					CategoryID:   categoryID,
+					DisplayOrder: displayOrder,
+				})
+			}
+		}
+
+		if len(events) == 0 {
+			logger.Debugf("Categories order of ledger %v has not been changed", cmd.ledgerID)
+			return nil
+		}
+
+		logger.Debugf("Reordering categories. Ledger: %v, events: %v", cmd.ledgerID, len(events))
+		return tx.Append(cmd.ledgerID, events...)
+	})
+}
+
+func (svc *dbCommandService) processMoveAccountCommand(ctx context.Context, cmd *moveAccountCommand) error {
+	if err := validateCommandParams(cmd.ledgerID, cmd.user); err != nil {
+		return err
+	}
+	if cmd.accountID == "" {
+		return errors.New("Please provide accountID")
+	}
+	logger := logging.FromContext(ctx)
+
+	// Accounts the user is not authorized on are not found so they can not be moved
+	var currentCategoryID int
+	err := users.WithAccessibleAccounts(tracing.DB(ctx, svc.db).Table("projections_accounts acc"), cmd.user).
+		Select("COALESCE(acc.category_id, 0)").
+		Where("acc.ledger_id = ? AND acc.aggregate_id = ?", cmd.ledgerID, cmd.accountID).
+		Row().Scan(&currentCategoryID)
+	if err == sql.ErrNoRows {
+		return errAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return svc.store.Transaction(ctx, commandHeaders(cmd.user), func(tx eventstore.Tx) error {
+		categories, err := loadCategories(tx, cmd.ledgerID)
+		if err != nil {
+			return err
+		}
+		if _, err := findCategory(categories, cmd.categoryID); err != nil {
+			return err
+		}
+		if currentCategoryID == cmd.categoryID {
+			logger.Debugf("Account %v is already in category %v", cmd.accountID, cmd.categoryID)
+			return nil
+		}
+
+		logger.Debugf("Moving account %v to category %v", cmd.accountID, cmd.categoryID)
+		return tx.Append(cmd.ledgerID,
+			&accountCategoryAssigned{AggregateID: cmd.ledgerID, CategoryID: cmd.categoryID, AccountID: cmd.accountID},
+		)
+	})
+}
+
+// CreateCommandService initializes a new instance of the command service
+func CreateCommandService(db *gorm.DB, store eventstore.Store) CommandService {
+	svc := dbCommandService{db: db, store: store}
+	return &svc
+}
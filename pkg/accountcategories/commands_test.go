@@ -0,0 +1,209 @@
+package accountcategories
+
+import (
+	"context"
+	"testing"
+
+	"github.com/icrowley/fake"
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/eventstore"
+	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/logging"
+)
+
+func TestCategoryCommands(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given account category commands", t, func() {
+		store := ldtesting.NewEventStore(DB)
+		svc := CreateCommandService(DB, store)
+		user := ldtesting.NewUser()
+		ledgerID := uuid.NewV4().String()
+		store.Seed(ledgerID,
+			&categoryCreated{AggregateID: ledgerID, CategoryID: 1, DisplayOrder: 0, Name: "Cash"},
+			&categoryCreated{AggregateID: ledgerID, CategoryID: 3, DisplayOrder: 2, Name: "Banks"},
+		)
+		store.Seed(ledgerID, &categoryDisplayOrderChanged{AggregateID: ledgerID, CategoryID: 3, DisplayOrder: 1})
+		acc, err := ldtesting.SetupAccount(DB, ledgerID, ldtesting.AccCategory(1), ldtesting.AccAuthorizedUsers(user))
+		So(err, ShouldBeNil)
+
+		Convey("When creating category", func() {
+			Convey("It should append created event with next id and display order", func() {
+				name := fake.Word()
+				categoryID, err := svc.processCreateCategoryCommand(ctx, &createCategoryCommand{
+					ledgerID: ledgerID,
+					user:     user,
+					name:     name,
+				})
+				So(err, ShouldBeNil)
+				So(categoryID, ShouldEqual, 4)
+				So(store.Commits, ShouldHaveLength, 1)
+				So(store.Commits[0].StreamID, ShouldEqual, ledgerID)
+				So(store.Commits[0].Headers, ShouldResemble, eventstore.Headers{"user_id": user.ID})
+				So(store.Commits[0].Events, ShouldResemble, []eventstore.Event{
+					&categoryCreated{AggregateID: ledgerID, CategoryID: 4, DisplayOrder: 2, Name: name},
+				})
+			})
+
+			Convey("It should fail if name is taken", func() {
+				_, err := svc.processCreateCategoryCommand(ctx, &createCategoryCommand{
+					ledgerID: ledgerID,
+					user:     user,
+					name:     "Cash",
+				})
+				So(err, ShouldEqual, errCategoryNameTaken)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should fail if name is taken by renamed category", func() {
+				store.Seed(ledgerID, &categoryRenamed{AggregateID: ledgerID, CategoryID: 1, Name: "Wallet"})
+				_, err := svc.processCreateCategoryCommand(ctx, &createCategoryCommand{
+					ledgerID: ledgerID,
+					user:     user,
+					name:     "Wallet",
+				})
+				So(err, ShouldEqual, errCategoryNameTaken)
+				So(store.Commits, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When renaming category", func() {
+			Convey("It should append renamed event", func() {
+				name := fake.Word()
+				err := svc.processRenameCategoryCommand(ctx, &renameCategoryCommand{
+					ledgerID:   ledgerID,
+					categoryID: 3,
+					user:       user,
+					name:       name,
+				})
+				So(err, ShouldBeNil)
+				So(store.Commits, ShouldHaveLength, 1)
+				So(store.Commits[0].Events, ShouldResemble, []eventstore.Event{
+					&categoryRenamed{AggregateID: ledgerID, CategoryID: 3, Name: name},
+				})
+			})
+
+			Convey("It should fail if name is taken", func() {
+				err := svc.processRenameCategoryCommand(ctx, &renameCategoryCommand{
+					ledgerID:   ledgerID,
+					categoryID: 3,
+					user:       user,
+					name:       "Cash",
+				})
+				So(err, ShouldEqual, errCategoryNameTaken)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should not append anything if name is the same", func() {
+				err := svc.processRenameCategoryCommand(ctx, &renameCategoryCommand{
+					ledgerID:   ledgerID,
+					categoryID: 3,
+					user:       user,
+					name:       "Banks",
+				})
+				So(err, ShouldBeNil)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should fail if category is from other ledger", func() {
+				err := svc.processRenameCategoryCommand(ctx, &renameCategoryCommand{
+					ledgerID:   uuid.NewV4().String(),
+					categoryID: 3,
+					user:       user,
+					name:       fake.Word(),
+				})
+				So(err, ShouldEqual, errCategoryNotFound)
+			})
+		})
+
+		Convey("When reordering categories", func() {
+			Convey("It should append display order changes", func() {
+				err := svc.processReorderCategoriesCommand(ctx, &reorderCategoriesCommand{
+					ledgerID:    ledgerID,
+					user:        user,
+					categoryIDs: []int{3, 1},
+				})
+				So(err, ShouldBeNil)
+				So(store.Commits, ShouldHaveLength, 1)
+				So(store.Commits[0].Events, ShouldResemble, []eventstore.Event{
+					&categoryDisplayOrderChanged{AggregateID: ledgerID, CategoryID: 3, DisplayOrder: 0},
+					&categoryDisplayOrderChanged{AggregateID: ledgerID, CategoryID: 1, DisplayOrder: 1},
+				})
+			})
+
+			Convey("It should not append anything if order is the same", func() {
+				err := svc.processReorderCategoriesCommand(ctx, &reorderCategoriesCommand{
+					ledgerID:    ledgerID,
+					user:        user,
+					categoryIDs: []int{1, 3},
+				})
+				So(err, ShouldBeNil)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should fail if order is incomplete", func() {
+				for _, categoryIDs := range [][]int{{1}, {1, 1}, {1, 2}, {1, 3, 4}} {
+					err := svc.processReorderCategoriesCommand(ctx, &reorderCategoriesCommand{
+						ledgerID:    ledgerID,
+						user:        user,
+						categoryIDs: categoryIDs,
+					})
+					So(err, ShouldEqual, errIncompleteOrder)
+				}
+				So(store.Commits, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When moving account", func() {
+			Convey("It should append category assigned event", func() {
+				err := svc.processMoveAccountCommand(ctx, &moveAccountCommand{
+					ledgerID:   ledgerID,
+					categoryID: 3,
+					accountID:  acc.AccountID,
+					user:       user,
+				})
+				So(err, ShouldBeNil)
+				So(store.Commits, ShouldHaveLength, 1)
+				So(store.Commits[0].Events, ShouldResemble, []eventstore.Event{
+					&accountCategoryAssigned{AggregateID: ledgerID, CategoryID: 3, AccountID: acc.AccountID},
+				})
+			})
+
+			Convey("It should fail if account is from other ledger", func() {
+				other, err := ldtesting.SetupAccount(DB, uuid.NewV4().String(), ldtesting.AccAuthorizedUsers(user))
+				So(err, ShouldBeNil)
+				err = svc.processMoveAccountCommand(ctx, &moveAccountCommand{
+					ledgerID:   ledgerID,
+					categoryID: 3,
+					accountID:  other.AccountID,
+					user:       user,
+				})
+				So(err, ShouldEqual, errAccountNotFound)
+			})
+
+			Convey("It should fail if user is not authorized on the account", func() {
+				hidden, err := ldtesting.SetupAccount(DB, ledgerID, ldtesting.AccCategory(1))
+				So(err, ShouldBeNil)
+				err = svc.processMoveAccountCommand(ctx, &moveAccountCommand{
+					ledgerID:   ledgerID,
+					categoryID: 3,
+					accountID:  hidden.AccountID,
+					user:       user,
+				})
+				So(err, ShouldEqual, errAccountNotFound)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should fail if category does not exist", func() {
+				err := svc.processMoveAccountCommand(ctx, &moveAccountCommand{
+					ledgerID:   ledgerID,
+					categoryID: 100,
+					accountID:  acc.AccountID,
+					user:       user,
+				})
+				So(err, ShouldEqual, errCategoryNotFound)
+			})
+		})
+	})
+}
@@ -0,0 +1,85 @@
+package accountcategories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
+	"ledger.api/pkg/users"
+)
+
+type categoryDTO struct {
+	CategoryID   int      `json:"categoryID"`
+	Name         string   `json:"name"`
+	DisplayOrder int      `json:"displayOrder"`
+	AccountIDs   []string `json:"accountIDs" gorm:"-"`
+}
+
+type ledgerCategoriesQuery struct {
+	ledgerID string
+	user     *users.User
+}
+
+// QueryService is a service to do various queries against account categories
+type QueryService interface {
+	processLedgerCategoriesQuery(ctx context.Context, query *ledgerCategoriesQuery) ([]categoryDTO, error)
+}
+
+type dbQueryService struct {
+	db *gorm.DB
+}
+
+func (svc *dbQueryService) processLedgerCategoriesQuery(ctx context.Context, query *ledgerCategoriesQuery) ([]categoryDTO, error) {
+	if query.ledgerID == "" {
+		return nil, errors.New("Please provide ledgerID")
+	}
+	if query.user == nil {
+		return nil, errors.New("Please provide user")
+	}
+	logger := logging.FromContext(ctx)
+	logger.Debugf("Processing ledger categories query. LedgerID: %v", query.ledgerID)
+
+	result := []categoryDTO{}
+	if err := tracing.DB(ctx, svc.db).Table("projections_categories cat").
+		Select("cat.category_id, cat.name, cat.display_order").
+		Where("cat.ledger_id = ?", query.ledgerID).
+		Order("cat.display_order, cat.category_id").
+		Find(&result).Error; err != nil {
+		return nil, err
+	}
+
+	// Categories are visible to all members but accounts only to users authorized on them
+	rows, err := users.WithAccessibleAccounts(tracing.DB(ctx, svc.db).Table("projections_accounts acc"), query.user).
+		Select("COALESCE(acc.category_id, 0), acc.aggregate_id").
+		Where("acc.ledger_id = ?", query.ledgerID).
+		Order("acc.sequential_number").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	indexByCategoryID := make(map[int]int)
+	for i := range result {
+		result[i].AccountIDs = []string{}
+		indexByCategoryID[result[i].CategoryID] = i
+	}
+	for rows.Next() {
+		var categoryID int
+		var accountID string
+		if err := rows.Scan(&categoryID, &accountID); err != nil {
+			return nil, err
+		}
+		if index, ok := indexByCategoryID[categoryID]; ok {
+			result[index].AccountIDs = append(result[index].AccountIDs, accountID)
+		}
+	}
+	return result, rows.Err()
+}
+
+// CreateQueryService initializes a new instance of the query service
+func CreateQueryService(db *gorm.DB) QueryService {
+	svc := dbQueryService{db: db}
+	return &svc
+}
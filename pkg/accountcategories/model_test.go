@@ -0,0 +1,54 @@
+package accountcategories
+
+import (
+	"context"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/logging"
+)
+
+func TestLedgerCategoriesQuery(t *testing.T) {
+	Convey("Given ledger categories query", t, func() {
+		ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+		svc := CreateQueryService(DB)
+		user := ldtesting.NewUser()
+		ledgerID := uuid.NewV4().String()
+		So(ldtesting.SetupCategory(DB, ledgerID, 1, "Cash", 1), ShouldBeNil)
+		So(ldtesting.SetupCategory(DB, ledgerID, 2, "Banks", 0), ShouldBeNil)
+		So(ldtesting.SetupCategory(DB, uuid.NewV4().String(), 1, "Other ledger", 0), ShouldBeNil)
+		cash, err := ldtesting.SetupAccount(DB, ledgerID, ldtesting.AccCategory(1), ldtesting.AccAuthorizedUsers(user))
+		So(err, ShouldBeNil)
+		savings, err := ldtesting.SetupAccount(DB, ledgerID, ldtesting.AccCategory(2))
+		So(err, ShouldBeNil)
+		_, err = ldtesting.SetupAccount(DB, uuid.NewV4().String(), ldtesting.AccCategory(1))
+		So(err, ShouldBeNil)
+
+		Convey("It should return categories of the ledger ordered by display order", func() {
+			result, err := svc.processLedgerCategoriesQuery(ctx, &ledgerCategoriesQuery{ledgerID: ledgerID, user: user})
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, []categoryDTO{
+				categoryDTO{CategoryID: 2, Name: "Banks", DisplayOrder: 0, AccountIDs: []string{}},
+				categoryDTO{CategoryID: 1, Name: "Cash", DisplayOrder: 1, AccountIDs: []string{cash.AccountID}},
+			})
+		})
+
+		Convey("It should include only accounts the user is authorized on", func() {
+			owner := ldtesting.NewUser()
+			So(DB.Exec("UPDATE projections_accounts SET owner_user_id = ? WHERE aggregate_id = ?", owner.ID, savings.AccountID).Error, ShouldBeNil)
+			result, err := svc.processLedgerCategoriesQuery(ctx, &ledgerCategoriesQuery{ledgerID: ledgerID, user: owner})
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, []categoryDTO{
+				categoryDTO{CategoryID: 2, Name: "Banks", DisplayOrder: 0, AccountIDs: []string{savings.AccountID}},
+				categoryDTO{CategoryID: 1, Name: "Cash", DisplayOrder: 1, AccountIDs: []string{}},
+			})
+		})
+
+		Convey("It should return error if no ledger provided", func() {
+			_, err := svc.processLedgerCategoriesQuery(ctx, &ledgerCategoriesQuery{user: user})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
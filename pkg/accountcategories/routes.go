@@ -0,0 +1,154 @@
+package accountcategories
+
+import (
+	"net/http"
+	"strconv"
+
+	"ledger.api/pkg/server"
+	"ledger.api/pkg/users"
+)
+
+// CreateRoutes - Register account categories related routes
+func CreateRoutes(svc QueryService, ledgerAccess server.LedgerAccessChecker) server.Routes {
+	return func(router *server.Router) {
+		router.
+			Group(
+				"/v2/ledgers/:ledgerID/account-categories",
+				server.WithScopes("read:account-categories"),
+				server.WithMiddleware(server.CreateLedgerAccessMiddlewareFunc(ledgerAccess)),
+			).
+			GET("", createLedgerCategoriesQueryHandler(svc))
+	}
+}
+
+// CreateCommandRoutes - Register routes that change account categories
+func CreateCommandRoutes(svc CommandService, ledgerAccess server.LedgerAccessChecker) server.Routes {
+	return func(router *server.Router) {
+		categories := router.Group(
+			"/v2/ledgers/:ledgerID/account-categories",
+			server.WithScopes("write:account-categories"),
+			server.WithMiddleware(server.CreateLedgerAccessMiddlewareFunc(ledgerAccess)),
+		)
+		categories.POST("", createCreateCategoryHandler(svc))
+		categories.PUT("", createReorderCategoriesHandler(svc))
+		categories.PATCH("/:categoryID", createRenameCategoryHandler(svc))
+		categories.POST("/:categoryID/accounts", createMoveAccountHandler(svc))
+	}
+}
+
+func createLedgerCategoriesQueryHandler(svc QueryService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		result, err := svc.processLedgerCategoriesQuery(req.Context(), &ledgerCategoriesQuery{
+			ledgerID: h.Params.ByName("ledgerID"),
+			user:     users.FromContext(req.Context()),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return h.Response(result), nil
+	}
+}
+
+// commandHTTPError maps command errors to http errors
+func commandHTTPError(err error) error {
+	switch err {
+	case errCategoryNotFound:
+		return *server.NotFoundError()
+	case errAccountNotFound, errIncompleteOrder:
+		return *server.BadRequestError(err.Error())
+	case errCategoryNameTaken:
+		return *server.ConflictError(err.Error())
+	}
+	return err
+}
+
+func parseCategoryID(h *server.HandlerToolkit) (int, error) {
+	categoryID, err := strconv.Atoi(h.Params.ByName("categoryID"))
+	if err != nil {
+		return 0, *server.NotFoundError()
+	}
+	return categoryID, nil
+}
+
+func createCreateCategoryHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		var payload categoryPayload
+		if err := h.Bind(req, &payload); err != nil {
+			return nil, err
+		}
+		categoryID, err := svc.processCreateCategoryCommand(req.Context(), &createCategoryCommand{
+			ledgerID: h.Params.ByName("ledgerID"),
+			user:     users.FromContext(req.Context()),
+			name:     payload.Name,
+		})
+		if err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(server.JSON{"categoryID": categoryID}).Status(http.StatusAccepted), nil
+	}
+}
+
+func createRenameCategoryHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		categoryID, err := parseCategoryID(h)
+		if err != nil {
+			return nil, err
+		}
+		var payload categoryPayload
+		if err := h.Bind(req, &payload); err != nil {
+			return nil, err
+		}
+		if payload.ID != 0 && payload.ID != categoryID {
+			return nil, *server.BadRequestError("Payload id does not match categoryID")
+		}
+		if err := svc.processRenameCategoryCommand(req.Context(), &renameCategoryCommand{
+			ledgerID:   h.Params.ByName("ledgerID"),
+			categoryID: categoryID,
+			user:       users.FromContext(req.Context()),
+			name:       payload.Name,
+		}); err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(server.JSON{"categoryID": categoryID}).Status(http.StatusAccepted), nil
+	}
+}
+
+func createReorderCategoriesHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		var payload categoriesOrderPayload
+		if err := h.Bind(req, &payload); err != nil {
+			return nil, err
+		}
+		categoryIDs := payload.categoryIDs()
+		if err := svc.processReorderCategoriesCommand(req.Context(), &reorderCategoriesCommand{
+			ledgerID:    h.Params.ByName("ledgerID"),
+			user:        users.FromContext(req.Context()),
+			categoryIDs: categoryIDs,
+		}); err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(server.JSON{"categoryIDs": categoryIDs}).Status(http.StatusAccepted), nil
+	}
+}
+
+func createMoveAccountHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		categoryID, err := parseCategoryID(h)
+		if err != nil {
+			return nil, err
+		}
+		var payload accountRef
+		if err := h.Bind(req, &payload); err != nil {
+			return nil, err
+		}
+		if err := svc.processMoveAccountCommand(req.Context(), &moveAccountCommand{
+			ledgerID:   h.Params.ByName("ledgerID"),
+			categoryID: categoryID,
+			accountID:  payload.ID,
+			user:       users.FromContext(req.Context()),
+		}); err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(server.JSON{"categoryID": categoryID, "accountID": payload.ID}).Status(http.StatusAccepted), nil
+	}
+}
@@ -0,0 +1,248 @@
+package accountcategories
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/jsonapi"
+	"github.com/icrowley/fake"
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/server"
+	"ledger.api/pkg/users"
+)
+
+var rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+type methodCall struct {
+	input  interface{}
+	result interface{}
+}
+
+type mockQueryService struct {
+	calls []methodCall
+}
+
+func (svc *mockQueryService) processLedgerCategoriesQuery(ctx context.Context, query *ledgerCategoriesQuery) ([]categoryDTO, error) {
+	result := []categoryDTO{
+		categoryDTO{CategoryID: rnd.Intn(1000), Name: fake.Word(), DisplayOrder: 0, AccountIDs: []string{uuid.NewV4().String()}},
+		categoryDTO{CategoryID: rnd.Intn(1000), Name: fake.Word(), DisplayOrder: 1, AccountIDs: []string{}},
+	}
+	svc.calls = append(svc.calls, methodCall{input: query, result: result})
+	return result, nil
+}
+
+type mockCommandService struct {
+	calls []methodCall
+	err   error
+}
+
+func (svc *mockCommandService) processCreateCategoryCommand(ctx context.Context, cmd *createCategoryCommand) (int, error) {
+	categoryID := 1 + rnd.Intn(1000)
+	svc.calls = append(svc.calls, methodCall{input: cmd, result: categoryID})
+	return categoryID, svc.err
+}
+
+func (svc *mockCommandService) processRenameCategoryCommand(ctx context.Context, cmd *renameCategoryCommand) error {
+	svc.calls = append(svc.calls, methodCall{input: cmd})
+	return svc.err
+}
+
+func (svc *mockCommandService) processReorderCategoriesCommand(ctx context.Context, cmd *reorderCategoriesCommand) error {
+	svc.calls = append(svc.calls, methodCall{input: cmd})
+	return svc.err
+}
+
+func (svc *mockCommandService) processMoveAccountCommand(ctx context.Context, cmd *moveAccountCommand) error {
+	svc.calls = append(svc.calls, methodCall{input: cmd})
+	return svc.err
+}
+
+type mockLedgerAccessChecker struct {
+	accessibleLedgers map[string]bool
+}
+
+func (checker *mockLedgerAccessChecker) HasLedgerAccess(ctx context.Context, user *users.User, ledgerID string) (bool, error) {
+	return checker.accessibleLedgers[ledgerID], nil
+}
+
+func TestAccountCategoriesRoutes(t *testing.T) {
+	Convey("Given account categories routes", t, func() {
+		ledgerID := uuid.NewV4().String()
+		checker := mockLedgerAccessChecker{accessibleLedgers: map[string]bool{ledgerID: true}}
+		querySvc := &mockQueryService{}
+		cmdSvc := &mockCommandService{}
+		router := server.
+			CreateHTTPApp(server.HTTPAppConfig{Env: "test"}).
+			RegisterRoutes(CreateRoutes(querySvc, &checker)).
+			RegisterRoutes(CreateCommandRoutes(cmdSvc, &checker))
+		recorder := httptest.NewRecorder()
+		user := ldtesting.NewUser()
+		path := fmt.Sprintf("/v2/ledgers/%v/account-categories", ledgerID)
+		newRequest := func(method string, path string, payload interface{}, scope string) *http.Request {
+			body := bytes.NewBuffer(nil)
+			if payload != nil {
+				if err := jsonapi.MarshalPayload(body, payload); err != nil {
+					panic(err)
+				}
+			}
+			req := ldtesting.NewRequest(method, path, ldtesting.WithScopeClaim(scope), ldtesting.WithUser(user))
+			req.Body = ioutil.NopCloser(body)
+			return req
+		}
+
+		Convey("When route is GET ledger categories", func() {
+			Convey("It should process query and return categories", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("GET", path, nil, "read:account-categories"))
+				So(recorder.Code, ShouldEqual, 200)
+				So(querySvc.calls, ShouldHaveLength, 1)
+				So(querySvc.calls[0].input, ShouldResemble, &ledgerCategoriesQuery{ledgerID: ledgerID, user: user})
+				expectedMessage, _ := json.Marshal(querySvc.calls[0].result)
+				So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+			})
+
+			Convey("It should reject with 403 if no read scope", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("GET", path, nil, "read:accounts"))
+				So(recorder.Code, ShouldEqual, 403)
+				So(querySvc.calls, ShouldBeEmpty)
+			})
+
+			Convey("It should reject with 404 if ledger is not accessible", func() {
+				otherPath := fmt.Sprintf("/v2/ledgers/%v/account-categories", uuid.NewV4().String())
+				router.CreateHandler().ServeHTTP(recorder, newRequest("GET", otherPath, nil, "read:account-categories"))
+				So(recorder.Code, ShouldEqual, 404)
+				So(querySvc.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When route is create category", func() {
+			payload := categoryPayload{Name: fake.Word()}
+
+			Convey("It should process command and respond with category id", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &payload, "write:account-categories"))
+				So(recorder.Code, ShouldEqual, 202)
+				So(cmdSvc.calls, ShouldHaveLength, 1)
+				So(cmdSvc.calls[0].input, ShouldResemble, &createCategoryCommand{
+					ledgerID: ledgerID,
+					user:     user,
+					name:     payload.Name,
+				})
+				expectedMessage, _ := json.Marshal(server.JSON{"categoryID": cmdSvc.calls[0].result})
+				So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+			})
+
+			Convey("It should respond with 400 if name is missing", func() {
+				payload.Name = ""
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &payload, "write:account-categories"))
+				So(recorder.Code, ShouldEqual, 400)
+				So(cmdSvc.calls, ShouldBeEmpty)
+			})
+
+			Convey("It should respond with 409 if name is taken", func() {
+				cmdSvc.err = errCategoryNameTaken
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &payload, "write:account-categories"))
+				So(recorder.Code, ShouldEqual, 409)
+			})
+
+			Convey("It should reject with 403 if no write scope", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &payload, "read:account-categories"))
+				So(recorder.Code, ShouldEqual, 403)
+				So(cmdSvc.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When route is rename category", func() {
+			categoryID := 1 + rnd.Intn(1000)
+			categoryPath := fmt.Sprintf("%v/%v", path, categoryID)
+			payload := categoryPayload{ID: categoryID, Name: fake.Word()}
+
+			Convey("It should process command", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("PATCH", categoryPath, &payload, "write:account-categories"))
+				So(recorder.Code, ShouldEqual, 202)
+				So(cmdSvc.calls, ShouldHaveLength, 1)
+				So(cmdSvc.calls[0].input, ShouldResemble, &renameCategoryCommand{
+					ledgerID:   ledgerID,
+					categoryID: categoryID,
+					user:       user,
+					name:       payload.Name,
+				})
+			})
+
+			Convey("It should respond with 400 if payload id is different", func() {
+				payload.ID = categoryID + 1
+				router.CreateHandler().ServeHTTP(recorder, newRequest("PATCH", categoryPath, &payload, "write:account-categories"))
+				So(recorder.Code, ShouldEqual, 400)
+				So(cmdSvc.calls, ShouldBeEmpty)
+			})
+
+			Convey("It should respond with 404 if category id is not a number", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("PATCH", path+"/"+fake.Word(), &payload, "write:account-categories"))
+				So(recorder.Code, ShouldEqual, 404)
+				So(cmdSvc.calls, ShouldBeEmpty)
+			})
+
+			Convey("It should respond with 404 if category is not found", func() {
+				cmdSvc.err = errCategoryNotFound
+				router.CreateHandler().ServeHTTP(recorder, newRequest("PATCH", categoryPath, &payload, "write:account-categories"))
+				So(recorder.Code, ShouldEqual, 404)
+			})
+		})
+
+		Convey("When route is reorder categories", func() {
+			categoryIDs := []int{1 + rnd.Intn(1000), 1001 + rnd.Intn(1000), 2001 + rnd.Intn(1000)}
+			payload := categoriesOrderPayload{Categories: []*categoryRef{
+				{ID: categoryIDs[0]}, {ID: categoryIDs[1]}, {ID: categoryIDs[2]},
+			}}
+
+			Convey("It should process command", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("PUT", path, &payload, "write:account-categories"))
+				So(recorder.Code, ShouldEqual, 202)
+				So(cmdSvc.calls, ShouldHaveLength, 1)
+				So(cmdSvc.calls[0].input, ShouldResemble, &reorderCategoriesCommand{
+					ledgerID:    ledgerID,
+					user:        user,
+					categoryIDs: categoryIDs,
+				})
+			})
+
+			Convey("It should respond with 400 if order is incomplete", func() {
+				cmdSvc.err = errIncompleteOrder
+				router.CreateHandler().ServeHTTP(recorder, newRequest("PUT", path, &payload, "write:account-categories"))
+				So(recorder.Code, ShouldEqual, 400)
+			})
+		})
+
+		Convey("When route is move account", func() {
+			categoryID := 1 + rnd.Intn(1000)
+			accountsPath := fmt.Sprintf("%v/%v/accounts", path, categoryID)
+			payload := accountRef{ID: uuid.NewV4().String()}
+
+			Convey("It should process command", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", accountsPath, &payload, "write:account-categories"))
+				So(recorder.Code, ShouldEqual, 202)
+				So(cmdSvc.calls, ShouldHaveLength, 1)
+				So(cmdSvc.calls[0].input, ShouldResemble, &moveAccountCommand{
+					ledgerID:   ledgerID,
+					categoryID: categoryID,
+					accountID:  payload.ID,
+					user:       user,
+				})
+			})
+
+			Convey("It should respond with 400 if account is not found", func() {
+				cmdSvc.err = errAccountNotFound
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", accountsPath, &payload, "write:account-categories"))
+				So(recorder.Code, ShouldEqual, 400)
+			})
+		})
+	})
+}
@@ -0,0 +1,187 @@
+package accounts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/rates"
+	"ledger.api/pkg/tracing"
+	"ledger.api/pkg/users"
+)
+
+// ErrAccountNotFound - account does not exist or is not accessible by the user
+var ErrAccountNotFound = errors.New("Account not found")
+
+// errLedgerNotFound - ledger of the query does not exist
+var errLedgerNotFound = errors.New("Ledger not found")
+
+type accountDTO struct {
+	AccountID        string `json:"accountID" gorm:"column:aggregate_id"`
+	LedgerID         string `json:"ledgerID"`
+	SequentialNumber int    `json:"sequentialNumber"`
+	Name             string `json:"name"`
+	CurrencyCode     string `json:"currencyCode"`
+	Balance          int    `json:"balance"`
+	IsClosed         bool   `json:"isClosed"`
+}
+
+type currencyTotalDTO struct {
+	CurrencyCode string `json:"currencyCode"`
+	Balance      int    `json:"balance"`
+}
+
+type ledgerAccountsDTO struct {
+	Accounts []accountDTO       `json:"accounts"`
+	Totals   []currencyTotalDTO `json:"totals"`
+
+	// ConvertedTotal is a sum of all balances converted to requested or ledger currency
+	ConvertedTotal *currencyTotalDTO `json:"convertedTotal,omitempty"`
+}
+
+type ledgerAccountsQuery struct {
+	ledgerID      string
+	user          *users.User
+	includeClosed bool
+
+	// currency totals should be converted to. Ledger currency is used if empty
+	currency string
+}
+
+type accountQuery struct {
+	user      *users.User
+	accountID string
+}
+
+// QueryService is a service to do various queries against accounts
+type QueryService interface {
+	processLedgerAccountsQuery(ctx context.Context, query *ledgerAccountsQuery) (*ledgerAccountsDTO, error)
+	processAccountQuery(ctx context.Context, query *accountQuery) (*accountDTO, error)
+}
+
+type dbQueryService struct {
+	db           *gorm.DB
+	rateProvider rates.RateProvider
+}
+
+// calculateTotals sums balances of given accounts per currency
+// keeping currencies in order of their first appearance
+func calculateTotals(accounts []accountDTO) []currencyTotalDTO {
+	totals := []currencyTotalDTO{}
+	indexByCurrency := make(map[string]int)
+	for _, acc := range accounts {
+		index, ok := indexByCurrency[acc.CurrencyCode]
+		if !ok {
+			index = len(totals)
+			indexByCurrency[acc.CurrencyCode] = index
+			totals = append(totals, currencyTotalDTO{CurrencyCode: acc.CurrencyCode})
+		}
+		totals[index].Balance += acc.Balance
+	}
+	return totals
+}
+
+// convertTotals sums given totals converting them to given currency using current rates
+func convertTotals(ctx context.Context, converter *rates.Converter, totals []currencyTotalDTO, currency string) (*currencyTotalDTO, error) {
+	now := time.Now()
+	result := currencyTotalDTO{CurrencyCode: currency}
+	for _, total := range totals {
+		balance, err := converter.Convert(ctx, total.Balance, total.CurrencyCode, currency, now)
+		if err != nil {
+			return nil, err
+		}
+		result.Balance += balance
+	}
+	return &result, nil
+}
+
+// targetCurrency returns currency of the query or ledger currency if not provided
+func (svc *dbQueryService) targetCurrency(ctx context.Context, query *ledgerAccountsQuery) (string, error) {
+	if query.currency != "" {
+		return query.currency, nil
+	}
+	var currencyCode string
+	err := tracing.DB(ctx, svc.db).Table("projections_ledgers").
+		Select("currency_code").
+		Where("aggregate_id = ?", query.ledgerID).
+		Row().Scan(&currencyCode)
+	if err == sql.ErrNoRows {
+		return "", errLedgerNotFound
+	}
+	return currencyCode, err
+}
+
+func (svc *dbQueryService) processLedgerAccountsQuery(ctx context.Context, query *ledgerAccountsQuery) (*ledgerAccountsDTO, error) {
+	if query.ledgerID == "" {
+		return nil, errors.New("Please provide ledgerID")
+	}
+	if query.user == nil {
+		return nil, errors.New("Please provide user")
+	}
+	logger := logging.FromContext(ctx)
+	logger.Debugf(
+		"Processing ledger accounts query. LedgerID: %v, includeClosed: %v, currency: %v",
+		query.ledgerID, query.includeClosed, query.currency,
+	)
+
+	stmt := tracing.DB(ctx, svc.db).Table("projections_accounts acc").
+		Select("acc.aggregate_id, acc.ledger_id, acc.sequential_number, acc.name, acc.currency_code, acc.balance, acc.is_closed").
+		Where("acc.ledger_id = ?", query.ledgerID)
+	stmt = users.WithAccessibleAccounts(stmt, query.user)
+	if !query.includeClosed {
+		stmt = stmt.Where("acc.is_closed = ?", false)
+	}
+
+	accounts := []accountDTO{}
+	if err := stmt.Order("acc.sequential_number").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	result := ledgerAccountsDTO{
+		Accounts: accounts,
+		Totals:   calculateTotals(accounts),
+	}
+	currency, err := svc.targetCurrency(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if currency != "" {
+		convertedTotal, err := convertTotals(ctx, rates.NewConverter(svc.rateProvider), result.Totals, currency)
+		if err != nil {
+			return nil, err
+		}
+		result.ConvertedTotal = convertedTotal
+	}
+	return &result, nil
+}
+
+func (svc *dbQueryService) processAccountQuery(ctx context.Context, query *accountQuery) (*accountDTO, error) {
+	if query.user == nil {
+		return nil, errors.New("Please provide user")
+	}
+	if query.accountID == "" {
+		return nil, errors.New("Please provide accountID")
+	}
+	logger := logging.FromContext(ctx)
+	logger.Debugf("Processing account query. AccountID: %v, UserID: %v", query.accountID, query.user.ID)
+
+	accounts := []accountDTO{}
+	stmt := tracing.DB(ctx, svc.db).Table("projections_accounts acc").
+		Select("acc.aggregate_id, acc.ledger_id, acc.sequential_number, acc.name, acc.currency_code, acc.balance, acc.is_closed").
+		Where("acc.aggregate_id = ?", query.accountID)
+	if err := users.WithAccessibleAccounts(stmt, query.user).Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, ErrAccountNotFound
+	}
+	return &accounts[0], nil
+}
+
+// CreateQueryService initializes a new instance of the query service
+func CreateQueryService(db *gorm.DB, rateProvider rates.RateProvider) QueryService {
+	svc := dbQueryService{db: db, rateProvider: rateProvider}
+	return &svc
+}
@@ -0,0 +1,214 @@
+package accounts
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/rates"
+)
+
+var testRates = rates.CreateStaticRateProvider([]rates.Rate{
+	rates.Rate{From: "USD", To: "UAH", Date: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), Rate: 27.5},
+})
+
+func toAccountDTO(acc *ldtesting.Account) accountDTO {
+	return accountDTO{
+		AccountID:        acc.AccountID,
+		LedgerID:         acc.LedgerID,
+		SequentialNumber: acc.SequentialNumber,
+		Name:             acc.Name,
+		CurrencyCode:     acc.CurrencyCode,
+		Balance:          acc.Balance,
+		IsClosed:         acc.IsClosed,
+	}
+}
+
+func TestCalculateTotals(t *testing.T) {
+	Convey("Given accounts in various currencies", t, func() {
+		accounts := []accountDTO{
+			accountDTO{CurrencyCode: "UAH", Balance: 100},
+			accountDTO{CurrencyCode: "USD", Balance: 20},
+			accountDTO{CurrencyCode: "UAH", Balance: -30},
+			accountDTO{CurrencyCode: "EUR", Balance: 5},
+			accountDTO{CurrencyCode: "USD", Balance: 1},
+		}
+
+		Convey("It should sum balances per currency", func() {
+			So(calculateTotals(accounts), ShouldResemble, []currencyTotalDTO{
+				currencyTotalDTO{CurrencyCode: "UAH", Balance: 70},
+				currencyTotalDTO{CurrencyCode: "USD", Balance: 21},
+				currencyTotalDTO{CurrencyCode: "EUR", Balance: 5},
+			})
+		})
+
+		Convey("It should return empty totals if no accounts", func() {
+			So(calculateTotals([]accountDTO{}), ShouldResemble, []currencyTotalDTO{})
+		})
+	})
+}
+
+func TestConvertTotals(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given totals in various currencies", t, func() {
+		totals := []currencyTotalDTO{
+			currencyTotalDTO{CurrencyCode: "UAH", Balance: 1000},
+			currencyTotalDTO{CurrencyCode: "USD", Balance: 20},
+		}
+
+		Convey("It should sum totals converted to given currency", func() {
+			result, err := convertTotals(ctx, rates.NewConverter(testRates), totals, "UAH")
+			So(err, ShouldBeNil)
+			So(*result, ShouldResemble, currencyTotalDTO{CurrencyCode: "UAH", Balance: 1550})
+		})
+
+		Convey("It should fail if there is no exchange rate", func() {
+			_, err := convertTotals(ctx, rates.NewConverter(testRates), totals, "EUR")
+			So(err, ShouldEqual, rates.ErrRateNotFound)
+		})
+	})
+}
+
+func TestLedgerAccountsQuery(t *testing.T) {
+	Convey("Given ledger accounts query", t, func() {
+		ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+		svc := CreateQueryService(DB, testRates)
+		ledgerID := uuid.NewV4().String()
+		So(DB.Exec(`
+			INSERT INTO projections_ledgers(aggregate_id, owner_user_id, name, currency_code, authorized_user_ids)
+			VALUES(?, 0, ?, 'UAH', '')
+			`, ledgerID, "Ledger "+ledgerID).Error, ShouldBeNil)
+		user := ldtesting.NewUser()
+		authorized := ldtesting.AccAuthorizedUsers(user)
+		uah1, err := ldtesting.SetupAccount(DB, ledgerID, ldtesting.AccCurrency("UAH"), authorized)
+		So(err, ShouldBeNil)
+		usd, err := ldtesting.SetupAccount(DB, ledgerID, ldtesting.AccCurrency("USD"), authorized)
+		So(err, ShouldBeNil)
+		uah2, err := ldtesting.SetupAccount(DB, ledgerID, ldtesting.AccCurrency("UAH"), authorized)
+		So(err, ShouldBeNil)
+		closed, err := ldtesting.SetupAccount(DB, ledgerID, ldtesting.AccCurrency("UAH"), ldtesting.AccClosed, authorized)
+		So(err, ShouldBeNil)
+		_, err = ldtesting.SetupAccount(DB, uuid.NewV4().String(), authorized)
+		So(err, ShouldBeNil)
+		otherUser := ldtesting.NewUser()
+		for otherUser.ID == user.ID {
+			otherUser = ldtesting.NewUser()
+		}
+		hidden, err := ldtesting.SetupAccount(DB, ledgerID, ldtesting.AccAuthorizedUsers(otherUser))
+		So(err, ShouldBeNil)
+
+		Convey("When closed accounts are excluded", func() {
+			result, err := svc.processLedgerAccountsQuery(ctx, &ledgerAccountsQuery{ledgerID: ledgerID, user: user})
+			So(err, ShouldBeNil)
+
+			Convey("It should return open accounts of the ledger", func() {
+				So(result.Accounts, ShouldHaveLength, 3)
+				So(result.Accounts, ShouldContain, toAccountDTO(uah1))
+				So(result.Accounts, ShouldContain, toAccountDTO(uah2))
+				So(result.Accounts, ShouldContain, toAccountDTO(usd))
+			})
+
+			Convey("It should not return accounts the user is not authorized on", func() {
+				So(result.Accounts, ShouldNotContain, toAccountDTO(hidden))
+			})
+
+			Convey("It should order accounts by sequential number", func() {
+				for i := 1; i < len(result.Accounts); i++ {
+					So(result.Accounts[i].SequentialNumber, ShouldBeGreaterThanOrEqualTo, result.Accounts[i-1].SequentialNumber)
+				}
+			})
+
+			Convey("It should calculate totals per currency", func() {
+				So(result.Totals, ShouldHaveLength, 2)
+				So(result.Totals, ShouldContain, currencyTotalDTO{CurrencyCode: "UAH", Balance: uah1.Balance + uah2.Balance})
+				So(result.Totals, ShouldContain, currencyTotalDTO{CurrencyCode: "USD", Balance: usd.Balance})
+			})
+
+			Convey("It should convert totals to ledger currency if currency is not requested", func() {
+				So(result.ConvertedTotal, ShouldNotBeNil)
+				So(*result.ConvertedTotal, ShouldResemble, currencyTotalDTO{
+					CurrencyCode: "UAH",
+					Balance:      uah1.Balance + uah2.Balance + int(math.Round(float64(usd.Balance)*27.5)),
+				})
+			})
+		})
+
+		Convey("When currency is requested", func() {
+			result, err := svc.processLedgerAccountsQuery(ctx, &ledgerAccountsQuery{ledgerID: ledgerID, user: user, currency: "UAH"})
+			So(err, ShouldBeNil)
+
+			Convey("It should convert totals to given currency", func() {
+				So(result.ConvertedTotal, ShouldNotBeNil)
+				So(*result.ConvertedTotal, ShouldResemble, currencyTotalDTO{
+					CurrencyCode: "UAH",
+					Balance:      uah1.Balance + uah2.Balance + int(math.Round(float64(usd.Balance)*27.5)),
+				})
+			})
+		})
+
+		Convey("It should fail if ledger does not exist", func() {
+			_, err := svc.processLedgerAccountsQuery(ctx, &ledgerAccountsQuery{ledgerID: uuid.NewV4().String(), user: user})
+			So(err, ShouldEqual, errLedgerNotFound)
+		})
+
+		Convey("When closed accounts are included", func() {
+			result, err := svc.processLedgerAccountsQuery(ctx, &ledgerAccountsQuery{ledgerID: ledgerID, user: user, includeClosed: true})
+			So(err, ShouldBeNil)
+
+			Convey("It should return all accounts of the ledger", func() {
+				So(result.Accounts, ShouldHaveLength, 4)
+				So(result.Accounts, ShouldContain, toAccountDTO(closed))
+			})
+
+			Convey("It should include closed accounts into totals", func() {
+				So(result.Totals, ShouldContain, currencyTotalDTO{
+					CurrencyCode: "UAH",
+					Balance:      uah1.Balance + uah2.Balance + closed.Balance,
+				})
+			})
+		})
+	})
+}
+
+func TestAccountQuery(t *testing.T) {
+	Convey("Given account query", t, func() {
+		ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+		svc := CreateQueryService(DB, testRates)
+		user := ldtesting.NewUser()
+		acc, err := ldtesting.SetupAccount(DB, uuid.NewV4().String(), ldtesting.AccAuthorizedUsers(user))
+		So(err, ShouldBeNil)
+
+		Convey("When user is authorized on the account", func() {
+			Convey("It should return the account", func() {
+				result, err := svc.processAccountQuery(ctx, &accountQuery{user: user, accountID: acc.AccountID})
+				So(err, ShouldBeNil)
+				So(*result, ShouldResemble, toAccountDTO(acc))
+			})
+		})
+
+		Convey("When user is not authorized on the account", func() {
+			otherUser := ldtesting.NewUser()
+			for otherUser.ID == user.ID {
+				otherUser = ldtesting.NewUser()
+			}
+
+			Convey("It should return not found error", func() {
+				_, err := svc.processAccountQuery(ctx, &accountQuery{user: otherUser, accountID: acc.AccountID})
+				So(err, ShouldEqual, ErrAccountNotFound)
+			})
+		})
+
+		Convey("When account does not exist", func() {
+			Convey("It should return not found error", func() {
+				_, err := svc.processAccountQuery(ctx, &accountQuery{user: user, accountID: uuid.NewV4().String()})
+				So(err, ShouldEqual, ErrAccountNotFound)
+			})
+		})
+	})
+}
@@ -0,0 +1,81 @@
+package accounts
+
+import (
+	"net/http"
+	"strconv"
+
+	"ledger.api/pkg/rates"
+	"ledger.api/pkg/server"
+	"ledger.api/pkg/users"
+)
+
+// CreateRoutes - Register accounts related routes
+func CreateRoutes(svc QueryService, ledgerAccess server.LedgerAccessChecker) server.Routes {
+	return func(router *server.Router) {
+		// includeClosed=:includeClosed&currency=:currency
+		router.
+			Group(
+				"/v2/ledgers/:ledgerID/accounts",
+				server.WithScopes("read:accounts"),
+				server.WithMiddleware(server.CreateLedgerAccessMiddlewareFunc(ledgerAccess)),
+			).
+			GET("", createLedgerAccountsQueryHandler(svc))
+		router.
+			Group("/v2/accounts", server.WithScopes("read:accounts")).
+			GET("/:accountID", createAccountQueryHandler(svc))
+	}
+}
+
+func createLedgerAccountsQueryHandler(svc QueryService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		query := ledgerAccountsQuery{
+			ledgerID: h.Params.ByName("ledgerID"),
+			user:     users.FromContext(req.Context()),
+		}
+		if includeClosed := req.URL.Query().Get("includeClosed"); includeClosed != "" {
+			val, err := strconv.ParseBool(includeClosed)
+			if err != nil {
+				return nil, *server.BadRequestError("Parameter 'includeClosed' should be a boolean")
+			}
+			query.includeClosed = val
+		}
+		if currency := req.URL.Query().Get("currency"); currency != "" {
+			if !rates.IsCurrencyCode(currency) {
+				return nil, *server.BadRequestError("Parameter 'currency' should be ISO 4217 currency code")
+			}
+			query.currency = currency
+		}
+		result, err := svc.processLedgerAccountsQuery(req.Context(), &query)
+		if err == errLedgerNotFound {
+			return nil, *server.NotFoundError()
+		}
+		if err == rates.ErrRateNotFound {
+			return nil, *server.UnprocessableEntityError(err.Error())
+		}
+		if err != nil {
+			return nil, err
+		}
+		return h.Response(result), nil
+	}
+}
+
+func createAccountQueryHandler(svc QueryService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		user := users.FromContext(req.Context())
+		if user == nil {
+			h.Logger.Info("Request has not been initialized with user, responding with 404")
+			return nil, *server.NotFoundError()
+		}
+		result, err := svc.processAccountQuery(req.Context(), &accountQuery{
+			user:      user,
+			accountID: h.Params.ByName("accountID"),
+		})
+		if err == ErrAccountNotFound {
+			return nil, *server.NotFoundError()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return h.Response(result), nil
+	}
+}
@@ -0,0 +1,225 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/icrowley/fake"
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/rates"
+	"ledger.api/pkg/server"
+	"ledger.api/pkg/users"
+)
+
+var rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+type methodCall struct {
+	input  interface{}
+	result interface{}
+}
+
+type ctxKey string
+
+const errorFnKey ctxKey = "error-fn"
+
+type mockQueryService struct {
+	processLedgerAccountsQueryCalls []methodCall
+	processAccountQueryCalls        []methodCall
+}
+
+func (svc *mockQueryService) processLedgerAccountsQuery(ctx context.Context, query *ledgerAccountsQuery) (*ledgerAccountsDTO, error) {
+	accounts := []accountDTO{
+		accountDTO{AccountID: uuid.NewV4().String(), Name: fake.Word(), CurrencyCode: "UAH", Balance: rnd.Intn(10000)},
+		accountDTO{AccountID: uuid.NewV4().String(), Name: fake.Word(), CurrencyCode: "USD", Balance: rnd.Intn(10000)},
+	}
+	result := &ledgerAccountsDTO{Accounts: accounts, Totals: calculateTotals(accounts)}
+	svc.processLedgerAccountsQueryCalls = append(svc.processLedgerAccountsQueryCalls, methodCall{
+		input:  []interface{}{query},
+		result: result,
+	})
+	failHandler := ctx.Value(errorFnKey)
+	if failHandler != nil {
+		return nil, failHandler.(func() error)()
+	}
+	return result, nil
+}
+
+func (svc *mockQueryService) processAccountQuery(ctx context.Context, query *accountQuery) (*accountDTO, error) {
+	result := &accountDTO{AccountID: query.accountID, Name: fake.Word(), CurrencyCode: "UAH", Balance: rnd.Intn(10000)}
+	svc.processAccountQueryCalls = append(svc.processAccountQueryCalls, methodCall{
+		input:  []interface{}{query},
+		result: result,
+	})
+	failHandler := ctx.Value(errorFnKey)
+	if failHandler != nil {
+		return nil, failHandler.(func() error)()
+	}
+	return result, nil
+}
+
+type mockLedgerAccessChecker struct {
+	accessibleLedgers map[string]bool
+}
+
+func (checker *mockLedgerAccessChecker) HasLedgerAccess(ctx context.Context, user *users.User, ledgerID string) (bool, error) {
+	return checker.accessibleLedgers[ledgerID], nil
+}
+
+func setupRouter(accessibleLedgerIDs ...string) (*mockQueryService, *server.HTTPApp) {
+	svc := mockQueryService{
+		processLedgerAccountsQueryCalls: []methodCall{},
+		processAccountQueryCalls:        []methodCall{},
+	}
+	checker := mockLedgerAccessChecker{accessibleLedgers: make(map[string]bool)}
+	for _, ledgerID := range accessibleLedgerIDs {
+		checker.accessibleLedgers[ledgerID] = true
+	}
+	return &svc, server.
+		CreateHTTPApp(server.HTTPAppConfig{Env: "test"}).
+		RegisterRoutes(CreateRoutes(&svc, &checker))
+}
+
+func TestAccountsRoutes(t *testing.T) {
+	Convey("Given accounts routes", t, func() {
+		ledgerID := uuid.NewV4().String()
+		svc, router := setupRouter(ledgerID)
+		recorder := httptest.NewRecorder()
+		user := ldtesting.NewUser()
+
+		Convey("When route is GET ledger accounts", func() {
+			path := fmt.Sprintf("/v2/ledgers/%v/accounts", ledgerID)
+
+			Convey("It should process query and return accounts with totals", func() {
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("read:accounts"), ldtesting.WithUser(user))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 200)
+				So(svc.processLedgerAccountsQueryCalls, ShouldHaveLength, 1)
+				queryCall := svc.processLedgerAccountsQueryCalls[0]
+				actualQuery := queryCall.input.([]interface{})[0].(*ledgerAccountsQuery)
+				So(actualQuery, ShouldResemble, &ledgerAccountsQuery{ledgerID: ledgerID, user: user})
+
+				expectedMessage, _ := json.Marshal(queryCall.result)
+				So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+			})
+
+			Convey("It should include closed accounts if requested", func() {
+				req := ldtesting.NewRequest("GET", path+"?includeClosed=true", ldtesting.WithScopeClaim("read:accounts"), ldtesting.WithUser(user))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 200)
+				actualQuery := svc.processLedgerAccountsQueryCalls[0].input.([]interface{})[0].(*ledgerAccountsQuery)
+				So(actualQuery.includeClosed, ShouldBeTrue)
+			})
+
+			Convey("It should respond with 400 if includeClosed is not a boolean", func() {
+				req := ldtesting.NewRequest("GET", path+"?includeClosed="+fake.Word(), ldtesting.WithScopeClaim("read:accounts"), ldtesting.WithUser(user))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 400)
+				So(svc.processLedgerAccountsQueryCalls, ShouldHaveLength, 0)
+			})
+
+			Convey("It should use currency param", func() {
+				req := ldtesting.NewRequest("GET", path+"?currency=USD", ldtesting.WithScopeClaim("read:accounts"), ldtesting.WithUser(user))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 200)
+				actualQuery := svc.processLedgerAccountsQueryCalls[0].input.([]interface{})[0].(*ledgerAccountsQuery)
+				So(actualQuery.currency, ShouldEqual, "USD")
+			})
+
+			Convey("It should respond with 400 if currency is malformed", func() {
+				req := ldtesting.NewRequest("GET", path+"?currency=dollar", ldtesting.WithScopeClaim("read:accounts"), ldtesting.WithUser(user))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 400)
+				So(svc.processLedgerAccountsQueryCalls, ShouldHaveLength, 0)
+			})
+
+			Convey("It should respond with 422 if exchange rate is not found", func() {
+				req := ldtesting.NewRequest("GET", path+"?currency=EUR", ldtesting.WithScopeClaim("read:accounts"), ldtesting.WithUser(user))
+				failCtx := context.WithValue(req.Context(), errorFnKey, func() error {
+					return rates.ErrRateNotFound
+				})
+				router.CreateHandler().ServeHTTP(recorder, req.WithContext(failCtx))
+				So(recorder.Code, ShouldEqual, 422)
+			})
+
+			Convey("It should respond with 404 if ledger is not found", func() {
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("read:accounts"), ldtesting.WithUser(user))
+				failCtx := context.WithValue(req.Context(), errorFnKey, func() error {
+					return errLedgerNotFound
+				})
+				router.CreateHandler().ServeHTTP(recorder, req.WithContext(failCtx))
+				So(recorder.Code, ShouldEqual, 404)
+			})
+
+			Convey("It should respond with error if query fails", func() {
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("read:accounts"), ldtesting.WithUser(user))
+				failCtx := context.WithValue(req.Context(), errorFnKey, func() error {
+					return errors.New(fake.Sentence())
+				})
+				router.CreateHandler().ServeHTTP(recorder, req.WithContext(failCtx))
+				So(recorder.Code, ShouldEqual, 500)
+			})
+
+			Convey("It should reject with 404 if ledger is not accessible", func() {
+				otherPath := fmt.Sprintf("/v2/ledgers/%v/accounts", uuid.NewV4().String())
+				req := ldtesting.NewRequest("GET", otherPath, ldtesting.WithScopeClaim("read:accounts"), ldtesting.WithUser(user))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 404)
+				So(svc.processLedgerAccountsQueryCalls, ShouldHaveLength, 0)
+			})
+
+			Convey("It should reject with 403 if scope is missing", func() {
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("read:ledgers"), ldtesting.WithUser(user))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 403)
+			})
+		})
+
+		Convey("When route is GET account", func() {
+			accountID := uuid.NewV4().String()
+			path := fmt.Sprintf("/v2/accounts/%v", accountID)
+
+			Convey("It should process query and return the account", func() {
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("read:accounts"), ldtesting.WithUser(user))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 200)
+				So(svc.processAccountQueryCalls, ShouldHaveLength, 1)
+				queryCall := svc.processAccountQueryCalls[0]
+				actualQuery := queryCall.input.([]interface{})[0].(*accountQuery)
+				So(actualQuery, ShouldResemble, &accountQuery{user: user, accountID: accountID})
+
+				expectedMessage, _ := json.Marshal(queryCall.result)
+				So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+			})
+
+			Convey("It should respond with 404 if account is not found", func() {
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("read:accounts"), ldtesting.WithUser(user))
+				failCtx := context.WithValue(req.Context(), errorFnKey, func() error {
+					return ErrAccountNotFound
+				})
+				router.CreateHandler().ServeHTTP(recorder, req.WithContext(failCtx))
+				So(recorder.Code, ShouldEqual, 404)
+			})
+
+			Convey("It should respond with 404 if user is not resolved", func() {
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("read:accounts"))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 404)
+				So(svc.processAccountQueryCalls, ShouldHaveLength, 0)
+			})
+
+			Convey("It should reject with 403 if scope is missing", func() {
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("none"), ldtesting.WithUser(user))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 403)
+			})
+		})
+	})
+}
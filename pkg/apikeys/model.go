@@ -0,0 +1,277 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
+)
+
+var (
+	errKeyNotFound     = errors.New("API key not found")
+	errInvalidKey      = errors.New("API key is invalid, expired or revoked")
+	errNoScopes        = errors.New("Please provide at least one scope")
+	errUnknownScope    = errors.New("Scope can not be granted to API keys")
+	errScopeNotGranted = errors.New("Scope is not granted to the caller")
+	errExpired         = errors.New("Expiry should be in future")
+)
+
+// Scopes is a list of scopes that can be granted to API keys.
+// These are the scopes routes are protected with
+var Scopes = []string{
+	"read:ledgers", "write:ledgers",
+	"read:accounts", "write:accounts",
+	"read:account-categories", "write:account-categories",
+	"read:tags", "write:tags",
+	"read:transactions", "write:transactions",
+}
+
+// keyPrefix is a prefix of all keys so they are easy to recognize, e.g in leaked secrets scans
+const keyPrefix = "ldk_"
+
+// lastUsedResolution is a min interval between last used timestamp updates
+// so busy keys do not cause a write per request
+const lastUsedResolution = time.Minute
+
+type keyDTO struct {
+	KeyID      string     `json:"keyID"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+// createdKeyDTO includes the key itself that is not stored so can't be queried later
+type createdKeyDTO struct {
+	keyDTO
+	Key string `json:"key"`
+}
+
+// keyRecord is a row of api_keys table
+type keyRecord struct {
+	KeyID      string
+	Subject    string
+	Name       string
+	KeyPrefix  string
+	KeyHash    string
+	Scopes     string
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (record *keyRecord) toDTO() keyDTO {
+	return keyDTO{
+		KeyID:      record.KeyID,
+		Name:       record.Name,
+		Prefix:     record.KeyPrefix,
+		Scopes:     strings.Fields(record.Scopes),
+		CreatedAt:  record.CreatedAt,
+		ExpiresAt:  record.ExpiresAt,
+		LastUsedAt: record.LastUsedAt,
+		RevokedAt:  record.RevokedAt,
+	}
+}
+
+// keyPayload is a JSON API representation of the key submitted by clients to create keys
+type keyPayload struct {
+	ID        string     `jsonapi:"primary,api-keys"`
+	Name      string     `jsonapi:"attr,name" validate:"required,max=255"`
+	Scopes    []string   `jsonapi:"attr,scopes"`
+	ExpiresAt *time.Time `jsonapi:"attr,expiresAt,iso8601"`
+}
+
+type userKeysQuery struct {
+	subject string
+}
+
+type createKeyCommand struct {
+	subject string
+
+	// grantedScopes are scopes of the caller. Keys can't have more scopes than the caller
+	grantedScopes []string
+	name          string
+	scopes        []string
+	expiresAt     *time.Time
+}
+
+type revokeKeyCommand struct {
+	subject string
+	keyID   string
+}
+
+// Service is a service to manage and authenticate API keys
+type Service interface {
+	processUserKeysQuery(ctx context.Context, query *userKeysQuery) ([]keyDTO, error)
+	processCreateKeyCommand(ctx context.Context, cmd *createKeyCommand) (*createdKeyDTO, error)
+	processRevokeKeyCommand(ctx context.Context, cmd *revokeKeyCommand) error
+
+	// authenticate returns an active key record or errInvalidKey
+	authenticate(ctx context.Context, key string) (*keyRecord, error)
+}
+
+type dbService struct {
+	db *gorm.DB
+}
+
+func hashKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// generateKey returns a random key and its prefix that is used to identify the key in listings
+func generateKey() (key string, prefix string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	key = keyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, key[:len(keyPrefix)+8], nil
+}
+
+// validateScopes checks that requested scopes are known and granted to the caller
+func validateScopes(requested []string, granted []string) error {
+	if len(requested) == 0 {
+		return errNoScopes
+	}
+	known := make(map[string]bool)
+	for _, scope := range Scopes {
+		known[scope] = true
+	}
+	grantedSet := make(map[string]bool)
+	for _, scope := range granted {
+		grantedSet[scope] = true
+	}
+	for _, scope := range requested {
+		if !known[scope] {
+			return errUnknownScope
+		}
+		if !grantedSet[scope] {
+			return errScopeNotGranted
+		}
+	}
+	return nil
+}
+
+func (svc *dbService) processUserKeysQuery(ctx context.Context, query *userKeysQuery) ([]keyDTO, error) {
+	if query.subject == "" {
+		return nil, errors.New("Please provide subject")
+	}
+	logger := logging.FromContext(ctx)
+	logger.Debugf("Processing user API keys query. Subject: %v", query.subject)
+	records := []keyRecord{}
+	if err := tracing.DB(ctx, svc.db).Table("api_keys").
+		Where("subject = ?", query.subject).
+		Order("created_at").
+		Find(&records).Error; err != nil {
+		return nil, err
+	}
+	result := make([]keyDTO, len(records))
+	for i := range records {
+		result[i] = records[i].toDTO()
+	}
+	return result, nil
+}
+
+func (svc *dbService) processCreateKeyCommand(ctx context.Context, cmd *createKeyCommand) (*createdKeyDTO, error) {
+	if cmd.subject == "" {
+		return nil, errors.New("Please provide subject")
+	}
+	if err := validateScopes(cmd.scopes, cmd.grantedScopes); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if cmd.expiresAt != nil {
+		if !cmd.expiresAt.After(now) {
+			return nil, errExpired
+		}
+		expiresAt := cmd.expiresAt.UTC()
+		cmd.expiresAt = &expiresAt
+	}
+	logger := logging.FromContext(ctx)
+	logger.Infof("Creating API key %v. Subject: %v, Scopes: %v", cmd.name, cmd.subject, cmd.scopes)
+
+	key, prefix, err := generateKey()
+	if err != nil {
+		return nil, err
+	}
+	record := keyRecord{
+		KeyID:     uuid.NewV4().String(),
+		Subject:   cmd.subject,
+		Name:      cmd.name,
+		KeyPrefix: prefix,
+		KeyHash:   hashKey(key),
+		Scopes:    strings.Join(cmd.scopes, " "),
+		CreatedAt: now,
+		ExpiresAt: cmd.expiresAt,
+	}
+	if err := tracing.DB(ctx, svc.db).Table("api_keys").Create(&record).Error; err != nil {
+		return nil, err
+	}
+	return &createdKeyDTO{keyDTO: record.toDTO(), Key: key}, nil
+}
+
+func (svc *dbService) processRevokeKeyCommand(ctx context.Context, cmd *revokeKeyCommand) error {
+	if cmd.subject == "" {
+		return errors.New("Please provide subject")
+	}
+	if _, err := uuid.FromString(cmd.keyID); err != nil {
+		return errKeyNotFound
+	}
+	logger := logging.FromContext(ctx)
+	logger.Infof("Revoking API key %v. Subject: %v", cmd.keyID, cmd.subject)
+	result := tracing.DB(ctx, svc.db).Table("api_keys").
+		Where("key_id = ? AND subject = ? AND revoked_at IS NULL", cmd.keyID, cmd.subject).
+		Update("revoked_at", time.Now().UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errKeyNotFound
+	}
+	return nil
+}
+
+func (svc *dbService) authenticate(ctx context.Context, key string) (*keyRecord, error) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return nil, errInvalidKey
+	}
+	now := time.Now().UTC()
+	record := keyRecord{}
+	err := tracing.DB(ctx, svc.db).Table("api_keys").
+		Where("key_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", hashKey(key), now).
+		Take(&record).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, errInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= lastUsedResolution {
+		if err := tracing.DB(ctx, svc.db).Table("api_keys").
+			Where("key_id = ?", record.KeyID).
+			Update("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+		record.LastUsedAt = &now
+	}
+	return &record, nil
+}
+
+// CreateService initializes a new instance of the service
+func CreateService(db *gorm.DB) Service {
+	return &dbService{db: db}
+}
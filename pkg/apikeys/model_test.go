@@ -0,0 +1,136 @@
+package apikeys
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/icrowley/fake"
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/logging"
+)
+
+func TestService(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given API keys service", t, func() {
+		svc := CreateService(DB)
+		subject := "auth0|" + fake.CharactersN(24)
+		create := func(expiresAt *time.Time, scopes ...string) (*createdKeyDTO, error) {
+			return svc.processCreateKeyCommand(ctx, &createKeyCommand{
+				subject:       subject,
+				grantedScopes: Scopes,
+				name:          fake.Word(),
+				scopes:        scopes,
+				expiresAt:     expiresAt,
+			})
+		}
+
+		Convey("When creating key", func() {
+			Convey("It should store key hash and return the key once", func() {
+				created, err := create(nil, "read:ledgers", "read:transactions")
+				So(err, ShouldBeNil)
+				So(created.Key, ShouldStartWith, created.Prefix)
+				So(created.Scopes, ShouldResemble, []string{"read:ledgers", "read:transactions"})
+
+				var keyHash string
+				So(DB.Table("api_keys").Select("key_hash").Where("key_id = ?", created.KeyID).Row().Scan(&keyHash), ShouldBeNil)
+				So(keyHash, ShouldEqual, hashKey(created.Key))
+				So(keyHash, ShouldNotContainSubstring, created.Key)
+			})
+
+			Convey("It should reject scopes that are not granted to the caller", func() {
+				_, err := svc.processCreateKeyCommand(ctx, &createKeyCommand{
+					subject:       subject,
+					grantedScopes: []string{"read:ledgers"},
+					name:          fake.Word(),
+					scopes:        []string{"read:ledgers", "write:transactions"},
+				})
+				So(err, ShouldEqual, errScopeNotGranted)
+			})
+
+			Convey("It should reject unknown scopes", func() {
+				_, err := create(nil, "admin")
+				So(err, ShouldEqual, errUnknownScope)
+				_, err = create(nil)
+				So(err, ShouldEqual, errNoScopes)
+			})
+
+			Convey("It should reject past expiry", func() {
+				expiresAt := time.Now().Add(-time.Hour)
+				_, err := create(&expiresAt, "read:ledgers")
+				So(err, ShouldEqual, errExpired)
+			})
+		})
+
+		Convey("When querying keys", func() {
+			first, _ := create(nil, "read:ledgers")
+			second, _ := create(nil, "read:tags")
+			create(nil, "read:accounts")
+			svc.processRevokeKeyCommand(ctx, &revokeKeyCommand{subject: subject, keyID: second.KeyID})
+
+			Convey("It should return all keys of the subject including revoked", func() {
+				keys, err := svc.processUserKeysQuery(ctx, &userKeysQuery{subject: subject})
+				So(err, ShouldBeNil)
+				So(keys, ShouldHaveLength, 3)
+				So(keys[0].KeyID, ShouldEqual, first.KeyID)
+				So(keys[0].RevokedAt, ShouldBeNil)
+				So(keys[1].KeyID, ShouldEqual, second.KeyID)
+				So(keys[1].RevokedAt, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When revoking key", func() {
+			created, _ := create(nil, "read:ledgers")
+
+			Convey("It should not revoke keys of other subjects", func() {
+				err := svc.processRevokeKeyCommand(ctx, &revokeKeyCommand{subject: "auth0|other", keyID: created.KeyID})
+				So(err, ShouldEqual, errKeyNotFound)
+			})
+
+			Convey("It should respond not found for unknown and revoked keys", func() {
+				So(svc.processRevokeKeyCommand(ctx, &revokeKeyCommand{subject: subject, keyID: uuid.NewV4().String()}), ShouldEqual, errKeyNotFound)
+				So(svc.processRevokeKeyCommand(ctx, &revokeKeyCommand{subject: subject, keyID: "not-uuid"}), ShouldEqual, errKeyNotFound)
+				So(svc.processRevokeKeyCommand(ctx, &revokeKeyCommand{subject: subject, keyID: created.KeyID}), ShouldBeNil)
+				So(svc.processRevokeKeyCommand(ctx, &revokeKeyCommand{subject: subject, keyID: created.KeyID}), ShouldEqual, errKeyNotFound)
+			})
+		})
+
+		Convey("When authenticating key", func() {
+			created, _ := create(nil, "read:ledgers")
+
+			Convey("It should return the key and record last use", func() {
+				record, err := svc.authenticate(ctx, created.Key)
+				So(err, ShouldBeNil)
+				So(record.Subject, ShouldEqual, subject)
+				So(record.Scopes, ShouldEqual, "read:ledgers")
+				So(record.LastUsedAt, ShouldNotBeNil)
+
+				keys, _ := svc.processUserKeysQuery(ctx, &userKeysQuery{subject: subject})
+				So(keys[0].LastUsedAt, ShouldNotBeNil)
+			})
+
+			Convey("It should reject unknown keys", func() {
+				_, err := svc.authenticate(ctx, created.Key+"x")
+				So(err, ShouldEqual, errInvalidKey)
+				_, err = svc.authenticate(ctx, "")
+				So(err, ShouldEqual, errInvalidKey)
+			})
+
+			Convey("It should reject revoked keys", func() {
+				svc.processRevokeKeyCommand(ctx, &revokeKeyCommand{subject: subject, keyID: created.KeyID})
+				_, err := svc.authenticate(ctx, created.Key)
+				So(err, ShouldEqual, errInvalidKey)
+			})
+
+			Convey("It should reject expired keys", func() {
+				expiresAt := time.Now().Add(time.Hour)
+				expiring, _ := create(&expiresAt, "read:ledgers")
+				So(DB.Exec("UPDATE api_keys SET expires_at = ? WHERE key_id = ?", time.Now().UTC().Add(-time.Minute), expiring.KeyID).Error, ShouldBeNil)
+				_, err := svc.authenticate(ctx, expiring.Key)
+				So(err, ShouldEqual, errInvalidKey)
+			})
+		})
+	})
+}
@@ -0,0 +1,96 @@
+package apikeys
+
+import (
+	"net/http"
+	"strings"
+
+	"ledger.api/pkg/auth"
+	"ledger.api/pkg/server"
+)
+
+// CreateRoutes - Register API keys related routes. Keys can only be managed
+// by requests authenticated with regular tokens so a leaked key can't be used to mint new keys
+func CreateRoutes(svc Service) server.Routes {
+	return func(router *server.Router) {
+		keys := router.Group("/v2/api-keys", server.WithMiddleware(requireTokenClaims))
+		keys.GET("", createUserKeysQueryHandler(svc))
+		keys.POST("", createCreateKeyHandler(svc))
+		keys.DELETE("/:keyID", createRevokeKeyHandler(svc))
+	}
+}
+
+// requireTokenClaims responds with 404 to requests without claims and with 403 to requests
+// authenticated with API keys
+func requireTokenClaims(next server.HandlerFunc) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		claims := auth.ClaimsFromContext(req.Context())
+		if claims == nil || claims.Claims == nil || claims.Subject == "" {
+			h.Logger.Info("Request has not been initialized with claims, responding with 404")
+			return nil, *server.NotFoundError()
+		}
+		if IsAPIKeyClaims(claims) {
+			h.Logger.Infof("API key %v attempted to manage API keys", claims.ID)
+			return nil, *server.ForbiddenError("API keys can not be managed with API keys")
+		}
+		return next(req, h)
+	}
+}
+
+// commandHTTPError maps command errors to http errors
+func commandHTTPError(err error) error {
+	switch err {
+	case errKeyNotFound:
+		return *server.NotFoundError()
+	case errNoScopes, errUnknownScope, errExpired:
+		return *server.BadRequestError(err.Error())
+	case errScopeNotGranted:
+		return *server.ForbiddenError(err.Error())
+	}
+	return err
+}
+
+func createUserKeysQueryHandler(svc Service) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		result, err := svc.processUserKeysQuery(req.Context(), &userKeysQuery{
+			subject: auth.ClaimsFromContext(req.Context()).Subject,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return h.Response(result), nil
+	}
+}
+
+func createCreateKeyHandler(svc Service) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		var payload keyPayload
+		if err := h.Bind(req, &payload); err != nil {
+			return nil, err
+		}
+		claims := auth.ClaimsFromContext(req.Context())
+		result, err := svc.processCreateKeyCommand(req.Context(), &createKeyCommand{
+			subject:       claims.Subject,
+			grantedScopes: strings.Fields(claims.Scope),
+			name:          payload.Name,
+			scopes:        payload.Scopes,
+			expiresAt:     payload.ExpiresAt,
+		})
+		if err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(result).Status(http.StatusCreated), nil
+	}
+}
+
+func createRevokeKeyHandler(svc Service) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		keyID := h.Params.ByName("keyID")
+		if err := svc.processRevokeKeyCommand(req.Context(), &revokeKeyCommand{
+			subject: auth.ClaimsFromContext(req.Context()).Subject,
+			keyID:   keyID,
+		}); err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(nil).Status(http.StatusNoContent), nil
+	}
+}
@@ -0,0 +1,88 @@
+package apikeys
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"ledger.api/pkg/auth"
+	"ledger.api/pkg/server"
+)
+
+func TestRoutes(t *testing.T) {
+	Convey("Given API keys routes", t, func() {
+		svc := &mockService{}
+		handler := server.
+			CreateHTTPApp(server.HTTPAppConfig{Env: "test"}).
+			RegisterRoutes(CreateRoutes(svc)).
+			CreateHandler()
+		serve := func(method string, path string, body string, claims *auth.LedgerClaims) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+			if claims != nil {
+				req = req.WithContext(auth.ContextWithClaims(req.Context(), claims))
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			return recorder
+		}
+		tokenClaims := &auth.LedgerClaims{
+			Claims: &jwt.Claims{Subject: "auth0|user-1"},
+			Scope:  "read:ledgers read:tags",
+		}
+		payload := `{"data": {"type": "api-keys", "attributes": {"name": "backup", "scopes": ["read:ledgers"]}}}`
+
+		Convey("When creating key", func() {
+			Convey("It should create key with scopes of the payload", func() {
+				recorder := serve("POST", "/v2/api-keys", payload, tokenClaims)
+				So(recorder.Code, ShouldEqual, http.StatusCreated)
+				So(svc.createKeyCommands, ShouldHaveLength, 1)
+				So(svc.createKeyCommands[0].subject, ShouldEqual, "auth0|user-1")
+				So(svc.createKeyCommands[0].name, ShouldEqual, "backup")
+				So(svc.createKeyCommands[0].scopes, ShouldResemble, []string{"read:ledgers"})
+				So(svc.createKeyCommands[0].grantedScopes, ShouldResemble, []string{"read:ledgers", "read:tags"})
+
+				var result map[string]interface{}
+				json.Unmarshal(recorder.Body.Bytes(), &result)
+				So(result["key"], ShouldEqual, "ldk_secret")
+			})
+
+			Convey("It should respond with 403 if scopes are not granted to the caller", func() {
+				recorder := serve("POST", "/v2/api-keys",
+					`{"data": {"type": "api-keys", "attributes": {"name": "backup", "scopes": ["write:tags"]}}}`,
+					tokenClaims)
+				So(recorder.Code, ShouldEqual, http.StatusForbidden)
+			})
+
+			Convey("It should respond with 403 if authenticated with API key", func() {
+				recorder := serve("POST", "/v2/api-keys", payload, &auth.LedgerClaims{
+					Claims: &jwt.Claims{Subject: "auth0|user-1", Issuer: Issuer},
+					Scope:  "read:ledgers",
+				})
+				So(recorder.Code, ShouldEqual, http.StatusForbidden)
+				So(svc.createKeyCommands, ShouldBeEmpty)
+			})
+
+			Convey("It should respond with 404 if not authenticated", func() {
+				recorder := serve("POST", "/v2/api-keys", payload, nil)
+				So(recorder.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When revoking key", func() {
+			Convey("It should revoke key of the caller", func() {
+				recorder := serve("DELETE", "/v2/api-keys/key-1", "", tokenClaims)
+				So(recorder.Code, ShouldEqual, http.StatusNoContent)
+				So(svc.revokeKeyCommands[0], ShouldResemble, &revokeKeyCommand{subject: "auth0|user-1", keyID: "key-1"})
+			})
+
+			Convey("It should respond with 404 if key not found", func() {
+				recorder := serve("DELETE", "/v2/api-keys/key-2", "", tokenClaims)
+				So(recorder.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
@@ -0,0 +1,97 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	auth0 "github.com/auth0-community/go-auth0"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"ledger.api/pkg/auth"
+)
+
+// Scheme is an authorization scheme of API keys, e.g: Authorization: ApiKey ldk_xxx
+const Scheme = "ApiKey"
+
+// Issuer is an issuer of claims of requests authenticated with API keys
+const Issuer = "ledger.api/apikeys"
+
+// IsAPIKeyClaims returns true if claims were populated from an API key
+func IsAPIKeyClaims(claims *auth.LedgerClaims) bool {
+	return claims != nil && claims.Claims != nil && claims.Issuer == Issuer
+}
+
+// requestValidator authenticates requests with API keys and delegates
+// requests with other authorization schemes to the fallback validator
+type requestValidator struct {
+	svc      Service
+	fallback auth.RequestValidator
+
+	// signingKey is a per process key. Validated keys are represented as tokens
+	// signed with it so claims are extracted the same way as claims of JWTs
+	signingKey []byte
+}
+
+// CreateRequestValidator returns validator that accepts API keys. Fallback is optional,
+// requests without API key are rejected with auth0.ErrTokenNotFound if it is nil
+func CreateRequestValidator(svc Service, fallback auth.RequestValidator) auth.RequestValidator {
+	signingKey := make([]byte, 32)
+	if _, err := rand.Read(signingKey); err != nil {
+		panic(err)
+	}
+	return &requestValidator{svc: svc, fallback: fallback, signingKey: signingKey}
+}
+
+// extractKey returns a key from the authorization header if it uses ApiKey scheme
+func extractKey(req *http.Request) (string, bool) {
+	parts := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], Scheme) {
+		return "", false
+	}
+	return strings.TrimSpace(parts[1]), true
+}
+
+func (validator *requestValidator) ValidateRequest(req *http.Request) (*jwt.JSONWebToken, error) {
+	key, ok := extractKey(req)
+	if !ok {
+		if validator.fallback == nil {
+			return nil, auth0.ErrTokenNotFound
+		}
+		return validator.fallback.ValidateRequest(req)
+	}
+	record, err := validator.svc.authenticate(req.Context(), key)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := auth.LedgerClaims{
+		Claims: &jwt.Claims{
+			Issuer:   Issuer,
+			Subject:  record.Subject,
+			ID:       record.KeyID,
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		Scope: record.Scopes,
+	}
+	if record.ExpiresAt != nil {
+		claims.Expiry = jwt.NewNumericDate(*record.ExpiresAt)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: validator.signingKey}, nil)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		return nil, err
+	}
+	return jwt.ParseSigned(raw)
+}
+
+func (validator *requestValidator) Claims(req *http.Request, token *jwt.JSONWebToken, values ...interface{}) error {
+	if _, ok := extractKey(req); !ok && validator.fallback != nil {
+		return validator.fallback.Claims(req, token, values...)
+	}
+	return token.Claims(validator.signingKey, values...)
+}
@@ -0,0 +1,110 @@
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	auth0 "github.com/auth0-community/go-auth0"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"ledger.api/pkg/auth"
+)
+
+type mockService struct {
+	Service
+	records           map[string]*keyRecord
+	createKeyCommands []*createKeyCommand
+	revokeKeyCommands []*revokeKeyCommand
+}
+
+func (svc *mockService) authenticate(ctx context.Context, key string) (*keyRecord, error) {
+	record, ok := svc.records[key]
+	if !ok {
+		return nil, errInvalidKey
+	}
+	return record, nil
+}
+
+func (svc *mockService) processCreateKeyCommand(ctx context.Context, cmd *createKeyCommand) (*createdKeyDTO, error) {
+	svc.createKeyCommands = append(svc.createKeyCommands, cmd)
+	if err := validateScopes(cmd.scopes, cmd.grantedScopes); err != nil {
+		return nil, err
+	}
+	return &createdKeyDTO{keyDTO: keyDTO{KeyID: "key-1", Name: cmd.name, Scopes: cmd.scopes}, Key: "ldk_secret"}, nil
+}
+
+func (svc *mockService) processRevokeKeyCommand(ctx context.Context, cmd *revokeKeyCommand) error {
+	svc.revokeKeyCommands = append(svc.revokeKeyCommands, cmd)
+	if cmd.keyID != "key-1" {
+		return errKeyNotFound
+	}
+	return nil
+}
+
+type mockFallbackValidator struct {
+	err error
+}
+
+func (validator *mockFallbackValidator) ValidateRequest(r *http.Request) (*jwt.JSONWebToken, error) {
+	return nil, validator.err
+}
+
+func (validator *mockFallbackValidator) Claims(r *http.Request, token *jwt.JSONWebToken, values ...interface{}) error {
+	values[0].(*auth.LedgerClaims).Scope = "fallback"
+	return nil
+}
+
+func TestRequestValidator(t *testing.T) {
+	Convey("Given API key request validator", t, func() {
+		expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		svc := &mockService{records: map[string]*keyRecord{
+			"ldk_valid": {KeyID: "key-1", Subject: "auth0|user-1", Scopes: "read:ledgers read:tags", ExpiresAt: &expiresAt},
+		}}
+		fallback := &mockFallbackValidator{err: errors.New("jwt validation failed")}
+		validator := CreateRequestValidator(svc, fallback)
+		newRequest := func(authorization string) *http.Request {
+			req, _ := http.NewRequest("GET", "/v2/ledgers", nil)
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			return req
+		}
+
+		Convey("It should populate ledger claims from the key", func() {
+			req := newRequest("ApiKey ldk_valid")
+			token, err := validator.ValidateRequest(req)
+			So(err, ShouldBeNil)
+			claims := auth.LedgerClaims{}
+			So(validator.Claims(req, token, &claims), ShouldBeNil)
+			So(claims.Subject, ShouldEqual, "auth0|user-1")
+			So(claims.Scope, ShouldEqual, "read:ledgers read:tags")
+			So(claims.ID, ShouldEqual, "key-1")
+			So(claims.Expiry.Time().UTC(), ShouldEqual, expiresAt)
+			So(IsAPIKeyClaims(&claims), ShouldBeTrue)
+		})
+
+		Convey("It should reject invalid keys", func() {
+			_, err := validator.ValidateRequest(newRequest("ApiKey ldk_unknown"))
+			So(err, ShouldEqual, errInvalidKey)
+		})
+
+		Convey("It should delegate other schemes to the fallback", func() {
+			req := newRequest("Bearer xxx.yyy.zzz")
+			_, err := validator.ValidateRequest(req)
+			So(err, ShouldEqual, fallback.err)
+
+			claims := auth.LedgerClaims{}
+			So(validator.Claims(req, nil, &claims), ShouldBeNil)
+			So(claims.Scope, ShouldEqual, "fallback")
+			So(IsAPIKeyClaims(&claims), ShouldBeFalse)
+		})
+
+		Convey("It should report missing token if there is no fallback", func() {
+			_, err := CreateRequestValidator(svc, nil).ValidateRequest(newRequest(""))
+			So(err, ShouldEqual, auth0.ErrTokenNotFound)
+		})
+	})
+}
@@ -3,6 +3,9 @@ package app
 import (
 	"flag"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -27,6 +30,15 @@ func setDefaults(cfg *viper.Viper) *viper.Viper {
 	cfg.SetDefault("PORT", 3000)
 	cfg.SetDefault("AUTH0_AUD", "https://staging.api.my-ledger.com")
 	cfg.SetDefault("AUTH0_ISS", "https://ledger-staging.eu.auth0.com/")
+	cfg.SetDefault("AUTH0_JWKS_FILE", "")
+	cfg.SetDefault("HTTP_READ_TIMEOUT", "15s")
+	cfg.SetDefault("HTTP_WRITE_TIMEOUT", "30s")
+	cfg.SetDefault("HTTP_IDLE_TIMEOUT", "120s")
+	cfg.SetDefault("SHUTDOWN_TIMEOUT", "20s")
+	cfg.SetDefault("TRACING_EXPORTER", "none")
+	cfg.SetDefault("TRACING_OTLP_ENDPOINT", "http://localhost:4318/v1/traces")
+	cfg.SetDefault("BEANSTALKD_URL", "")
+	cfg.SetDefault("INVITATIONS_SECRET", "")
 	return cfg
 }
 
@@ -36,3 +48,79 @@ func GetConfig() Config {
 	viperCfg.AutomaticEnv()
 	return setDefaults(viperCfg)
 }
+
+// GetDuration parses a duration config value, e.g 15s
+func GetDuration(cfg Config, key string) (time.Duration, error) {
+	value := cfg.GetString(key)
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%v should be a duration (e.g 15s), got: %v", key, value)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("%v should be positive, got: %v", key, value)
+	}
+	return duration, nil
+}
+
+// durationKeys is a list of config keys that hold durations
+var durationKeys = []string{"HTTP_READ_TIMEOUT", "HTTP_WRITE_TIMEOUT", "HTTP_IDLE_TIMEOUT", "SHUTDOWN_TIMEOUT"}
+
+// tracingExporters is a list of supported TRACING_EXPORTER values
+var tracingExporters = map[string]bool{"none": true, "log": true, "otlp": true}
+
+// minInvitationsSecretLength is a minimal length of INVITATIONS_SECRET
+const minInvitationsSecretLength = 32
+
+// envs is a list of supported APP_ENV values
+var envs = map[string]bool{"dev": true, "test": true, "stage": true, "prod": true}
+
+// ValidateConfig checks config values and returns a list of problems found.
+// It does not check if services the config points to are available
+func ValidateConfig(cfg Config) []error {
+	var problems []error
+	if env := cfg.GetString("APP_ENV"); !envs[env] {
+		problems = append(problems, fmt.Errorf("APP_ENV should be one of dev, test, stage or prod, got: %v", env))
+	}
+	if port := cfg.GetInt("PORT"); port <= 0 || port > 65535 {
+		problems = append(problems, fmt.Errorf("PORT should be between 1 and 65535, got: %v", port))
+	}
+	if dbURL, err := url.Parse(cfg.GetString("DB_URL")); err != nil {
+		problems = append(problems, fmt.Errorf("DB_URL is malformed: %v", err))
+	} else if dbURL.Scheme != "postgres" && dbURL.Scheme != "postgresql" {
+		problems = append(problems, fmt.Errorf("DB_URL should be a postgres url, got scheme: %v", dbURL.Scheme))
+	}
+	if iss, err := url.Parse(cfg.GetString("AUTH0_ISS")); err != nil || iss.Scheme != "https" {
+		problems = append(problems, fmt.Errorf("AUTH0_ISS should be an https url, got: %v", cfg.GetString("AUTH0_ISS")))
+	} else if !strings.HasSuffix(iss.Path, "/") {
+		// JWKS url is built by appending .well-known/jwks.json to the issuer
+		problems = append(problems, fmt.Errorf("AUTH0_ISS should end with /, got: %v", cfg.GetString("AUTH0_ISS")))
+	}
+	if cfg.GetString("AUTH0_AUD") == "" {
+		problems = append(problems, fmt.Errorf("AUTH0_AUD should not be empty"))
+	}
+	if exporter := cfg.GetString("TRACING_EXPORTER"); !tracingExporters[exporter] {
+		problems = append(problems, fmt.Errorf("TRACING_EXPORTER should be one of none, log or otlp, got: %v", exporter))
+	} else if exporter == "otlp" {
+		endpoint, err := url.Parse(cfg.GetString("TRACING_OTLP_ENDPOINT"))
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+			problems = append(problems, fmt.Errorf("TRACING_OTLP_ENDPOINT should be an http url, got: %v", cfg.GetString("TRACING_OTLP_ENDPOINT")))
+		}
+	}
+	if beanstalkdURL := cfg.GetString("BEANSTALKD_URL"); strings.Contains(beanstalkdURL, "://") {
+		if parsed, err := url.Parse(beanstalkdURL); err != nil || parsed.Scheme != "beanstalk" || parsed.Host == "" {
+			problems = append(problems, fmt.Errorf("BEANSTALKD_URL should be host:port or beanstalk://host:port, got: %v", beanstalkdURL))
+		}
+	}
+	// Random secret is generated if not configured so invitations do not survive restarts
+	if env := cfg.GetString("APP_ENV"); env == "stage" || env == "prod" {
+		if len(cfg.GetString("INVITATIONS_SECRET")) < minInvitationsSecretLength {
+			problems = append(problems, fmt.Errorf("INVITATIONS_SECRET should be at least %v characters long", minInvitationsSecretLength))
+		}
+	}
+	for _, key := range durationKeys {
+		if _, err := GetDuration(cfg, key); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	return problems
+}
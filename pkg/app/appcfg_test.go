@@ -0,0 +1,99 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type mapConfig map[string]interface{}
+
+func (cfg mapConfig) GetString(key string) string {
+	val, _ := cfg[key].(string)
+	return val
+}
+
+func (cfg mapConfig) GetInt(key string) int {
+	val, _ := cfg[key].(int)
+	return val
+}
+
+func TestValidateConfig(t *testing.T) {
+	Convey("Given config", t, func() {
+		cfg := mapConfig{
+			"APP_ENV":   "prod",
+			"PORT":      3000,
+			"DB_URL":    "postgresql://postgres@localhost:5432/ledger?sslmode=disable",
+			"AUTH0_ISS": "https://ledger.eu.auth0.com/",
+			"AUTH0_AUD": "https://api.my-ledger.com",
+
+			"HTTP_READ_TIMEOUT":  "15s",
+			"HTTP_WRITE_TIMEOUT": "30s",
+			"HTTP_IDLE_TIMEOUT":  "2m",
+			"SHUTDOWN_TIMEOUT":   "20s",
+
+			"TRACING_EXPORTER":      "otlp",
+			"TRACING_OTLP_ENDPOINT": "http://localhost:4318/v1/traces",
+
+			"BEANSTALKD_URL": "beanstalk://localhost:11300",
+
+			"INVITATIONS_SECRET": "0123456789abcdef0123456789abcdef",
+		}
+
+		Convey("It should return no problems if config is valid", func() {
+			So(ValidateConfig(cfg), ShouldBeEmpty)
+		})
+
+		Convey("It should accept default config", func() {
+			So(ValidateConfig(GetConfig()), ShouldBeEmpty)
+		})
+
+		Convey("It should report each invalid value", func() {
+			cfg["APP_ENV"] = "production"
+			cfg["PORT"] = 0
+			cfg["DB_URL"] = "mysql://localhost/ledger"
+			cfg["AUTH0_ISS"] = "https://ledger.eu.auth0.com"
+			cfg["AUTH0_AUD"] = ""
+			So(ValidateConfig(cfg), ShouldHaveLength, 5)
+		})
+
+		Convey("It should require positive durations", func() {
+			cfg["HTTP_READ_TIMEOUT"] = "15"
+			cfg["SHUTDOWN_TIMEOUT"] = "-1s"
+			So(ValidateConfig(cfg), ShouldHaveLength, 2)
+
+			duration, err := GetDuration(cfg, "HTTP_IDLE_TIMEOUT")
+			So(err, ShouldBeNil)
+			So(duration, ShouldEqual, 2*time.Minute)
+		})
+
+		Convey("It should validate tracing exporter", func() {
+			cfg["TRACING_OTLP_ENDPOINT"] = "localhost:4318"
+			So(ValidateConfig(cfg), ShouldHaveLength, 1)
+			cfg["TRACING_EXPORTER"] = "jaeger"
+			So(ValidateConfig(cfg), ShouldHaveLength, 1)
+			cfg["TRACING_EXPORTER"] = "none"
+			So(ValidateConfig(cfg), ShouldBeEmpty)
+		})
+
+		Convey("It should validate healthcheck dependencies", func() {
+			cfg["BEANSTALKD_URL"] = "redis://localhost:6379"
+			So(ValidateConfig(cfg), ShouldHaveLength, 1)
+			cfg["BEANSTALKD_URL"] = "localhost:11300"
+			So(ValidateConfig(cfg), ShouldBeEmpty)
+		})
+
+		Convey("It should require invitations secret in prod", func() {
+			cfg["INVITATIONS_SECRET"] = "secret"
+			So(ValidateConfig(cfg), ShouldHaveLength, 1)
+			cfg["APP_ENV"] = "dev"
+			So(ValidateConfig(cfg), ShouldBeEmpty)
+		})
+
+		Convey("It should require https issuer", func() {
+			cfg["AUTH0_ISS"] = "http://ledger.eu.auth0.com/"
+			So(ValidateConfig(cfg), ShouldHaveLength, 1)
+		})
+	})
+}
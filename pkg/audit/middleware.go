@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"ledger.api/pkg/auth"
+	"ledger.api/pkg/server"
+)
+
+// unmatchedRoute is recorded as a route of calls that matched no route
+// so arbitrary paths of clients are not written to the log
+const unmatchedRoute = "unmatched"
+
+// Max lengths of client controlled values according to columns of the audit log
+const (
+	maxValueLength  = 255
+	maxMethodLength = 16
+)
+
+// truncate cuts the value to maxLength characters
+func truncate(value string, maxLength int) string {
+	if utf8.RuneCountInString(value) <= maxLength {
+		return value
+	}
+	return string([]rune(value)[:maxLength])
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// CreateAuditMiddlewareFunc creates middleware that records authenticated calls.
+// Should be used after the auth middleware so claims are available.
+// Calls without claims (e.g whitelisted healthchecks) are not recorded
+func CreateAuditMiddlewareFunc(recorder Recorder) server.RouterMiddlewareFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			claims := auth.ClaimsFromContext(req.Context())
+			if claims == nil || claims.Claims == nil {
+				next(w, req)
+				return
+			}
+			occurredAt := time.Now()
+			ctx := server.ContextWithRoutePattern(req.Context())
+			wrappedWriter := &statusRecorder{ResponseWriter: w}
+			next(wrappedWriter, req.WithContext(ctx))
+
+			entry := Entry{
+				OccurredAt: occurredAt,
+				Subject:    truncate(claims.Subject, maxValueLength),
+				Scopes:     claims.Scope,
+				RequestID:  truncate(server.RequestIDVAlue(ctx), maxValueLength),
+				Method:     truncate(req.Method, maxMethodLength),
+				Route:      server.RoutePattern(ctx),
+				Status:     wrappedWriter.status,
+			}
+			if entry.Route == "" {
+				entry.Route = unmatchedRoute
+			}
+			if params := server.RouteParams(ctx); params != nil {
+				entry.LedgerID = truncate(params.ByName("ledgerID"), maxValueLength)
+			}
+			if entry.Status == 0 {
+				entry.Status = http.StatusOK
+			}
+			recorder.Record(entry)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"ledger.api/pkg/auth"
+	"ledger.api/pkg/server"
+)
+
+type mockRecorder struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func (recorder *mockRecorder) Record(entry Entry) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.entries = append(recorder.entries, entry)
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	Convey("Given an app with audit middleware", t, func() {
+		recorder := &mockRecorder{}
+		claims := &auth.LedgerClaims{
+			Claims: &jwt.Claims{Subject: "auth0|user-1"},
+			Scope:  "read:tags write:tags",
+		}
+		withClaims := func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, req *http.Request) {
+				if req.Header.Get("Authorization") != "" {
+					req = req.WithContext(auth.ContextWithClaims(req.Context(), claims))
+				}
+				next(w, req)
+			}
+		}
+		handler := server.CreateHTTPApp(server.HTTPAppConfig{Env: "test"}).
+			Use(withClaims).
+			Use(CreateAuditMiddlewareFunc(recorder)).
+			RegisterRoutes(func(r *server.Router) {
+				r.GET("/v2/ledgers/:ledgerID/tags", func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+					return h.Response(server.JSON{}), nil
+				})
+				r.DELETE("/v2/ledgers/:ledgerID/tags/:tagID", func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+					return nil, *server.NotFoundError()
+				})
+				r.GET("/v2/healthcheck/ping", func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+					return h.Response(server.JSON{}), nil
+				})
+			}).
+			CreateHandler()
+		serveRequest := func(req *http.Request, authorized bool) {
+			if authorized {
+				req.Header.Set("Authorization", "Bearer token")
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		serve := func(method string, path string, authorized bool) {
+			req, _ := http.NewRequest(method, path, nil)
+			serveRequest(req, authorized)
+		}
+		ledgerID := uuid.NewV4().String()
+
+		Convey("It should record authenticated calls", func() {
+			serve("GET", "/v2/ledgers/"+ledgerID+"/tags", true)
+			So(recorder.entries, ShouldHaveLength, 1)
+			entry := recorder.entries[0]
+			So(entry.Subject, ShouldEqual, "auth0|user-1")
+			So(entry.Scopes, ShouldEqual, "read:tags write:tags")
+			So(entry.RequestID, ShouldNotBeEmpty)
+			So(entry.Method, ShouldEqual, "GET")
+			So(entry.Route, ShouldEqual, "/v2/ledgers/:ledgerID/tags")
+			So(entry.LedgerID, ShouldEqual, ledgerID)
+			So(entry.Status, ShouldEqual, http.StatusOK)
+			So(entry.OccurredAt.IsZero(), ShouldBeFalse)
+		})
+
+		Convey("It should record status of failed calls", func() {
+			serve("DELETE", "/v2/ledgers/"+ledgerID+"/tags/10", true)
+			So(recorder.entries, ShouldHaveLength, 1)
+			So(recorder.entries[0].Route, ShouldEqual, "/v2/ledgers/:ledgerID/tags/:tagID")
+			So(recorder.entries[0].Status, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("It should record calls of routes without ledger", func() {
+			serve("GET", "/v2/healthcheck/ping", true)
+			So(recorder.entries[0].LedgerID, ShouldBeEmpty)
+		})
+
+		Convey("It should record calls that matched no route without their path", func() {
+			serve("GET", "/v2/unknown/"+strings.Repeat("a", 300), true)
+			So(recorder.entries[0].Route, ShouldEqual, unmatchedRoute)
+			So(recorder.entries[0].Status, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("It should truncate oversized request id and ledger id", func() {
+			req, _ := http.NewRequest("GET", "/v2/ledgers/"+strings.Repeat("l", 300)+"/tags", nil)
+			req.Header.Set("x-request-id", strings.Repeat("r", 300))
+			serveRequest(req, true)
+			So(recorder.entries, ShouldHaveLength, 1)
+			So(recorder.entries[0].RequestID, ShouldEqual, strings.Repeat("r", maxValueLength))
+			So(recorder.entries[0].LedgerID, ShouldEqual, strings.Repeat("l", maxValueLength))
+		})
+
+		Convey("It should not record anonymous calls", func() {
+			serve("GET", "/v2/healthcheck/ping", false)
+			So(recorder.entries, ShouldBeEmpty)
+		})
+	})
+}
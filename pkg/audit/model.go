@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
+	"ledger.api/pkg/users"
+)
+
+var errNotLedgerOwner = errors.New("Audit trail is only available to the ledger owner")
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+type entryDTO struct {
+	AuditID    int64     `json:"auditID"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Subject    string    `json:"subject"`
+	Scopes     []string  `json:"scopes" gorm:"-"`
+	RequestID  string    `json:"requestID"`
+	Method     string    `json:"method"`
+	Route      string    `json:"route"`
+	Status     int       `json:"status"`
+
+	RawScopes string `json:"-" gorm:"column:scopes"`
+}
+
+type ledgerAuditQuery struct {
+	ledgerID string
+	user     *users.User
+
+	// beforeID is an auditID entries should precede. Used to fetch next pages
+	beforeID *int64
+	limit    int
+}
+
+// QueryService is a service to query the audit trail
+type QueryService interface {
+	processLedgerAuditQuery(ctx context.Context, query *ledgerAuditQuery) ([]entryDTO, error)
+}
+
+type dbQueryService struct {
+	db *gorm.DB
+}
+
+func (svc *dbQueryService) processLedgerAuditQuery(ctx context.Context, query *ledgerAuditQuery) ([]entryDTO, error) {
+	if query.ledgerID == "" {
+		return nil, errors.New("Please provide ledgerID")
+	}
+	if query.user == nil {
+		return nil, errors.New("Please provide user")
+	}
+	logger := logging.FromContext(ctx)
+	logger.Debugf("Processing ledger audit query. LedgerID: %v, UserID: %v", query.ledgerID, query.user.ID)
+
+	var isOwner bool
+	if err := tracing.DB(ctx, svc.db).Raw(`
+		SELECT EXISTS(
+			SELECT 1 FROM projections_ledgers WHERE aggregate_id = ? AND owner_user_id = ?
+		)`, query.ledgerID, query.user.ID).Row().Scan(&isOwner); err != nil {
+		return nil, err
+	}
+	if !isOwner {
+		return nil, errNotLedgerOwner
+	}
+
+	limit := query.limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	scope := tracing.DB(ctx, svc.db).Table("audit_log").
+		Select("audit_id, occurred_at, subject, scopes, request_id, method, route, status").
+		Where("ledger_id = ?", query.ledgerID)
+	if query.beforeID != nil {
+		scope = scope.Where("audit_id < ?", *query.beforeID)
+	}
+	result := []entryDTO{}
+	if err := scope.Order("audit_id DESC").Limit(limit).Find(&result).Error; err != nil {
+		return nil, err
+	}
+	for i := range result {
+		result[i].Scopes = strings.Fields(result[i].RawScopes)
+	}
+	return result, nil
+}
+
+// CreateQueryService initializes a new instance of the query service
+func CreateQueryService(db *gorm.DB) QueryService {
+	return &dbQueryService{db: db}
+}
@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/logging"
+)
+
+func TestQueryService(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given audit query service", t, func() {
+		svc := CreateQueryService(DB)
+		owner := ldtesting.NewUser()
+		member := ldtesting.NewUser()
+		ledgerID := uuid.NewV4().String()
+		So(DB.Exec(`
+			INSERT INTO projections_ledgers(aggregate_id, owner_user_id, name, currency_code, authorized_user_ids)
+			VALUES(?, ?, 'Ledger', 'UAH', ?)
+		`, ledgerID, owner.ID, ldtesting.AuthorizedUserIDs(owner, member)).Error, ShouldBeNil)
+
+		writer := CreateWriter(DB, logging.NewTestLogger(), DefaultWriterOptions())
+		occurredAt := time.Now().UTC().Truncate(time.Millisecond)
+		for i := 0; i < 5; i++ {
+			writer.Record(Entry{
+				OccurredAt: occurredAt,
+				Subject:    member.Subject,
+				Scopes:     "read:tags write:tags",
+				RequestID:  uuid.NewV4().String(),
+				Method:     "POST",
+				Route:      "/v2/ledgers/:ledgerID/tags",
+				LedgerID:   ledgerID,
+				Status:     202,
+			})
+		}
+		writer.Record(Entry{OccurredAt: occurredAt, Subject: member.Subject, LedgerID: uuid.NewV4().String(), Status: 200})
+		writer.Shutdown()
+
+		Convey("It should return ledger entries to the owner newest first", func() {
+			entries, err := svc.processLedgerAuditQuery(ctx, &ledgerAuditQuery{ledgerID: ledgerID, user: owner})
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 5)
+			So(entries[0].AuditID, ShouldBeGreaterThan, entries[1].AuditID)
+			So(entries[0].Subject, ShouldEqual, member.Subject)
+			So(entries[0].Scopes, ShouldResemble, []string{"read:tags", "write:tags"})
+			So(entries[0].Route, ShouldEqual, "/v2/ledgers/:ledgerID/tags")
+			So(entries[0].Status, ShouldEqual, 202)
+			So(entries[0].OccurredAt.Equal(occurredAt), ShouldBeTrue)
+		})
+
+		Convey("It should return pages of entries", func() {
+			firstPage, err := svc.processLedgerAuditQuery(ctx, &ledgerAuditQuery{ledgerID: ledgerID, user: owner, limit: 3})
+			So(err, ShouldBeNil)
+			So(firstPage, ShouldHaveLength, 3)
+			beforeID := firstPage[2].AuditID
+			secondPage, err := svc.processLedgerAuditQuery(ctx, &ledgerAuditQuery{
+				ledgerID: ledgerID, user: owner, limit: 3, beforeID: &beforeID,
+			})
+			So(err, ShouldBeNil)
+			So(secondPage, ShouldHaveLength, 2)
+			So(secondPage[0].AuditID, ShouldBeLessThan, beforeID)
+		})
+
+		Convey("It should not return entries to other members", func() {
+			_, err := svc.processLedgerAuditQuery(ctx, &ledgerAuditQuery{ledgerID: ledgerID, user: member})
+			So(err, ShouldEqual, errNotLedgerOwner)
+		})
+	})
+}
@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"ledger.api/pkg/server"
+	"ledger.api/pkg/users"
+)
+
+// CreateRoutes - Register audit related routes
+func CreateRoutes(svc QueryService, ledgerAccess server.LedgerAccessChecker) server.Routes {
+	return func(router *server.Router) {
+		router.
+			Group(
+				"/v2/ledgers/:ledgerID/audit",
+				server.WithScopes("read:ledgers"),
+				server.WithMiddleware(server.CreateLedgerAccessMiddlewareFunc(ledgerAccess)),
+			).
+			GET("", createLedgerAuditQueryHandler(svc))
+	}
+}
+
+// queryHTTPError maps query errors to http errors
+func queryHTTPError(err error) error {
+	if err == errNotLedgerOwner {
+		return *server.ForbiddenError(err.Error())
+	}
+	return err
+}
+
+func parseLedgerAuditQuery(req *http.Request, query *ledgerAuditQuery) error {
+	if val := req.URL.Query().Get("limit"); val != "" {
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit <= 0 || limit > maxLimit {
+			return *server.BadRequestError(fmt.Sprintf("Parameter 'limit' should be an integer between 1 and %v", maxLimit))
+		}
+		query.limit = limit
+	}
+	if val := req.URL.Query().Get("beforeID"); val != "" {
+		beforeID, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return *server.BadRequestError("Parameter 'beforeID' should be an integer")
+		}
+		query.beforeID = &beforeID
+	}
+	return nil
+}
+
+func createLedgerAuditQueryHandler(svc QueryService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		query := ledgerAuditQuery{
+			ledgerID: h.Params.ByName("ledgerID"),
+			user:     users.FromContext(req.Context()),
+		}
+		if err := parseLedgerAuditQuery(req, &query); err != nil {
+			return nil, err
+		}
+		result, err := svc.processLedgerAuditQuery(req.Context(), &query)
+		if err != nil {
+			return nil, queryHTTPError(err)
+		}
+		return h.Response(result), nil
+	}
+}
@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/server"
+	"ledger.api/pkg/users"
+)
+
+type mockQueryService struct {
+	queries []*ledgerAuditQuery
+	err     error
+}
+
+func (svc *mockQueryService) processLedgerAuditQuery(ctx context.Context, query *ledgerAuditQuery) ([]entryDTO, error) {
+	svc.queries = append(svc.queries, query)
+	return []entryDTO{}, svc.err
+}
+
+type mockLedgerAccessChecker struct {
+	accessibleLedgers map[string]bool
+}
+
+func (checker *mockLedgerAccessChecker) HasLedgerAccess(ctx context.Context, user *users.User, ledgerID string) (bool, error) {
+	return checker.accessibleLedgers[ledgerID], nil
+}
+
+func TestRoutes(t *testing.T) {
+	Convey("Given audit routes", t, func() {
+		ledgerID := uuid.NewV4().String()
+		svc := &mockQueryService{}
+		handler := server.
+			CreateHTTPApp(server.HTTPAppConfig{Env: "test"}).
+			RegisterRoutes(CreateRoutes(svc, &mockLedgerAccessChecker{accessibleLedgers: map[string]bool{ledgerID: true}})).
+			CreateHandler()
+		user := ldtesting.NewUser()
+		serve := func(path string) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, ldtesting.NewRequest("GET", path,
+				ldtesting.WithScopeClaim("read:ledgers"), ldtesting.WithUser(user)))
+			return recorder
+		}
+		path := fmt.Sprintf("/v2/ledgers/%v/audit", ledgerID)
+
+		Convey("It should query ledger audit trail", func() {
+			recorder := serve(path + "?limit=10&beforeID=100")
+			So(recorder.Code, ShouldEqual, 200)
+			So(svc.queries, ShouldHaveLength, 1)
+			So(svc.queries[0].ledgerID, ShouldEqual, ledgerID)
+			So(svc.queries[0].user, ShouldEqual, user)
+			So(svc.queries[0].limit, ShouldEqual, 10)
+			So(*svc.queries[0].beforeID, ShouldEqual, 100)
+		})
+
+		Convey("It should reject invalid params", func() {
+			So(serve(path+"?limit=0").Code, ShouldEqual, 400)
+			So(serve(path+"?limit=5000").Code, ShouldEqual, 400)
+			So(serve(path+"?beforeID=last").Code, ShouldEqual, 400)
+			So(svc.queries, ShouldBeEmpty)
+		})
+
+		Convey("It should respond with 403 if user is not the owner", func() {
+			svc.err = errNotLedgerOwner
+			So(serve(path).Code, ShouldEqual, 403)
+		})
+
+		Convey("It should respond with 404 if ledger is not accessible", func() {
+			So(serve(fmt.Sprintf("/v2/ledgers/%v/audit", uuid.NewV4().String())).Code, ShouldEqual, 404)
+		})
+	})
+}
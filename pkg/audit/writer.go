@@ -0,0 +1,221 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
+)
+
+// Entry - an authenticated API call
+type Entry struct {
+	OccurredAt time.Time
+	Subject    string
+	Scopes     string
+	RequestID  string
+	Method     string
+
+	// Route is a pattern of the route that served the call, e.g /v2/ledgers/:ledgerID/tags
+	Route string
+
+	// LedgerID is a ledgerID param of the route. Empty if the route has no such param
+	LedgerID string
+	Status   int
+}
+
+// WriterOptions - options of the audit writer
+type WriterOptions struct {
+	// BufferSize is a max number of entries waiting to be written.
+	// Entries are dropped if the buffer is full
+	BufferSize int
+
+	// BatchSize is a max number of entries inserted at once
+	BatchSize int
+
+	// FlushInterval is a max time an entry waits in the buffer
+	FlushInterval time.Duration
+
+	// Tracer traces inserts of batches if provided. Batches include entries
+	// of different requests so each insert starts its own trace
+	Tracer *tracing.Tracer
+}
+
+// DefaultWriterOptions returns options suitable for most cases
+func DefaultWriterOptions() WriterOptions {
+	return WriterOptions{
+		BufferSize:    4096,
+		BatchSize:     100,
+		FlushInterval: time.Second,
+	}
+}
+
+// Writer - writes audit entries to the db asynchronously so requests are not
+// slowed down by the audit. Entries are inserted in batches
+type Writer struct {
+	db      *gorm.DB
+	logger  logging.Logger
+	opts    WriterOptions
+	entries chan Entry
+	done    chan struct{}
+
+	mu       sync.Mutex
+	stopped  bool
+	dropped  int
+	stopOnce sync.Once
+}
+
+// CreateWriter creates a writer and starts writing entries in background.
+// Shutdown should be called to write pending entries before exit
+func CreateWriter(db *gorm.DB, logger logging.Logger, opts WriterOptions) *Writer {
+	defaults := DefaultWriterOptions()
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaults.BufferSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaults.BatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaults.FlushInterval
+	}
+	writer := &Writer{
+		db:      db,
+		logger:  logger,
+		opts:    opts,
+		entries: make(chan Entry, opts.BufferSize),
+		done:    make(chan struct{}),
+	}
+	go writer.run()
+	return writer
+}
+
+// Record queues the entry. It never blocks, the entry is dropped
+// if the buffer is full or the writer is stopped
+func (writer *Writer) Record(entry Entry) {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	if writer.stopped {
+		writer.dropped++
+		return
+	}
+	select {
+	case writer.entries <- entry:
+	default:
+		writer.dropped++
+		writer.logger.Warnf("Audit buffer is full. Dropping entry of request %v", entry.RequestID)
+	}
+}
+
+// Dropped returns a number of entries dropped or failed to be written so far
+func (writer *Writer) Dropped() int {
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	return writer.dropped
+}
+
+// Shutdown writes pending entries and stops the writer
+func (writer *Writer) Shutdown() error {
+	writer.stopOnce.Do(func() {
+		writer.mu.Lock()
+		writer.stopped = true
+		close(writer.entries)
+		writer.mu.Unlock()
+	})
+	<-writer.done
+	return nil
+}
+
+func (writer *Writer) run() {
+	defer close(writer.done)
+	ticker := time.NewTicker(writer.opts.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]Entry, 0, writer.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		writer.write(batch)
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case entry, ok := <-writer.entries:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= writer.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// write inserts the batch. Entries are inserted one by one if the batch fails
+// so a single malformed entry does not get entries of other calls lost
+func (writer *Writer) write(batch []Entry) {
+	err := writer.insert(context.Background(), batch)
+	if err == nil {
+		return
+	}
+	if len(batch) > 1 {
+		writer.logger.WithError(err).Warnf("Failed to write %v audit entries at once. Writing them one by one", len(batch))
+		for _, entry := range batch {
+			if err := writer.insert(context.Background(), []Entry{entry}); err != nil {
+				writer.failed(entry, err)
+			}
+		}
+		return
+	}
+	writer.failed(batch[0], err)
+}
+
+// failed counts the entry that could not be written as dropped
+func (writer *Writer) failed(entry Entry, err error) {
+	writer.logger.WithError(err).Errorf("Failed to write audit entry of request %v", entry.RequestID)
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	writer.dropped++
+}
+
+func (writer *Writer) insert(ctx context.Context, entries []Entry) error {
+	if writer.opts.Tracer != nil {
+		var span trace.Span
+		ctx, span = writer.opts.Tracer.StartSpan(ctx, "audit insert")
+		span.SetAttributes(attribute.Int("audit.entries", len(entries)))
+		defer span.End()
+	}
+	var query bytes.Buffer
+	query.WriteString(`INSERT INTO audit_log(
+		occurred_at, subject, scopes, request_id, method, route, ledger_id, status
+	) VALUES `)
+	args := make([]interface{}, 0, len(entries)*8)
+	for i, entry := range entries {
+		if i > 0 {
+			query.WriteString(",")
+		}
+		query.WriteString("(?,?,?,?,?,?,?,?)")
+		var ledgerID interface{}
+		if entry.LedgerID != "" {
+			ledgerID = entry.LedgerID
+		}
+		args = append(args,
+			entry.OccurredAt.UTC(), entry.Subject, entry.Scopes, entry.RequestID,
+			entry.Method, entry.Route, ledgerID, entry.Status,
+		)
+	}
+	return tracing.Exec(tracing.DB(ctx, writer.db), query.String(), args...).Error
+}
+
+// Recorder - records audit entries. Implemented by Writer
+type Recorder interface {
+	Record(entry Entry)
+}
@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icrowley/fake"
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/logging"
+)
+
+func TestWriter(t *testing.T) {
+	Convey("Given audit writer", t, func() {
+		newEntry := func(ledgerID string) Entry {
+			return Entry{
+				OccurredAt: time.Now(),
+				Subject:    "auth0|" + fake.CharactersN(24),
+				Scopes:     "read:ledgers",
+				RequestID:  uuid.NewV4().String(),
+				Method:     "GET",
+				Route:      "/v2/ledgers/:ledgerID/tags",
+				LedgerID:   ledgerID,
+				Status:     200,
+			}
+		}
+		countEntries := func(ledgerID string) int {
+			var count int
+			So(DB.Table("audit_log").Where("ledger_id = ?", ledgerID).Count(&count).Error, ShouldBeNil)
+			return count
+		}
+
+		Convey("It should write pending entries on shutdown", func() {
+			writer := CreateWriter(DB, logging.NewTestLogger(), WriterOptions{BatchSize: 2, FlushInterval: time.Hour})
+			ledgerID := uuid.NewV4().String()
+			for i := 0; i < 5; i++ {
+				writer.Record(newEntry(ledgerID))
+			}
+			writer.Record(newEntry(""))
+			So(writer.Shutdown(), ShouldBeNil)
+			So(countEntries(ledgerID), ShouldEqual, 5)
+			So(writer.Dropped(), ShouldEqual, 0)
+		})
+
+		Convey("It should write entries periodically", func() {
+			writer := CreateWriter(DB, logging.NewTestLogger(), WriterOptions{FlushInterval: 10 * time.Millisecond})
+			defer writer.Shutdown()
+			ledgerID := uuid.NewV4().String()
+			writer.Record(newEntry(ledgerID))
+			So(func() int {
+				for i := 0; i < 100 && countEntries(ledgerID) == 0; i++ {
+					time.Sleep(10 * time.Millisecond)
+				}
+				return countEntries(ledgerID)
+			}(), ShouldEqual, 1)
+		})
+
+		Convey("It should write other entries of the batch if an entry can not be written", func() {
+			writer := CreateWriter(DB, logging.NewTestLogger(), WriterOptions{BatchSize: 10, FlushInterval: time.Hour})
+			ledgerID := uuid.NewV4().String()
+			oversized := newEntry(ledgerID)
+			oversized.RequestID = strings.Repeat("r", 300)
+			writer.Record(newEntry(ledgerID))
+			writer.Record(oversized)
+			writer.Record(newEntry(ledgerID))
+			So(writer.Shutdown(), ShouldBeNil)
+			So(countEntries(ledgerID), ShouldEqual, 2)
+			So(writer.Dropped(), ShouldEqual, 1)
+		})
+
+		Convey("It should drop entries recorded after shutdown", func() {
+			writer := CreateWriter(DB, logging.NewTestLogger(), DefaultWriterOptions())
+			writer.Shutdown()
+			writer.Record(newEntry(uuid.NewV4().String()))
+			So(writer.Dropped(), ShouldEqual, 1)
+		})
+
+		Convey("It should not allow changing entries", func() {
+			ledgerID := uuid.NewV4().String()
+			writer := CreateWriter(DB, logging.NewTestLogger(), DefaultWriterOptions())
+			writer.Record(newEntry(ledgerID))
+			writer.Shutdown()
+			So(DB.Exec("UPDATE audit_log SET status = 500 WHERE ledger_id = ?", ledgerID).Error, ShouldNotBeNil)
+			So(DB.Exec("DELETE FROM audit_log WHERE ledger_id = ?", ledgerID).Error, ShouldNotBeNil)
+		})
+	})
+}
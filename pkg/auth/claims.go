@@ -14,6 +14,18 @@ const ledgerClaimsKey contextKeys = "ledgerClaims"
 type LedgerClaims struct {
 	*jwt.Claims
 	Scope string `json:"scope"`
+
+	// Email and EmailVerified are present if the token has been issued with the email scope
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+}
+
+// VerifiedEmail returns the email of the user or empty string if it has not been verified
+func (claims *LedgerClaims) VerifiedEmail() string {
+	if claims == nil || !claims.EmailVerified {
+		return ""
+	}
+	return claims.Email
 }
 
 // ClaimsFromContext returns an instance of LedgerClaims from context
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	auth0 "github.com/auth0-community/go-auth0"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// DefaultJWKSRefreshInterval is a min time between reloads of the key set
+const DefaultJWKSRefreshInterval = time.Minute
+
+// ErrUnknownKey - the token is signed with a key that is not in the key set
+var ErrUnknownKey = errors.New("Token is signed with unknown key")
+
+// KeySource - loads a JSON web key set, e.g from the issuer or a local file
+type KeySource func() (*jose.JSONWebKeySet, error)
+
+// CreateURLKeySource creates a source that downloads the key set from given url,
+// e.g https://ledger-staging.eu.auth0.com/.well-known/jwks.json
+func CreateURLKeySource(url string, client *http.Client) KeySource {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return func() (*jose.JSONWebKeySet, error) {
+		res, err := client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Failed to download JWKS from %v: status %v", url, res.StatusCode)
+		}
+		var keySet jose.JSONWebKeySet
+		if err := json.NewDecoder(res.Body).Decode(&keySet); err != nil {
+			return nil, fmt.Errorf("Failed to parse JWKS from %v: %v", url, err)
+		}
+		return &keySet, nil
+	}
+}
+
+// CreateFileKeySource creates a source that reads the key set from given file.
+// If the path is a directory then keys of all *.json files of it are merged
+func CreateFileKeySource(path string) KeySource {
+	return func() (*jose.JSONWebKeySet, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		files := []string{path}
+		if info.IsDir() {
+			if files, err = filepath.Glob(filepath.Join(path, "*.json")); err != nil {
+				return nil, err
+			}
+			sort.Strings(files)
+		}
+		result := jose.JSONWebKeySet{}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			var keySet jose.JSONWebKeySet
+			if err := json.Unmarshal(data, &keySet); err != nil {
+				return nil, fmt.Errorf("Failed to parse JWKS file %v: %v", file, err)
+			}
+			result.Keys = append(result.Keys, keySet.Keys...)
+		}
+		return &result, nil
+	}
+}
+
+// JWKSCache - caches public keys of the key set by key id. The key set is reloaded if a
+// token is signed with a key that is not cached (e.g keys have been rotated). Reloads are
+// rate limited so tokens with bogus key ids can not make it hammer the source.
+// Cached keys are served while the key set is being reloaded
+type JWKSCache struct {
+	source          KeySource
+	refreshInterval time.Duration
+	now             func() time.Time
+
+	// refreshMu makes concurrent lookups of unknown keys wait for a single reload
+	refreshMu sync.Mutex
+
+	mu          sync.RWMutex
+	keys        map[string]jose.JSONWebKey
+	refreshedAt time.Time
+	lastError   error
+}
+
+// CreateJWKSCache creates an empty cache. Keys are loaded on first use unless Load is called.
+// The key set is reloaded at most once per refreshInterval
+func CreateJWKSCache(source KeySource, refreshInterval time.Duration) *JWKSCache {
+	return &JWKSCache{
+		source:          source,
+		refreshInterval: refreshInterval,
+		now:             time.Now,
+		keys:            make(map[string]jose.JSONWebKey),
+	}
+}
+
+// Load loads the key set. Intended to be called on startup to make sure keys are available
+func (cache *JWKSCache) Load() error {
+	cache.refreshMu.Lock()
+	defer cache.refreshMu.Unlock()
+	return cache.refresh()
+}
+
+// refresh replaces cached keys with keys of the source. Keys are kept if the source fails.
+// The source is called without holding the lock so cached keys can be served meanwhile
+func (cache *JWKSCache) refresh() error {
+	cache.mu.Lock()
+	cache.refreshedAt = cache.now()
+	cache.mu.Unlock()
+
+	keys, err := cache.loadKeys()
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.lastError = err
+	if err != nil {
+		return err
+	}
+	cache.keys = keys
+	return nil
+}
+
+// loadKeys returns public signing keys of the source by key id
+func (cache *JWKSCache) loadKeys() (map[string]jose.JSONWebKey, error) {
+	keySet, err := cache.source()
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]jose.JSONWebKey, len(keySet.Keys))
+	for _, key := range keySet.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		// Private keys may be in the set (e.g local files) but only public parts are used
+		public := key.Public()
+		if !public.Valid() {
+			continue
+		}
+		keys[key.KeyID] = public
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no signing keys")
+	}
+	return keys, nil
+}
+
+// refreshedRecently returns true if the key set may not be reloaded yet. Should be called under the lock
+func (cache *JWKSCache) refreshedRecently() bool {
+	return !cache.refreshedAt.IsZero() && cache.now().Sub(cache.refreshedAt) < cache.refreshInterval
+}
+
+// lookup returns a cached key and whether the key set may be reloaded to find it
+func (cache *JWKSCache) lookup(keyID string) (key jose.JSONWebKey, found bool, canRefresh bool) {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	if key, ok := cache.keys[keyID]; ok {
+		return key, true, false
+	}
+	return jose.JSONWebKey{}, false, !cache.refreshedRecently()
+}
+
+// status returns an error of the last reload and whether the key set should be reloaded to check it
+func (cache *JWKSCache) status() (lastError error, shouldRefresh bool) {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	if cache.refreshedAt.IsZero() {
+		return nil, true
+	}
+	return cache.lastError, cache.lastError != nil && !cache.refreshedRecently()
+}
+
+// Check reports an error of the last reload of the key set, so readiness reflects keys tokens
+// are validated with. The key set is loaded if it has not been loaded yet. Failed reload is
+// retried at most once per refreshInterval so the cache recovers once the source is available
+func (cache *JWKSCache) Check(ctx context.Context) error {
+	if err, shouldRefresh := cache.status(); !shouldRefresh {
+		return err
+	}
+	cache.refreshMu.Lock()
+	defer cache.refreshMu.Unlock()
+	if err, shouldRefresh := cache.status(); !shouldRefresh {
+		return err
+	}
+	return cache.refresh()
+}
+
+// GetKey returns a public key with given id. The key set is reloaded if the key is not
+// cached and it has not been reloaded recently. Returns ErrUnknownKey if there's no such key
+func (cache *JWKSCache) GetKey(keyID string) (jose.JSONWebKey, error) {
+	if key, found, canRefresh := cache.lookup(keyID); found {
+		return key, nil
+	} else if !canRefresh {
+		return jose.JSONWebKey{}, ErrUnknownKey
+	}
+
+	cache.refreshMu.Lock()
+	defer cache.refreshMu.Unlock()
+
+	// The key set may have been reloaded while waiting for other lookup
+	if key, found, canRefresh := cache.lookup(keyID); found {
+		return key, nil
+	} else if !canRefresh {
+		return jose.JSONWebKey{}, ErrUnknownKey
+	}
+	if err := cache.refresh(); err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	if key, found, _ := cache.lookup(keyID); found {
+		return key, nil
+	}
+	return jose.JSONWebKey{}, ErrUnknownKey
+}
+
+// GetSecret returns a key the token of the request is signed with
+func (cache *JWKSCache) GetSecret(r *http.Request) (interface{}, error) {
+	token, err := auth0.FromHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(token.Headers) < 1 {
+		return nil, auth0.ErrNoJWTHeaders
+	}
+	return cache.GetKey(token.Headers[0].KeyID)
+}
+
+// CreateJWKSValidator returns validator instance configured to use
+// RS256 jwt tokens signed with keys of the cache
+func CreateJWKSValidator(cache *JWKSCache, iss string, aud string) RequestValidator {
+	configuration := auth0.NewConfiguration(cache, []string{aud}, iss, jose.RS256)
+	return auth0.NewValidator(configuration, nil)
+}
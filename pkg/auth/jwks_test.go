@@ -0,0 +1,295 @@
+package auth_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	jose "gopkg.in/square/go-jose.v2"
+	"ledger.api/pkg/auth"
+	"ledger.api/pkg/internal/ldtesting"
+)
+
+const (
+	testIss = "https://ledger-test.local/"
+	testAud = "https://test.api.my-ledger.com"
+)
+
+func newTokenRequest(token string) *http.Request {
+	req, _ := http.NewRequest("GET", "/v1/ledgers", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func validateToken(validator auth.RequestValidator, token string) (*auth.LedgerClaims, error) {
+	req := newTokenRequest(token)
+	jwtToken, err := validator.ValidateRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	claims := auth.LedgerClaims{}
+	if err := validator.Claims(req, jwtToken, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func TestJWKSValidator(t *testing.T) {
+	Convey("Given a validator with keys of the issuer served over http", t, func() {
+		issuer := ldtesting.NewTestIssuer(testIss, testAud)
+		downloads := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			downloads++
+			issuer.ServeHTTP(w, req)
+		}))
+		defer server.Close()
+
+		newValidator := func(refreshInterval time.Duration) auth.RequestValidator {
+			cache := auth.CreateJWKSCache(auth.CreateURLKeySource(server.URL, nil), refreshInterval)
+			return auth.CreateJWKSValidator(cache, testIss, testAud)
+		}
+
+		Convey("It should accept tokens of the issuer", func() {
+			validator := newValidator(time.Hour)
+			token, err := issuer.MintLedgerClaims("auth0|user-1", "read:ledgers")
+			So(err, ShouldBeNil)
+			claims, err := validateToken(validator, token)
+			So(err, ShouldBeNil)
+			So(claims.Subject, ShouldEqual, "auth0|user-1")
+			So(claims.Scope, ShouldEqual, "read:ledgers")
+
+			Convey("It should not download keys again", func() {
+				_, err := validateToken(validator, token)
+				So(err, ShouldBeNil)
+				So(downloads, ShouldEqual, 1)
+			})
+		})
+
+		Convey("It should reject tokens of other audience", func() {
+			token, err := issuer.MintLedgerClaims("auth0|user-1", "read:ledgers")
+			So(err, ShouldBeNil)
+			_, err = validateToken(auth.CreateJWKSValidator(
+				auth.CreateJWKSCache(auth.CreateURLKeySource(server.URL, nil), time.Hour),
+				testIss, "https://other.api",
+			), token)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("It should reject tokens signed with unknown keys", func() {
+			other := ldtesting.NewTestIssuer(testIss, testAud)
+			token, err := other.MintLedgerClaims("auth0|user-1", "read:ledgers")
+			So(err, ShouldBeNil)
+			_, err = validateToken(newValidator(time.Hour), token)
+			So(err, ShouldEqual, auth.ErrUnknownKey)
+		})
+
+		Convey("When keys of the issuer are rotated", func() {
+			validator := newValidator(0)
+			token, err := issuer.MintLedgerClaims("auth0|user-1", "read:ledgers")
+			So(err, ShouldBeNil)
+			_, err = validateToken(validator, token)
+			So(err, ShouldBeNil)
+			issuer.Rotate(false)
+
+			Convey("It should reload keys to accept tokens signed with the new key", func() {
+				token, err := issuer.MintLedgerClaims("auth0|user-1", "read:ledgers")
+				So(err, ShouldBeNil)
+				_, err = validateToken(validator, token)
+				So(err, ShouldBeNil)
+				So(downloads, ShouldEqual, 2)
+			})
+
+			Convey("It should reject tokens signed with removed keys once reloaded", func() {
+				newToken, err := issuer.MintLedgerClaims("auth0|user-1", "read:ledgers")
+				So(err, ShouldBeNil)
+				_, err = validateToken(validator, newToken)
+				So(err, ShouldBeNil)
+				_, err = validateToken(validator, token)
+				So(err, ShouldEqual, auth.ErrUnknownKey)
+			})
+		})
+
+		Convey("When keys of the issuer are rotated keeping the previous key", func() {
+			validator := newValidator(0)
+			oldToken, err := issuer.MintLedgerClaims("auth0|user-1", "read:ledgers")
+			So(err, ShouldBeNil)
+			issuer.Rotate(true)
+			newToken, err := issuer.MintLedgerClaims("auth0|user-1", "read:ledgers")
+			So(err, ShouldBeNil)
+
+			Convey("It should accept tokens signed with both keys", func() {
+				_, err := validateToken(validator, newToken)
+				So(err, ShouldBeNil)
+				_, err = validateToken(validator, oldToken)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When keys have been reloaded recently", func() {
+			validator := newValidator(time.Hour)
+			token, err := issuer.MintLedgerClaims("auth0|user-1", "read:ledgers")
+			So(err, ShouldBeNil)
+			_, err = validateToken(validator, token)
+			So(err, ShouldBeNil)
+			issuer.Rotate(false)
+
+			Convey("It should not reload keys on unknown key id", func() {
+				token, err := issuer.MintLedgerClaims("auth0|user-1", "read:ledgers")
+				So(err, ShouldBeNil)
+				_, err = validateToken(validator, token)
+				So(err, ShouldEqual, auth.ErrUnknownKey)
+				_, err = validateToken(validator, token)
+				So(err, ShouldEqual, auth.ErrUnknownKey)
+				So(downloads, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When keys are being reloaded", func() {
+			reloading := make(chan struct{})
+			release := make(chan struct{})
+			loads := 0
+			source := auth.CreateURLKeySource(server.URL, nil)
+			cache := auth.CreateJWKSCache(func() (*jose.JSONWebKeySet, error) {
+				loads++
+				if loads > 1 {
+					close(reloading)
+					<-release
+				}
+				return source()
+			}, 0)
+			validator := auth.CreateJWKSValidator(cache, testIss, testAud)
+			token, err := issuer.MintLedgerClaims("auth0|user-1", "read:ledgers")
+			So(err, ShouldBeNil)
+			_, err = validateToken(validator, token)
+			So(err, ShouldBeNil)
+
+			unknownToken, err := ldtesting.NewTestIssuer(testIss, testAud).MintLedgerClaims("auth0|user-1", "read:ledgers")
+			So(err, ShouldBeNil)
+			done := make(chan error)
+			go func() {
+				_, err := validateToken(validator, unknownToken)
+				done <- err
+			}()
+			<-reloading
+
+			Convey("It should accept tokens signed with cached keys meanwhile", func() {
+				_, err := validateToken(validator, token)
+				So(err, ShouldBeNil)
+				close(release)
+				So(<-done, ShouldEqual, auth.ErrUnknownKey)
+			})
+		})
+
+		Convey("It should fail if keys can not be downloaded", func() {
+			server.Close()
+			token, err := issuer.MintLedgerClaims("auth0|user-1", "read:ledgers")
+			So(err, ShouldBeNil)
+			_, err = validateToken(newValidator(time.Hour), token)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestJWKSCacheCheck(t *testing.T) {
+	Convey("Given a cache of keys of the issuer served over http", t, func() {
+		issuer := ldtesting.NewTestIssuer(testIss, testAud)
+		downloads := 0
+		available := true
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			downloads++
+			if !available {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			issuer.ServeHTTP(w, req)
+		}))
+		defer server.Close()
+		source := auth.CreateURLKeySource(server.URL, nil)
+
+		Convey("It should load keys on first check", func() {
+			cache := auth.CreateJWKSCache(source, time.Hour)
+			So(cache.Check(context.Background()), ShouldBeNil)
+			_, err := cache.GetKey(issuer.KeyID())
+			So(err, ShouldBeNil)
+			So(cache.Check(context.Background()), ShouldBeNil)
+			So(downloads, ShouldEqual, 1)
+		})
+
+		Convey("When keys failed to be loaded by a token lookup", func() {
+			cache := auth.CreateJWKSCache(source, time.Hour)
+			available = false
+			_, err := cache.GetKey(issuer.KeyID())
+			So(err, ShouldNotBeNil)
+
+			Convey("It should report the error without loading keys again", func() {
+				So(cache.Check(context.Background()), ShouldNotBeNil)
+				So(downloads, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the source recovers", func() {
+			cache := auth.CreateJWKSCache(source, 0)
+			available = false
+			So(cache.Check(context.Background()), ShouldNotBeNil)
+			available = true
+
+			Convey("It should reload keys and report ok", func() {
+				So(cache.Check(context.Background()), ShouldBeNil)
+				_, err := cache.GetKey(issuer.KeyID())
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestFileKeySource(t *testing.T) {
+	Convey("Given JWKS files", t, func() {
+		dir, err := ioutil.TempDir("", "ledger-jwks")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		first := ldtesting.NewTestIssuer(testIss, testAud)
+		second := ldtesting.NewTestIssuer(testIss, testAud)
+		So(first.WriteJWKS(filepath.Join(dir, "first.json")), ShouldBeNil)
+		So(second.WriteJWKS(filepath.Join(dir, "second.json")), ShouldBeNil)
+
+		Convey("It should load keys of a single file", func() {
+			cache := auth.CreateJWKSCache(auth.CreateFileKeySource(filepath.Join(dir, "first.json")), time.Hour)
+			So(cache.Load(), ShouldBeNil)
+			token, err := first.MintLedgerClaims("auth0|user-1", "read:ledgers")
+			So(err, ShouldBeNil)
+			_, err = validateToken(auth.CreateJWKSValidator(cache, testIss, testAud), token)
+			So(err, ShouldBeNil)
+			_, err = cache.GetKey(second.KeyID())
+			So(err, ShouldEqual, auth.ErrUnknownKey)
+		})
+
+		Convey("It should merge keys of all files of a directory", func() {
+			cache := auth.CreateJWKSCache(auth.CreateFileKeySource(dir), time.Hour)
+			So(cache.Load(), ShouldBeNil)
+			for _, issuer := range []*ldtesting.TestIssuer{first, second} {
+				token, err := issuer.MintLedgerClaims("auth0|user-1", "read:ledgers")
+				So(err, ShouldBeNil)
+				_, err = validateToken(auth.CreateJWKSValidator(cache, testIss, testAud), token)
+				So(err, ShouldBeNil)
+			}
+		})
+
+		Convey("It should fail to load missing or malformed files", func() {
+			So(auth.CreateJWKSCache(auth.CreateFileKeySource(filepath.Join(dir, "missing.json")), time.Hour).Load(), ShouldNotBeNil)
+			So(ioutil.WriteFile(filepath.Join(dir, "first.json"), []byte("not a jwks"), 0644), ShouldBeNil)
+			So(auth.CreateJWKSCache(auth.CreateFileKeySource(dir), time.Hour).Load(), ShouldNotBeNil)
+		})
+
+		Convey("It should fail to load key sets without signing keys", func() {
+			empty := filepath.Join(dir, "empty.json")
+			So(ioutil.WriteFile(empty, []byte(`{"keys":[]}`), 0644), ShouldBeNil)
+			So(auth.CreateJWKSCache(auth.CreateFileKeySource(empty), time.Hour).Load(), ShouldNotBeNil)
+		})
+	})
+}
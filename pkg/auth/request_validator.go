@@ -15,12 +15,14 @@ type RequestValidator interface {
 }
 
 // CreateAuth0Validator returns validator instance configured to use
-// jwt tokens issued by auth0
+// jwt tokens issued by auth0. Keys are downloaded from the JWKS endpoint of the issuer
 func CreateAuth0Validator(iss string, aud string) RequestValidator {
-	client := auth0.NewJWKClient(auth0.JWKClientOptions{URI: iss + ".well-known/jwks.json"}, nil)
-	configuration := auth0.NewConfiguration(client, []string{aud}, iss, jose.RS256)
-	validator := auth0.NewValidator(configuration, nil)
-	return validator
+	return CreateJWKSValidator(CreateAuth0JWKSCache(iss), iss, aud)
+}
+
+// CreateAuth0JWKSCache creates a cache of keys downloaded from the JWKS endpoint of the issuer
+func CreateAuth0JWKSCache(iss string) *JWKSCache {
+	return CreateJWKSCache(CreateURLKeySource(iss+".well-known/jwks.json", nil), DefaultJWKSRefreshInterval)
 }
 
 // CreateHS256Validator returns validator instance configured to use
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// wildcard matches the rest of a scope, e.g read:* matches read:ledgers and read:tags
+const wildcard = "*"
+
+// Scopes returns scopes of the scope claim
+func (claims *LedgerClaims) Scopes() []string {
+	return strings.Fields(claims.Scope)
+}
+
+// GrantedScopes - scopes granted to a caller, including implied ones.
+// Granted scopes may include wildcards
+type GrantedScopes map[string]bool
+
+// Has returns true if the scope is granted explicitly or via wildcard
+func (granted GrantedScopes) Has(scope string) bool {
+	if granted[scope] {
+		return true
+	}
+	for grantedScope := range granted {
+		if strings.HasSuffix(grantedScope, wildcard) &&
+			strings.HasPrefix(scope, strings.TrimSuffix(grantedScope, wildcard)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopeRequirement - scopes a caller should have. All of AllOf scopes and
+// at least one scope of each AnyOf group are required
+type ScopeRequirement struct {
+	AllOf []string
+	AnyOf [][]string
+}
+
+// AllScopes returns a requirement of all given scopes
+func AllScopes(scopes ...string) ScopeRequirement {
+	return ScopeRequirement{AllOf: append([]string{}, scopes...)}
+}
+
+// AnyScope returns a requirement of at least one of given scopes
+func AnyScope(scopes ...string) ScopeRequirement {
+	return ScopeRequirement{AnyOf: [][]string{append([]string{}, scopes...)}}
+}
+
+// And returns a requirement of both this and other requirements
+func (requirement ScopeRequirement) And(other ScopeRequirement) ScopeRequirement {
+	result := ScopeRequirement{
+		AllOf: make([]string, 0, len(requirement.AllOf)+len(other.AllOf)),
+		AnyOf: make([][]string, 0, len(requirement.AnyOf)+len(other.AnyOf)),
+	}
+	result.AllOf = append(append(result.AllOf, requirement.AllOf...), other.AllOf...)
+	result.AnyOf = append(append(result.AnyOf, requirement.AnyOf...), other.AnyOf...)
+	return result
+}
+
+// IsEmpty returns true if no scopes are required
+func (requirement ScopeRequirement) IsEmpty() bool {
+	return len(requirement.AllOf) == 0 && len(requirement.AnyOf) == 0
+}
+
+// Describe returns required scopes in a printable form. Scopes of any of groups are joined with |
+func (requirement ScopeRequirement) Describe() []string {
+	result := append([]string{}, requirement.AllOf...)
+	for _, group := range requirement.AnyOf {
+		result = append(result, strings.Join(group, "|"))
+	}
+	return result
+}
+
+// MissingScopes - explains why a requirement is not satisfied
+type MissingScopes struct {
+	// AllOf are required scopes that are not granted
+	AllOf []string `json:"allOf,omitempty"`
+
+	// AnyOf are groups none of scopes of which are granted
+	AnyOf [][]string `json:"anyOf,omitempty"`
+}
+
+func (missing *MissingScopes) String() string {
+	return strings.Join(ScopeRequirement{AllOf: missing.AllOf, AnyOf: missing.AnyOf}.Describe(), " ")
+}
+
+// scopeImplication - granted scopes matching the pattern imply other scopes.
+// If the pattern ends with a wildcard, the wildcard of implied scopes is replaced
+// with a part of the granted scope it matched, so write:* implying read:*
+// makes write:tags imply read:tags
+type scopeImplication struct {
+	pattern string
+	implies []string
+}
+
+// ScopePolicy - rules that decide which scopes a caller has
+type ScopePolicy struct {
+	implications []scopeImplication
+}
+
+// ScopePolicyConfig - a JSON representation of the policy, e.g:
+// {"implications": {"write:*": ["read:*"], "admin": ["read:*", "write:*"]}}
+type ScopePolicyConfig struct {
+	Implications map[string][]string `json:"implications"`
+}
+
+func validateScopePattern(pattern string) error {
+	if pattern == "" || strings.ContainsAny(pattern, " \t") {
+		return fmt.Errorf("Invalid scope: %q", pattern)
+	}
+	if index := strings.Index(pattern, wildcard); index >= 0 && index != len(pattern)-1 {
+		return fmt.Errorf("Wildcard is only allowed at the end of scope: %v", pattern)
+	}
+	return nil
+}
+
+// CreateScopePolicy creates a policy from the config
+func CreateScopePolicy(cfg ScopePolicyConfig) (*ScopePolicy, error) {
+	patterns := make([]string, 0, len(cfg.Implications))
+	for pattern := range cfg.Implications {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	policy := &ScopePolicy{}
+	for _, pattern := range patterns {
+		if err := validateScopePattern(pattern); err != nil {
+			return nil, err
+		}
+		for _, implied := range cfg.Implications[pattern] {
+			if err := validateScopePattern(implied); err != nil {
+				return nil, err
+			}
+		}
+		policy.implications = append(policy.implications, scopeImplication{
+			pattern: pattern,
+			implies: cfg.Implications[pattern],
+		})
+	}
+	return policy, nil
+}
+
+// DefaultScopePolicy returns a policy without implications so only
+// explicitly granted scopes (including wildcards) are granted
+func DefaultScopePolicy() *ScopePolicy {
+	return &ScopePolicy{}
+}
+
+// LoadScopePolicy loads a policy from the JSON file
+func LoadScopePolicy(path string) (*ScopePolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg ScopePolicyConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("Failed to parse scope policy %v: %v", path, err)
+	}
+	return CreateScopePolicy(cfg)
+}
+
+// implied returns scopes implied by the granted scope
+func (implication *scopeImplication) implied(scope string) []string {
+	var captured string
+	if strings.HasSuffix(implication.pattern, wildcard) {
+		prefix := strings.TrimSuffix(implication.pattern, wildcard)
+		if !strings.HasPrefix(scope, prefix) {
+			return nil
+		}
+		captured = strings.TrimPrefix(scope, prefix)
+	} else if scope != implication.pattern {
+		return nil
+	}
+	result := make([]string, len(implication.implies))
+	for i, implied := range implication.implies {
+		if strings.HasSuffix(implied, wildcard) && captured != "" {
+			implied = strings.TrimSuffix(implied, wildcard) + captured
+		}
+		result[i] = implied
+	}
+	return result
+}
+
+// Expand returns granted scopes along with scopes they imply
+func (policy *ScopePolicy) Expand(scopes []string) GrantedScopes {
+	granted := make(GrantedScopes, len(scopes))
+	pending := append([]string{}, scopes...)
+	for len(pending) > 0 {
+		scope := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if granted[scope] {
+			continue
+		}
+		granted[scope] = true
+		for i := range policy.implications {
+			pending = append(pending, policy.implications[i].implied(scope)...)
+		}
+	}
+	return granted
+}
+
+// Authorize checks if the requirement is satisfied by the scopes and
+// returns missing scopes if it's not or nil otherwise
+func (policy *ScopePolicy) Authorize(scopes []string, requirement ScopeRequirement) *MissingScopes {
+	granted := policy.Expand(scopes)
+	missing := MissingScopes{}
+	for _, scope := range requirement.AllOf {
+		if !granted.Has(scope) {
+			missing.AllOf = append(missing.AllOf, scope)
+		}
+	}
+	for _, group := range requirement.AnyOf {
+		satisfied := false
+		for _, scope := range group {
+			if granted.Has(scope) {
+				satisfied = true
+				break
+			}
+		}
+		if !satisfied {
+			missing.AnyOf = append(missing.AnyOf, group)
+		}
+	}
+	if len(missing.AllOf) == 0 && len(missing.AnyOf) == 0 {
+		return nil
+	}
+	return &missing
+}
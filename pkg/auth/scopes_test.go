@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestScopePolicy(t *testing.T) {
+	Convey("Given scope policy", t, func() {
+		policy, err := CreateScopePolicy(ScopePolicyConfig{
+			Implications: map[string][]string{
+				"write:*": {"read:*"},
+				"admin":   {"write:*", "manage:users"},
+			},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("It should grant exact scopes", func() {
+			So(policy.Authorize([]string{"read:ledgers", "read:tags"}, AllScopes("read:ledgers", "read:tags")), ShouldBeNil)
+		})
+
+		Convey("It should grant scopes matching wildcards", func() {
+			granted := policy.Expand([]string{"read:*"})
+			So(granted.Has("read:ledgers"), ShouldBeTrue)
+			So(granted.Has("read:account-categories"), ShouldBeTrue)
+			So(granted.Has("write:ledgers"), ShouldBeFalse)
+			So(policy.Expand([]string{"*"}).Has("write:ledgers"), ShouldBeTrue)
+		})
+
+		Convey("It should grant implied scopes", func() {
+			granted := policy.Expand([]string{"write:tags"})
+			So(granted.Has("read:tags"), ShouldBeTrue)
+			So(granted.Has("read:ledgers"), ShouldBeFalse)
+		})
+
+		Convey("It should apply implications transitively", func() {
+			granted := policy.Expand([]string{"admin"})
+			So(granted.Has("manage:users"), ShouldBeTrue)
+			So(granted.Has("write:transactions"), ShouldBeTrue)
+			So(granted.Has("read:transactions"), ShouldBeTrue)
+		})
+
+		Convey("It should explain missing scopes", func() {
+			missing := policy.Authorize(
+				[]string{"read:ledgers", "write:tags"},
+				AllScopes("read:ledgers", "read:tags", "read:accounts").
+					And(AnyScope("write:ledgers", "write:accounts")).
+					And(AnyScope("read:transactions", "write:tags")),
+			)
+			So(missing, ShouldResemble, &MissingScopes{
+				AllOf: []string{"read:accounts"},
+				AnyOf: [][]string{{"write:ledgers", "write:accounts"}},
+			})
+			So(missing.String(), ShouldEqual, "read:accounts write:ledgers|write:accounts")
+		})
+
+		Convey("It should reject invalid patterns", func() {
+			_, err := CreateScopePolicy(ScopePolicyConfig{Implications: map[string][]string{"write:*:all": {"read:*"}}})
+			So(err, ShouldNotBeNil)
+			_, err = CreateScopePolicy(ScopePolicyConfig{Implications: map[string][]string{"write:*": {"read tags"}}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given default scope policy", t, func() {
+		policy := DefaultScopePolicy()
+
+		Convey("It should grant only explicit scopes and wildcards", func() {
+			So(policy.Authorize([]string{"write:ledgers"}, AllScopes("read:ledgers")), ShouldNotBeNil)
+			So(policy.Authorize([]string{"read:*", "write:ledgers"}, AllScopes("read:ledgers", "write:ledgers")), ShouldBeNil)
+		})
+	})
+
+	Convey("Given scope policy file", t, func() {
+		dir, err := ioutil.TempDir("", "scope-policy")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "policy.json")
+
+		Convey("It should load implications", func() {
+			ioutil.WriteFile(path, []byte(`{"implications": {"admin": ["read:*"]}}`), 0644)
+			policy, err := LoadScopePolicy(path)
+			So(err, ShouldBeNil)
+			So(policy.Expand([]string{"admin"}).Has("read:ledgers"), ShouldBeTrue)
+		})
+
+		Convey("It should fail if file is malformed", func() {
+			ioutil.WriteFile(path, []byte(`{"implications": ["admin"]}`), 0644)
+			_, err := LoadScopePolicy(path)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
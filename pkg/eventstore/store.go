@@ -0,0 +1,290 @@
+package eventstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
+)
+
+// ErrKeyClaimed - a unique key has already been claimed by other commit
+var ErrKeyClaimed = errors.New("Key has already been claimed")
+
+// Event is a domain event that can be appended to the event store
+type Event interface {
+	// EventType returns a v1 event type name, e.g Domain::Events::TransactionReported
+	EventType() string
+}
+
+// Headers is a commit level metadata (e.g user or request id)
+type Headers map[string]interface{}
+
+// RecordedEvent is an event as it's stored within a commit
+type RecordedEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Decode unmarshals data of the event into given value
+func (evt *RecordedEvent) Decode(value interface{}) error {
+	return json.Unmarshal(evt.Data, value)
+}
+
+// Tx is a transaction of the event store. A stream is locked once it's read or
+// appended to within the transaction so its state can not be changed concurrently
+// until the transaction is finished. Streams should be locked in the same order
+// by all writers (e.g a ledger prior to its accounts) to avoid deadlocks
+type Tx interface {
+	// DB returns the db transaction. Changes made with it are committed atomically with appended events
+	DB() *gorm.DB
+
+	// ReadEvents returns events of the stream in order they have been appended. Only events of
+	// commits that mention given text are returned if it's not empty, e.g an id of the transaction
+	ReadEvents(streamID string, mentioning string) ([]RecordedEvent, error)
+
+	// LastEvent returns the most recent event of given type or nil if the stream has no such events
+	LastEvent(streamID string, eventType string) (*RecordedEvent, error)
+
+	// ClaimKey reserves a key that should be unique across all streams, e.g an id of the entity
+	// that belongs to the stream. Returns ErrKeyClaimed if the key has already been claimed
+	ClaimKey(streamID string, key string) error
+
+	// Append appends events to the stream as a single commit
+	Append(streamID string, events ...Event) error
+}
+
+// Store appends events to streams of the v1 event store
+type Store interface {
+	AppendEvents(ctx context.Context, streamID string, headers Headers, events ...Event) error
+
+	// Transaction runs fn within a single db transaction. Commits appended by fn are
+	// committed or rolled back together, given headers are used for all of them
+	Transaction(ctx context.Context, headers Headers, fn func(tx Tx) error) error
+}
+
+// serializedEvent is a representation of an event within a commit
+type serializedEvent struct {
+	Type string `json:"type"`
+	Data Event  `json:"data"`
+}
+
+// likePattern returns a pattern that matches text containing given substring
+func likePattern(substring string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(substring)
+	return "%" + escaped + "%"
+}
+
+type dbTx struct {
+	db      *gorm.DB
+	logger  logging.Logger
+	headers Headers
+	locked  map[string]bool
+}
+
+func (tx *dbTx) DB() *gorm.DB {
+	return tx.db
+}
+
+// lock acquires a lock of the stream that is held until the transaction is finished
+func (tx *dbTx) lock(streamID string) error {
+	if streamID == "" {
+		return errors.New("Please provide streamID")
+	}
+	if tx.locked[streamID] {
+		return nil
+	}
+	if err := tracing.Exec(tx.db, "SELECT pg_advisory_xact_lock(hashtext(?))", streamID).Error; err != nil {
+		return err
+	}
+	tx.locked[streamID] = true
+	return nil
+}
+
+func (tx *dbTx) ReadEvents(streamID string, mentioning string) ([]RecordedEvent, error) {
+	if err := tx.lock(streamID); err != nil {
+		return nil, err
+	}
+	dbQuery := tx.db.Table("event_store_commits").
+		Select("events").
+		Where("stream_id = ?", streamID).
+		Order("commit_sequence")
+	if mentioning != "" {
+		dbQuery = dbQuery.Where("events LIKE ?", likePattern(mentioning))
+	}
+	rows, err := dbQuery.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := []RecordedEvent{}
+	for rows.Next() {
+		var eventsJSON string
+		if err := rows.Scan(&eventsJSON); err != nil {
+			return nil, err
+		}
+		var events []RecordedEvent
+		if err := json.Unmarshal([]byte(eventsJSON), &events); err != nil {
+			return nil, err
+		}
+		result = append(result, events...)
+	}
+	return result, rows.Err()
+}
+
+func (tx *dbTx) LastEvent(streamID string, eventType string) (*RecordedEvent, error) {
+	if err := tx.lock(streamID); err != nil {
+		return nil, err
+	}
+	var eventsJSON string
+	err := tx.db.Table("event_store_commits").
+		Select("events").
+		Where("stream_id = ? AND events LIKE ?", streamID, likePattern(eventType+`"`)).
+		Order("commit_sequence DESC").
+		Limit(1).
+		Row().Scan(&eventsJSON)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var events []RecordedEvent
+	if err := json.Unmarshal([]byte(eventsJSON), &events); err != nil {
+		return nil, err
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Type == eventType {
+			return &events[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (tx *dbTx) ClaimKey(streamID string, key string) error {
+	if key == "" {
+		return errors.New("Please provide key")
+	}
+	if err := tx.lock(streamID); err != nil {
+		return err
+	}
+	result := tracing.Exec(tx.db, `
+		INSERT INTO event_store_keys(key, stream_id, claimed_at) VALUES(?, ?, ?)
+		ON CONFLICT (key) DO NOTHING
+		`, key, streamID, time.Now().UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrKeyClaimed
+	}
+	return nil
+}
+
+func (tx *dbTx) Append(streamID string, events ...Event) error {
+	if streamID == "" {
+		return errors.New("Please provide streamID")
+	}
+	if len(events) == 0 {
+		return errors.New("Please provide events")
+	}
+
+	serializedEvents := make([]serializedEvent, len(events))
+	for i, evt := range events {
+		serializedEvents[i] = serializedEvent{Type: evt.EventType(), Data: evt}
+	}
+	eventsJSON, err := json.Marshal(serializedEvents)
+	if err != nil {
+		return err
+	}
+	headersJSON, err := json.Marshal(tx.headers)
+	if err != nil {
+		return err
+	}
+
+	// Commits of the same stream are serialized so sequence and revision are consistent
+	if err := tx.lock(streamID); err != nil {
+		return err
+	}
+
+	var commitSequence, streamRevision int
+	if err := tx.db.Raw(`
+		SELECT COALESCE(MAX(commit_sequence), 0), COALESCE(MAX(stream_revision), 0)
+		FROM event_store_commits WHERE stream_id = ?
+		`, streamID).Row().Scan(&commitSequence, &streamRevision); err != nil {
+		return err
+	}
+
+	// The transaction gets its id before the checkpoint number is assigned so projectors
+	// see it in progress as long as the commit with the number may become visible
+	if err := tracing.Exec(tx.db, "SELECT txid_current()").Error; err != nil {
+		return err
+	}
+
+	commitID := uuid.NewV4().String()
+	tx.logger.Debugf("Appending %v events to stream %v. CommitID: %v", len(events), streamID, commitID)
+	return tracing.Exec(tx.db, `
+		INSERT INTO event_store_commits(
+			stream_id,
+			commit_id,
+			commit_sequence,
+			stream_revision,
+			commit_timestamp,
+			headers,
+			events
+		)
+		VALUES(?,?,?,?,?,?,?)
+		`,
+		streamID,
+		commitID,
+		commitSequence+1,
+		streamRevision+len(events),
+		time.Now().UTC(),
+		string(headersJSON),
+		string(eventsJSON),
+	).Error
+}
+
+type dbStore struct {
+	db *gorm.DB
+}
+
+func (store *dbStore) Transaction(ctx context.Context, headers Headers, fn func(tx Tx) error) error {
+	if headers == nil {
+		headers = Headers{}
+	}
+	db := tracing.DB(ctx, store.db).Begin()
+	if err := db.Error; err != nil {
+		return err
+	}
+	tx := dbTx{db: db, logger: logging.FromContext(ctx), headers: headers, locked: make(map[string]bool)}
+	if err := fn(&tx); err != nil {
+		db.Rollback()
+		return err
+	}
+	return db.Commit().Error
+}
+
+func (store *dbStore) AppendEvents(ctx context.Context, streamID string, headers Headers, events ...Event) error {
+	if streamID == "" {
+		return errors.New("Please provide streamID")
+	}
+	if len(events) == 0 {
+		return errors.New("Please provide events")
+	}
+	return store.Transaction(ctx, headers, func(tx Tx) error {
+		return tx.Append(streamID, events...)
+	})
+}
+
+// CreateStore initializes a new instance of the db backed event store
+func CreateStore(db *gorm.DB) Store {
+	store := dbStore{db: db}
+	return &store
+}
@@ -0,0 +1,212 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/icrowley/fake"
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/logging"
+)
+
+type testEvent struct {
+	AggregateID string `json:"aggregate_id"`
+	Value       string `json:"value"`
+}
+
+func (testEvent) EventType() string { return "Domain::Events::TestEvent" }
+
+type storedCommit struct {
+	CommitID       string
+	CommitSequence int
+	StreamRevision int
+	Headers        string
+	Events         string
+}
+
+var rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+func loadCommits(streamID string) ([]storedCommit, error) {
+	commits := []storedCommit{}
+	err := DB.Table("event_store_commits").
+		Select("commit_id, commit_sequence, stream_revision, headers, events").
+		Where("stream_id = ?", streamID).
+		Order("commit_sequence").
+		Scan(&commits).Error
+	return commits, err
+}
+
+func TestAppendEvents(t *testing.T) {
+	store := CreateStore(DB)
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given event store", t, func() {
+		streamID := uuid.NewV4().String()
+
+		Convey("When required parameters are missing", func() {
+			Convey("It should return error if no stream provided", func() {
+				err := store.AppendEvents(ctx, "", nil, &testEvent{})
+				So(err, ShouldResemble, errors.New("Please provide streamID"))
+			})
+
+			Convey("It should return error if no events provided", func() {
+				err := store.AppendEvents(ctx, streamID, nil)
+				So(err, ShouldResemble, errors.New("Please provide events"))
+			})
+		})
+
+		Convey("When events are appended", func() {
+			evt1 := &testEvent{AggregateID: streamID, Value: fake.Word()}
+			evt2 := &testEvent{AggregateID: streamID, Value: fake.Word()}
+			evt3 := &testEvent{AggregateID: streamID, Value: fake.Word()}
+			headers := Headers{"user_id": float64(rnd.Intn(1000))}
+			So(store.AppendEvents(ctx, streamID, headers, evt1, evt2), ShouldBeNil)
+			So(store.AppendEvents(ctx, streamID, nil, evt3), ShouldBeNil)
+
+			commits, err := loadCommits(streamID)
+			So(err, ShouldBeNil)
+			So(commits, ShouldHaveLength, 2)
+
+			Convey("It should increment commit sequence and stream revision", func() {
+				So(commits[0].CommitSequence, ShouldEqual, 1)
+				So(commits[0].StreamRevision, ShouldEqual, 2)
+				So(commits[1].CommitSequence, ShouldEqual, 2)
+				So(commits[1].StreamRevision, ShouldEqual, 3)
+				So(commits[0].CommitID, ShouldNotEqual, commits[1].CommitID)
+			})
+
+			Convey("It should serialize events with their types", func() {
+				var events []map[string]interface{}
+				So(json.Unmarshal([]byte(commits[0].Events), &events), ShouldBeNil)
+				So(events, ShouldResemble, []map[string]interface{}{
+					{
+						"type": "Domain::Events::TestEvent",
+						"data": map[string]interface{}{"aggregate_id": streamID, "value": evt1.Value},
+					},
+					{
+						"type": "Domain::Events::TestEvent",
+						"data": map[string]interface{}{"aggregate_id": streamID, "value": evt2.Value},
+					},
+				})
+			})
+
+			Convey("It should persist headers", func() {
+				var actualHeaders Headers
+				So(json.Unmarshal([]byte(commits[0].Headers), &actualHeaders), ShouldBeNil)
+				So(actualHeaders, ShouldResemble, headers)
+			})
+		})
+	})
+}
+
+type otherTestEvent struct {
+	AggregateID string `json:"aggregate_id"`
+}
+
+func (otherTestEvent) EventType() string { return "Domain::Events::OtherTestEvent" }
+
+func TestTransaction(t *testing.T) {
+	store := CreateStore(DB)
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given event store with events", t, func() {
+		streamID := uuid.NewV4().String()
+		evt1 := &testEvent{AggregateID: streamID, Value: uuid.NewV4().String()}
+		evt2 := &testEvent{AggregateID: streamID, Value: uuid.NewV4().String()}
+		evt3 := &otherTestEvent{AggregateID: streamID}
+		So(store.AppendEvents(ctx, streamID, nil, evt1), ShouldBeNil)
+		So(store.AppendEvents(ctx, streamID, nil, evt2, evt3), ShouldBeNil)
+
+		decodeAll := func(events []RecordedEvent) []string {
+			values := []string{}
+			for _, evt := range events {
+				var data testEvent
+				So(evt.Decode(&data), ShouldBeNil)
+				values = append(values, evt.Type+":"+data.Value)
+			}
+			return values
+		}
+
+		Convey("It should read events of the stream in order", func() {
+			So(store.Transaction(ctx, nil, func(tx Tx) error {
+				events, err := tx.ReadEvents(streamID, "")
+				So(err, ShouldBeNil)
+				So(decodeAll(events), ShouldResemble, []string{
+					"Domain::Events::TestEvent:" + evt1.Value,
+					"Domain::Events::TestEvent:" + evt2.Value,
+					"Domain::Events::OtherTestEvent:",
+				})
+				return nil
+			}), ShouldBeNil)
+		})
+
+		Convey("It should read events of commits that mention given text", func() {
+			So(store.Transaction(ctx, nil, func(tx Tx) error {
+				events, err := tx.ReadEvents(streamID, evt2.Value)
+				So(err, ShouldBeNil)
+				So(decodeAll(events), ShouldResemble, []string{
+					"Domain::Events::TestEvent:" + evt2.Value,
+					"Domain::Events::OtherTestEvent:",
+				})
+				return nil
+			}), ShouldBeNil)
+		})
+
+		Convey("It should return the most recent event of given type", func() {
+			So(store.Transaction(ctx, nil, func(tx Tx) error {
+				evt, err := tx.LastEvent(streamID, "Domain::Events::TestEvent")
+				So(err, ShouldBeNil)
+				So(decodeAll([]RecordedEvent{*evt}), ShouldResemble, []string{"Domain::Events::TestEvent:" + evt2.Value})
+
+				evt, err = tx.LastEvent(streamID, "Domain::Events::Test")
+				So(err, ShouldBeNil)
+				So(evt, ShouldBeNil)
+				return nil
+			}), ShouldBeNil)
+		})
+
+		Convey("It should append commits of all streams atomically", func() {
+			otherStreamID := uuid.NewV4().String()
+			So(store.Transaction(ctx, Headers{"user_id": float64(1)}, func(tx Tx) error {
+				So(tx.Append(streamID, &testEvent{AggregateID: streamID}), ShouldBeNil)
+				So(tx.Append(otherStreamID, &testEvent{AggregateID: otherStreamID}), ShouldBeNil)
+				return nil
+			}), ShouldBeNil)
+			commits, err := loadCommits(streamID)
+			So(err, ShouldBeNil)
+			So(commits, ShouldHaveLength, 3)
+			So(commits[2].StreamRevision, ShouldEqual, 4)
+			commits, err = loadCommits(otherStreamID)
+			So(err, ShouldBeNil)
+			So(commits, ShouldHaveLength, 1)
+		})
+
+		Convey("It should roll back commits if fn fails", func() {
+			fnErr := errors.New(fake.Sentence())
+			err := store.Transaction(ctx, nil, func(tx Tx) error {
+				So(tx.Append(streamID, &testEvent{AggregateID: streamID}), ShouldBeNil)
+				return fnErr
+			})
+			So(err, ShouldEqual, fnErr)
+			commits, err := loadCommits(streamID)
+			So(err, ShouldBeNil)
+			So(commits, ShouldHaveLength, 2)
+		})
+
+		Convey("It should claim a key once", func() {
+			key := "test:" + uuid.NewV4().String()
+			So(store.Transaction(ctx, nil, func(tx Tx) error {
+				return tx.ClaimKey(streamID, key)
+			}), ShouldBeNil)
+			err := store.Transaction(ctx, nil, func(tx Tx) error {
+				return tx.ClaimKey(uuid.NewV4().String(), key)
+			})
+			So(err, ShouldEqual, ErrKeyClaimed)
+		})
+	})
+}
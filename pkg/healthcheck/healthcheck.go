@@ -0,0 +1,158 @@
+package healthcheck
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"ledger.api/pkg/jobs"
+	"ledger.api/version"
+)
+
+// Check statuses
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// DefaultTimeout is a max time a single check may take
+const DefaultTimeout = 3 * time.Second
+
+// Checker - checks if a dependency of the app is available
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc - a function that implements Checker
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls the function
+func (fn CheckerFunc) Check(ctx context.Context) error {
+	return fn(ctx)
+}
+
+// CheckResult - a result of a single check. The error is not serialized
+// so details of dependencies are not exposed to unauthenticated callers
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"-"`
+}
+
+// Report - results of all checks along with the app version
+type Report struct {
+	Status  string        `json:"status"`
+	Version string        `json:"version"`
+	GitHash string        `json:"gitHash"`
+	Checks  []CheckResult `json:"checks,omitempty"`
+}
+
+// OK returns true if all checks passed
+func (report *Report) OK() bool {
+	return report.Status == StatusOK
+}
+
+func createReport() *Report {
+	return &Report{Status: StatusOK, Version: version.VERSION, GitHash: version.GitHash}
+}
+
+type namedChecker struct {
+	name    string
+	checker Checker
+}
+
+// Registry - a list of checkers the app readiness depends on
+type Registry struct {
+	timeout  time.Duration
+	checkers []namedChecker
+}
+
+// CreateRegistry creates an empty registry. Each check is failed if it takes longer than the timeout
+func CreateRegistry(timeout time.Duration) *Registry {
+	return &Registry{timeout: timeout}
+}
+
+// Register adds a checker. Results are reported in order checkers are registered
+func (registry *Registry) Register(name string, checker Checker) *Registry {
+	registry.checkers = append(registry.checkers, namedChecker{name: name, checker: checker})
+	return registry
+}
+
+// Check runs all checkers concurrently and reports their results
+func (registry *Registry) Check(ctx context.Context) *Report {
+	report := createReport()
+	report.Checks = make([]CheckResult, len(registry.checkers))
+	var wg sync.WaitGroup
+	for i, named := range registry.checkers {
+		wg.Add(1)
+		go func(i int, named namedChecker) {
+			defer wg.Done()
+			report.Checks[i] = registry.runCheck(ctx, named)
+		}(i, named)
+	}
+	wg.Wait()
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func (registry *Registry) runCheck(ctx context.Context, named namedChecker) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, registry.timeout)
+	defer cancel()
+	start := time.Now()
+
+	// Some checkers (e.g beanstalkd dial) can not be cancelled so the result
+	// is not awaited longer than the timeout
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- fmt.Errorf("Check panicked: %v", recovered)
+			}
+		}()
+		done <- named.checker.Check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("Check timed out after %v", registry.timeout)
+	}
+
+	result := CheckResult{
+		Name:      named.name,
+		Status:    StatusOK,
+		LatencyMs: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// CreateDBChecker creates a checker that pings the db
+func CreateDBChecker(db *sql.DB) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+}
+
+// CreateBeanstalkdChecker creates a checker that connects to beanstalkd and queries its stats
+func CreateBeanstalkdChecker(address string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		conn, err := jobs.Dial(address)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = conn.Stats()
+		return err
+	})
+}
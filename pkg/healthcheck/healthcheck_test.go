@@ -0,0 +1,95 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/version"
+)
+
+func TestRegistry(t *testing.T) {
+	Convey("Given a registry", t, func() {
+		registry := CreateRegistry(100 * time.Millisecond)
+
+		Convey("It should report ok if all checks passed", func() {
+			registry.
+				Register("first", CheckerFunc(func(ctx context.Context) error { return nil })).
+				Register("second", CheckerFunc(func(ctx context.Context) error { return nil }))
+			report := registry.Check(context.Background())
+			So(report.OK(), ShouldBeTrue)
+			So(report.Version, ShouldEqual, version.VERSION)
+			So(report.GitHash, ShouldEqual, version.GitHash)
+			So(report.Checks, ShouldHaveLength, 2)
+			So(report.Checks[0].Name, ShouldEqual, "first")
+			So(report.Checks[0].Status, ShouldEqual, StatusOK)
+			So(report.Checks[1].Name, ShouldEqual, "second")
+		})
+
+		Convey("It should report failed checks in order they were registered", func() {
+			registry.
+				Register("slow", CheckerFunc(func(ctx context.Context) error {
+					time.Sleep(20 * time.Millisecond)
+					return nil
+				})).
+				Register("failing", CheckerFunc(func(ctx context.Context) error { return errors.New("unavailable") }))
+			report := registry.Check(context.Background())
+			So(report.OK(), ShouldBeFalse)
+			So(report.Checks[0].Name, ShouldEqual, "slow")
+			So(report.Checks[0].Status, ShouldEqual, StatusOK)
+			So(report.Checks[0].LatencyMs, ShouldBeGreaterThanOrEqualTo, 20)
+			So(report.Checks[1].Status, ShouldEqual, StatusFail)
+			So(report.Checks[1].Error, ShouldEqual, "unavailable")
+		})
+
+		Convey("It should fail checks that took longer than timeout", func() {
+			release := make(chan struct{})
+			defer close(release)
+			registry.Register("stuck", CheckerFunc(func(ctx context.Context) error {
+				<-release
+				return nil
+			}))
+			report := registry.Check(context.Background())
+			So(report.OK(), ShouldBeFalse)
+			So(report.Checks[0].Error, ShouldContainSubstring, "timed out")
+		})
+
+		Convey("It should fail checks that panicked", func() {
+			registry.Register("panicking", CheckerFunc(func(ctx context.Context) error { panic("boom") }))
+			report := registry.Check(context.Background())
+			So(report.Checks[0].Status, ShouldEqual, StatusFail)
+			So(report.Checks[0].Error, ShouldContainSubstring, "boom")
+		})
+	})
+}
+
+func TestCheckers(t *testing.T) {
+	Convey("Given beanstalkd checker", t, func() {
+		Convey("It should query stats of beanstalkd", func() {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			So(err, ShouldBeNil)
+			defer listener.Close()
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				buffer := make([]byte, 64)
+				conn.Read(buffer)
+				conn.Write([]byte("OK 14\r\n---\nversion: 1\n\r\n"))
+			}()
+			So(CreateBeanstalkdChecker("beanstalk://"+listener.Addr().String()).Check(context.Background()), ShouldBeNil)
+		})
+
+		Convey("It should fail if beanstalkd is not available", func() {
+			listener, _ := net.Listen("tcp", "127.0.0.1:0")
+			address := listener.Addr().String()
+			listener.Close()
+			So(CreateBeanstalkdChecker(address).Check(context.Background()), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,32 @@
+package healthcheck
+
+import (
+	"net/http"
+
+	"ledger.api/pkg/server"
+)
+
+// CreateRoutes - register liveness and readiness routes
+func CreateRoutes(registry *Registry) server.Routes {
+	return func(router *server.Router) {
+		router.GET("/v2/healthcheck/live", handleLive)
+		router.GET("/v2/healthcheck/ready", func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+			report := registry.Check(req.Context())
+			if !report.OK() {
+				for _, result := range report.Checks {
+					if result.Status != StatusOK {
+						h.Logger.WithField("check", result.Name).Warnf("App is not ready. Check failed: %v", result.Error)
+					}
+				}
+				return h.Response(report).Status(http.StatusServiceUnavailable), nil
+			}
+			return h.Response(report), nil
+		})
+	}
+}
+
+// handleLive responds with 200 as long as the process is able to serve requests.
+// Dependencies are not checked so their outage does not get the app restarted
+func handleLive(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+	return h.Response(createReport()), nil
+}
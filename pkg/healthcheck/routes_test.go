@@ -0,0 +1,67 @@
+package healthcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/server"
+)
+
+func TestRoutes(t *testing.T) {
+	Convey("Given healthcheck routes", t, func() {
+		var dbErr error
+		registry := CreateRegistry(time.Second).
+			Register("db", CheckerFunc(func(ctx context.Context) error { return dbErr }))
+		handler := server.
+			CreateHTTPApp(server.HTTPAppConfig{Env: "test"}).
+			RegisterRoutes(CreateRoutes(registry)).
+			CreateHandler()
+		serve := func(path string) (*httptest.ResponseRecorder, Report) {
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			handler.ServeHTTP(recorder, req)
+			var report Report
+			json.Unmarshal(recorder.Body.Bytes(), &report)
+			return recorder, report
+		}
+
+		Convey("When dependencies are available", func() {
+			Convey("It should respond ready with check results", func() {
+				recorder, report := serve("/v2/healthcheck/ready")
+				So(recorder.Code, ShouldEqual, 200)
+				So(report.Status, ShouldEqual, StatusOK)
+				So(report.Checks, ShouldHaveLength, 1)
+				So(report.Checks[0].Name, ShouldEqual, "db")
+			})
+		})
+
+		Convey("When dependencies are not available", func() {
+			dbErr = errors.New("connection refused")
+
+			Convey("It should respond not ready with failed checks", func() {
+				recorder, report := serve("/v2/healthcheck/ready")
+				So(recorder.Code, ShouldEqual, 503)
+				So(report.Status, ShouldEqual, StatusFail)
+				So(report.Checks[0].Status, ShouldEqual, StatusFail)
+			})
+
+			Convey("It should not expose errors of failed checks", func() {
+				recorder, _ := serve("/v2/healthcheck/ready")
+				So(recorder.Body.String(), ShouldNotContainSubstring, "connection refused")
+			})
+
+			Convey("It should still respond live without checks", func() {
+				recorder, report := serve("/v2/healthcheck/live")
+				So(recorder.Code, ShouldEqual, 200)
+				So(report.Status, ShouldEqual, StatusOK)
+				So(report.Checks, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,116 @@
+package ldtesting
+
+import (
+	"fmt"
+
+	"github.com/icrowley/fake"
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+	"ledger.api/pkg/users"
+)
+
+// Account represents test account related data to setup for tests
+type Account struct {
+	AccountID         string
+	LedgerID          string
+	SequentialNumber  int
+	Name              string
+	CurrencyCode      string
+	Balance           int
+	IsClosed          bool
+	CategoryID        int
+	AuthorizedUserIDs string
+}
+
+// AccountSetup fn to setup account
+type AccountSetup func(*Account)
+
+// AccCurrency setup account with given currency
+func AccCurrency(currencyCode string) AccountSetup {
+	return func(acc *Account) {
+		acc.CurrencyCode = currencyCode
+	}
+}
+
+// AccBalance setup account with given balance
+func AccBalance(balance int) AccountSetup {
+	return func(acc *Account) {
+		acc.Balance = balance
+	}
+}
+
+// AccCategory setup account with given category
+func AccCategory(categoryID int) AccountSetup {
+	return func(acc *Account) {
+		acc.CategoryID = categoryID
+	}
+}
+
+// AccClosed will mark given account as closed
+func AccClosed(acc *Account) {
+	acc.IsClosed = true
+}
+
+// AccAuthorizedUsers will authorize given users on the account
+func AccAuthorizedUsers(authorizedUsers ...*users.User) AccountSetup {
+	return func(acc *Account) {
+		acc.AuthorizedUserIDs = AuthorizedUserIDs(authorizedUsers...)
+	}
+}
+
+// NewAccount creates a new mock account structure
+func NewAccount(ledgerID string, setup ...AccountSetup) *Account {
+	acc := Account{
+		AccountID:        uuid.NewV4().String(),
+		LedgerID:         ledgerID,
+		SequentialNumber: rnd.Intn(1000000),
+		Name:             fmt.Sprintf("Account %v", fake.Word()),
+		CurrencyCode:     "UAH",
+		Balance:          rnd.Intn(100000),
+	}
+	for _, setupFn := range setup {
+		setupFn(&acc)
+	}
+	return &acc
+}
+
+// SetupAccount generate and persist a mock account of a given ledger
+func SetupAccount(db *gorm.DB, ledgerID string, setup ...AccountSetup) (*Account, error) {
+	acc := NewAccount(ledgerID, setup...)
+	if err := db.Exec(`
+		INSERT INTO projections_accounts(
+			ledger_id,
+			aggregate_id,
+			sequential_number,
+			owner_user_id,
+			authorized_user_ids,
+			currency_code,
+			name,
+			balance,
+			is_closed,
+			category_id
+		)
+		VALUES(?, ?, ?, 0, ?, ?, ?, ?, ?, ?)
+		`,
+		acc.LedgerID,
+		acc.AccountID,
+		acc.SequentialNumber,
+		acc.AuthorizedUserIDs,
+		acc.CurrencyCode,
+		acc.Name,
+		acc.Balance,
+		acc.IsClosed,
+		acc.CategoryID,
+	).Error; err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+// SetupCategory will insert a new account category into categories projection
+func SetupCategory(db *gorm.DB, ledgerID string, categoryID int, name string, displayOrder int) error {
+	return db.Exec(`
+		INSERT INTO projections_categories(ledger_id, category_id, display_order, name)
+		VALUES(?,?,?,?)
+		`, ledgerID, categoryID, displayOrder, name).Error
+}
@@ -0,0 +1,140 @@
+package ldtesting
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/eventstore"
+)
+
+// Commit is a commit appended to the event store
+type Commit struct {
+	StreamID string
+	Headers  eventstore.Headers
+	Events   []eventstore.Event
+}
+
+type memoryCommit struct {
+	eventsJSON string
+	events     []eventstore.RecordedEvent
+}
+
+// EventStore is an in memory event store. Commits appended by the code under
+// test are recorded. Streams can be seeded with events to read the state from
+type EventStore struct {
+	Commits []Commit
+
+	db      *gorm.DB
+	streams map[string][]memoryCommit
+	keys    map[string]bool
+}
+
+func (store *EventStore) addCommit(streamID string, events []eventstore.Event) {
+	recorded := make([]eventstore.RecordedEvent, len(events))
+	for i, evt := range events {
+		data, err := json.Marshal(evt)
+		if err != nil {
+			panic(err)
+		}
+		recorded[i] = eventstore.RecordedEvent{Type: evt.EventType(), Data: data}
+	}
+	eventsJSON, err := json.Marshal(recorded)
+	if err != nil {
+		panic(err)
+	}
+	store.streams[streamID] = append(store.streams[streamID], memoryCommit{
+		eventsJSON: string(eventsJSON),
+		events:     recorded,
+	})
+}
+
+// Seed appends events to the stream without recording the commit
+func (store *EventStore) Seed(streamID string, events ...eventstore.Event) {
+	store.addCommit(streamID, events)
+}
+
+// SeedKey claims the key so it can not be claimed by the code under test
+func (store *EventStore) SeedKey(key string) {
+	store.keys[key] = true
+}
+
+// AppendEvents records a commit of given events
+func (store *EventStore) AppendEvents(ctx context.Context, streamID string, headers eventstore.Headers, events ...eventstore.Event) error {
+	return store.Transaction(ctx, headers, func(tx eventstore.Tx) error {
+		return tx.Append(streamID, events...)
+	})
+}
+
+// Transaction runs fn and records commits it appends if it succeeds.
+// Changes made with the db of the transaction are applied to the db of the store directly
+func (store *EventStore) Transaction(ctx context.Context, headers eventstore.Headers, fn func(tx eventstore.Tx) error) error {
+	tx := memoryTx{store: store, headers: headers, keys: make(map[string]bool)}
+	if err := fn(&tx); err != nil {
+		return err
+	}
+	for _, cmt := range tx.commits {
+		store.addCommit(cmt.StreamID, cmt.Events)
+		store.Commits = append(store.Commits, cmt)
+	}
+	for key := range tx.keys {
+		store.keys[key] = true
+	}
+	return nil
+}
+
+type memoryTx struct {
+	store   *EventStore
+	headers eventstore.Headers
+	commits []Commit
+	keys    map[string]bool
+}
+
+func (tx *memoryTx) DB() *gorm.DB {
+	return tx.store.db
+}
+
+func (tx *memoryTx) ReadEvents(streamID string, mentioning string) ([]eventstore.RecordedEvent, error) {
+	result := []eventstore.RecordedEvent{}
+	for _, cmt := range tx.store.streams[streamID] {
+		if strings.Contains(cmt.eventsJSON, mentioning) {
+			result = append(result, cmt.events...)
+		}
+	}
+	return result, nil
+}
+
+func (tx *memoryTx) LastEvent(streamID string, eventType string) (*eventstore.RecordedEvent, error) {
+	var result *eventstore.RecordedEvent
+	for _, cmt := range tx.store.streams[streamID] {
+		for i, evt := range cmt.events {
+			if evt.Type == eventType {
+				result = &cmt.events[i]
+			}
+		}
+	}
+	return result, nil
+}
+
+func (tx *memoryTx) ClaimKey(streamID string, key string) error {
+	if tx.store.keys[key] || tx.keys[key] {
+		return eventstore.ErrKeyClaimed
+	}
+	tx.keys[key] = true
+	return nil
+}
+
+func (tx *memoryTx) Append(streamID string, events ...eventstore.Event) error {
+	tx.commits = append(tx.commits, Commit{StreamID: streamID, Headers: tx.headers, Events: events})
+	return nil
+}
+
+// NewEventStore creates a new instance of the in memory event store
+func NewEventStore(db *gorm.DB) *EventStore {
+	return &EventStore{
+		db:      db,
+		streams: make(map[string][]memoryCommit),
+		keys:    make(map[string]bool),
+	}
+}
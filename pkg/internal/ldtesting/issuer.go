@@ -0,0 +1,112 @@
+package ldtesting
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/icrowley/fake"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"ledger.api/pkg/auth"
+)
+
+// TestIssuer is a local issuer that mints RS256 tokens. Public keys are published as
+// a key set that can be served over http or written to a file for the validator to use
+type TestIssuer struct {
+	Issuer   string
+	Audience string
+
+	mu   sync.Mutex
+	key  jose.JSONWebKey
+	keys []jose.JSONWebKey
+}
+
+func generateSigningKey() jose.JSONWebKey {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return jose.JSONWebKey{Key: privateKey, KeyID: fake.CharactersN(16), Algorithm: string(jose.RS256), Use: "sig"}
+}
+
+// NewTestIssuer creates an issuer with a new signing key
+func NewTestIssuer(iss string, aud string) *TestIssuer {
+	issuer := &TestIssuer{Issuer: iss, Audience: aud}
+	issuer.Rotate(false)
+	return issuer
+}
+
+// Rotate generates a new signing key. Public key of the previous one is still published if keepPrevious
+func (issuer *TestIssuer) Rotate(keepPrevious bool) {
+	issuer.mu.Lock()
+	defer issuer.mu.Unlock()
+	issuer.key = generateSigningKey()
+	if !keepPrevious {
+		issuer.keys = nil
+	}
+	issuer.keys = append(issuer.keys, issuer.key.Public())
+}
+
+// KeyID returns an id of the current signing key
+func (issuer *TestIssuer) KeyID() string {
+	issuer.mu.Lock()
+	defer issuer.mu.Unlock()
+	return issuer.key.KeyID
+}
+
+// JWKS returns a key set with public keys of the issuer
+func (issuer *TestIssuer) JWKS() jose.JSONWebKeySet {
+	issuer.mu.Lock()
+	defer issuer.mu.Unlock()
+	return jose.JSONWebKeySet{Keys: append([]jose.JSONWebKey{}, issuer.keys...)}
+}
+
+// WriteJWKS writes the key set to the file
+func (issuer *TestIssuer) WriteJWKS(path string) error {
+	data, err := json.Marshal(issuer.JWKS())
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// ServeHTTP responds with the key set, e.g as .well-known/jwks.json of the issuer
+func (issuer *TestIssuer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(issuer.JWKS())
+}
+
+// Mint returns a token with given claims signed with the current key
+func (issuer *TestIssuer) Mint(claims interface{}) (string, error) {
+	issuer.mu.Lock()
+	key := issuer.key
+	issuer.mu.Unlock()
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return "", err
+	}
+	return jwt.Signed(signer).Claims(claims).CompactSerialize()
+}
+
+// MintLedgerClaims returns a token of given subject and scope that is valid for a minute
+func (issuer *TestIssuer) MintLedgerClaims(subject string, scope string) (string, error) {
+	now := time.Now()
+	return issuer.Mint(auth.LedgerClaims{
+		Claims: &jwt.Claims{
+			Issuer:   issuer.Issuer,
+			Audience: jwt.Audience{issuer.Audience},
+			Subject:  subject,
+			IssuedAt: jwt.NewNumericDate(now),
+			Expiry:   jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+		Scope: scope,
+	})
+}
@@ -5,11 +5,14 @@ import (
 	"net/http"
 
 	"ledger.api/pkg/auth"
+	"ledger.api/pkg/users"
 )
 
 type requestOptions struct {
 	body  io.Reader
 	scope string
+	email string
+	user  *users.User
 }
 
 // RequestOption function to set request options
@@ -22,6 +25,20 @@ func WithScopeClaim(scope string) RequestOption {
 	}
 }
 
+// WithVerifiedEmailClaim will set a verified email claim to initialize request with
+func WithVerifiedEmailClaim(email string) RequestOption {
+	return func(opts *requestOptions) {
+		opts.email = email
+	}
+}
+
+// WithUser will set a user to initialize request with
+func WithUser(user *users.User) RequestOption {
+	return func(opts *requestOptions) {
+		opts.user = user
+	}
+}
+
 // NewRequest creates a new instance of the http request for testing purposes
 func NewRequest(method string, url string, opts ...RequestOption) *http.Request {
 	reqOpts := requestOptions{}
@@ -34,13 +51,17 @@ func NewRequest(method string, url string, opts ...RequestOption) *http.Request
 		panic(err)
 	}
 
-	if reqOpts.scope != "" {
+	if reqOpts.scope != "" || reqOpts.email != "" {
 		req = req.WithContext(
 			auth.ContextWithClaims(
 				req.Context(),
-				&auth.LedgerClaims{Scope: reqOpts.scope},
+				&auth.LedgerClaims{Scope: reqOpts.scope, Email: reqOpts.email, EmailVerified: reqOpts.email != ""},
 			))
 	}
 
+	if reqOpts.user != nil {
+		req = req.WithContext(users.ContextWithUser(req.Context(), reqOpts.user))
+	}
+
 	return req
 }
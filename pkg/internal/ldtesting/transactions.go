@@ -3,23 +3,26 @@ package ldtesting
 import (
 	"fmt"
 	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/icrowley/fake"
 
 	"github.com/jinzhu/gorm"
 	uuid "github.com/satori/go.uuid"
+	"ledger.api/pkg/users"
 )
 
 var rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 // LedgerData represents ledger related data used in tests
 type LedgerData struct {
-	LedgerID   string
-	TagIDs     []int
-	TagsByID   map[int]string
-	TagsByName map[string]int
-	AccountIDs []string
+	LedgerID     string
+	CurrencyCode string
+	TagIDs       []int
+	TagsByID     map[int]string
+	TagsByName   map[string]int
+	AccountIDs   []string
 }
 
 // Transaction represents test transaction related data to setup for tests
@@ -76,6 +79,28 @@ func TrxRefund(trx *Transaction) {
 	trx.typeID = 3
 }
 
+// TrxTransfer will mark given transaction as transfer
+func TrxTransfer(trx *Transaction) {
+	trx.isTransfer = true
+}
+
+// TrxAmount setup transaction with given amount
+func TrxAmount(amount int) TransactionSetup {
+	return func(trx *Transaction) {
+		trx.Amount = amount
+	}
+}
+
+// TypeID returns transaction type id (income=1, expense=2, refund=3)
+func (trx *Transaction) TypeID() int {
+	return trx.typeID
+}
+
+// IsTransfer returns true if transaction is a transfer
+func (trx *Transaction) IsTransfer() bool {
+	return trx.isTransfer
+}
+
 // NewTransaction creates a new mock transaction structure
 func NewTransaction(setup ...TransactionSetup) *Transaction {
 	trx := Transaction{
@@ -91,18 +116,37 @@ func NewTransaction(setup ...TransactionSetup) *Transaction {
 	return &trx
 }
 
-// SetupLedgerData generate and persist mock ledger data
-func SetupLedgerData(db *gorm.DB) (LedgerData, error) {
+// AuthorizedUserIDs formats user ids the way v1 stores them in authorized_user_ids
+// columns, e.g: {1},{2},{4}
+func AuthorizedUserIDs(authorizedUsers ...*users.User) string {
+	ids := make([]string, len(authorizedUsers))
+	for i, user := range authorizedUsers {
+		ids[i] = fmt.Sprintf("{%v}", user.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+// SetupLedgerData generate and persist mock ledger data.
+// Accounts and tags of the ledger are authorized for given users
+func SetupLedgerData(db *gorm.DB, authorizedUsers ...*users.User) (LedgerData, error) {
 	ledgerID := uuid.NewV4().String()
 	md := LedgerData{
-		LedgerID:   ledgerID,
-		TagIDs:     make([]int, 10),
-		TagsByID:   make(map[int]string),
-		TagsByName: make(map[string]int),
-		AccountIDs: make([]string, 10),
+		LedgerID:     ledgerID,
+		CurrencyCode: "UAH",
+		TagIDs:       make([]int, 10),
+		TagsByID:     make(map[int]string),
+		TagsByName:   make(map[string]int),
+		AccountIDs:   make([]string, 10),
 	}
 
+	authorizedUserIDs := AuthorizedUserIDs(authorizedUsers...)
 	base := rnd.Intn(10000)
+	if err := db.Exec(`
+		INSERT INTO projections_ledgers(aggregate_id, owner_user_id, name, currency_code, authorized_user_ids)
+		VALUES(?, 0, ?, ?, ?)
+		`, ledgerID, fmt.Sprintf("Ledger %v", base), md.CurrencyCode, authorizedUserIDs).Error; err != nil {
+		return LedgerData{}, err
+	}
 	for i := 0; i < 10; i++ {
 		tagID := i + base
 		tagName := fmt.Sprintf("Tag %v %v", base, i)
@@ -110,7 +154,7 @@ func SetupLedgerData(db *gorm.DB) (LedgerData, error) {
 		md.TagsByID[tagID] = tagName
 		md.TagsByName[tagName] = tagID
 
-		if err := SetupTag(db, ledgerID, tagID, tagName); err != nil {
+		if err := SetupAuthorizedTag(db, ledgerID, tagID, tagName, authorizedUserIDs); err != nil {
 			return LedgerData{}, err
 		}
 
@@ -129,8 +173,8 @@ func SetupLedgerData(db *gorm.DB) (LedgerData, error) {
 				balance,
 				is_closed
 			)
-			VALUES(?,?, ?, 0, '', 'UAH', ?, 0, false)
-			`, ledgerID, accountID, i, fmt.Sprintf("Account %v-%v", base, i)).Error; err != nil {
+			VALUES(?,?, ?, 0, ?, ?, ?, 0, false)
+			`, ledgerID, accountID, i, authorizedUserIDs, md.CurrencyCode, fmt.Sprintf("Account %v-%v", base, i)).Error; err != nil {
 			return LedgerData{}, err
 		}
 	}
@@ -140,10 +184,16 @@ func SetupLedgerData(db *gorm.DB) (LedgerData, error) {
 
 // SetupTag will insert a new tag into tags projection
 func SetupTag(db *gorm.DB, ledgerID string, tagID int, tagName string) error {
+	return SetupAuthorizedTag(db, ledgerID, tagID, tagName, "")
+}
+
+// SetupAuthorizedTag will insert a new tag into tags projection
+// with given authorized_user_ids
+func SetupAuthorizedTag(db *gorm.DB, ledgerID string, tagID int, tagName string, authorizedUserIDs string) error {
 	return db.Exec(`
 		INSERT INTO projections_tags(ledger_id, tag_id, name, authorized_user_ids)
-		VALUES(?,?,?,'')
-		`, ledgerID, tagID, tagName).Error
+		VALUES(?,?,?,?)
+		`, ledgerID, tagID, tagName, authorizedUserIDs).Error
 }
 
 // SetupTransactions persist mock transactions to db
@@ -0,0 +1,29 @@
+package ldtesting
+
+import (
+	"fmt"
+
+	"github.com/icrowley/fake"
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/users"
+)
+
+// NewUser creates a new mock user structure with random id and subject
+func NewUser() *users.User {
+	return &users.User{
+		ID:      1 + rnd.Intn(1000000),
+		Subject: fmt.Sprintf("auth0|%v", fake.CharactersN(24)),
+	}
+}
+
+// SetupUser generate and persist a mock user identity
+func SetupUser(db *gorm.DB) (*users.User, error) {
+	user := NewUser()
+	if err := db.Exec(`
+		INSERT INTO user_identities(subject, user_id)
+		VALUES(?,?)
+		`, user.Subject, user.ID).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// DefaultBackburnerNamespace is a tube namespace backburner uses if not configured otherwise
+const DefaultBackburnerNamespace = "backburner.worker.queue"
+
+// BackburnerTube returns a name of the tube backburner uses for given queue,
+// e.g backburner.worker.queue.projections
+func BackburnerTube(namespace string, queue string) string {
+	return namespace + "." + queue
+}
+
+// BackburnerPayload - a body of the job enqueued by backburner
+type BackburnerPayload struct {
+	Class string            `json:"class"`
+	Args  []json.RawMessage `json:"args"`
+}
+
+// DecodeBackburnerPayload decodes the job body enqueued by backburner
+func DecodeBackburnerPayload(body []byte) (*BackburnerPayload, error) {
+	var payload BackburnerPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Class == "" {
+		return nil, errors.New("Backburner job class is missing")
+	}
+	return &payload, nil
+}
@@ -0,0 +1,282 @@
+package jobs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Replies of beanstalkd that are expected to be handled by callers
+var (
+	ErrTimedOut     = errors.New("TIMED_OUT")
+	ErrDeadlineSoon = errors.New("DEADLINE_SOON")
+	ErrNotFound     = errors.New("NOT_FOUND")
+)
+
+// ProtocolError - unexpected reply of beanstalkd to a command
+type ProtocolError struct {
+	Command string
+	Reply   string
+}
+
+func (err *ProtocolError) Error() string {
+	return fmt.Sprintf("beanstalkd: %v failed: %v", err.Command, err.Reply)
+}
+
+// dialTimeout is a max time to wait for a connection to beanstalkd
+const dialTimeout = 5 * time.Second
+
+// Conn - a connection to beanstalkd. Commands are serialized so the conn
+// is safe for concurrent use, however reserve blocks other commands until it returns
+type Conn struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Dial connects to beanstalkd. Address can be either host:port or
+// an url like beanstalk://host:port (the form v1 uses in BEANSTALKD_URL)
+func Dial(address string) (*Conn, error) {
+	if strings.Contains(address, "://") {
+		parsed, err := url.Parse(address)
+		if err != nil {
+			return nil, err
+		}
+		if parsed.Scheme != "beanstalk" {
+			return nil, fmt.Errorf("Unexpected beanstalkd url scheme: %v", parsed.Scheme)
+		}
+		address = parsed.Host
+	}
+	conn, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Conn) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
+
+func (c *Conn) readBody(size int) ([]byte, error) {
+	body := make([]byte, size+2)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return nil, err
+	}
+	return body[:size], nil
+}
+
+// exec sends a command and returns fields of the reply line.
+// Reply is checked to start with one of expected words
+func (c *Conn) exec(command string, body []byte, expected ...string) ([]string, error) {
+	request := command + "\r\n"
+	if body != nil {
+		request += string(body) + "\r\n"
+	}
+	if _, err := c.conn.Write([]byte(request)); err != nil {
+		return nil, err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, &ProtocolError{Command: command, Reply: line}
+	}
+	switch fields[0] {
+	case "TIMED_OUT":
+		return nil, ErrTimedOut
+	case "DEADLINE_SOON":
+		return nil, ErrDeadlineSoon
+	case "NOT_FOUND":
+		return nil, ErrNotFound
+	}
+	for _, word := range expected {
+		if fields[0] == word {
+			return fields, nil
+		}
+	}
+	return nil, &ProtocolError{Command: strings.Fields(command)[0], Reply: line}
+}
+
+func parseUint(fields []string, index int) (uint64, error) {
+	if len(fields) <= index {
+		return 0, fmt.Errorf("beanstalkd: malformed reply: %v", strings.Join(fields, " "))
+	}
+	return strconv.ParseUint(fields[index], 10, 64)
+}
+
+func seconds(duration time.Duration) int {
+	return int(duration / time.Second)
+}
+
+// Use sets a tube that subsequent puts go to
+func (c *Conn) Use(tube string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.exec("use "+tube, nil, "USING")
+	return err
+}
+
+// Put puts a job to the used tube and returns its id
+func (c *Conn) Put(body []byte, priority uint32, delay time.Duration, ttr time.Duration) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fields, err := c.exec(
+		fmt.Sprintf("put %v %v %v %v", priority, seconds(delay), seconds(ttr), len(body)),
+		body, "INSERTED",
+	)
+	if err != nil {
+		return 0, err
+	}
+	return parseUint(fields, 1)
+}
+
+// Watch adds the tube to the watch list. Returns a number of watched tubes
+func (c *Conn) Watch(tube string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fields, err := c.exec("watch "+tube, nil, "WATCHING")
+	if err != nil {
+		return 0, err
+	}
+	count, err := parseUint(fields, 1)
+	return int(count), err
+}
+
+// Ignore removes the tube from the watch list. Returns a number of watched tubes
+func (c *Conn) Ignore(tube string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fields, err := c.exec("ignore "+tube, nil, "WATCHING")
+	if err != nil {
+		return 0, err
+	}
+	count, err := parseUint(fields, 1)
+	return int(count), err
+}
+
+// Reserve waits up to timeout for a job in watched tubes.
+// Returns ErrTimedOut if there was no job
+func (c *Conn) Reserve(timeout time.Duration) (uint64, []byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fields, err := c.exec(fmt.Sprintf("reserve-with-timeout %v", seconds(timeout)), nil, "RESERVED")
+	if err != nil {
+		return 0, nil, err
+	}
+	id, err := parseUint(fields, 1)
+	if err != nil {
+		return 0, nil, err
+	}
+	size, err := parseUint(fields, 2)
+	if err != nil {
+		return 0, nil, err
+	}
+	body, err := c.readBody(int(size))
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, body, nil
+}
+
+// Delete deletes the job
+func (c *Conn) Delete(id uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.exec(fmt.Sprintf("delete %v", id), nil, "DELETED")
+	return err
+}
+
+// Release puts reserved job back to the ready queue after delay
+func (c *Conn) Release(id uint64, priority uint32, delay time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.exec(fmt.Sprintf("release %v %v %v", id, priority, seconds(delay)), nil, "RELEASED")
+	return err
+}
+
+// Bury puts reserved job to the buried queue. Buried jobs stay there until kicked
+func (c *Conn) Bury(id uint64, priority uint32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.exec(fmt.Sprintf("bury %v %v", id, priority), nil, "BURIED")
+	return err
+}
+
+// Touch extends time to run of the reserved job
+func (c *Conn) Touch(id uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.exec(fmt.Sprintf("touch %v", id), nil, "TOUCHED")
+	return err
+}
+
+// Kick moves up to bound buried jobs of the used tube back to the ready queue.
+// Returns a number of kicked jobs
+func (c *Conn) Kick(bound int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fields, err := c.exec(fmt.Sprintf("kick %v", bound), nil, "KICKED")
+	if err != nil {
+		return 0, err
+	}
+	count, err := parseUint(fields, 1)
+	return int(count), err
+}
+
+// readStats reads yaml dictionary beanstalkd replies with to stats commands
+func (c *Conn) readStats(command string) (map[string]string, error) {
+	fields, err := c.exec(command, nil, "OK")
+	if err != nil {
+		return nil, err
+	}
+	size, err := parseUint(fields, 1)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.readBody(int(size))
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]string)
+	for _, line := range strings.Split(string(body), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		stats[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return stats, nil
+}
+
+// StatsJob returns stats of the job (tube, state, releases, e.t.c)
+func (c *Conn) StatsJob(id uint64) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readStats(fmt.Sprintf("stats-job %v", id))
+}
+
+// Stats returns stats of the server
+func (c *Conn) Stats() (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readStats("stats")
+}
@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConn(t *testing.T) {
+	server := startFakeServer(t)
+	defer server.close()
+
+	Convey("Given a connection", t, func() {
+		conn, err := Dial("beanstalk://" + server.addr())
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		So(conn.Use("test-conn"), ShouldBeNil)
+		_, err = conn.Watch("test-conn")
+		So(err, ShouldBeNil)
+		_, err = conn.Ignore("default")
+		So(err, ShouldBeNil)
+
+		Convey("It should put and reserve jobs", func() {
+			id, err := conn.Put([]byte("job 1"), 100, 0, 60*time.Second)
+			So(err, ShouldBeNil)
+
+			reservedID, body, err := conn.Reserve(time.Second)
+			So(err, ShouldBeNil)
+			So(reservedID, ShouldEqual, id)
+			So(string(body), ShouldEqual, "job 1")
+
+			stats, err := conn.StatsJob(id)
+			So(err, ShouldBeNil)
+			So(stats["tube"], ShouldEqual, "test-conn")
+			So(stats["state"], ShouldEqual, "reserved")
+
+			So(conn.Delete(id), ShouldBeNil)
+			So(conn.Delete(id), ShouldEqual, ErrNotFound)
+		})
+
+		Convey("It should return ErrTimedOut if there are no jobs", func() {
+			_, _, err := conn.Reserve(0)
+			So(err, ShouldEqual, ErrTimedOut)
+		})
+
+		Convey("It should release, bury and kick jobs", func() {
+			id, err := conn.Put([]byte("job 2"), 100, 0, 60*time.Second)
+			So(err, ShouldBeNil)
+			_, _, err = conn.Reserve(time.Second)
+			So(err, ShouldBeNil)
+			So(conn.Release(id, 100, 0), ShouldBeNil)
+
+			_, _, err = conn.Reserve(time.Second)
+			So(err, ShouldBeNil)
+			So(conn.Bury(id, 100), ShouldBeNil)
+			So(server.job(id).state, ShouldEqual, "buried")
+			So(server.job(id).releases, ShouldEqual, 1)
+
+			kicked, err := conn.Kick(10)
+			So(err, ShouldBeNil)
+			So(kicked, ShouldEqual, 1)
+			So(server.job(id).state, ShouldEqual, "ready")
+			So(conn.Delete(id), ShouldBeNil)
+		})
+
+		Convey("It should return ProtocolError on unexpected reply", func() {
+			_, err := conn.Ignore("test-conn")
+			So(err, ShouldHaveSameTypeAs, &ProtocolError{})
+			So(err.Error(), ShouldEqual, "beanstalkd: ignore failed: NOT_IGNORED")
+		})
+	})
+
+	Convey("It should reject urls with unexpected scheme", t, func() {
+		_, err := Dial("http://" + server.addr())
+		So(err, ShouldNotBeNil)
+	})
+}
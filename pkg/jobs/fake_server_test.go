@@ -0,0 +1,239 @@
+package jobs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeJob - a job kept by the fake server
+type fakeJob struct {
+	id       uint64
+	tube     string
+	priority uint64
+	body     []byte
+	state    string
+	readyAt  time.Time
+	releases int
+	buries   int
+}
+
+// fakeServer - an in-process beanstalkd that supports commands the package uses
+type fakeServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	lastID   uint64
+	jobs     map[uint64]*fakeJob
+}
+
+func startFakeServer(t *testing.T) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeServer{listener: listener, jobs: make(map[uint64]*fakeJob)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *fakeServer) addr() string {
+	return server.listener.Addr().String()
+}
+
+func (server *fakeServer) close() {
+	server.listener.Close()
+}
+
+// job returns a copy of the job so it can be inspected without locks
+func (server *fakeServer) job(id uint64) *fakeJob {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	job, ok := server.jobs[id]
+	if !ok {
+		return nil
+	}
+	copied := *job
+	return &copied
+}
+
+// waitFor polls the condition until it's true or timeout passes
+func (server *fakeServer) waitFor(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return condition()
+}
+
+func (server *fakeServer) reserve(watching map[string]bool) *fakeJob {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	var found *fakeJob
+	for _, job := range server.jobs {
+		if job.state == "delayed" && !time.Now().Before(job.readyAt) {
+			job.state = "ready"
+		}
+		if job.state != "ready" || !watching[job.tube] {
+			continue
+		}
+		if found == nil || job.priority < found.priority || (job.priority == found.priority && job.id < found.id) {
+			found = job
+		}
+	}
+	if found != nil {
+		found.state = "reserved"
+	}
+	return found
+}
+
+func (server *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	using := "default"
+	watching := map[string]bool{"default": true}
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			reply("BAD_FORMAT")
+			continue
+		}
+		arg := func(index int) uint64 {
+			value, _ := strconv.ParseUint(fields[index], 10, 64)
+			return value
+		}
+		switch fields[0] {
+		case "use":
+			using = fields[1]
+			reply("USING %v", using)
+		case "watch":
+			watching[fields[1]] = true
+			reply("WATCHING %v", len(watching))
+		case "ignore":
+			if len(watching) == 1 {
+				reply("NOT_IGNORED")
+				continue
+			}
+			delete(watching, fields[1])
+			reply("WATCHING %v", len(watching))
+		case "put":
+			body := make([]byte, arg(4)+2)
+			if _, err := io.ReadFull(reader, body); err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.lastID++
+			job := &fakeJob{
+				id:       server.lastID,
+				tube:     using,
+				priority: arg(1),
+				body:     body[:len(body)-2],
+				state:    "ready",
+			}
+			if delay := arg(2); delay > 0 {
+				job.state = "delayed"
+				job.readyAt = time.Now().Add(time.Duration(delay) * time.Second)
+			}
+			server.jobs[job.id] = job
+			server.mu.Unlock()
+			reply("INSERTED %v", job.id)
+		case "reserve-with-timeout":
+			deadline := time.Now().Add(time.Duration(arg(1)) * time.Second)
+			var job *fakeJob
+			for job = server.reserve(watching); job == nil && time.Now().Before(deadline); job = server.reserve(watching) {
+				time.Sleep(5 * time.Millisecond)
+			}
+			if job == nil {
+				reply("TIMED_OUT")
+				continue
+			}
+			reply("RESERVED %v %v", job.id, len(job.body))
+			conn.Write(append(job.body, '\r', '\n'))
+		case "delete", "release", "bury", "touch":
+			server.mu.Lock()
+			job, ok := server.jobs[arg(1)]
+			if !ok {
+				server.mu.Unlock()
+				reply("NOT_FOUND")
+				continue
+			}
+			switch fields[0] {
+			case "delete":
+				delete(server.jobs, job.id)
+				reply("DELETED")
+			case "release":
+				job.releases++
+				job.priority = arg(2)
+				job.state = "ready"
+				if delay := arg(3); delay > 0 {
+					job.state = "delayed"
+					job.readyAt = time.Now().Add(time.Duration(delay) * time.Second)
+				}
+				reply("RELEASED")
+			case "bury":
+				job.buries++
+				job.priority = arg(2)
+				job.state = "buried"
+				reply("BURIED")
+			case "touch":
+				reply("TOUCHED")
+			}
+			server.mu.Unlock()
+		case "kick":
+			server.mu.Lock()
+			kicked := uint64(0)
+			for _, job := range server.jobs {
+				if kicked < arg(1) && job.tube == using && job.state == "buried" {
+					job.state = "ready"
+					kicked++
+				}
+			}
+			server.mu.Unlock()
+			reply("KICKED %v", kicked)
+		case "stats-job":
+			server.mu.Lock()
+			job, ok := server.jobs[arg(1)]
+			if !ok {
+				server.mu.Unlock()
+				reply("NOT_FOUND")
+				continue
+			}
+			stats := fmt.Sprintf("---\nid: %v\ntube: %v\nstate: %v\npri: %v\nreleases: %v\nburies: %v\n",
+				job.id, job.tube, job.state, job.priority, job.releases, job.buries)
+			server.mu.Unlock()
+			reply("OK %v", len(stats))
+			reply("%s", stats)
+		case "stats":
+			server.mu.Lock()
+			stats := fmt.Sprintf("---\ncurrent-jobs-ready: %v\n", len(server.jobs))
+			server.mu.Unlock()
+			reply("OK %v", len(stats))
+			reply("%s", stats)
+		default:
+			reply("UNKNOWN_COMMAND")
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"ledger.api/pkg/logging"
+)
+
+// Job - a job reserved by a worker
+type Job struct {
+	ID   uint64
+	Tube string
+	Body []byte
+
+	// Attempt is a number of the attempt to handle the job starting from 1
+	Attempt int
+}
+
+// Handler handles a job. Failed jobs are retried unless the error is permanent
+type Handler func(ctx context.Context, job *Job) error
+
+// permanentError - an error that should not be retried
+type permanentError struct {
+	err error
+}
+
+func (err *permanentError) Error() string {
+	return err.err.Error()
+}
+
+// Permanent marks the error as permanent so the job is buried without retries
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Options - pool options
+type Options struct {
+	// Concurrency is a number of workers. Each worker holds its own connection
+	Concurrency int
+
+	// MaxRetries is a number of retries of a failed job before it gets buried
+	MaxRetries int
+
+	// Backoff returns a delay before given retry. Exponential backoff is used if not set
+	Backoff func(retry int) time.Duration
+
+	// ReserveTimeout is a max time a worker waits for a job before checking if the pool is stopped
+	ReserveTimeout time.Duration
+
+	// ReconnectDelay is a time to wait before reconnecting after connection failure
+	ReconnectDelay time.Duration
+}
+
+// DefaultOptions returns options suitable for most cases
+func DefaultOptions() Options {
+	return Options{
+		Concurrency:    2,
+		MaxRetries:     5,
+		Backoff:        ExponentialBackoff(1*time.Second, 5*time.Minute),
+		ReserveTimeout: 1 * time.Second,
+		ReconnectDelay: 5 * time.Second,
+	}
+}
+
+// ExponentialBackoff returns a backoff that doubles the delay on each retry up to max
+func ExponentialBackoff(initial time.Duration, max time.Duration) func(retry int) time.Duration {
+	return func(retry int) time.Duration {
+		delay := initial
+		for i := 1; i < retry && delay < max; i++ {
+			delay *= 2
+		}
+		if delay > max {
+			return max
+		}
+		return delay
+	}
+}
+
+// Pool - a pool of workers that reserve jobs of registered tubes and dispatch them to handlers
+type Pool struct {
+	dial     func() (*Conn, error)
+	options  Options
+	handlers map[string]Handler
+}
+
+// CreatePool creates a pool that connects to beanstalkd using given dial func
+func CreatePool(dial func() (*Conn, error), options Options) *Pool {
+	defaults := DefaultOptions()
+	if options.Concurrency <= 0 {
+		options.Concurrency = defaults.Concurrency
+	}
+	if options.Backoff == nil {
+		options.Backoff = defaults.Backoff
+	}
+	if options.ReserveTimeout <= 0 {
+		options.ReserveTimeout = defaults.ReserveTimeout
+	}
+	if options.ReconnectDelay <= 0 {
+		options.ReconnectDelay = defaults.ReconnectDelay
+	}
+	return &Pool{dial: dial, options: options, handlers: make(map[string]Handler)}
+}
+
+// Handle registers a handler of jobs of the tube. Should be called before Run
+func (pool *Pool) Handle(tube string, handler Handler) {
+	pool.handlers[tube] = handler
+}
+
+func (pool *Pool) tubes() []string {
+	tubes := make([]string, 0, len(pool.handlers))
+	for tube := range pool.handlers {
+		tubes = append(tubes, tube)
+	}
+	sort.Strings(tubes)
+	return tubes
+}
+
+// Run starts workers and blocks until ctx is done and all workers are stopped
+func (pool *Pool) Run(ctx context.Context) error {
+	if len(pool.handlers) == 0 {
+		return errors.New("No job handlers registered")
+	}
+	logger := logging.FromContext(ctx)
+	logger.Infof("Starting %v workers. Tubes: %v", pool.options.Concurrency, pool.tubes())
+	var wg sync.WaitGroup
+	for i := 0; i < pool.options.Concurrency; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			workerLogger := logger.WithField("WorkerID", workerID)
+			pool.runWorker(logging.CreateContext(ctx, workerLogger))
+		}(i + 1)
+	}
+	wg.Wait()
+	logger.Info("All workers stopped")
+	return nil
+}
+
+// connect opens a connection that watches registered tubes only
+func (pool *Pool) connect() (*Conn, error) {
+	conn, err := pool.dial()
+	if err != nil {
+		return nil, err
+	}
+	for _, tube := range pool.tubes() {
+		if _, err := conn.Watch(tube); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if _, ok := pool.handlers["default"]; !ok {
+		if _, err := conn.Ignore("default"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// sleep waits for given duration and returns false if ctx got done earlier
+func sleep(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (pool *Pool) runWorker(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+	var conn *Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	for ctx.Err() == nil {
+		if conn == nil {
+			var err error
+			if conn, err = pool.connect(); err != nil {
+				logger.WithError(err).Errorf("Failed to connect. Reconnecting in %v", pool.options.ReconnectDelay)
+				conn = nil
+				sleep(ctx, pool.options.ReconnectDelay)
+				continue
+			}
+		}
+		id, body, err := conn.Reserve(pool.options.ReserveTimeout)
+		if err == ErrTimedOut || err == ErrDeadlineSoon {
+			continue
+		}
+		if err != nil {
+			logger.WithError(err).Errorf("Failed to reserve a job. Reconnecting in %v", pool.options.ReconnectDelay)
+			conn.Close()
+			conn = nil
+			sleep(ctx, pool.options.ReconnectDelay)
+			continue
+		}
+		if err := pool.process(ctx, conn, id, body); err != nil {
+			logger.WithError(err).Errorf("Failed to process job %v. Reconnecting", id)
+			conn.Close()
+			conn = nil
+		}
+	}
+}
+
+// process dispatches the job to its handler and then deletes, releases or buries it.
+// Returned error indicates a connection failure
+func (pool *Pool) process(ctx context.Context, conn *Conn, id uint64, body []byte) error {
+	stats, err := conn.StatsJob(id)
+	if err != nil {
+		return err
+	}
+	releases, _ := strconv.Atoi(stats["releases"])
+	priority, _ := strconv.ParseUint(stats["pri"], 10, 32)
+	job := Job{ID: id, Tube: stats["tube"], Body: body, Attempt: releases + 1}
+	logger := logging.FromContext(ctx).WithFields(logging.Fields{
+		"JobID":   job.ID,
+		"Tube":    job.Tube,
+		"Attempt": job.Attempt,
+	})
+
+	handler, ok := pool.handlers[job.Tube]
+	if !ok {
+		logger.Warn("No handler registered for the tube. Burying the job")
+		return conn.Bury(id, uint32(priority))
+	}
+
+	started := time.Now()
+	handlerErr := pool.invoke(logging.CreateContext(ctx, logger), handler, &job)
+	if handlerErr == nil {
+		logger.Debugf("Job completed in %v", time.Since(started))
+		return conn.Delete(id)
+	}
+	if _, permanent := handlerErr.(*permanentError); permanent || job.Attempt > pool.options.MaxRetries {
+		logger.WithError(handlerErr).Error("Job failed. Burying the job")
+		return conn.Bury(id, uint32(priority))
+	}
+	delay := pool.options.Backoff(job.Attempt)
+	logger.WithError(handlerErr).Warnf("Job failed. Retrying in %v", delay)
+	return conn.Release(id, uint32(priority), delay)
+}
+
+// invoke calls the handler turning panics into errors
+func (pool *Pool) invoke(ctx context.Context, handler Handler, job *Job) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logging.FromContext(ctx).Errorf("Job handler panic: %v\n%s", recovered, debug.Stack())
+			err = fmt.Errorf("Job handler panic: %v", recovered)
+		}
+	}()
+	return handler(ctx, job)
+}
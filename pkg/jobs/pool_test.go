@@ -0,0 +1,148 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/logging"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	Convey("It should double the delay up to max", t, func() {
+		backoff := ExponentialBackoff(time.Second, 5*time.Second)
+		So(backoff(1), ShouldEqual, time.Second)
+		So(backoff(2), ShouldEqual, 2*time.Second)
+		So(backoff(3), ShouldEqual, 4*time.Second)
+		So(backoff(4), ShouldEqual, 5*time.Second)
+		So(backoff(100), ShouldEqual, 5*time.Second)
+	})
+}
+
+func TestDecodeBackburnerPayload(t *testing.T) {
+	Convey("It should decode class and args", t, func() {
+		payload, err := DecodeBackburnerPayload([]byte(`{"class":"Projections::Worker","args":["ledger-1",10]}`))
+		So(err, ShouldBeNil)
+		So(payload.Class, ShouldEqual, "Projections::Worker")
+		So(payload.Args, ShouldHaveLength, 2)
+		So(string(payload.Args[0]), ShouldEqual, `"ledger-1"`)
+	})
+
+	Convey("It should fail if class is missing", t, func() {
+		_, err := DecodeBackburnerPayload([]byte(`{"args":[]}`))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("It should build tube names", t, func() {
+		So(BackburnerTube(DefaultBackburnerNamespace, "projections"), ShouldEqual, "backburner.worker.queue.projections")
+	})
+}
+
+func TestPool(t *testing.T) {
+	server := startFakeServer(t)
+	defer server.close()
+
+	dial := func() (*Conn, error) { return Dial(server.addr()) }
+	put := func(tube string, body string) uint64 {
+		conn, err := dial()
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		So(conn.Use(tube), ShouldBeNil)
+		id, err := conn.Put([]byte(body), 100, 0, 60*time.Second)
+		So(err, ShouldBeNil)
+		return id
+	}
+
+	Convey("Given a running pool", t, func() {
+		pool := CreatePool(dial, Options{
+			Concurrency:    3,
+			MaxRetries:     2,
+			Backoff:        func(int) time.Duration { return 0 },
+			ReserveTimeout: time.Second,
+			ReconnectDelay: 10 * time.Millisecond,
+		})
+		handled := make(chan *Job, 10)
+		pool.Handle("test-succeed", func(ctx context.Context, job *Job) error {
+			handled <- job
+			return nil
+		})
+		pool.Handle("test-fail", func(ctx context.Context, job *Job) error {
+			handled <- job
+			return errors.New("failed")
+		})
+		pool.Handle("test-permanent", func(ctx context.Context, job *Job) error {
+			handled <- job
+			return Permanent(errors.New("failed"))
+		})
+		pool.Handle("test-panic", func(ctx context.Context, job *Job) error {
+			handled <- job
+			panic("boom")
+		})
+
+		ctx, cancel := context.WithCancel(logging.CreateContext(context.Background(), logging.NewTestLogger()))
+		stopped := make(chan error)
+		go func() { stopped <- pool.Run(ctx) }()
+		defer func() {
+			cancel()
+			<-stopped
+		}()
+
+		receive := func() *Job {
+			select {
+			case job := <-handled:
+				return job
+			case <-time.After(5 * time.Second):
+				return nil
+			}
+		}
+
+		Convey("It should handle and delete a job", func() {
+			id := put("test-succeed", "job body")
+			job := receive()
+			So(job, ShouldNotBeNil)
+			So(job.ID, ShouldEqual, id)
+			So(job.Tube, ShouldEqual, "test-succeed")
+			So(string(job.Body), ShouldEqual, "job body")
+			So(job.Attempt, ShouldEqual, 1)
+			So(server.waitFor(time.Second, func() bool { return server.job(id) == nil }), ShouldBeTrue)
+		})
+
+		Convey("It should retry a failed job and bury it when retries are exhausted", func() {
+			id := put("test-fail", "job body")
+			for attempt := 1; attempt <= 3; attempt++ {
+				job := receive()
+				So(job, ShouldNotBeNil)
+				So(job.Attempt, ShouldEqual, attempt)
+			}
+			So(server.waitFor(time.Second, func() bool { return server.job(id).state == "buried" }), ShouldBeTrue)
+			So(server.job(id).releases, ShouldEqual, 2)
+		})
+
+		Convey("It should bury a job failed permanently without retries", func() {
+			id := put("test-permanent", "job body")
+			So(receive(), ShouldNotBeNil)
+			So(server.waitFor(time.Second, func() bool { return server.job(id).state == "buried" }), ShouldBeTrue)
+			So(server.job(id).releases, ShouldEqual, 0)
+		})
+
+		Convey("It should recover from handler panic and retry the job", func() {
+			id := put("test-panic", "job body")
+			So(receive(), ShouldNotBeNil)
+			So(receive(), ShouldNotBeNil)
+			So(server.job(id).releases, ShouldBeGreaterThanOrEqualTo, 1)
+		})
+
+		Convey("It should not reserve jobs of other tubes", func() {
+			id := put("test-other", "job body")
+			time.Sleep(50 * time.Millisecond)
+			So(server.job(id).state, ShouldEqual, "ready")
+		})
+	})
+
+	Convey("It should fail to run without handlers", t, func() {
+		pool := CreatePool(dial, Options{})
+		So(pool.Run(context.Background()), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,402 @@
+package ledgers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"ledger.api/pkg/eventstore"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
+	"ledger.api/pkg/users"
+)
+
+var (
+	errLedgerNotFound       = errors.New("Ledger not found")
+	errNotLedgerOwner       = errors.New("Only the ledger owner can manage members")
+	errMemberNotFound       = errors.New("User is not a member of the ledger")
+	errOwnerCanNotBeRevoked = errors.New("Access of the ledger owner can not be revoked")
+	errAlreadyMember        = errors.New("User is already a member of the ledger")
+	errInvalidInvitation    = errors.New("Invitation token is invalid")
+	errInvitationExpired    = errors.New("Invitation has expired")
+	errInvitationUsed       = errors.New("Invitation has already been accepted or declined")
+	errEmailNotVerified     = errors.New("Verified email is required to accept or decline invitations")
+	errNotInvitee           = errors.New("Invitation has been sent to other email")
+)
+
+// invitationIssuer is an issuer of invitation tokens
+const invitationIssuer = "ledger.api/invitations"
+
+// invitationTTL is a time an invitation can be accepted within
+const invitationTTL = 7 * 24 * time.Hour
+
+// Events below are emitted by v1 ledger aggregate. Stream id is a ledger id.
+
+type ledgerShared struct {
+	AggregateID string `json:"aggregate_id"`
+	UserID      int    `json:"user_id"`
+}
+
+func (ledgerShared) EventType() string { return "Domain::Events::LedgerShared" }
+
+type ledgerUnshared struct {
+	AggregateID string `json:"aggregate_id"`
+	UserID      int    `json:"user_id"`
+}
+
+func (ledgerUnshared) EventType() string { return "Domain::Events::LedgerUnshared" }
+
+// invitationPayload is a JSON API representation of the invitation
+// submitted by ledger owners to invite users
+type invitationPayload struct {
+	ID    string `jsonapi:"primary,invitations"`
+	Email string `jsonapi:"attr,email" validate:"required,email,max=255"`
+}
+
+// invitationTokenPayload is submitted by invited users to accept or decline invitations
+type invitationTokenPayload struct {
+	ID    string `jsonapi:"primary,invitations"`
+	Token string `jsonapi:"attr,token" validate:"required"`
+}
+
+type invitationDTO struct {
+	InvitationID string    `json:"invitationID"`
+	LedgerID     string    `json:"ledgerID"`
+	Email        string    `json:"email"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+
+	// Token is returned once on creation and should be delivered to the invited user
+	Token string `json:"token"`
+}
+
+// invitationClaims are claims of a signed invitation token
+type invitationClaims struct {
+	*jwt.Claims
+	LedgerID string `json:"ledgerID"`
+	Email    string `json:"email"`
+}
+
+type inviteMemberCommand struct {
+	ledgerID string
+	user     *users.User
+	email    string
+}
+
+// acceptInvitationCommand and declineInvitationCommand are processed only if
+// the verified email of the user is the email the invitation has been sent to
+type acceptInvitationCommand struct {
+	token string
+	user  *users.User
+	email string
+}
+
+type declineInvitationCommand struct {
+	token string
+	user  *users.User
+	email string
+}
+
+type revokeMemberCommand struct {
+	ledgerID     string
+	user         *users.User
+	memberUserID int
+}
+
+// CommandService is a service to process commands that change ledger members
+type CommandService interface {
+	processInviteMemberCommand(ctx context.Context, cmd *inviteMemberCommand) (*invitationDTO, error)
+	processAcceptInvitationCommand(ctx context.Context, cmd *acceptInvitationCommand) (string, error)
+	processDeclineInvitationCommand(ctx context.Context, cmd *declineInvitationCommand) error
+	processRevokeMemberCommand(ctx context.Context, cmd *revokeMemberCommand) error
+}
+
+type dbCommandService struct {
+	db    *gorm.DB
+	store eventstore.Store
+
+	// invitationKey is a key invitation tokens are signed with
+	invitationKey []byte
+	now           func() time.Time
+}
+
+func commandHeaders(user *users.User) eventstore.Headers {
+	return eventstore.Headers{"user_id": user.ID}
+}
+
+func containsUserID(userIDs []int, userID int) bool {
+	for _, id := range userIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (svc *dbCommandService) signInvitation(claims *invitationClaims) (string, error) {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: svc.invitationKey}, nil)
+	if err != nil {
+		return "", err
+	}
+	return jwt.Signed(signer).Claims(claims).CompactSerialize()
+}
+
+// parseInvitation verifies signature and expiry of the token and returns its claims
+func (svc *dbCommandService) parseInvitation(token string) (*invitationClaims, error) {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		return nil, errInvalidInvitation
+	}
+	claims := invitationClaims{}
+	if err := parsed.Claims(svc.invitationKey, &claims); err != nil || claims.Claims == nil {
+		return nil, errInvalidInvitation
+	}
+	err = claims.ValidateWithLeeway(jwt.Expected{Issuer: invitationIssuer, Time: svc.now()}, 0)
+	if err == jwt.ErrExpired {
+		return nil, errInvitationExpired
+	}
+	if err != nil || claims.ID == "" || claims.LedgerID == "" {
+		return nil, errInvalidInvitation
+	}
+	return &claims, nil
+}
+
+func (svc *dbCommandService) processInviteMemberCommand(ctx context.Context, cmd *inviteMemberCommand) (*invitationDTO, error) {
+	if cmd.ledgerID == "" {
+		return nil, errors.New("Please provide ledgerID")
+	}
+	if cmd.user == nil {
+		return nil, errors.New("Please provide user")
+	}
+	logger := logging.FromContext(ctx)
+	db := tracing.DB(ctx, svc.db)
+
+	ownerUserID, _, err := loadLedgerUsers(db, cmd.ledgerID)
+	if err != nil {
+		return nil, err
+	}
+	if ownerUserID != cmd.user.ID {
+		return nil, errNotLedgerOwner
+	}
+
+	now := svc.now().UTC()
+	invitation := invitationDTO{
+		InvitationID: uuid.NewV4().String(),
+		LedgerID:     cmd.ledgerID,
+		Email:        cmd.email,
+		ExpiresAt:    now.Add(invitationTTL).Truncate(time.Second),
+	}
+	invitation.Token, err = svc.signInvitation(&invitationClaims{
+		Claims: &jwt.Claims{
+			Issuer:   invitationIssuer,
+			ID:       invitation.InvitationID,
+			IssuedAt: jwt.NewNumericDate(now),
+			Expiry:   jwt.NewNumericDate(invitation.ExpiresAt),
+		},
+		LedgerID: invitation.LedgerID,
+		Email:    invitation.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("Inviting member to ledger %v. Invitation: %v", cmd.ledgerID, invitation.InvitationID)
+	if err := tracing.Exec(db, `
+		INSERT INTO ledger_invitations(invitation_id, ledger_id, email, invited_by_user_id, created_at, expires_at)
+		VALUES(?, ?, ?, ?, ?, ?)
+		`, invitation.InvitationID, invitation.LedgerID, invitation.Email, cmd.user.ID, now, invitation.ExpiresAt,
+	).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// checkInvitee makes sure the invitation has been sent to given verified email
+func checkInvitee(claims *invitationClaims, email string) error {
+	if email == "" {
+		return errEmailNotVerified
+	}
+	if !strings.EqualFold(claims.Email, email) {
+		return errNotInvitee
+	}
+	return nil
+}
+
+// loadLedgerMembers returns the owner and members of the ledger. Members of the projection are
+// updated with shared and unshared events of the ledger stream so members are up to date under
+// the stream lock even if the projection lags behind. Replaying events already applied to the
+// projection is safe since the last event of each user defines whether the user is a member
+func loadLedgerMembers(tx eventstore.Tx, ledgerID string) (int, []int, error) {
+	ownerUserID, userIDs, err := loadLedgerUsers(tx.DB(), ledgerID)
+	if err != nil {
+		return 0, nil, err
+	}
+	events, err := tx.ReadEvents(ledgerID, "Domain::Events::Ledger")
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, evt := range events {
+		switch evt.Type {
+		case ledgerShared{}.EventType():
+			var data ledgerShared
+			if err := evt.Decode(&data); err != nil {
+				return 0, nil, err
+			}
+			if !containsUserID(userIDs, data.UserID) {
+				userIDs = append(userIDs, data.UserID)
+			}
+		case ledgerUnshared{}.EventType():
+			var data ledgerUnshared
+			if err := evt.Decode(&data); err != nil {
+				return 0, nil, err
+			}
+			remaining := userIDs[:0]
+			for _, userID := range userIDs {
+				if userID != data.UserID {
+					remaining = append(remaining, userID)
+				}
+			}
+			userIDs = remaining
+		}
+	}
+	return ownerUserID, userIDs, nil
+}
+
+// lockPendingInvitation locks the invitation row within the transaction
+// and makes sure it has not been accepted or declined yet
+func lockPendingInvitation(tx *gorm.DB, invitationID string) error {
+	var isUsed bool
+	err := tx.Raw(`
+		SELECT accepted_at IS NOT NULL OR declined_at IS NOT NULL
+		FROM ledger_invitations WHERE invitation_id = ?
+		FOR UPDATE
+		`, invitationID).Row().Scan(&isUsed)
+	if err == sql.ErrNoRows {
+		return errInvalidInvitation
+	}
+	if err != nil {
+		return err
+	}
+	if isUsed {
+		return errInvitationUsed
+	}
+	return nil
+}
+
+// processAcceptInvitationCommand shares the ledger with the user. Returns id of the ledger.
+// The invitation is marked accepted within the same transaction the event is appended with
+func (svc *dbCommandService) processAcceptInvitationCommand(ctx context.Context, cmd *acceptInvitationCommand) (string, error) {
+	if cmd.user == nil {
+		return "", errors.New("Please provide user")
+	}
+	logger := logging.FromContext(ctx)
+
+	claims, err := svc.parseInvitation(cmd.token)
+	if err != nil {
+		return "", err
+	}
+	if err := checkInvitee(claims, cmd.email); err != nil {
+		return "", err
+	}
+
+	err = svc.store.Transaction(ctx, commandHeaders(cmd.user), func(tx eventstore.Tx) error {
+		if err := lockPendingInvitation(tx.DB(), claims.ID); err != nil {
+			return err
+		}
+		ownerUserID, userIDs, err := loadLedgerMembers(tx, claims.LedgerID)
+		if err != nil {
+			return err
+		}
+		if ownerUserID == cmd.user.ID || containsUserID(userIDs, cmd.user.ID) {
+			return errAlreadyMember
+		}
+		if err := tracing.Exec(tx.DB(),
+			"UPDATE ledger_invitations SET accepted_at = ?, accepted_by_user_id = ? WHERE invitation_id = ?",
+			svc.now().UTC(), cmd.user.ID, claims.ID,
+		).Error; err != nil {
+			return err
+		}
+		logger.Debugf("Sharing ledger %v with user %v. Invitation: %v", claims.LedgerID, cmd.user.ID, claims.ID)
+		return tx.Append(claims.LedgerID, &ledgerShared{AggregateID: claims.LedgerID, UserID: cmd.user.ID})
+	})
+	if err != nil {
+		return "", err
+	}
+	return claims.LedgerID, nil
+}
+
+func (svc *dbCommandService) processDeclineInvitationCommand(ctx context.Context, cmd *declineInvitationCommand) error {
+	if cmd.user == nil {
+		return errors.New("Please provide user")
+	}
+	logger := logging.FromContext(ctx)
+
+	claims, err := svc.parseInvitation(cmd.token)
+	if err != nil {
+		return err
+	}
+	if err := checkInvitee(claims, cmd.email); err != nil {
+		return err
+	}
+
+	tx := tracing.DB(ctx, svc.db).Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+	if err := lockPendingInvitation(tx, claims.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	logger.Debugf("Declining invitation %v to ledger %v", claims.ID, claims.LedgerID)
+	if err := tracing.Exec(tx,
+		"UPDATE ledger_invitations SET declined_at = ? WHERE invitation_id = ?", svc.now().UTC(), claims.ID,
+	).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// processRevokeMemberCommand revokes access of the member to the ledger.
+// The owner can revoke access of any member, members can revoke their own access
+func (svc *dbCommandService) processRevokeMemberCommand(ctx context.Context, cmd *revokeMemberCommand) error {
+	if cmd.ledgerID == "" {
+		return errors.New("Please provide ledgerID")
+	}
+	if cmd.user == nil {
+		return errors.New("Please provide user")
+	}
+	logger := logging.FromContext(ctx)
+
+	// Members are checked under the ledger stream lock so concurrent commands can not interleave
+	return svc.store.Transaction(ctx, commandHeaders(cmd.user), func(tx eventstore.Tx) error {
+		ownerUserID, userIDs, err := loadLedgerMembers(tx, cmd.ledgerID)
+		if err != nil {
+			return err
+		}
+		if cmd.user.ID != ownerUserID && cmd.user.ID != cmd.memberUserID {
+			return errNotLedgerOwner
+		}
+		if cmd.memberUserID == ownerUserID {
+			return errOwnerCanNotBeRevoked
+		}
+		if !containsUserID(userIDs, cmd.memberUserID) {
+			return errMemberNotFound
+		}
+
+		logger.Debugf("Revoking access of user %v to ledger %v", cmd.memberUserID, cmd.ledgerID)
+		return tx.Append(cmd.ledgerID, &ledgerUnshared{AggregateID: cmd.ledgerID, UserID: cmd.memberUserID})
+	})
+}
+
+// CreateCommandService initializes a new instance of the command service.
+// Invitation tokens are signed with given key
+func CreateCommandService(db *gorm.DB, store eventstore.Store, invitationKey []byte) CommandService {
+	svc := dbCommandService{db: db, store: store, invitationKey: invitationKey, now: time.Now}
+	return &svc
+}
@@ -0,0 +1,211 @@
+package ledgers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icrowley/fake"
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/eventstore"
+	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/logging"
+)
+
+func TestMemberCommands(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given member commands", t, func() {
+		store := ldtesting.NewEventStore(DB)
+		svc := CreateCommandService(DB, store, []byte("invitations-test-key-0123456789ab")).(*dbCommandService)
+		owner := ldtesting.NewUser()
+		member := ldtesting.NewUser()
+		invitee := ldtesting.NewUser()
+		ldr := ledger{
+			AggregateID:       uuid.NewV4().String(),
+			OwnerUserID:       owner.ID,
+			Name:              fake.Brand(),
+			CurrencyCode:      fake.CurrencyCode(),
+			AuthorizedUserIDs: ldtesting.AuthorizedUserIDs(owner, member),
+		}
+		So(DB.Create(&ldr).Error, ShouldBeNil)
+		email := fake.EmailAddress()
+
+		Convey("When inviting a member", func() {
+			Convey("It should create a signed invitation", func() {
+				invitation, err := svc.processInviteMemberCommand(ctx, &inviteMemberCommand{ledgerID: ldr.AggregateID, user: owner, email: email})
+				So(err, ShouldBeNil)
+				So(invitation.LedgerID, ShouldEqual, ldr.AggregateID)
+				So(invitation.Email, ShouldEqual, email)
+				So(invitation.ExpiresAt, ShouldHappenWithin, time.Minute, time.Now().Add(invitationTTL))
+
+				claims, err := svc.parseInvitation(invitation.Token)
+				So(err, ShouldBeNil)
+				So(claims.ID, ShouldEqual, invitation.InvitationID)
+				So(claims.LedgerID, ShouldEqual, ldr.AggregateID)
+				So(claims.Email, ShouldEqual, email)
+
+				var count int
+				So(DB.Table("ledger_invitations").Where("invitation_id = ?", invitation.InvitationID).Count(&count).Error, ShouldBeNil)
+				So(count, ShouldEqual, 1)
+			})
+
+			Convey("It should fail if user is not the owner", func() {
+				_, err := svc.processInviteMemberCommand(ctx, &inviteMemberCommand{ledgerID: ldr.AggregateID, user: member, email: email})
+				So(err, ShouldEqual, errNotLedgerOwner)
+			})
+
+			Convey("It should fail if ledger does not exist", func() {
+				_, err := svc.processInviteMemberCommand(ctx, &inviteMemberCommand{ledgerID: uuid.NewV4().String(), user: owner, email: email})
+				So(err, ShouldEqual, errLedgerNotFound)
+			})
+		})
+
+		Convey("When invitation is sent", func() {
+			invitation, err := svc.processInviteMemberCommand(ctx, &inviteMemberCommand{ledgerID: ldr.AggregateID, user: owner, email: email})
+			So(err, ShouldBeNil)
+
+			Convey("It should share the ledger with the user that accepts it", func() {
+				ledgerID, err := svc.processAcceptInvitationCommand(ctx, &acceptInvitationCommand{token: invitation.Token, user: invitee, email: email})
+				So(err, ShouldBeNil)
+				So(ledgerID, ShouldEqual, ldr.AggregateID)
+				So(store.Commits, ShouldHaveLength, 1)
+				So(store.Commits[0].StreamID, ShouldEqual, ldr.AggregateID)
+				So(store.Commits[0].Headers, ShouldResemble, eventstore.Headers{"user_id": invitee.ID})
+				So(store.Commits[0].Events, ShouldResemble, []eventstore.Event{
+					&ledgerShared{AggregateID: ldr.AggregateID, UserID: invitee.ID},
+				})
+
+				var acceptedByUserID int
+				So(DB.Table("ledger_invitations").Select("accepted_by_user_id").
+					Where("invitation_id = ?", invitation.InvitationID).Row().Scan(&acceptedByUserID), ShouldBeNil)
+				So(acceptedByUserID, ShouldEqual, invitee.ID)
+			})
+
+			Convey("It should accept the invitation once", func() {
+				_, err := svc.processAcceptInvitationCommand(ctx, &acceptInvitationCommand{token: invitation.Token, user: invitee, email: email})
+				So(err, ShouldBeNil)
+				_, err = svc.processAcceptInvitationCommand(ctx, &acceptInvitationCommand{token: invitation.Token, user: ldtesting.NewUser(), email: email})
+				So(err, ShouldEqual, errInvitationUsed)
+				So(store.Commits, ShouldHaveLength, 1)
+			})
+
+			Convey("It should not share the ledger if user is already a member", func() {
+				_, err := svc.processAcceptInvitationCommand(ctx, &acceptInvitationCommand{token: invitation.Token, user: member, email: email})
+				So(err, ShouldEqual, errAlreadyMember)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should accept the invitation regardless of email case", func() {
+				_, err := svc.processAcceptInvitationCommand(ctx, &acceptInvitationCommand{token: invitation.Token, user: invitee, email: strings.ToUpper(email)})
+				So(err, ShouldBeNil)
+			})
+
+			Convey("It should not accept the invitation sent to other email", func() {
+				_, err := svc.processAcceptInvitationCommand(ctx, &acceptInvitationCommand{token: invitation.Token, user: invitee, email: "other-" + email})
+				So(err, ShouldEqual, errNotInvitee)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should not accept the invitation if user email is not verified", func() {
+				_, err := svc.processAcceptInvitationCommand(ctx, &acceptInvitationCommand{token: invitation.Token, user: invitee})
+				So(err, ShouldEqual, errEmailNotVerified)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should not decline the invitation sent to other email", func() {
+				err := svc.processDeclineInvitationCommand(ctx, &declineInvitationCommand{token: invitation.Token, user: invitee, email: "other-" + email})
+				So(err, ShouldEqual, errNotInvitee)
+				_, err = svc.processAcceptInvitationCommand(ctx, &acceptInvitationCommand{token: invitation.Token, user: invitee, email: email})
+				So(err, ShouldBeNil)
+			})
+
+			Convey("It should not share the ledger with the owner", func() {
+				_, err := svc.processAcceptInvitationCommand(ctx, &acceptInvitationCommand{token: invitation.Token, user: owner, email: email})
+				So(err, ShouldEqual, errAlreadyMember)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should not share the ledger if user has been shared with but not projected yet", func() {
+				store.Seed(ldr.AggregateID, &ledgerShared{AggregateID: ldr.AggregateID, UserID: invitee.ID})
+				_, err := svc.processAcceptInvitationCommand(ctx, &acceptInvitationCommand{token: invitation.Token, user: invitee, email: email})
+				So(err, ShouldEqual, errAlreadyMember)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should not accept declined invitation", func() {
+				So(svc.processDeclineInvitationCommand(ctx, &declineInvitationCommand{token: invitation.Token, user: invitee, email: email}), ShouldBeNil)
+				_, err := svc.processAcceptInvitationCommand(ctx, &acceptInvitationCommand{token: invitation.Token, user: invitee, email: email})
+				So(err, ShouldEqual, errInvitationUsed)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should not accept expired invitation", func() {
+				svc.now = func() time.Time { return time.Now().Add(invitationTTL + time.Minute) }
+				_, err := svc.processAcceptInvitationCommand(ctx, &acceptInvitationCommand{token: invitation.Token, user: invitee, email: email})
+				So(err, ShouldEqual, errInvitationExpired)
+			})
+
+			Convey("It should not accept tokens signed with other key", func() {
+				otherSvc := CreateCommandService(DB, store, []byte("other-test-key-0123456789abcdefgh"))
+				_, err := otherSvc.processAcceptInvitationCommand(ctx, &acceptInvitationCommand{token: invitation.Token, user: invitee, email: email})
+				So(err, ShouldEqual, errInvalidInvitation)
+			})
+
+			Convey("It should not accept malformed tokens", func() {
+				_, err := svc.processAcceptInvitationCommand(ctx, &acceptInvitationCommand{token: "not-a-token", user: invitee, email: email})
+				So(err, ShouldEqual, errInvalidInvitation)
+			})
+		})
+
+		Convey("When revoking access", func() {
+			Convey("It should append unshared event", func() {
+				err := svc.processRevokeMemberCommand(ctx, &revokeMemberCommand{ledgerID: ldr.AggregateID, user: owner, memberUserID: member.ID})
+				So(err, ShouldBeNil)
+				So(store.Commits, ShouldHaveLength, 1)
+				So(store.Commits[0].Headers, ShouldResemble, eventstore.Headers{"user_id": owner.ID})
+				So(store.Commits[0].Events, ShouldResemble, []eventstore.Event{
+					&ledgerUnshared{AggregateID: ldr.AggregateID, UserID: member.ID},
+				})
+			})
+
+			Convey("It should let members revoke their own access", func() {
+				err := svc.processRevokeMemberCommand(ctx, &revokeMemberCommand{ledgerID: ldr.AggregateID, user: member, memberUserID: member.ID})
+				So(err, ShouldBeNil)
+				So(store.Commits, ShouldHaveLength, 1)
+			})
+
+			Convey("It should fail if other member revokes access", func() {
+				err := svc.processRevokeMemberCommand(ctx, &revokeMemberCommand{ledgerID: ldr.AggregateID, user: member, memberUserID: owner.ID})
+				So(err, ShouldEqual, errNotLedgerOwner)
+			})
+
+			Convey("It should fail to revoke access of the owner", func() {
+				err := svc.processRevokeMemberCommand(ctx, &revokeMemberCommand{ledgerID: ldr.AggregateID, user: owner, memberUserID: owner.ID})
+				So(err, ShouldEqual, errOwnerCanNotBeRevoked)
+			})
+
+			Convey("It should revoke access of the member that has not been projected yet", func() {
+				store.Seed(ldr.AggregateID, &ledgerShared{AggregateID: ldr.AggregateID, UserID: invitee.ID})
+				err := svc.processRevokeMemberCommand(ctx, &revokeMemberCommand{ledgerID: ldr.AggregateID, user: owner, memberUserID: invitee.ID})
+				So(err, ShouldBeNil)
+				So(store.Commits, ShouldHaveLength, 1)
+			})
+
+			Convey("It should fail if access has already been revoked but not projected yet", func() {
+				store.Seed(ldr.AggregateID, &ledgerUnshared{AggregateID: ldr.AggregateID, UserID: member.ID})
+				err := svc.processRevokeMemberCommand(ctx, &revokeMemberCommand{ledgerID: ldr.AggregateID, user: owner, memberUserID: member.ID})
+				So(err, ShouldEqual, errMemberNotFound)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should fail if user is not a member", func() {
+				err := svc.processRevokeMemberCommand(ctx, &revokeMemberCommand{ledgerID: ldr.AggregateID, user: owner, memberUserID: invitee.ID})
+				So(err, ShouldEqual, errMemberNotFound)
+				So(store.Commits, ShouldBeEmpty)
+			})
+		})
+	})
+}
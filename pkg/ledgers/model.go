@@ -2,8 +2,17 @@ package ledgers
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/server"
+	"ledger.api/pkg/tracing"
+	"ledger.api/pkg/users"
 )
 
 type ledgerDTO struct {
@@ -12,28 +21,163 @@ type ledgerDTO struct {
 	CurrencyCode string `json:"currencyCode"`
 }
 
+type memberDTO struct {
+	UserID  int  `json:"userID"`
+	IsOwner bool `json:"isOwner"`
+}
+
 type userLedgersQuery struct {
+	user *users.User
+}
+
+type ledgerMembersQuery struct {
+	ledgerID string
 }
 
 // QueryService is a service to do various queries against ledgers
 type QueryService interface {
 	processUserLedgersQuery(ctx context.Context, query *userLedgersQuery) ([]ledgerDTO, error)
+	processLedgerMembersQuery(ctx context.Context, query *ledgerMembersQuery) ([]memberDTO, error)
+}
+
+// parseAuthorizedUserIDs parses user ids the way v1 stores them
+// in authorized_user_ids columns, e.g: {1},{2},{4}
+func parseAuthorizedUserIDs(authorizedUserIDs string) ([]int, error) {
+	result := []int{}
+	if authorizedUserIDs == "" {
+		return result, nil
+	}
+	for _, part := range strings.Split(authorizedUserIDs, ",") {
+		userID, err := strconv.Atoi(strings.Trim(part, "{}"))
+		if err != nil {
+			return nil, fmt.Errorf("Malformed authorized user ids: %v", authorizedUserIDs)
+		}
+		result = append(result, userID)
+	}
+	return result, nil
+}
+
+// loadLedgerUsers returns owner and authorized users of the ledger
+func loadLedgerUsers(db *gorm.DB, ledgerID string) (int, []int, error) {
+	var ownerUserID int
+	var authorizedUserIDs string
+	err := db.Table("projections_ledgers").
+		Select("owner_user_id, authorized_user_ids").
+		Where("aggregate_id = ?", ledgerID).
+		Row().Scan(&ownerUserID, &authorizedUserIDs)
+	if err == sql.ErrNoRows {
+		return 0, nil, errLedgerNotFound
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	userIDs, err := parseAuthorizedUserIDs(authorizedUserIDs)
+	if err != nil {
+		return 0, nil, err
+	}
+	return ownerUserID, userIDs, nil
+}
+
+// ledgerAccessCondition matches ledgers (aliased as ldr) the user owns or is authorized on
+// directly or via any account or tag of the ledger. Membership via a tag grants access to the
+// ledger only, data of accounts the user is not authorized on is still hidden.
+// Params are returned by ledgerAccessParams
+const ledgerAccessCondition = `
+	ldr.owner_user_id = ? OR ldr.authorized_user_ids LIKE ? OR EXISTS(
+		SELECT 1 FROM projections_accounts acc
+		WHERE acc.ledger_id = ldr.aggregate_id AND ` + users.AccessibleAccountsCondition + `
+	) OR EXISTS(
+		SELECT 1 FROM projections_tags tg
+		WHERE tg.ledger_id = ldr.aggregate_id AND tg.authorized_user_ids LIKE ?
+	)`
+
+func ledgerAccessParams(user *users.User) []interface{} {
+	authorizedUserID := users.AuthorizedUserIDPattern(user)
+	params := []interface{}{user.ID, authorizedUserID}
+	params = append(params, users.AccessibleAccountsParams(user)...)
+	return append(params, authorizedUserID)
 }
 
 type dbQueryService struct {
 	db *gorm.DB
 }
 
+// processUserLedgersQuery returns ledgers the user has access to. Users authorized
+// on some accounts of the ledger only get the ledger as well, the same way access is checked
 func (svc *dbQueryService) processUserLedgersQuery(ctx context.Context, query *userLedgersQuery) ([]ledgerDTO, error) {
+	if query.user == nil {
+		return nil, errors.New("Please provide user")
+	}
+	logger := logging.FromContext(ctx)
+	logger.Debugf("Processing user ledgers query. UserID: %v", query.user.ID)
 	result := []ledgerDTO{}
-	if err := svc.db.Table("projections_ledgers ldr").
+	if err := tracing.DB(ctx, svc.db).Table("projections_ledgers ldr").
 		Select("ldr.aggregate_id, ldr.name, ldr.currency_code").
+		Where(ledgerAccessCondition, ledgerAccessParams(query.user)...).
 		Find(&result).Error; err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
+// processLedgerMembersQuery returns users the ledger is shared with, owner goes first
+func (svc *dbQueryService) processLedgerMembersQuery(ctx context.Context, query *ledgerMembersQuery) ([]memberDTO, error) {
+	if query.ledgerID == "" {
+		return nil, errors.New("Please provide ledgerID")
+	}
+	logger := logging.FromContext(ctx)
+	logger.Debugf("Processing ledger members query. LedgerID: %v", query.ledgerID)
+
+	ownerUserID, userIDs, err := loadLedgerUsers(tracing.DB(ctx, svc.db), query.ledgerID)
+	if err != nil {
+		return nil, err
+	}
+	result := []memberDTO{{UserID: ownerUserID, IsOwner: true}}
+	for _, userID := range userIDs {
+		if userID != ownerUserID {
+			result = append(result, memberDTO{UserID: userID})
+		}
+	}
+	return result, nil
+}
+
+type dbLedgerAccessChecker struct {
+	db *gorm.DB
+}
+
+// HasLedgerAccess checks if user owns or is authorized on the ledger
+// the same way ledgers of the user are queried
+func (checker *dbLedgerAccessChecker) HasLedgerAccess(ctx context.Context, user *users.User, ledgerID string) (bool, error) {
+	if user == nil {
+		return false, errors.New("Please provide user")
+	}
+	if ledgerID == "" {
+		return false, errors.New("Please provide ledgerID")
+	}
+	logger := logging.FromContext(ctx)
+	logger.Debugf("Checking ledger access. LedgerID: %v, UserID: %v", ledgerID, user.ID)
+
+	params := append([]interface{}{ledgerID}, ledgerAccessParams(user)...)
+	row := tracing.DB(ctx, checker.db).Raw(`
+		SELECT EXISTS(
+			SELECT 1 FROM projections_ledgers ldr
+			WHERE ldr.aggregate_id = ? AND (`+ledgerAccessCondition+`)
+		)
+		`, params...).Row()
+	var hasAccess bool
+	if err := row.Scan(&hasAccess); err != nil {
+		return false, err
+	}
+	return hasAccess, nil
+}
+
+// CreateLedgerAccessChecker initializes a new instance of the checker
+// that verifies ledger membership using ledgers, accounts and tags projections
+func CreateLedgerAccessChecker(db *gorm.DB) server.LedgerAccessChecker {
+	checker := dbLedgerAccessChecker{db: db}
+	return &checker
+}
+
 // CreateQueryService initializes a new instance of the query service
 func CreateQueryService(db *gorm.DB) QueryService {
 	svc := dbQueryService{db: db}
@@ -2,6 +2,8 @@ package ledgers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math/rand"
 	"testing"
 	"time"
@@ -9,7 +11,9 @@ import (
 	"github.com/icrowley/fake"
 	"github.com/satori/go.uuid"
 	funk "github.com/thoas/go-funk"
+	"ledger.api/pkg/internal/ldtesting"
 	"ledger.api/pkg/logging"
+	"ledger.api/pkg/users"
 
 	"github.com/jinzhu/gorm"
 	. "github.com/smartystreets/goconvey/convey"
@@ -30,19 +34,20 @@ func (ledger) TableName() string {
 	return "projections_ledgers"
 }
 
-func setupLedgers(db *gorm.DB) ([]ledger, error) {
-	if err := db.Delete(&ledger{}).Error; err != nil {
-		return nil, err
-	}
+func cleanupLedgers(db *gorm.DB) error {
+	return db.Delete(&ledger{}).Error
+}
 
+func setupLedgers(db *gorm.DB, ownerUserID int, authorizedUserIDs string) ([]ledger, error) {
 	numLedgers := 2 + rnd.Intn(5)
 	ledgers := make([]ledger, numLedgers)
 	for i := 0; i < numLedgers; i++ {
 		ldr := ledger{
-			AggregateID:  uuid.NewV4().String(),
-			OwnerUserID:  rnd.Intn(20),
-			Name:         fake.Brand(),
-			CurrencyCode: fake.CurrencyCode(),
+			AggregateID:       uuid.NewV4().String(),
+			OwnerUserID:       ownerUserID,
+			Name:              fake.Brand(),
+			CurrencyCode:      fake.CurrencyCode(),
+			AuthorizedUserIDs: authorizedUserIDs,
 		}
 		ledgers[i] = ldr
 		if err := db.Create(&ldr).Error; err != nil {
@@ -55,24 +60,246 @@ func setupLedgers(db *gorm.DB) ([]ledger, error) {
 func TestUserLedgersQuery(t *testing.T) {
 	Convey("Given user ledgers query", t, func() {
 		ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
-		ledgers, err := setupLedgers(DB)
+		So(cleanupLedgers(DB), ShouldBeNil)
+		user1 := ldtesting.NewUser()
+		user2 := ldtesting.NewUser()
+		for user2.ID == user1.ID {
+			user2 = ldtesting.NewUser()
+		}
+		user1Ledgers, err := setupLedgers(DB, user1.ID, fmt.Sprintf("{%v}", user1.ID))
+		So(err, ShouldBeNil)
+		user2Ledgers, err := setupLedgers(DB, user2.ID, fmt.Sprintf("{%v}", user2.ID))
+		So(err, ShouldBeNil)
 		svc := CreateQueryService(DB)
+
+		assertLedgers := func(actual []ledgerDTO, expected []ledger) {
+			So(actual, ShouldHaveLength, len(expected))
+			ledgersByID := funk.ToMap(expected, "AggregateID").(map[string]ledger)
+			for _, dto := range actual {
+				actualLedger, ok := ledgersByID[dto.LedgerID]
+				So(ok, ShouldBeTrue)
+				So(dto, ShouldResemble, ledgerDTO{
+					LedgerID:     actualLedger.AggregateID,
+					Name:         actualLedger.Name,
+					CurrencyCode: actualLedger.CurrencyCode,
+				})
+			}
+		}
+
+		Convey("When user is not provided", func() {
+			Convey("It should return error", func() {
+				_, err := svc.processUserLedgersQuery(ctx, &userLedgersQuery{})
+				So(err, ShouldResemble, errors.New("Please provide user"))
+			})
+		})
+
+		Convey("When users have disjoint ledgers", func() {
+			Convey("It should return only ledgers of the first user", func() {
+				ledgersDTOs, err := svc.processUserLedgersQuery(ctx, &userLedgersQuery{user: user1})
+				So(err, ShouldBeNil)
+				assertLedgers(ledgersDTOs, user1Ledgers)
+			})
+
+			Convey("It should return only ledgers of the second user", func() {
+				ledgersDTOs, err := svc.processUserLedgersQuery(ctx, &userLedgersQuery{user: user2})
+				So(err, ShouldBeNil)
+				assertLedgers(ledgersDTOs, user2Ledgers)
+			})
+
+			Convey("It should return nothing for unknown user", func() {
+				ledgersDTOs, err := svc.processUserLedgersQuery(ctx, &userLedgersQuery{
+					user: &users.User{ID: -1},
+				})
+				So(err, ShouldBeNil)
+				So(ledgersDTOs, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When user is authorized on a ledger of another user", func() {
+			sharedLedgers, err := setupLedgers(DB, user1.ID, fmt.Sprintf("{%v},{%v}", user1.ID, user2.ID))
+			So(err, ShouldBeNil)
+
+			Convey("It should include shared ledgers for the owner", func() {
+				ledgersDTOs, err := svc.processUserLedgersQuery(ctx, &userLedgersQuery{user: user1})
+				So(err, ShouldBeNil)
+				assertLedgers(ledgersDTOs, append(user1Ledgers, sharedLedgers...))
+			})
+
+			Convey("It should include shared ledgers for the authorized user", func() {
+				ledgersDTOs, err := svc.processUserLedgersQuery(ctx, &userLedgersQuery{user: user2})
+				So(err, ShouldBeNil)
+				assertLedgers(ledgersDTOs, append(user2Ledgers, sharedLedgers...))
+			})
+		})
+
+		Convey("When user is authorized on some accounts of a ledger of another user only", func() {
+			partiallySharedLedgers, err := setupLedgers(DB, user1.ID, fmt.Sprintf("{%v}", user1.ID))
+			So(err, ShouldBeNil)
+			_, err = ldtesting.SetupAccount(DB, partiallySharedLedgers[0].AggregateID, ldtesting.AccAuthorizedUsers(user1, user2))
+			So(err, ShouldBeNil)
+
+			Convey("It should include the ledger for the authorized user", func() {
+				ledgersDTOs, err := svc.processUserLedgersQuery(ctx, &userLedgersQuery{user: user2})
+				So(err, ShouldBeNil)
+				assertLedgers(ledgersDTOs, append(user2Ledgers, partiallySharedLedgers[0]))
+			})
+		})
+	})
+}
+
+func TestLedgerAccessChecker(t *testing.T) {
+	Convey("Given ledger access checker", t, func() {
+		ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+		checker := CreateLedgerAccessChecker(DB)
+		user1 := ldtesting.NewUser()
+		user2 := ldtesting.NewUser()
+		for user2.ID == user1.ID {
+			user2 = ldtesting.NewUser()
+		}
+		user1Ledger, err := ldtesting.SetupLedgerData(DB, user1)
+		So(err, ShouldBeNil)
+		user2Ledger, err := ldtesting.SetupLedgerData(DB, user2)
 		So(err, ShouldBeNil)
-		Convey("When default query object is used", func() {
-			Convey("It should return all ledgers", func() {
-				ledgersDTOs, err := svc.processUserLedgersQuery(ctx, &userLedgersQuery{})
-				So(err, ShouldBeNil)
-				So(ledgersDTOs, ShouldHaveLength, len(ledgers))
-				ledgersByID := funk.ToMap(ledgers, "AggregateID").(map[string]ledger)
-				for _, dto := range ledgersDTOs {
-					actualLedger := ledgersByID[dto.LedgerID]
-					So(dto, ShouldResemble, ledgerDTO{
-						LedgerID:     actualLedger.AggregateID,
-						Name:         actualLedger.Name,
-						CurrencyCode: actualLedger.CurrencyCode,
-					})
-				}
+
+		Convey("When user is authorized on ledger accounts and tags", func() {
+			Convey("It should allow access", func() {
+				hasAccess, err := checker.HasLedgerAccess(ctx, user1, user1Ledger.LedgerID)
+				So(err, ShouldBeNil)
+				So(hasAccess, ShouldBeTrue)
+
+				hasAccess, err = checker.HasLedgerAccess(ctx, user2, user2Ledger.LedgerID)
+				So(err, ShouldBeNil)
+				So(hasAccess, ShouldBeTrue)
 			})
 		})
+
+		Convey("When user is not authorized on the ledger", func() {
+			Convey("It should deny access", func() {
+				hasAccess, err := checker.HasLedgerAccess(ctx, user1, user2Ledger.LedgerID)
+				So(err, ShouldBeNil)
+				So(hasAccess, ShouldBeFalse)
+
+				hasAccess, err = checker.HasLedgerAccess(ctx, user2, user1Ledger.LedgerID)
+				So(err, ShouldBeNil)
+				So(hasAccess, ShouldBeFalse)
+			})
+		})
+
+		Convey("When user is authorized on a tag only", func() {
+			sharedLedger, err := ldtesting.SetupLedgerData(DB, user1)
+			So(err, ShouldBeNil)
+			tagID := sharedLedger.TagIDs[len(sharedLedger.TagIDs)-1] + 1
+			So(ldtesting.SetupAuthorizedTag(
+				DB, sharedLedger.LedgerID, tagID, fake.Word(), ldtesting.AuthorizedUserIDs(user2),
+			), ShouldBeNil)
+
+			Convey("It should allow access", func() {
+				hasAccess, err := checker.HasLedgerAccess(ctx, user2, sharedLedger.LedgerID)
+				So(err, ShouldBeNil)
+				So(hasAccess, ShouldBeTrue)
+			})
+		})
+
+		Convey("When user is authorized on some accounts of the ledger only", func() {
+			sharedLedger, err := ldtesting.SetupLedgerData(DB, user1)
+			So(err, ShouldBeNil)
+			_, err = ldtesting.SetupAccount(DB, sharedLedger.LedgerID, ldtesting.AccAuthorizedUsers(user2))
+			So(err, ShouldBeNil)
+
+			Convey("It should allow access", func() {
+				hasAccess, err := checker.HasLedgerAccess(ctx, user2, sharedLedger.LedgerID)
+				So(err, ShouldBeNil)
+				So(hasAccess, ShouldBeTrue)
+			})
+		})
+
+		Convey("When user owns a ledger that has no accounts or tags yet", func() {
+			ownLedgers, err := setupLedgers(DB, user1.ID, "")
+			So(err, ShouldBeNil)
+
+			Convey("It should allow access", func() {
+				hasAccess, err := checker.HasLedgerAccess(ctx, user1, ownLedgers[0].AggregateID)
+				So(err, ShouldBeNil)
+				So(hasAccess, ShouldBeTrue)
+			})
+
+			Convey("It should deny access to other users", func() {
+				hasAccess, err := checker.HasLedgerAccess(ctx, user2, ownLedgers[0].AggregateID)
+				So(err, ShouldBeNil)
+				So(hasAccess, ShouldBeFalse)
+			})
+		})
+
+		Convey("When ledger is shared with the user but has no accounts or tags yet", func() {
+			sharedLedgers, err := setupLedgers(DB, user1.ID, ldtesting.AuthorizedUserIDs(user1, user2))
+			So(err, ShouldBeNil)
+
+			Convey("It should allow access", func() {
+				hasAccess, err := checker.HasLedgerAccess(ctx, user2, sharedLedgers[0].AggregateID)
+				So(err, ShouldBeNil)
+				So(hasAccess, ShouldBeTrue)
+			})
+		})
+
+		Convey("When ledger does not exist", func() {
+			Convey("It should deny access", func() {
+				hasAccess, err := checker.HasLedgerAccess(ctx, user1, uuid.NewV4().String())
+				So(err, ShouldBeNil)
+				So(hasAccess, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestLedgerMembersQuery(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+	svc := CreateQueryService(DB)
+
+	Convey("Given ledger members query", t, func() {
+		owner := ldtesting.NewUser()
+		member := ldtesting.NewUser()
+		ldr := ledger{
+			AggregateID:       uuid.NewV4().String(),
+			OwnerUserID:       owner.ID,
+			Name:              fake.Brand(),
+			CurrencyCode:      fake.CurrencyCode(),
+			AuthorizedUserIDs: ldtesting.AuthorizedUserIDs(owner, member),
+		}
+		So(DB.Create(&ldr).Error, ShouldBeNil)
+
+		Convey("It should return the owner first and other members", func() {
+			members, err := svc.processLedgerMembersQuery(ctx, &ledgerMembersQuery{ledgerID: ldr.AggregateID})
+			So(err, ShouldBeNil)
+			So(members, ShouldResemble, []memberDTO{
+				{UserID: owner.ID, IsOwner: true},
+				{UserID: member.ID},
+			})
+		})
+
+		Convey("It should return error if ledger does not exist", func() {
+			_, err := svc.processLedgerMembersQuery(ctx, &ledgerMembersQuery{ledgerID: uuid.NewV4().String()})
+			So(err, ShouldEqual, errLedgerNotFound)
+		})
+	})
+}
+
+func TestParseAuthorizedUserIDs(t *testing.T) {
+	Convey("Given authorized user ids", t, func() {
+		Convey("It should parse user ids", func() {
+			userIDs, err := parseAuthorizedUserIDs("{1},{22},{4}")
+			So(err, ShouldBeNil)
+			So(userIDs, ShouldResemble, []int{1, 22, 4})
+		})
+
+		Convey("It should return empty list if there are no users", func() {
+			userIDs, err := parseAuthorizedUserIDs("")
+			So(err, ShouldBeNil)
+			So(userIDs, ShouldBeEmpty)
+		})
+
+		Convey("It should fail if ids are malformed", func() {
+			_, err := parseAuthorizedUserIDs("{1},{x}")
+			So(err, ShouldNotBeNil)
+		})
 	})
 }
@@ -2,23 +2,173 @@ package ledgers
 
 import (
 	"net/http"
+	"strconv"
 
+	"ledger.api/pkg/auth"
 	"ledger.api/pkg/server"
+	"ledger.api/pkg/users"
 )
 
 // CreateRoutes - Register ledger related routes
 func CreateRoutes(svc QueryService) server.Routes {
 	return func(router *server.Router) {
-		router.GET("/v2/ledgers", server.RequireScopes(createGetLedgersHandler(svc), "read:ledgers"))
+		router.
+			Group("/v2/ledgers", server.WithScopes("read:ledgers")).
+			GET("", createGetLedgersHandler(svc))
+	}
+}
+
+// CreateMembersRoutes - Register routes that list members of the ledger
+func CreateMembersRoutes(svc QueryService, ledgerAccess server.LedgerAccessChecker) server.Routes {
+	return func(router *server.Router) {
+		router.
+			Group(
+				"/v2/ledgers/:ledgerID/members",
+				server.WithScopes("read:ledgers"),
+				server.WithMiddleware(server.CreateLedgerAccessMiddlewareFunc(ledgerAccess)),
+			).
+			GET("", createLedgerMembersQueryHandler(svc))
+	}
+}
+
+// CreateCommandRoutes - Register routes that share ledgers and revoke access to them
+func CreateCommandRoutes(svc CommandService, ledgerAccess server.LedgerAccessChecker) server.Routes {
+	return func(router *server.Router) {
+		ledger := router.Group(
+			"/v2/ledgers/:ledgerID",
+			server.WithScopes("write:ledgers"),
+			server.WithMiddleware(server.CreateLedgerAccessMiddlewareFunc(ledgerAccess)),
+		)
+		ledger.POST("/invitations", createInviteMemberHandler(svc))
+		ledger.DELETE("/members/:userID", createRevokeMemberHandler(svc))
+
+		// Invited users are not members yet so ledger access is not checked
+		invitations := router.Group("/v2/invitations", server.WithScopes("write:ledgers"))
+		invitations.POST("/accept", createAcceptInvitationHandler(svc))
+		invitations.POST("/decline", createDeclineInvitationHandler(svc))
 	}
 }
 
 func createGetLedgersHandler(svc QueryService) server.HandlerFunc {
 	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
-		result, err := svc.processUserLedgersQuery(req.Context(), &userLedgersQuery{})
+		user := users.FromContext(req.Context())
+		if user == nil {
+			h.Logger.Info("Request has not been initialized with user, responding with 404")
+			return nil, *server.NotFoundError()
+		}
+		result, err := svc.processUserLedgersQuery(req.Context(), &userLedgersQuery{user: user})
 		if err != nil {
 			return nil, err
 		}
 		return h.Response(result), nil
 	}
 }
+
+func createLedgerMembersQueryHandler(svc QueryService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		result, err := svc.processLedgerMembersQuery(req.Context(), &ledgerMembersQuery{
+			ledgerID: h.Params.ByName("ledgerID"),
+		})
+		if err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(result), nil
+	}
+}
+
+// commandHTTPError maps command errors to http errors
+func commandHTTPError(err error) error {
+	switch err {
+	case errLedgerNotFound, errMemberNotFound:
+		return *server.NotFoundError()
+	case errNotLedgerOwner, errEmailNotVerified, errNotInvitee:
+		return *server.ForbiddenError(err.Error())
+	case errOwnerCanNotBeRevoked, errInvalidInvitation:
+		return *server.BadRequestError(err.Error())
+	case errAlreadyMember, errInvitationUsed:
+		return *server.ConflictError(err.Error())
+	case errInvitationExpired:
+		return *server.GoneError(err.Error())
+	}
+	return err
+}
+
+func createInviteMemberHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		var payload invitationPayload
+		if err := h.Bind(req, &payload); err != nil {
+			return nil, err
+		}
+		invitation, err := svc.processInviteMemberCommand(req.Context(), &inviteMemberCommand{
+			ledgerID: h.Params.ByName("ledgerID"),
+			user:     users.FromContext(req.Context()),
+			email:    payload.Email,
+		})
+		if err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(invitation).Status(http.StatusCreated), nil
+	}
+}
+
+func createRevokeMemberHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		memberUserID, err := strconv.Atoi(h.Params.ByName("userID"))
+		if err != nil {
+			return nil, *server.NotFoundError()
+		}
+		if err := svc.processRevokeMemberCommand(req.Context(), &revokeMemberCommand{
+			ledgerID:     h.Params.ByName("ledgerID"),
+			user:         users.FromContext(req.Context()),
+			memberUserID: memberUserID,
+		}); err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(server.JSON{"userID": memberUserID}).Status(http.StatusAccepted), nil
+	}
+}
+
+func createAcceptInvitationHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		user := users.FromContext(req.Context())
+		if user == nil {
+			h.Logger.Info("Request has not been initialized with user, responding with 404")
+			return nil, *server.NotFoundError()
+		}
+		var payload invitationTokenPayload
+		if err := h.Bind(req, &payload); err != nil {
+			return nil, err
+		}
+		ledgerID, err := svc.processAcceptInvitationCommand(req.Context(), &acceptInvitationCommand{
+			token: payload.Token,
+			user:  user,
+			email: auth.ClaimsFromContext(req.Context()).VerifiedEmail(),
+		})
+		if err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(server.JSON{"ledgerID": ledgerID}).Status(http.StatusAccepted), nil
+	}
+}
+
+func createDeclineInvitationHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		user := users.FromContext(req.Context())
+		if user == nil {
+			h.Logger.Info("Request has not been initialized with user, responding with 404")
+			return nil, *server.NotFoundError()
+		}
+		var payload invitationTokenPayload
+		if err := h.Bind(req, &payload); err != nil {
+			return nil, err
+		}
+		if err := svc.processDeclineInvitationCommand(req.Context(), &declineInvitationCommand{
+			token: payload.Token,
+			user:  user,
+			email: auth.ClaimsFromContext(req.Context()).VerifiedEmail(),
+		}); err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(nil).Status(http.StatusNoContent), nil
+	}
+}
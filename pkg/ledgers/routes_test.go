@@ -1,17 +1,24 @@
 package ledgers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/satori/go.uuid"
 
+	"github.com/google/jsonapi"
 	"github.com/icrowley/fake"
 	. "github.com/smartystreets/goconvey/convey"
 	"ledger.api/pkg/internal/ldtesting"
 	"ledger.api/pkg/server"
+	"ledger.api/pkg/users"
 )
 
 type methodCall struct {
@@ -20,7 +27,8 @@ type methodCall struct {
 }
 
 type mockQueryService struct {
-	processUserLedgersQueryCalls []methodCall
+	processUserLedgersQueryCalls   []methodCall
+	processLedgerMembersQueryCalls []methodCall
 }
 
 type ctxKey string
@@ -44,6 +52,56 @@ func (svc *mockQueryService) processUserLedgersQuery(ctx context.Context, query
 	return result, nil
 }
 
+func (svc *mockQueryService) processLedgerMembersQuery(ctx context.Context, query *ledgerMembersQuery) ([]memberDTO, error) {
+	result := []memberDTO{{UserID: 1, IsOwner: true}, {UserID: 2}}
+	svc.processLedgerMembersQueryCalls = append(svc.processLedgerMembersQueryCalls, methodCall{
+		input:  query,
+		result: result,
+	})
+	return result, nil
+}
+
+type mockCommandService struct {
+	calls []methodCall
+	err   error
+}
+
+func (svc *mockCommandService) processInviteMemberCommand(ctx context.Context, cmd *inviteMemberCommand) (*invitationDTO, error) {
+	result := &invitationDTO{
+		InvitationID: uuid.NewV4().String(),
+		LedgerID:     cmd.ledgerID,
+		Email:        cmd.email,
+		ExpiresAt:    time.Now().Add(invitationTTL).UTC(),
+		Token:        "token-" + fake.Word(),
+	}
+	svc.calls = append(svc.calls, methodCall{input: cmd, result: result})
+	return result, svc.err
+}
+
+func (svc *mockCommandService) processAcceptInvitationCommand(ctx context.Context, cmd *acceptInvitationCommand) (string, error) {
+	ledgerID := uuid.NewV4().String()
+	svc.calls = append(svc.calls, methodCall{input: cmd, result: ledgerID})
+	return ledgerID, svc.err
+}
+
+func (svc *mockCommandService) processDeclineInvitationCommand(ctx context.Context, cmd *declineInvitationCommand) error {
+	svc.calls = append(svc.calls, methodCall{input: cmd})
+	return svc.err
+}
+
+func (svc *mockCommandService) processRevokeMemberCommand(ctx context.Context, cmd *revokeMemberCommand) error {
+	svc.calls = append(svc.calls, methodCall{input: cmd})
+	return svc.err
+}
+
+type mockLedgerAccessChecker struct {
+	accessibleLedgers map[string]bool
+}
+
+func (checker *mockLedgerAccessChecker) HasLedgerAccess(ctx context.Context, user *users.User, ledgerID string) (bool, error) {
+	return checker.accessibleLedgers[ledgerID], nil
+}
+
 func setupRouter() (*mockQueryService, *server.HTTPApp) {
 	svc := mockQueryService{processUserLedgersQueryCalls: []methodCall{}}
 	return &svc, server.
@@ -57,16 +115,19 @@ func TestCreateRoute(t *testing.T) {
 		recorder := httptest.NewRecorder()
 
 		Convey("When route is GET index", func() {
+			svc.processUserLedgersQueryCalls = []methodCall{}
+			user := ldtesting.NewUser()
 			req := ldtesting.NewRequest(
 				"GET",
 				"/v2/ledgers",
-				ldtesting.WithScopeClaim("read:ledgers"))
+				ldtesting.WithScopeClaim("read:ledgers"),
+				ldtesting.WithUser(user))
 			router.CreateHandler().ServeHTTP(recorder, req)
 
 			Convey("It should respond with user ledgers fetched via query service", func() {
 				So(len(svc.processUserLedgersQueryCalls), ShouldEqual, 1)
 				queryCall := svc.processUserLedgersQueryCalls[0]
-				defaultQuery := &userLedgersQuery{}
+				defaultQuery := &userLedgersQuery{user: user}
 				actualQuery := queryCall.input.([]interface{})[0].(*userLedgersQuery)
 				So(actualQuery, ShouldResemble, defaultQuery)
 
@@ -79,5 +140,154 @@ func TestCreateRoute(t *testing.T) {
 				So(recorder.Code, ShouldEqual, 200)
 			})
 		})
+
+		Convey("When route is GET index and user is not resolved", func() {
+			svc.processUserLedgersQueryCalls = []methodCall{}
+			req := ldtesting.NewRequest(
+				"GET",
+				"/v2/ledgers",
+				ldtesting.WithScopeClaim("read:ledgers"))
+			router.CreateHandler().ServeHTTP(recorder, req)
+
+			Convey("It should respond with 404", func() {
+				So(recorder.Code, ShouldEqual, 404)
+				So(len(svc.processUserLedgersQueryCalls), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestMembersRoutes(t *testing.T) {
+	Convey("Given members routes", t, func() {
+		ledgerID := uuid.NewV4().String()
+		checker := mockLedgerAccessChecker{accessibleLedgers: map[string]bool{ledgerID: true}}
+		querySvc := &mockQueryService{}
+		cmdSvc := &mockCommandService{}
+		router := server.
+			CreateHTTPApp(server.HTTPAppConfig{Env: "test"}).
+			RegisterRoutes(CreateMembersRoutes(querySvc, &checker)).
+			RegisterRoutes(CreateCommandRoutes(cmdSvc, &checker))
+		recorder := httptest.NewRecorder()
+		user := ldtesting.NewUser()
+		userEmail := fake.EmailAddress()
+		newRequest := func(method string, path string, payload interface{}, scope string) *http.Request {
+			body := bytes.NewBuffer(nil)
+			if payload != nil {
+				if err := jsonapi.MarshalPayload(body, payload); err != nil {
+					panic(err)
+				}
+			}
+			req := ldtesting.NewRequest(method, path,
+				ldtesting.WithScopeClaim(scope),
+				ldtesting.WithVerifiedEmailClaim(userEmail),
+				ldtesting.WithUser(user))
+			req.Body = ioutil.NopCloser(body)
+			return req
+		}
+
+		Convey("When route is GET ledger members", func() {
+			Convey("It should process query and return members", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("GET", fmt.Sprintf("/v2/ledgers/%v/members", ledgerID), nil, "read:ledgers"))
+				So(recorder.Code, ShouldEqual, 200)
+				So(querySvc.processLedgerMembersQueryCalls, ShouldHaveLength, 1)
+				So(querySvc.processLedgerMembersQueryCalls[0].input, ShouldResemble, &ledgerMembersQuery{ledgerID: ledgerID})
+				expectedMessage, _ := json.Marshal(querySvc.processLedgerMembersQueryCalls[0].result)
+				So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+			})
+
+			Convey("It should respond with 404 if ledger is not accessible", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("GET", fmt.Sprintf("/v2/ledgers/%v/members", uuid.NewV4().String()), nil, "read:ledgers"))
+				So(recorder.Code, ShouldEqual, 404)
+				So(querySvc.processLedgerMembersQueryCalls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When route is POST invitations", func() {
+			path := fmt.Sprintf("/v2/ledgers/%v/invitations", ledgerID)
+			email := fake.EmailAddress()
+
+			Convey("It should create the invitation", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &invitationPayload{Email: email}, "write:ledgers"))
+				So(recorder.Code, ShouldEqual, 201)
+				So(cmdSvc.calls, ShouldHaveLength, 1)
+				So(cmdSvc.calls[0].input, ShouldResemble, &inviteMemberCommand{ledgerID: ledgerID, user: user, email: email})
+				expectedMessage, _ := json.Marshal(cmdSvc.calls[0].result)
+				So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+			})
+
+			Convey("It should validate email", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &invitationPayload{Email: "not-an-email"}, "write:ledgers"))
+				So(recorder.Code, ShouldEqual, 400)
+				So(cmdSvc.calls, ShouldBeEmpty)
+			})
+
+			Convey("It should respond with 403 if user is not the owner", func() {
+				cmdSvc.err = errNotLedgerOwner
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &invitationPayload{Email: email}, "write:ledgers"))
+				So(recorder.Code, ShouldEqual, 403)
+			})
+
+			Convey("It should require write scope", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &invitationPayload{Email: email}, "read:ledgers"))
+				So(recorder.Code, ShouldEqual, 403)
+				So(cmdSvc.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When route is POST accept invitation", func() {
+			Convey("It should accept the invitation", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", "/v2/invitations/accept", &invitationTokenPayload{Token: "token-1"}, "write:ledgers"))
+				So(recorder.Code, ShouldEqual, 202)
+				So(cmdSvc.calls, ShouldHaveLength, 1)
+				So(cmdSvc.calls[0].input, ShouldResemble, &acceptInvitationCommand{token: "token-1", user: user, email: userEmail})
+				So(recorder.Body.String(), ShouldEqual, fmt.Sprintf(`{"ledgerID":"%v"}`, cmdSvc.calls[0].result))
+			})
+
+			Convey("It should map invitation errors", func() {
+				for err, status := range map[error]int{
+					errInvalidInvitation: 400,
+					errEmailNotVerified:  403,
+					errNotInvitee:        403,
+					errInvitationUsed:    409,
+					errAlreadyMember:     409,
+					errInvitationExpired: 410,
+				} {
+					cmdSvc.err = err
+					recorder := httptest.NewRecorder()
+					router.CreateHandler().ServeHTTP(recorder, newRequest("POST", "/v2/invitations/accept", &invitationTokenPayload{Token: "token-1"}, "write:ledgers"))
+					So(recorder.Code, ShouldEqual, status)
+				}
+			})
+		})
+
+		Convey("When route is POST decline invitation", func() {
+			Convey("It should decline the invitation", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", "/v2/invitations/decline", &invitationTokenPayload{Token: "token-1"}, "write:ledgers"))
+				So(recorder.Code, ShouldEqual, 204)
+				So(cmdSvc.calls, ShouldHaveLength, 1)
+				So(cmdSvc.calls[0].input, ShouldResemble, &declineInvitationCommand{token: "token-1", user: user, email: userEmail})
+			})
+		})
+
+		Convey("When route is DELETE member", func() {
+			Convey("It should revoke access of the member", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("DELETE", fmt.Sprintf("/v2/ledgers/%v/members/22", ledgerID), nil, "write:ledgers"))
+				So(recorder.Code, ShouldEqual, 202)
+				So(cmdSvc.calls, ShouldHaveLength, 1)
+				So(cmdSvc.calls[0].input, ShouldResemble, &revokeMemberCommand{ledgerID: ledgerID, user: user, memberUserID: 22})
+			})
+
+			Convey("It should respond with 404 if user id is malformed", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("DELETE", fmt.Sprintf("/v2/ledgers/%v/members/abc", ledgerID), nil, "write:ledgers"))
+				So(recorder.Code, ShouldEqual, 404)
+				So(cmdSvc.calls, ShouldBeEmpty)
+			})
+
+			Convey("It should respond with 400 if owner access is revoked", func() {
+				cmdSvc.err = errOwnerCanNotBeRevoked
+				router.CreateHandler().ServeHTTP(recorder, newRequest("DELETE", fmt.Sprintf("/v2/ledgers/%v/members/22", ledgerID), nil, "write:ledgers"))
+				So(recorder.Code, ShouldEqual, 400)
+			})
+		})
 	})
 }
@@ -103,7 +103,7 @@ func (logger *logrusLogger) Warnf(format string, args ...interface{}) {
 	logger.getTarget().Warnf(format, args...)
 }
 func (logger *logrusLogger) Warn(args ...interface{}) {
-	logger.getTarget().Warn(args)
+	logger.getTarget().Warn(args...)
 }
 
 func (logger *logrusLogger) Infof(format string, args ...interface{}) {
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	_ "github.com/lib/pq"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegistry(t *testing.T) {
+	Convey("Given a registry with db stats collector", t, func() {
+		// Connections are established lazily so the db does not have to be available
+		db, err := sql.Open("postgres", "postgresql://postgres@localhost:5432/ledger_test?sslmode=disable")
+		So(err, ShouldBeNil)
+		defer db.Close()
+		db.SetMaxOpenConns(7)
+
+		registry := CreateRegistry()
+		registry.MustRegister(CreateDBStatsCollector(db))
+
+		Convey("It should serve runtime and db pool metrics", func() {
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/metrics", nil)
+			CreateHandler(registry).ServeHTTP(recorder, req)
+			So(recorder.Code, ShouldEqual, 200)
+			body := recorder.Body.String()
+			So(body, ShouldContainSubstring, "go_goroutines")
+			So(body, ShouldContainSubstring, "db_max_open_connections 7")
+			So(body, ShouldContainSubstring, "db_in_use_connections 0")
+		})
+	})
+}
@@ -0,0 +1,13 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"ledger.api/pkg/server"
+)
+
+// CreateRoutes - register metrics routes
+func CreateRoutes(registry *prometheus.Registry) server.Routes {
+	return func(router *server.Router) {
+		router.Handler("GET", "/metrics", CreateHandler(registry))
+	}
+}
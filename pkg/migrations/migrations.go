@@ -0,0 +1,280 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
+)
+
+// Migration - a versioned schema change. Up and Down are SQL scripts
+// that apply and revert the change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus - a migration and the time it has been applied at.
+// AppliedAt is nil if migration is pending
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// files holds migration scripts. Each migration is defined by a pair of
+// NNNN_name.up.sql and NNNN_name.down.sql files of the sql directory
+//
+//go:embed sql/*.sql
+var files embed.FS
+
+// fileNamePattern matches names of migration scripts, e.g 0001_create_projections.up.sql
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// load reads migrations from scripts of given directory. Each migration should have both up and down scripts
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("Unexpected migration file %v", entry.Name())
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("Migration file %v has invalid version: %v", entry.Name(), err)
+		}
+		script, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("Migration %v has different names: %v and %v", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+	result := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("Migration %v_%v should have both up and down scripts", migration.Version, migration.Name)
+		}
+		result = append(result, *migration)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+// All returns all known migrations ordered by version. Scripts are embedded
+// into the binary so it panics if they are malformed
+func All() []Migration {
+	result, err := load(files, "sql")
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// validate checks that migrations have unique positive versions
+func validate(migrations []Migration) error {
+	seen := make(map[int]bool)
+	for _, migration := range migrations {
+		if migration.Version <= 0 {
+			return fmt.Errorf("Migration %v has invalid version %v", migration.Name, migration.Version)
+		}
+		if seen[migration.Version] {
+			return fmt.Errorf("Duplicate migration version %v", migration.Version)
+		}
+		seen[migration.Version] = true
+	}
+	return nil
+}
+
+// migrationsLockID is an id of advisory lock that serializes concurrent migrators
+const migrationsLockID = 827364
+
+// Migrator applies and reverts migrations tracking applied versions in schema_migrations table
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// CreateMigrator initializes a new instance of the migrator for given migrations
+func CreateMigrator(db *gorm.DB, migrations []Migration) (*Migrator, error) {
+	if err := validate(migrations); err != nil {
+		return nil, err
+	}
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return &Migrator{db: db, migrations: sorted}, nil
+}
+
+func ensureMigrationsTable(db *gorm.DB) error {
+	return tracing.Exec(db, `
+		CREATE TABLE IF NOT EXISTS schema_migrations(
+			version integer PRIMARY KEY,
+			name varchar(255) NOT NULL,
+			applied_at timestamp without time zone NOT NULL
+		)
+		`).Error
+}
+
+func appliedVersions(db *gorm.DB) (map[int]time.Time, error) {
+	rows, err := db.Table("schema_migrations").Select("version, applied_at").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		result[version] = appliedAt
+	}
+	return result, rows.Err()
+}
+
+// Status returns all migrations with their applied time
+func (migrator *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	db := tracing.DB(ctx, migrator.db)
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]MigrationStatus, len(migrator.migrations))
+	for i, migration := range migrator.migrations {
+		result[i] = MigrationStatus{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			result[i].AppliedAt = &appliedAt
+		}
+	}
+	return result, nil
+}
+
+// inLockedTransaction runs given fn within a transaction holding migrations lock
+func inLockedTransaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	tx := db.Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+	if err := tracing.Exec(tx, "SELECT pg_advisory_xact_lock(?)", migrationsLockID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// Up applies all pending migrations in order. Each migration is applied within
+// its own transaction. Returns migrations that have been applied
+func (migrator *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	logger := logging.FromContext(ctx)
+	db := tracing.DB(ctx, migrator.db)
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	result := []Migration{}
+	for _, migration := range migrator.migrations {
+		applied := false
+		err := inLockedTransaction(db, func(tx *gorm.DB) error {
+			versions, err := appliedVersions(tx)
+			if err != nil {
+				return err
+			}
+			if _, ok := versions[migration.Version]; ok {
+				return nil
+			}
+			logger.Infof("Applying migration %v_%v", migration.Version, migration.Name)
+			if err := tracing.Exec(tx, migration.Up).Error; err != nil {
+				return fmt.Errorf("Failed to apply migration %v_%v: %v", migration.Version, migration.Name, err)
+			}
+			applied = true
+			return tracing.Exec(tx,
+				"INSERT INTO schema_migrations(version, name, applied_at) VALUES(?, ?, ?)",
+				migration.Version, migration.Name, time.Now().UTC(),
+			).Error
+		})
+		if err != nil {
+			return result, err
+		}
+		if applied {
+			result = append(result, migration)
+		}
+	}
+	return result, nil
+}
+
+// Down reverts given number of most recently applied migrations in reverse order.
+// Returns migrations that have been reverted
+func (migrator *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, errors.New("Please provide a positive number of steps")
+	}
+	logger := logging.FromContext(ctx)
+	db := tracing.DB(ctx, migrator.db)
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	result := []Migration{}
+	for i := len(migrator.migrations) - 1; i >= 0 && len(result) < steps; i-- {
+		migration := migrator.migrations[i]
+		reverted := false
+		err := inLockedTransaction(db, func(tx *gorm.DB) error {
+			versions, err := appliedVersions(tx)
+			if err != nil {
+				return err
+			}
+			if _, ok := versions[migration.Version]; !ok {
+				return nil
+			}
+			logger.Infof("Reverting migration %v_%v", migration.Version, migration.Name)
+			if err := tracing.Exec(tx, migration.Down).Error; err != nil {
+				return fmt.Errorf("Failed to revert migration %v_%v: %v", migration.Version, migration.Name, err)
+			}
+			reverted = true
+			return tracing.Exec(tx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version).Error
+		})
+		if err != nil {
+			return result, err
+		}
+		if reverted {
+			result = append(result, migration)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,163 @@
+package migrations
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/app"
+	"ledger.api/pkg/logging"
+)
+
+func TestAll(t *testing.T) {
+	Convey("Given registered migrations", t, func() {
+		migrations := All()
+
+		Convey("It should return migrations ordered by version", func() {
+			So(migrations, ShouldNotBeEmpty)
+			for i := 1; i < len(migrations); i++ {
+				So(migrations[i].Version, ShouldBeGreaterThan, migrations[i-1].Version)
+			}
+		})
+
+		Convey("It should have valid migrations", func() {
+			So(validate(migrations), ShouldBeNil)
+			for _, migration := range migrations {
+				So(migration.Name, ShouldNotBeEmpty)
+				So(migration.Up, ShouldNotBeEmpty)
+				So(migration.Down, ShouldNotBeEmpty)
+			}
+		})
+	})
+}
+
+func TestLoad(t *testing.T) {
+	Convey("Given migration scripts", t, func() {
+		fsys := fstest.MapFS{
+			"sql/0002_second.up.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE second();")},
+			"sql/0002_second.down.sql": &fstest.MapFile{Data: []byte("DROP TABLE second;")},
+			"sql/0001_first.up.sql":    &fstest.MapFile{Data: []byte("CREATE TABLE first();")},
+			"sql/0001_first.down.sql":  &fstest.MapFile{Data: []byte("DROP TABLE first;")},
+		}
+
+		Convey("It should load migrations ordered by version", func() {
+			migrations, err := load(fsys, "sql")
+			So(err, ShouldBeNil)
+			So(migrations, ShouldResemble, []Migration{
+				Migration{Version: 1, Name: "first", Up: "CREATE TABLE first();", Down: "DROP TABLE first;"},
+				Migration{Version: 2, Name: "second", Up: "CREATE TABLE second();", Down: "DROP TABLE second;"},
+			})
+		})
+
+		Convey("It should fail if down script is missing", func() {
+			delete(fsys, "sql/0002_second.down.sql")
+			_, err := load(fsys, "sql")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("It should fail if names of scripts are different", func() {
+			fsys["sql/0002_other.down.sql"] = fsys["sql/0002_second.down.sql"]
+			delete(fsys, "sql/0002_second.down.sql")
+			_, err := load(fsys, "sql")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("It should fail if file name is unexpected", func() {
+			fsys["sql/first.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+			_, err := load(fsys, "sql")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestCreateMigrator(t *testing.T) {
+	Convey("It should reject duplicate versions", t, func() {
+		_, err := CreateMigrator(DB, []Migration{
+			Migration{Version: 1, Name: "first"},
+			Migration{Version: 1, Name: "second"},
+		})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("It should reject invalid versions", t, func() {
+		_, err := CreateMigrator(DB, []Migration{Migration{Version: 0, Name: "zero"}})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	// Migrations are applied to a dedicated schema so tables of the test db are not affected
+	const schema = "migrations_test"
+	if err := DB.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer DB.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE")
+
+	dbURL, err := url.Parse(app.GetConfig().GetString("DB_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := dbURL.Query()
+	query.Set("search_path", schema)
+	dbURL.RawQuery = query.Encode()
+	schemaDB := app.OpenGormConnection(dbURL.String(), logging.NewTestLogger())
+	defer schemaDB.Close()
+
+	Convey("Given migrator", t, func() {
+		migrator, err := CreateMigrator(schemaDB, All())
+		So(err, ShouldBeNil)
+
+		Convey("It should report all migrations as pending initially", func() {
+			status, err := migrator.Status(ctx)
+			So(err, ShouldBeNil)
+			So(status, ShouldHaveLength, len(All()))
+			for _, migrationStatus := range status {
+				So(migrationStatus.AppliedAt, ShouldBeNil)
+			}
+		})
+
+		Convey("When migrations are applied", func() {
+			applied, err := migrator.Up(ctx)
+			So(err, ShouldBeNil)
+			Reset(func() {
+				_, err := migrator.Down(ctx, len(All()))
+				So(err, ShouldBeNil)
+			})
+
+			Convey("It should apply all migrations", func() {
+				So(applied, ShouldResemble, All())
+				status, err := migrator.Status(ctx)
+				So(err, ShouldBeNil)
+				for _, migrationStatus := range status {
+					So(migrationStatus.AppliedAt, ShouldNotBeNil)
+				}
+				var count int
+				So(schemaDB.Table("projections_transactions").Count(&count).Error, ShouldBeNil)
+			})
+
+			Convey("It should not apply migrations again", func() {
+				applied, err := migrator.Up(ctx)
+				So(err, ShouldBeNil)
+				So(applied, ShouldBeEmpty)
+			})
+
+			Convey("It should revert given number of migrations", func() {
+				all := All()
+				reverted, err := migrator.Down(ctx, 1)
+				So(err, ShouldBeNil)
+				So(reverted, ShouldResemble, []Migration{all[len(all)-1]})
+				status, err := migrator.Status(ctx)
+				So(err, ShouldBeNil)
+				So(status[len(status)-1].AppliedAt, ShouldBeNil)
+				So(status[0].AppliedAt, ShouldNotBeNil)
+			})
+		})
+	})
+}
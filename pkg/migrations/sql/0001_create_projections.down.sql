@@ -0,0 +1,5 @@
+DROP TABLE projections_transactions;
+DROP TABLE projections_tags;
+DROP TABLE projections_categories;
+DROP TABLE projections_accounts;
+DROP TABLE projections_ledgers;
@@ -0,0 +1,60 @@
+-- Projections are maintained by v1 and read (and in a few cases updated) by v2.
+-- Columns below are the ones v2 relies on
+-- Tables are created only if missing so migrations can be applied to v1 initialized dbs
+CREATE TABLE IF NOT EXISTS projections_ledgers(
+  id serial PRIMARY KEY,
+  aggregate_id varchar(255) NOT NULL,
+  owner_user_id integer NOT NULL,
+  name varchar(255) NOT NULL,
+  currency_code varchar(255) NOT NULL,
+  authorized_user_ids text NOT NULL DEFAULT ''
+);
+CREATE UNIQUE INDEX IF NOT EXISTS projections_ledgers_aggregate_id_idx ON projections_ledgers(aggregate_id);
+
+CREATE TABLE IF NOT EXISTS projections_accounts(
+  id serial PRIMARY KEY,
+  ledger_id varchar(255) NOT NULL,
+  aggregate_id varchar(255) NOT NULL,
+  sequential_number integer NOT NULL,
+  owner_user_id integer NOT NULL,
+  authorized_user_ids text NOT NULL DEFAULT '',
+  currency_code varchar(255) NOT NULL,
+  name varchar(255) NOT NULL,
+  balance integer NOT NULL DEFAULT 0,
+  is_closed boolean NOT NULL DEFAULT false,
+  category_id integer
+);
+CREATE UNIQUE INDEX IF NOT EXISTS projections_accounts_aggregate_id_idx ON projections_accounts(aggregate_id);
+CREATE INDEX IF NOT EXISTS projections_accounts_ledger_id_idx ON projections_accounts(ledger_id);
+
+CREATE TABLE IF NOT EXISTS projections_categories(
+  id serial PRIMARY KEY,
+  ledger_id varchar(255) NOT NULL,
+  category_id integer NOT NULL,
+  display_order integer NOT NULL DEFAULT 0,
+  name varchar(255) NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS projections_categories_ledger_id_category_id_idx ON projections_categories(ledger_id, category_id);
+
+CREATE TABLE IF NOT EXISTS projections_tags(
+  id serial PRIMARY KEY,
+  ledger_id varchar(255) NOT NULL,
+  tag_id integer NOT NULL,
+  name varchar(255) NOT NULL,
+  authorized_user_ids text NOT NULL DEFAULT ''
+);
+CREATE UNIQUE INDEX IF NOT EXISTS projections_tags_ledger_id_tag_id_idx ON projections_tags(ledger_id, tag_id);
+
+CREATE TABLE IF NOT EXISTS projections_transactions(
+  id serial PRIMARY KEY,
+  transaction_id varchar(255) NOT NULL,
+  account_id varchar(255) NOT NULL,
+  type_id integer NOT NULL,
+  amount integer NOT NULL,
+  tag_ids text NOT NULL DEFAULT '',
+  comment text NOT NULL DEFAULT '',
+  date timestamp without time zone NOT NULL,
+  is_transfer boolean NOT NULL DEFAULT false
+);
+CREATE UNIQUE INDEX IF NOT EXISTS projections_transactions_transaction_id_idx ON projections_transactions(transaction_id);
+CREATE INDEX IF NOT EXISTS projections_transactions_account_id_date_idx ON projections_transactions(account_id, date);
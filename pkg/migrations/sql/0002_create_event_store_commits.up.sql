@@ -0,0 +1,15 @@
+-- Event store commits table has the same layout v1 event store uses so
+-- events appended by v2 can be dispatched by v1 and vice versa
+-- Tables are created only if missing so migrations can be applied to v1 initialized dbs
+CREATE TABLE IF NOT EXISTS event_store_commits(
+  checkpoint_number bigserial PRIMARY KEY,
+  stream_id varchar(255) NOT NULL,
+  commit_id varchar(255) NOT NULL,
+  commit_sequence integer NOT NULL,
+  stream_revision integer NOT NULL,
+  commit_timestamp timestamp without time zone NOT NULL,
+  headers text NOT NULL,
+  events text NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS event_store_commits_commit_id_idx ON event_store_commits(commit_id);
+CREATE UNIQUE INDEX IF NOT EXISTS event_store_commits_stream_id_commit_sequence_idx ON event_store_commits(stream_id, commit_sequence);
@@ -0,0 +1,6 @@
+-- User identities map auth0 subjects to v1 user ids
+CREATE TABLE user_identities(
+  subject varchar(255) PRIMARY KEY,
+  user_id integer NOT NULL
+);
+CREATE INDEX user_identities_user_id_idx ON user_identities(user_id);
@@ -0,0 +1,7 @@
+CREATE TABLE exchange_rates(
+  from_currency varchar(3) NOT NULL,
+  to_currency varchar(3) NOT NULL,
+  date date NOT NULL,
+  rate double precision NOT NULL,
+  PRIMARY KEY (from_currency, to_currency, date)
+);
@@ -0,0 +1 @@
+DROP TABLE projections_checkpoints;
@@ -0,0 +1,6 @@
+-- Projections checkpoints keep position of projectors in the event store
+CREATE TABLE projections_checkpoints(
+  name varchar(255) PRIMARY KEY,
+  checkpoint_number bigint NOT NULL DEFAULT 0,
+  updated_at timestamp without time zone NOT NULL
+);
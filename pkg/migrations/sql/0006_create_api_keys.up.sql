@@ -0,0 +1,15 @@
+-- API keys authenticate scripts and integrations on behalf of a user.
+-- Only a hash of the key is stored, the key itself is shown once on creation
+CREATE TABLE api_keys(
+  key_id uuid PRIMARY KEY,
+  subject varchar(255) NOT NULL,
+  name varchar(255) NOT NULL,
+  key_prefix varchar(16) NOT NULL,
+  key_hash varchar(64) NOT NULL UNIQUE,
+  scopes text NOT NULL,
+  created_at timestamp without time zone NOT NULL,
+  expires_at timestamp without time zone,
+  last_used_at timestamp without time zone,
+  revoked_at timestamp without time zone
+);
+CREATE INDEX api_keys_subject_idx ON api_keys(subject);
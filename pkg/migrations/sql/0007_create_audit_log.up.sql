@@ -0,0 +1,23 @@
+-- Audit log keeps authenticated API calls. Rows can't be updated or deleted
+CREATE TABLE audit_log(
+  audit_id bigserial PRIMARY KEY,
+  occurred_at timestamp without time zone NOT NULL,
+  subject varchar(255) NOT NULL,
+  scopes text NOT NULL,
+  request_id varchar(255) NOT NULL,
+  method varchar(16) NOT NULL,
+  route varchar(255) NOT NULL,
+  ledger_id varchar(255),
+  status integer NOT NULL
+);
+CREATE INDEX audit_log_ledger_id_idx ON audit_log(ledger_id, audit_id);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+  BEFORE UPDATE OR DELETE ON audit_log
+  FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
@@ -0,0 +1,14 @@
+-- Ledger invitations are sent by ledger owners. The invitation token is signed
+-- and carries the invitation id, a row keeps the state so the token is used once
+CREATE TABLE ledger_invitations(
+  invitation_id uuid PRIMARY KEY,
+  ledger_id varchar(255) NOT NULL,
+  email varchar(255) NOT NULL,
+  invited_by_user_id integer NOT NULL,
+  created_at timestamp without time zone NOT NULL,
+  expires_at timestamp without time zone NOT NULL,
+  accepted_by_user_id integer,
+  accepted_at timestamp without time zone,
+  declined_at timestamp without time zone
+);
+CREATE INDEX ledger_invitations_ledger_id_idx ON ledger_invitations(ledger_id);
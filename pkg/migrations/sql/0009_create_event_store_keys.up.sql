@@ -0,0 +1,17 @@
+-- Event store keys are claimed within commits to keep ids of entities unique
+-- across streams, e.g ids of transactions. Ids of existing transactions are claimed as well
+CREATE TABLE event_store_keys(
+  key varchar(255) PRIMARY KEY,
+  stream_id varchar(255) NOT NULL,
+  claimed_at timestamp without time zone NOT NULL
+);
+
+INSERT INTO event_store_keys(key, stream_id, claimed_at)
+SELECT 'transaction:' || (evt->'data'->>'transaction_id'), cmt.stream_id, cmt.commit_timestamp
+FROM event_store_commits cmt, json_array_elements(cmt.events::json) evt
+WHERE evt->>'type' IN (
+  'Domain::Events::TransactionReported',
+  'Domain::Events::TransferSent',
+  'Domain::Events::TransferReceived'
+)
+ON CONFLICT (key) DO NOTHING;
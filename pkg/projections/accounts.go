@@ -0,0 +1,117 @@
+package projections
+
+import (
+	"encoding/json"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/tracing"
+)
+
+// Events below are emitted by v1 account aggregate. Stream id is an account id.
+
+type accountCreated struct {
+	AggregateID      string `json:"aggregate_id"`
+	LedgerID         string `json:"ledger_id"`
+	SequentialNumber int    `json:"sequential_number"`
+	OwnerUserID      int    `json:"owner_user_id"`
+	Name             string `json:"name"`
+	CurrencyCode     string `json:"currency_code"`
+}
+
+func (evt *accountCreated) aggregateID() string { return evt.AggregateID }
+
+type accountRenamed struct {
+	AggregateID string `json:"aggregate_id"`
+	Name        string `json:"name"`
+}
+
+func (evt *accountRenamed) aggregateID() string { return evt.AggregateID }
+
+type accountStateChanged struct {
+	AggregateID string `json:"aggregate_id"`
+}
+
+func (evt *accountStateChanged) aggregateID() string { return evt.AggregateID }
+
+type accountBalanceChanged struct {
+	AggregateID   string `json:"aggregate_id"`
+	TransactionID string `json:"transaction_id"`
+	Balance       int    `json:"balance"`
+}
+
+func (evt *accountBalanceChanged) aggregateID() string { return evt.AggregateID }
+
+func registerAccountHandlers(projector *Projector) {
+	// Account is authorized for the same users as its ledger
+	projector.on("Domain::Events::AccountCreated", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt accountCreated
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx, `
+			INSERT INTO projections_accounts(
+				ledger_id, aggregate_id, sequential_number, owner_user_id,
+				authorized_user_ids, currency_code, name
+			)
+			SELECT ?, ?, ?, ?, COALESCE(MAX(authorized_user_ids), ?), ?, ?
+			FROM projections_ledgers WHERE aggregate_id = ?
+			`,
+			evt.LedgerID, evt.AggregateID, evt.SequentialNumber, evt.OwnerUserID,
+			authorizedUserID(evt.OwnerUserID), evt.CurrencyCode, evt.Name, evt.LedgerID,
+		).Error
+	})
+
+	projector.on("Domain::Events::AccountRenamed", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt accountRenamed
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx,
+			"UPDATE projections_accounts SET name = ? WHERE aggregate_id = ?", evt.Name, evt.AggregateID,
+		).Error
+	})
+
+	projector.on("Domain::Events::AccountClosed", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt accountStateChanged
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx,
+			"UPDATE projections_accounts SET is_closed = true WHERE aggregate_id = ?", evt.AggregateID,
+		).Error
+	})
+
+	projector.on("Domain::Events::AccountReopened", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt accountStateChanged
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx,
+			"UPDATE projections_accounts SET is_closed = false WHERE aggregate_id = ?", evt.AggregateID,
+		).Error
+	})
+
+	// Removing an account removes its transactions as well
+	projector.on("Domain::Events::AccountRemoved", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt accountStateChanged
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		if err := tracing.Exec(tx,
+			"DELETE FROM projections_transactions WHERE account_id = ?", evt.AggregateID,
+		).Error; err != nil {
+			return err
+		}
+		return tracing.Exec(tx, "DELETE FROM projections_accounts WHERE aggregate_id = ?", evt.AggregateID).Error
+	})
+
+	projector.on("Domain::Events::AccountBalanceChanged", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt accountBalanceChanged
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx,
+			"UPDATE projections_accounts SET balance = ? WHERE aggregate_id = ?", evt.Balance, evt.AggregateID,
+		).Error
+	})
+}
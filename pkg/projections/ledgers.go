@@ -0,0 +1,199 @@
+package projections
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/tracing"
+)
+
+// Events below are emitted by v1 ledger aggregate. Stream id is a ledger id.
+
+type ledgerCreated struct {
+	AggregateID  string `json:"aggregate_id"`
+	UserID       int    `json:"user_id"`
+	Name         string `json:"name"`
+	CurrencyCode string `json:"currency_code"`
+}
+
+func (evt *ledgerCreated) aggregateID() string { return evt.AggregateID }
+
+type ledgerRenamed struct {
+	AggregateID string `json:"aggregate_id"`
+	Name        string `json:"name"`
+}
+
+func (evt *ledgerRenamed) aggregateID() string { return evt.AggregateID }
+
+type ledgerShared struct {
+	AggregateID string `json:"aggregate_id"`
+	UserID      int    `json:"user_id"`
+}
+
+func (evt *ledgerShared) aggregateID() string { return evt.AggregateID }
+
+type ledgerUnshared struct {
+	AggregateID string `json:"aggregate_id"`
+	UserID      int    `json:"user_id"`
+}
+
+func (evt *ledgerUnshared) aggregateID() string { return evt.AggregateID }
+
+type categoryCreated struct {
+	AggregateID  string `json:"aggregate_id"`
+	CategoryID   int    `json:"category_id"`
+	DisplayOrder int    `json:"display_order"`
+	Name         string `json:"name"`
+}
+
+func (evt *categoryCreated) aggregateID() string { return evt.AggregateID }
+
+type categoryRenamed struct {
+	AggregateID string `json:"aggregate_id"`
+	CategoryID  int    `json:"category_id"`
+	Name        string `json:"name"`
+}
+
+func (evt *categoryRenamed) aggregateID() string { return evt.AggregateID }
+
+type categoryDisplayOrderChanged struct {
+	AggregateID  string `json:"aggregate_id"`
+	CategoryID   int    `json:"category_id"`
+	DisplayOrder int    `json:"display_order"`
+}
+
+func (evt *categoryDisplayOrderChanged) aggregateID() string { return evt.AggregateID }
+
+type accountCategoryAssigned struct {
+	AggregateID string `json:"aggregate_id"`
+	CategoryID  int    `json:"category_id"`
+	AccountID   string `json:"account_id"`
+}
+
+func (evt *accountCategoryAssigned) aggregateID() string { return evt.AggregateID }
+
+// authorizedUserID formats user id the way v1 stores it in authorized_user_ids columns
+func authorizedUserID(userID int) string {
+	return fmt.Sprintf("{%v}", userID)
+}
+
+// appendAuthorizedUser appends user id to authorized_user_ids of rows matching given condition
+// unless the user is already authorized
+func appendAuthorizedUser(tx *gorm.DB, table string, condition string, value interface{}, userID int) error {
+	return tracing.Exec(tx, `
+		UPDATE `+table+`
+		SET authorized_user_ids = CASE authorized_user_ids WHEN '' THEN ? ELSE authorized_user_ids || ',' || ? END
+		WHERE `+condition+` AND authorized_user_ids NOT LIKE ?
+		`, authorizedUserID(userID), authorizedUserID(userID), value, "%"+authorizedUserID(userID)+"%",
+	).Error
+}
+
+// removeAuthorizedUser removes user id from authorized_user_ids of rows matching given condition
+func removeAuthorizedUser(tx *gorm.DB, table string, condition string, value interface{}, userID int) error {
+	return tracing.Exec(tx, `
+		UPDATE `+table+`
+		SET authorized_user_ids = TRIM(BOTH ',' FROM REPLACE(',' || authorized_user_ids || ',', ?, ','))
+		WHERE `+condition+` AND authorized_user_ids LIKE ?
+		`, ","+authorizedUserID(userID)+",", value, "%"+authorizedUserID(userID)+"%",
+	).Error
+}
+
+func registerLedgerHandlers(projector *Projector) {
+	projector.on("Domain::Events::LedgerCreated", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt ledgerCreated
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx, `
+			INSERT INTO projections_ledgers(aggregate_id, owner_user_id, name, currency_code, authorized_user_ids)
+			VALUES(?, ?, ?, ?, ?)
+			`, evt.AggregateID, evt.UserID, evt.Name, evt.CurrencyCode, authorizedUserID(evt.UserID),
+		).Error
+	})
+
+	projector.on("Domain::Events::LedgerRenamed", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt ledgerRenamed
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx,
+			"UPDATE projections_ledgers SET name = ? WHERE aggregate_id = ?", evt.Name, evt.AggregateID,
+		).Error
+	})
+
+	// Accounts and tags of the ledger are shared with the user as well
+	projector.on("Domain::Events::LedgerShared", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt ledgerShared
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		if err := appendAuthorizedUser(tx, "projections_ledgers", "aggregate_id = ?", evt.AggregateID, evt.UserID); err != nil {
+			return err
+		}
+		if err := appendAuthorizedUser(tx, "projections_accounts", "ledger_id = ?", evt.AggregateID, evt.UserID); err != nil {
+			return err
+		}
+		return appendAuthorizedUser(tx, "projections_tags", "ledger_id = ?", evt.AggregateID, evt.UserID)
+	})
+
+	// Access to accounts and tags of the ledger is revoked as well
+	projector.on("Domain::Events::LedgerUnshared", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt ledgerUnshared
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		if err := removeAuthorizedUser(tx, "projections_ledgers", "aggregate_id = ?", evt.AggregateID, evt.UserID); err != nil {
+			return err
+		}
+		if err := removeAuthorizedUser(tx, "projections_accounts", "ledger_id = ?", evt.AggregateID, evt.UserID); err != nil {
+			return err
+		}
+		return removeAuthorizedUser(tx, "projections_tags", "ledger_id = ?", evt.AggregateID, evt.UserID)
+	})
+
+	projector.on("Domain::Events::CategoryCreated", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt categoryCreated
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx, `
+			INSERT INTO projections_categories(ledger_id, category_id, display_order, name)
+			VALUES(?, ?, ?, ?)
+			`, evt.AggregateID, evt.CategoryID, evt.DisplayOrder, evt.Name,
+		).Error
+	})
+
+	projector.on("Domain::Events::CategoryRenamed", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt categoryRenamed
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx,
+			"UPDATE projections_categories SET name = ? WHERE ledger_id = ? AND category_id = ?",
+			evt.Name, evt.AggregateID, evt.CategoryID,
+		).Error
+	})
+
+	projector.on("Domain::Events::CategoryDisplayOrderChanged", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt categoryDisplayOrderChanged
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx,
+			"UPDATE projections_categories SET display_order = ? WHERE ledger_id = ? AND category_id = ?",
+			evt.DisplayOrder, evt.AggregateID, evt.CategoryID,
+		).Error
+	})
+
+	projector.on("Domain::Events::AccountCategoryAssigned", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt accountCategoryAssigned
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx,
+			"UPDATE projections_accounts SET category_id = ? WHERE ledger_id = ? AND aggregate_id = ?",
+			evt.CategoryID, evt.AggregateID, evt.AccountID,
+		).Error
+	})
+}
@@ -0,0 +1,336 @@
+package projections
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
+)
+
+// DefaultName is a name of the checkpoint of the default projector
+const DefaultName = "ledger.api"
+
+// defaultBatchSize is a max number of commits read from the event store at once
+const defaultBatchSize = 100
+
+// projectorLockID is an id of advisory lock that serializes projectors
+const projectorLockID = 419273
+
+// projectionTables are tables that are built by the projector. They're cleaned on rebuild
+var projectionTables = []string{
+	"projections_transactions",
+	"projections_tags",
+	"projections_categories",
+	"projections_accounts",
+	"projections_ledgers",
+}
+
+// rawEvent is an event as it's stored within a commit
+type rawEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// commit is a single commit of the event store
+type commit struct {
+	checkpointNumber int64
+	streamID         string
+	events           []rawEvent
+}
+
+// eventHandler applies an event to projections within given db transaction
+type eventHandler func(tx *gorm.DB, data json.RawMessage) error
+
+// checkpointGap - checkpoint numbers after the checkpoint that are not visible while later ones are.
+// Checkpoint numbers are assigned before commits are committed so a long transaction may commit
+// a lower number after higher ones. Numbers of rolled back transactions are never committed.
+// The gap is skipped once all transactions that were in progress when it was found are finished
+type checkpointGap struct {
+	after int64
+	xmax  int64
+}
+
+// Projector - reads v1 event store in order and applies events to projections.
+// Position in the event store is checkpointed together with projections changes
+// so each commit is applied exactly once
+type Projector struct {
+	db        *gorm.DB
+	name      string
+	batchSize int
+	handlers  map[string]eventHandler
+	gap       *checkpointGap
+}
+
+// CreateProjector initializes a new instance of the projector.
+// Position of the projector is tracked by given name
+func CreateProjector(db *gorm.DB, name string) *Projector {
+	projector := Projector{
+		db:        db,
+		name:      name,
+		batchSize: defaultBatchSize,
+		handlers:  make(map[string]eventHandler),
+	}
+	registerLedgerHandlers(&projector)
+	registerAccountHandlers(&projector)
+	registerTagHandlers(&projector)
+	registerTransactionHandlers(&projector)
+	return &projector
+}
+
+func (projector *Projector) on(eventType string, handler eventHandler) {
+	projector.handlers[eventType] = handler
+}
+
+// decodeEvent unmarshals event data and fails if aggregate id is missing
+func decodeEvent(data json.RawMessage, evt interface{ aggregateID() string }) error {
+	if err := json.Unmarshal(data, evt); err != nil {
+		return err
+	}
+	if evt.aggregateID() == "" {
+		return errors.New("Event has no aggregate_id")
+	}
+	return nil
+}
+
+func decodeCommit(checkpointNumber int64, streamID string, eventsJSON string) (*commit, error) {
+	result := commit{checkpointNumber: checkpointNumber, streamID: streamID}
+	if err := json.Unmarshal([]byte(eventsJSON), &result.events); err != nil {
+		return nil, fmt.Errorf("Failed to decode events of commit %v: %v", checkpointNumber, err)
+	}
+	return &result, nil
+}
+
+func loadCheckpoint(db *gorm.DB, name string) (int64, error) {
+	var checkpoint int64
+	if err := db.Table("projections_checkpoints").
+		Select("COALESCE(MAX(checkpoint_number), 0)").
+		Where("name = ?", name).
+		Row().Scan(&checkpoint); err != nil {
+		return 0, err
+	}
+	return checkpoint, nil
+}
+
+func saveCheckpoint(db *gorm.DB, name string, checkpoint int64) error {
+	return tracing.Exec(db, `
+		INSERT INTO projections_checkpoints(name, checkpoint_number, updated_at)
+		VALUES(?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET checkpoint_number = EXCLUDED.checkpoint_number, updated_at = EXCLUDED.updated_at
+		`, name, checkpoint, time.Now().UTC()).Error
+}
+
+// Checkpoint returns checkpoint number of the last applied commit
+func (projector *Projector) Checkpoint() (int64, error) {
+	return loadCheckpoint(projector.db, projector.name)
+}
+
+func (projector *Projector) readCommits(db *gorm.DB, after int64) ([]commit, error) {
+	rows, err := db.Table("event_store_commits").
+		Select("checkpoint_number, stream_id, events").
+		Where("checkpoint_number > ?", after).
+		Order("checkpoint_number").
+		Limit(projector.batchSize).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	commits := []commit{}
+	for rows.Next() {
+		var checkpointNumber int64
+		var streamID, eventsJSON string
+		if err := rows.Scan(&checkpointNumber, &streamID, &eventsJSON); err != nil {
+			return nil, err
+		}
+		decoded, err := decodeCommit(checkpointNumber, streamID, eventsJSON)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, *decoded)
+	}
+	return commits, rows.Err()
+}
+
+// readyCommits returns leading commits that follow the checkpoint without gaps.
+// A gap prior to the first commit is skipped if it's settled
+func readyCommits(checkpoint int64, commits []commit, gapSettled bool) []commit {
+	previous := checkpoint
+	for i, cmt := range commits {
+		if cmt.checkpointNumber != previous+1 && !(i == 0 && gapSettled) {
+			return commits[:i]
+		}
+		previous = cmt.checkpointNumber
+	}
+	return commits
+}
+
+// observeGap remembers transactions that are in progress while commits following the checkpoint are missing.
+// Should be called after commits are read so transactions that assigned missing numbers are in progress or finished
+func (projector *Projector) observeGap(db *gorm.DB, checkpoint int64) error {
+	var xmax int64
+	if err := db.Raw("SELECT txid_snapshot_xmax(txid_current_snapshot())").Row().Scan(&xmax); err != nil {
+		return err
+	}
+	projector.gap = &checkpointGap{after: checkpoint, xmax: xmax}
+	return nil
+}
+
+// gapSettled returns true if all transactions that were in progress when the gap after the checkpoint
+// was observed are finished. Should be called before commits are read so commits of such transactions are visible
+func (projector *Projector) gapSettled(db *gorm.DB, checkpoint int64) (bool, error) {
+	if projector.gap == nil || projector.gap.after != checkpoint {
+		return false, nil
+	}
+	var xmin int64
+	if err := db.Raw("SELECT txid_snapshot_xmin(txid_current_snapshot())").Row().Scan(&xmin); err != nil {
+		return false, err
+	}
+	return xmin >= projector.gap.xmax, nil
+}
+
+// applyCommit applies events of the commit and moves the checkpoint within a single transaction.
+// Commits that have already been applied (e.g by other projector instance) are skipped
+func (projector *Projector) applyCommit(db *gorm.DB, logger logging.Logger, cmt *commit) error {
+	tx := db.Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+	if err := tracing.Exec(tx, "SELECT pg_advisory_xact_lock(?)", projectorLockID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	checkpoint, err := loadCheckpoint(tx, projector.name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if checkpoint >= cmt.checkpointNumber {
+		return tx.Rollback().Error
+	}
+	for _, evt := range cmt.events {
+		handler, ok := projector.handlers[evt.Type]
+		if !ok {
+			logger.Debugf("Skipping event %v of commit %v", evt.Type, cmt.checkpointNumber)
+			continue
+		}
+		if err := handler(tx, evt.Data); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Failed to apply event %v of commit %v: %v", evt.Type, cmt.checkpointNumber, err)
+		}
+	}
+	if err := saveCheckpoint(tx, projector.name, cmt.checkpointNumber); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// ProcessPending applies all commits appended after the checkpoint in order of checkpoint numbers.
+// Commits following a gap in checkpoint numbers are not applied until the gap is filled or settled.
+// Returns a number of commits that have been processed
+func (projector *Projector) ProcessPending(ctx context.Context) (int, error) {
+	logger := logging.FromContext(ctx)
+	db := tracing.DB(ctx, projector.db)
+	processed := 0
+	for {
+		checkpoint, err := loadCheckpoint(db, projector.name)
+		if err != nil {
+			return processed, err
+		}
+		gapSettled, err := projector.gapSettled(db, checkpoint)
+		if err != nil {
+			return processed, err
+		}
+		commits, err := projector.readCommits(db, checkpoint)
+		if err != nil {
+			return processed, err
+		}
+		if len(commits) == 0 {
+			return processed, nil
+		}
+		commits = readyCommits(checkpoint, commits, gapSettled)
+		if len(commits) == 0 {
+			if projector.gap != nil && projector.gap.after == checkpoint {
+				logger.Debugf("Waiting for commits after checkpoint %v", checkpoint)
+				return processed, nil
+			}
+			// Checked again right away so gaps of rolled back transactions do not wait for the next poll
+			if err := projector.observeGap(db, checkpoint); err != nil {
+				return processed, err
+			}
+			continue
+		}
+		if gapSettled && commits[0].checkpointNumber > checkpoint+1 {
+			logger.Warnf("Skipping checkpoint numbers %v-%v that have not been committed",
+				checkpoint+1, commits[0].checkpointNumber-1)
+		}
+		logger.Debugf("Applying %v commits after checkpoint %v", len(commits), checkpoint)
+		for i := range commits {
+			if err := ctx.Err(); err != nil {
+				return processed, err
+			}
+			if err := projector.applyCommit(db, logger, &commits[i]); err != nil {
+				return processed, err
+			}
+			processed++
+		}
+	}
+}
+
+// Rebuild cleans projections and the checkpoint and applies all commits from scratch
+func (projector *Projector) Rebuild(ctx context.Context) (int, error) {
+	logger := logging.FromContext(ctx)
+	logger.Infof("Cleaning projections. Checkpoint: %v", projector.name)
+	tx := tracing.DB(ctx, projector.db).Begin()
+	if err := tx.Error; err != nil {
+		return 0, err
+	}
+	if err := tracing.Exec(tx, "SELECT pg_advisory_xact_lock(?)", projectorLockID).Error; err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	for _, table := range projectionTables {
+		if err := tracing.Exec(tx, "DELETE FROM "+table).Error; err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	if err := saveCheckpoint(tx, projector.name, 0); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+	return projector.ProcessPending(ctx)
+}
+
+// Run processes pending commits polling the event store with given interval until ctx is done
+func (projector *Projector) Run(ctx context.Context, pollInterval time.Duration) error {
+	logger := logging.FromContext(ctx)
+	logger.Infof("Starting projector %v. Poll interval: %v", projector.name, pollInterval)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		processed, err := projector.ProcessPending(ctx)
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if processed > 0 {
+			logger.Infof("Applied %v commits", processed)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package projections
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/icrowley/fake"
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/eventstore"
+	"ledger.api/pkg/logging"
+)
+
+// testEvent is serialized as its data so any v1 event can be appended
+type testEvent struct {
+	typ  string
+	data map[string]interface{}
+}
+
+func (evt testEvent) EventType() string { return evt.typ }
+
+func (evt testEvent) MarshalJSON() ([]byte, error) { return json.Marshal(evt.data) }
+
+// applyStreams applies commits of given streams only so events
+// appended concurrently by other tests do not interfere
+func applyStreams(projector *Projector, streamIDs ...string) error {
+	rows, err := DB.Table("event_store_commits").
+		Select("checkpoint_number, stream_id, events").
+		Where("stream_id IN (?)", streamIDs).
+		Order("checkpoint_number").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	logger := logging.NewTestLogger()
+	for rows.Next() {
+		var checkpointNumber int64
+		var streamID, eventsJSON string
+		if err := rows.Scan(&checkpointNumber, &streamID, &eventsJSON); err != nil {
+			return err
+		}
+		cmt, err := decodeCommit(checkpointNumber, streamID, eventsJSON)
+		if err != nil {
+			return err
+		}
+		if err := projector.applyCommit(DB, logger, cmt); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func TestDecodeCommit(t *testing.T) {
+	Convey("Given commit events", t, func() {
+		Convey("It should decode events", func() {
+			cmt, err := decodeCommit(10, "stream-1", `[
+				{"type":"Domain::Events::TagCreated","data":{"aggregate_id":"ledger-1","tag_id":1,"name":"t1"}},
+				{"type":"Domain::Events::TagRenamed","data":{"aggregate_id":"ledger-1","tag_id":1,"name":"t2"}}
+			]`)
+			So(err, ShouldBeNil)
+			So(cmt.checkpointNumber, ShouldEqual, 10)
+			So(cmt.streamID, ShouldEqual, "stream-1")
+			So(cmt.events, ShouldHaveLength, 2)
+			So(cmt.events[1].Type, ShouldEqual, "Domain::Events::TagRenamed")
+
+			var evt tagRenamed
+			So(decodeEvent(cmt.events[1].Data, &evt), ShouldBeNil)
+			So(evt, ShouldResemble, tagRenamed{AggregateID: "ledger-1", TagID: 1, Name: "t2"})
+		})
+
+		Convey("It should fail if events are malformed", func() {
+			_, err := decodeCommit(10, "stream-1", `{"type":"Domain::Events::TagCreated"}`)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("It should fail to decode event without aggregate id", func() {
+			var evt tagCreated
+			So(decodeEvent(json.RawMessage(`{"tag_id":1,"name":"t1"}`), &evt), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestReadyCommits(t *testing.T) {
+	Convey("Given commits read after a checkpoint", t, func() {
+		commits := []commit{{checkpointNumber: 11}, {checkpointNumber: 12}, {checkpointNumber: 14}}
+
+		Convey("It should return commits up to the first gap", func() {
+			So(readyCommits(10, commits, false), ShouldResemble, commits[:2])
+		})
+
+		Convey("It should return no commits if the gap follows the checkpoint", func() {
+			So(readyCommits(9, commits, false), ShouldBeEmpty)
+		})
+
+		Convey("It should skip settled gap that follows the checkpoint", func() {
+			So(readyCommits(9, commits, true), ShouldResemble, commits[:2])
+		})
+	})
+}
+
+func TestProjector(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+	store := eventstore.CreateStore(DB)
+
+	Convey("Given a projector", t, func() {
+		projector := CreateProjector(DB, "test-"+uuid.NewV4().String())
+
+		ledgerID := uuid.NewV4().String()
+		accountID := uuid.NewV4().String()
+		transactionID := uuid.NewV4().String()
+		ownerID := 100000 + fake.Year(0, 10000)
+		sharedWithID := ownerID + 1
+
+		appendEvents := func(streamID string, events ...testEvent) {
+			evts := make([]eventstore.Event, len(events))
+			for i, evt := range events {
+				evts[i] = evt
+			}
+			So(store.AppendEvents(ctx, streamID, eventstore.Headers{}, evts...), ShouldBeNil)
+		}
+
+		appendEvents(ledgerID,
+			testEvent{"Domain::Events::LedgerCreated", map[string]interface{}{
+				"aggregate_id": ledgerID, "user_id": ownerID, "name": "Ledger 1", "currency_code": "UAH",
+			}},
+			testEvent{"Domain::Events::TagCreated", map[string]interface{}{
+				"aggregate_id": ledgerID, "tag_id": 1, "name": "food",
+			}},
+			testEvent{"Domain::Events::TagCreated", map[string]interface{}{
+				"aggregate_id": ledgerID, "tag_id": 2, "name": "drinks",
+			}},
+			testEvent{"Domain::Events::CategoryCreated", map[string]interface{}{
+				"aggregate_id": ledgerID, "category_id": 1, "display_order": 0, "name": "Cash",
+			}},
+		)
+		appendEvents(accountID,
+			testEvent{"Domain::Events::AccountCreated", map[string]interface{}{
+				"aggregate_id": accountID, "ledger_id": ledgerID, "sequential_number": 1,
+				"owner_user_id": ownerID, "name": "Account 1", "currency_code": "UAH",
+			}},
+			testEvent{"Domain::Events::TransactionReported", map[string]interface{}{
+				"aggregate_id": accountID, "transaction_id": transactionID, "type_id": 2,
+				"amount": 1000, "date": "2018-03-01T10:00:00Z", "tag_ids": []int{1}, "comment": "Lunch",
+			}},
+			testEvent{"Domain::Events::AccountBalanceChanged", map[string]interface{}{
+				"aggregate_id": accountID, "transaction_id": transactionID, "balance": -1000,
+			}},
+		)
+
+		Convey("When commits are applied", func() {
+			So(applyStreams(projector, ledgerID, accountID), ShouldBeNil)
+
+			Convey("It should project the ledger, its tags and categories", func() {
+				var name, authorizedUserIDs string
+				So(DB.Table("projections_ledgers").Select("name, authorized_user_ids").
+					Where("aggregate_id = ?", ledgerID).Row().Scan(&name, &authorizedUserIDs), ShouldBeNil)
+				So(name, ShouldEqual, "Ledger 1")
+				So(authorizedUserIDs, ShouldEqual, authorizedUserID(ownerID))
+
+				var tagsCount, categoriesCount int
+				So(DB.Table("projections_tags").Where("ledger_id = ?", ledgerID).Count(&tagsCount).Error, ShouldBeNil)
+				So(tagsCount, ShouldEqual, 2)
+				So(DB.Table("projections_categories").Where("ledger_id = ?", ledgerID).Count(&categoriesCount).Error, ShouldBeNil)
+				So(categoriesCount, ShouldEqual, 1)
+			})
+
+			Convey("It should project the account and its transactions", func() {
+				var balance int
+				var authorizedUserIDs string
+				So(DB.Table("projections_accounts").Select("balance, authorized_user_ids").
+					Where("aggregate_id = ?", accountID).Row().Scan(&balance, &authorizedUserIDs), ShouldBeNil)
+				So(balance, ShouldEqual, -1000)
+				So(authorizedUserIDs, ShouldEqual, authorizedUserID(ownerID))
+
+				var amount int
+				var tagIDs, comment string
+				var date time.Time
+				So(DB.Table("projections_transactions").Select("amount, tag_ids, comment, date").
+					Where("transaction_id = ?", transactionID).Row().Scan(&amount, &tagIDs, &comment, &date), ShouldBeNil)
+				So(amount, ShouldEqual, 1000)
+				So(tagIDs, ShouldEqual, "{1}")
+				So(comment, ShouldEqual, "Lunch")
+				So(date.Equal(time.Date(2018, 3, 1, 10, 0, 0, 0, time.UTC)), ShouldBeTrue)
+			})
+
+			Convey("It should move the checkpoint", func() {
+				var last int64
+				So(DB.Table("event_store_commits").Select("MAX(checkpoint_number)").
+					Where("stream_id = ?", accountID).Row().Scan(&last), ShouldBeNil)
+				checkpoint, err := projector.Checkpoint()
+				So(err, ShouldBeNil)
+				So(checkpoint, ShouldEqual, last)
+			})
+
+			Convey("It should skip commits that have already been applied", func() {
+				So(applyStreams(projector, ledgerID, accountID), ShouldBeNil)
+				var count int
+				So(DB.Table("projections_transactions").Where("account_id = ?", accountID).Count(&count).Error, ShouldBeNil)
+				So(count, ShouldEqual, 1)
+			})
+
+			Convey("When further events are appended", func() {
+				appendEvents(accountID,
+					testEvent{"Domain::Events::TransactionTagged", map[string]interface{}{
+						"aggregate_id": accountID, "transaction_id": transactionID, "tag_id": 2,
+					}},
+					testEvent{"Domain::Events::TransactionUntagged", map[string]interface{}{
+						"aggregate_id": accountID, "transaction_id": transactionID, "tag_id": 1,
+					}},
+					testEvent{"Domain::Events::TransactionAmountAdjusted", map[string]interface{}{
+						"aggregate_id": accountID, "transaction_id": transactionID, "amount": 1500,
+					}},
+					testEvent{"Domain::Events::AccountClosed", map[string]interface{}{
+						"aggregate_id": accountID,
+					}},
+				)
+				appendEvents(ledgerID,
+					testEvent{"Domain::Events::LedgerShared", map[string]interface{}{
+						"aggregate_id": ledgerID, "user_id": sharedWithID,
+					}},
+					testEvent{"Domain::Events::TagRemoved", map[string]interface{}{
+						"aggregate_id": ledgerID, "tag_id": 1,
+					}},
+					testEvent{"Domain::Events::UnknownToProjector", map[string]interface{}{
+						"aggregate_id": ledgerID,
+					}},
+				)
+				So(applyStreams(projector, ledgerID, accountID), ShouldBeNil)
+
+				Convey("It should update the transaction", func() {
+					var amount int
+					var tagIDs string
+					So(DB.Table("projections_transactions").Select("amount, tag_ids").
+						Where("transaction_id = ?", transactionID).Row().Scan(&amount, &tagIDs), ShouldBeNil)
+					So(amount, ShouldEqual, 1500)
+					So(tagIDs, ShouldEqual, "{2}")
+				})
+
+				Convey("It should close the account", func() {
+					var isClosed bool
+					So(DB.Table("projections_accounts").Select("is_closed").
+						Where("aggregate_id = ?", accountID).Row().Scan(&isClosed), ShouldBeNil)
+					So(isClosed, ShouldBeTrue)
+				})
+
+				Convey("It should share the ledger with its accounts and tags", func() {
+					expected := authorizedUserID(ownerID) + "," + authorizedUserID(sharedWithID)
+					for _, table := range []string{"projections_ledgers", "projections_accounts", "projections_tags"} {
+						var authorizedUserIDs string
+						column := "ledger_id"
+						if table == "projections_ledgers" {
+							column = "aggregate_id"
+						}
+						So(DB.Table(table).Select("authorized_user_ids").
+							Where(column+" = ?", ledgerID).Row().Scan(&authorizedUserIDs), ShouldBeNil)
+						So(authorizedUserIDs, ShouldEqual, expected)
+					}
+				})
+
+				Convey("When the ledger is unshared", func() {
+					appendEvents(ledgerID,
+						testEvent{"Domain::Events::LedgerUnshared", map[string]interface{}{
+							"aggregate_id": ledgerID, "user_id": sharedWithID,
+						}},
+					)
+					So(applyStreams(projector, ledgerID, accountID), ShouldBeNil)
+
+					Convey("It should revoke access to the ledger, its accounts and tags", func() {
+						for _, table := range []string{"projections_ledgers", "projections_accounts", "projections_tags"} {
+							var authorizedUserIDs string
+							column := "ledger_id"
+							if table == "projections_ledgers" {
+								column = "aggregate_id"
+							}
+							So(DB.Table(table).Select("authorized_user_ids").
+								Where(column+" = ?", ledgerID).Row().Scan(&authorizedUserIDs), ShouldBeNil)
+							So(authorizedUserIDs, ShouldEqual, authorizedUserID(ownerID))
+						}
+					})
+				})
+
+				Convey("It should remove the tag", func() {
+					var count int
+					So(DB.Table("projections_tags").Where("ledger_id = ?", ledgerID).Count(&count).Error, ShouldBeNil)
+					So(count, ShouldEqual, 1)
+				})
+			})
+		})
+	})
+}
+
+func TestProjectorCheckpointGaps(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+	store := eventstore.CreateStore(DB)
+
+	Convey("Given a projector positioned at the end of the event store", t, func() {
+		projector := CreateProjector(DB, "test-"+uuid.NewV4().String())
+		streamID := uuid.NewV4().String()
+		applied := []string{}
+		projector.handlers = make(map[string]eventHandler)
+		projector.on("Test::Events::Appended", func(tx *gorm.DB, data json.RawMessage) error {
+			var evt struct {
+				AggregateID string `json:"aggregate_id"`
+				Name        string `json:"name"`
+			}
+			if err := json.Unmarshal(data, &evt); err != nil {
+				return err
+			}
+			if evt.AggregateID == streamID {
+				applied = append(applied, evt.Name)
+			}
+			return nil
+		})
+		var last int64
+		So(DB.Table("event_store_commits").Select("COALESCE(MAX(checkpoint_number), 0)").Row().Scan(&last), ShouldBeNil)
+		So(saveCheckpoint(DB, projector.name, last), ShouldBeNil)
+
+		newEvent := func(name string) eventstore.Event {
+			return testEvent{"Test::Events::Appended", map[string]interface{}{"aggregate_id": streamID, "name": name}}
+		}
+
+		// appendSlowly appends the event within a transaction that is finished once release is closed
+		appendSlowly := func(name string, result error) (release chan struct{}, done chan error) {
+			appended := make(chan struct{})
+			release = make(chan struct{})
+			done = make(chan error, 1)
+			go func() {
+				done <- store.Transaction(ctx, eventstore.Headers{}, func(tx eventstore.Tx) error {
+					if err := tx.Append(streamID, newEvent(name)); err != nil {
+						return err
+					}
+					close(appended)
+					<-release
+					return result
+				})
+			}()
+			<-appended
+			return release, done
+		}
+
+		// processPending processes commits until given number of them is applied. Commits of
+		// other tests may be in progress meanwhile so gaps they leave may take a few polls to settle
+		processPending := func(count int) {
+			for i := 0; i < 100 && len(applied) < count; i++ {
+				_, err := projector.ProcessPending(ctx)
+				So(err, ShouldBeNil)
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+
+		Convey("When an older checkpoint is committed after a newer one", func() {
+			release, done := appendSlowly("first", nil)
+			So(store.AppendEvents(ctx, streamID, eventstore.Headers{}, newEvent("second")), ShouldBeNil)
+
+			_, err := projector.ProcessPending(ctx)
+			So(err, ShouldBeNil)
+			So(applied, ShouldBeEmpty)
+
+			close(release)
+			So(<-done, ShouldBeNil)
+
+			Convey("It should apply both commits in order of checkpoint numbers", func() {
+				processPending(2)
+				So(applied, ShouldResemble, []string{"first", "second"})
+			})
+		})
+
+		Convey("When an older checkpoint is rolled back", func() {
+			failure := errors.New("rolled back")
+			release, done := appendSlowly("first", failure)
+			So(store.AppendEvents(ctx, streamID, eventstore.Headers{}, newEvent("second")), ShouldBeNil)
+			close(release)
+			So(<-done, ShouldEqual, failure)
+
+			Convey("It should skip its checkpoint number once settled", func() {
+				processPending(1)
+				So(applied, ShouldResemble, []string{"second"})
+			})
+		})
+	})
+}
@@ -0,0 +1,70 @@
+package projections
+
+import (
+	"encoding/json"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/tracing"
+)
+
+// Events below are emitted by v1 ledger aggregate. Stream id is a ledger id.
+
+type tagCreated struct {
+	AggregateID string `json:"aggregate_id"`
+	TagID       int    `json:"tag_id"`
+	Name        string `json:"name"`
+}
+
+func (evt *tagCreated) aggregateID() string { return evt.AggregateID }
+
+type tagRenamed struct {
+	AggregateID string `json:"aggregate_id"`
+	TagID       int    `json:"tag_id"`
+	Name        string `json:"name"`
+}
+
+func (evt *tagRenamed) aggregateID() string { return evt.AggregateID }
+
+type tagRemoved struct {
+	AggregateID string `json:"aggregate_id"`
+	TagID       int    `json:"tag_id"`
+}
+
+func (evt *tagRemoved) aggregateID() string { return evt.AggregateID }
+
+func registerTagHandlers(projector *Projector) {
+	// Tag is authorized for the same users as its ledger
+	projector.on("Domain::Events::TagCreated", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt tagCreated
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx, `
+			INSERT INTO projections_tags(ledger_id, tag_id, name, authorized_user_ids)
+			SELECT ?, ?, ?, COALESCE(MAX(authorized_user_ids), '')
+			FROM projections_ledgers WHERE aggregate_id = ?
+			`, evt.AggregateID, evt.TagID, evt.Name, evt.AggregateID,
+		).Error
+	})
+
+	projector.on("Domain::Events::TagRenamed", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt tagRenamed
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx,
+			"UPDATE projections_tags SET name = ? WHERE ledger_id = ? AND tag_id = ?",
+			evt.Name, evt.AggregateID, evt.TagID,
+		).Error
+	})
+
+	projector.on("Domain::Events::TagRemoved", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt tagRemoved
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx,
+			"DELETE FROM projections_tags WHERE ledger_id = ? AND tag_id = ?", evt.AggregateID, evt.TagID,
+		).Error
+	})
+}
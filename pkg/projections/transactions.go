@@ -0,0 +1,226 @@
+package projections
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/tags"
+	"ledger.api/pkg/tracing"
+)
+
+// Events below are emitted by v1 account aggregate. Stream id is an account id.
+
+// Transfers are projected as regular transactions flagged with is_transfer
+const (
+	transferSentTypeID     = 2 // expense
+	transferReceivedTypeID = 1 // income
+)
+
+type transactionReported struct {
+	AggregateID   string    `json:"aggregate_id"`
+	TransactionID string    `json:"transaction_id"`
+	TypeID        int       `json:"type_id"`
+	Amount        int       `json:"amount"`
+	Date          time.Time `json:"date"`
+	TagIDs        []int     `json:"tag_ids"`
+	Comment       string    `json:"comment"`
+}
+
+func (evt *transactionReported) aggregateID() string { return evt.AggregateID }
+
+type transferSent struct {
+	AggregateID        string    `json:"aggregate_id"`
+	TransactionID      string    `json:"transaction_id"`
+	ReceivingAccountID string    `json:"receiving_account_id"`
+	Amount             int       `json:"amount"`
+	Date               time.Time `json:"date"`
+	TagIDs             []int     `json:"tag_ids"`
+	Comment            string    `json:"comment"`
+}
+
+func (evt *transferSent) aggregateID() string { return evt.AggregateID }
+
+type transferReceived struct {
+	AggregateID          string    `json:"aggregate_id"`
+	TransactionID        string    `json:"transaction_id"`
+	SendingAccountID     string    `json:"sending_account_id"`
+	SendingTransactionID string    `json:"sending_transaction_id"`
+	Amount               int       `json:"amount"`
+	Date                 time.Time `json:"date"`
+	TagIDs               []int     `json:"tag_ids"`
+	Comment              string    `json:"comment"`
+}
+
+func (evt *transferReceived) aggregateID() string { return evt.AggregateID }
+
+type transactionAmountAdjusted struct {
+	AggregateID   string `json:"aggregate_id"`
+	TransactionID string `json:"transaction_id"`
+	Amount        int    `json:"amount"`
+}
+
+func (evt *transactionAmountAdjusted) aggregateID() string { return evt.AggregateID }
+
+type transactionCommentAdjusted struct {
+	AggregateID   string `json:"aggregate_id"`
+	TransactionID string `json:"transaction_id"`
+	Comment       string `json:"comment"`
+}
+
+func (evt *transactionCommentAdjusted) aggregateID() string { return evt.AggregateID }
+
+type transactionDateAdjusted struct {
+	AggregateID   string    `json:"aggregate_id"`
+	TransactionID string    `json:"transaction_id"`
+	Date          time.Time `json:"date"`
+}
+
+func (evt *transactionDateAdjusted) aggregateID() string { return evt.AggregateID }
+
+type transactionTagChanged struct {
+	AggregateID   string `json:"aggregate_id"`
+	TransactionID string `json:"transaction_id"`
+	TagID         int    `json:"tag_id"`
+}
+
+func (evt *transactionTagChanged) aggregateID() string { return evt.AggregateID }
+
+type transactionRemoved struct {
+	AggregateID   string `json:"aggregate_id"`
+	TransactionID string `json:"transaction_id"`
+}
+
+func (evt *transactionRemoved) aggregateID() string { return evt.AggregateID }
+
+func insertTransaction(
+	tx *gorm.DB, accountID string, transactionID string, typeID int,
+	amount int, date time.Time, tagIDs []int, comment string, isTransfer bool,
+) error {
+	return tracing.Exec(tx, `
+		INSERT INTO projections_transactions(
+			transaction_id, account_id, type_id, amount, tag_ids, comment, date, is_transfer
+		)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?)
+		`, transactionID, accountID, typeID, amount, tags.FormatTagIDs(tagIDs), comment, date.UTC(), isTransfer,
+	).Error
+}
+
+// updateTransactionTags loads tag ids of the transaction and stores the result of the update
+func updateTransactionTags(tx *gorm.DB, transactionID string, update func(tagIDs []int) []int) error {
+	var tagIDs string
+	if err := tx.Table("projections_transactions").
+		Where("transaction_id = ?", transactionID).
+		Select("tag_ids").
+		Row().
+		Scan(&tagIDs); err != nil {
+		return err
+	}
+	return tracing.Exec(tx,
+		"UPDATE projections_transactions SET tag_ids = ? WHERE transaction_id = ?",
+		tags.FormatTagIDs(update(tags.GetTagIDsFromString(tagIDs))), transactionID,
+	).Error
+}
+
+func registerTransactionHandlers(projector *Projector) {
+	projector.on("Domain::Events::TransactionReported", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt transactionReported
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return insertTransaction(tx, evt.AggregateID, evt.TransactionID, evt.TypeID,
+			evt.Amount, evt.Date, evt.TagIDs, evt.Comment, false)
+	})
+
+	projector.on("Domain::Events::TransferSent", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt transferSent
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return insertTransaction(tx, evt.AggregateID, evt.TransactionID, transferSentTypeID,
+			evt.Amount, evt.Date, evt.TagIDs, evt.Comment, true)
+	})
+
+	projector.on("Domain::Events::TransferReceived", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt transferReceived
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return insertTransaction(tx, evt.AggregateID, evt.TransactionID, transferReceivedTypeID,
+			evt.Amount, evt.Date, evt.TagIDs, evt.Comment, true)
+	})
+
+	projector.on("Domain::Events::TransactionAmountAdjusted", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt transactionAmountAdjusted
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx,
+			"UPDATE projections_transactions SET amount = ? WHERE transaction_id = ?",
+			evt.Amount, evt.TransactionID,
+		).Error
+	})
+
+	projector.on("Domain::Events::TransactionCommentAdjusted", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt transactionCommentAdjusted
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx,
+			"UPDATE projections_transactions SET comment = ? WHERE transaction_id = ?",
+			evt.Comment, evt.TransactionID,
+		).Error
+	})
+
+	projector.on("Domain::Events::TransactionDateAdjusted", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt transactionDateAdjusted
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx,
+			"UPDATE projections_transactions SET date = ? WHERE transaction_id = ?",
+			evt.Date.UTC(), evt.TransactionID,
+		).Error
+	})
+
+	projector.on("Domain::Events::TransactionTagged", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt transactionTagChanged
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return updateTransactionTags(tx, evt.TransactionID, func(tagIDs []int) []int {
+			for _, tagID := range tagIDs {
+				if tagID == evt.TagID {
+					return tagIDs
+				}
+			}
+			return append(tagIDs, evt.TagID)
+		})
+	})
+
+	projector.on("Domain::Events::TransactionUntagged", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt transactionTagChanged
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return updateTransactionTags(tx, evt.TransactionID, func(tagIDs []int) []int {
+			result := make([]int, 0, len(tagIDs))
+			for _, tagID := range tagIDs {
+				if tagID != evt.TagID {
+					result = append(result, tagID)
+				}
+			}
+			return result
+		})
+	})
+
+	projector.on("Domain::Events::TransactionRemoved", func(tx *gorm.DB, data json.RawMessage) error {
+		var evt transactionRemoved
+		if err := decodeEvent(data, &evt); err != nil {
+			return err
+		}
+		return tracing.Exec(tx,
+			"DELETE FROM projections_transactions WHERE transaction_id = ?", evt.TransactionID,
+		).Error
+	})
+}
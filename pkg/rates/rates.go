@@ -0,0 +1,179 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
+)
+
+// ErrRateNotFound - there is no rate for given currencies on or before given date
+var ErrRateNotFound = errors.New("Exchange rate not found")
+
+// IsCurrencyCode checks if given string looks like ISO 4217 currency code
+func IsCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Rate - exchange rate effective from given date. 1 unit of From currency costs Rate units of To currency
+type Rate struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	Date time.Time `json:"date"`
+	Rate float64   `json:"rate"`
+}
+
+// RateProvider - provides exchange rates
+type RateProvider interface {
+	// GetRate returns the most recent rate effective on given date.
+	// Returns ErrRateNotFound if there is no such rate
+	GetRate(ctx context.Context, from string, to string, date time.Time) (float64, error)
+}
+
+type dbRateProvider struct {
+	db *gorm.DB
+}
+
+func (provider *dbRateProvider) GetRate(ctx context.Context, from string, to string, date time.Time) (float64, error) {
+	logger := logging.FromContext(ctx)
+	logger.Debugf("Fetching exchange rate %v/%v on %v", from, to, date.Format("2006-01-02"))
+
+	rows, err := tracing.DB(ctx, provider.db).Table("exchange_rates").
+		Select("rate").
+		Where("from_currency = ? AND to_currency = ? AND date <= ?", from, to, date).
+		Order("date DESC").
+		Limit(1).
+		Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, ErrRateNotFound
+	}
+	var rate float64
+	if err := rows.Scan(&rate); err != nil {
+		return 0, err
+	}
+	return rate, nil
+}
+
+// CreateDBRateProvider initializes a new instance of the provider
+// that reads rates from exchange_rates table
+func CreateDBRateProvider(db *gorm.DB) RateProvider {
+	provider := dbRateProvider{db: db}
+	return &provider
+}
+
+type staticRateProvider struct {
+	// ratesByPair holds rates ordered by date for each "FROM/TO" pair
+	ratesByPair map[string][]Rate
+}
+
+func (provider *staticRateProvider) GetRate(ctx context.Context, from string, to string, date time.Time) (float64, error) {
+	rates := provider.ratesByPair[from+"/"+to]
+	index := sort.Search(len(rates), func(i int) bool {
+		return rates[i].Date.After(date)
+	})
+	if index == 0 {
+		return 0, ErrRateNotFound
+	}
+	return rates[index-1].Rate, nil
+}
+
+// CreateStaticRateProvider initializes a new instance of the provider
+// that serves given rates from memory
+func CreateStaticRateProvider(rates []Rate) RateProvider {
+	provider := staticRateProvider{ratesByPair: make(map[string][]Rate)}
+	for _, rate := range rates {
+		pair := rate.From + "/" + rate.To
+		provider.ratesByPair[pair] = append(provider.ratesByPair[pair], rate)
+	}
+	for _, pairRates := range provider.ratesByPair {
+		sort.Slice(pairRates, func(i, j int) bool {
+			return pairRates[i].Date.Before(pairRates[j].Date)
+		})
+	}
+	return &provider
+}
+
+// CreateFileRateProvider initializes a new instance of the provider
+// that serves rates loaded from a JSON file. The file should contain an array
+// of rates, e.g: [{"from": "USD", "to": "UAH", "date": "2018-01-01T00:00:00Z", "rate": 28.06}]
+func CreateFileRateProvider(path string) (RateProvider, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var rates []Rate
+	if err := json.NewDecoder(file).Decode(&rates); err != nil {
+		return nil, fmt.Errorf("Failed to parse rates file %v: %v", path, err)
+	}
+	return CreateStaticRateProvider(rates), nil
+}
+
+type conversionKey struct {
+	from string
+	to   string
+	date string
+}
+
+// Converter - converts amounts using rates of a given provider.
+// Rates are cached so a converter is intended to be used within a single request
+type Converter struct {
+	provider RateProvider
+	cache    map[conversionKey]float64
+}
+
+// NewConverter creates a new converter instance
+func NewConverter(provider RateProvider) *Converter {
+	return &Converter{provider: provider, cache: make(map[conversionKey]float64)}
+}
+
+// Convert converts amount (in cents) from one currency to another using rate effective on given date.
+// Rates are looked up for a direct pair first and for a reverse pair if not found
+func (converter *Converter) Convert(ctx context.Context, amount int, from string, to string, date time.Time) (int, error) {
+	if from == to || amount == 0 {
+		return amount, nil
+	}
+	key := conversionKey{from: from, to: to, date: date.Format("2006-01-02")}
+	rate, ok := converter.cache[key]
+	if !ok {
+		var err error
+		rate, err = converter.provider.GetRate(ctx, from, to, date)
+		if err == ErrRateNotFound {
+			var reverseRate float64
+			reverseRate, err = converter.provider.GetRate(ctx, to, from, date)
+			if err == nil && reverseRate > 0 {
+				rate = 1 / reverseRate
+			} else if err == nil {
+				err = ErrRateNotFound
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+		converter.cache[key] = rate
+	}
+	return int(math.Round(float64(amount) * rate)), nil
+}
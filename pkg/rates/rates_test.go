@@ -0,0 +1,161 @@
+package rates
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/logging"
+)
+
+type countingRateProvider struct {
+	RateProvider
+	calls int
+}
+
+func (provider *countingRateProvider) GetRate(ctx context.Context, from string, to string, date time.Time) (float64, error) {
+	provider.calls++
+	return provider.RateProvider.GetRate(ctx, from, to, date)
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+var testRates = []Rate{
+	Rate{From: "USD", To: "UAH", Date: date(2018, 2, 1), Rate: 28},
+	Rate{From: "USD", To: "UAH", Date: date(2018, 1, 1), Rate: 27},
+	Rate{From: "EUR", To: "UAH", Date: date(2018, 1, 1), Rate: 32.5},
+}
+
+func TestStaticRateProvider(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given static rate provider", t, func() {
+		provider := CreateStaticRateProvider(testRates)
+
+		Convey("It should return the most recent rate effective on given date", func() {
+			rate, err := provider.GetRate(ctx, "USD", "UAH", date(2018, 1, 15))
+			So(err, ShouldBeNil)
+			So(rate, ShouldEqual, 27)
+
+			rate, err = provider.GetRate(ctx, "USD", "UAH", date(2018, 2, 1))
+			So(err, ShouldBeNil)
+			So(rate, ShouldEqual, 28)
+		})
+
+		Convey("It should return not found if there are no rates before given date", func() {
+			_, err := provider.GetRate(ctx, "USD", "UAH", date(2017, 12, 31))
+			So(err, ShouldEqual, ErrRateNotFound)
+		})
+
+		Convey("It should return not found for unknown pair", func() {
+			_, err := provider.GetRate(ctx, "UAH", "USD", date(2018, 2, 1))
+			So(err, ShouldEqual, ErrRateNotFound)
+		})
+	})
+}
+
+func TestFileRateProvider(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given rates file", t, func() {
+		file, err := ioutil.TempFile("", "rates")
+		So(err, ShouldBeNil)
+		defer os.Remove(file.Name())
+
+		Convey("It should serve rates from the file", func() {
+			_, err := file.WriteString(`[{"from": "USD", "to": "UAH", "date": "2018-01-01T00:00:00Z", "rate": 27.5}]`)
+			So(err, ShouldBeNil)
+			provider, err := CreateFileRateProvider(file.Name())
+			So(err, ShouldBeNil)
+			rate, err := provider.GetRate(ctx, "USD", "UAH", date(2018, 1, 2))
+			So(err, ShouldBeNil)
+			So(rate, ShouldEqual, 27.5)
+		})
+
+		Convey("It should fail if file is malformed", func() {
+			_, err := file.WriteString(`{"from": "USD"`)
+			So(err, ShouldBeNil)
+			_, err = CreateFileRateProvider(file.Name())
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestConverter(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given converter", t, func() {
+		provider := &countingRateProvider{RateProvider: CreateStaticRateProvider(testRates)}
+		converter := NewConverter(provider)
+
+		Convey("It should keep amount as is for the same currency", func() {
+			amount, err := converter.Convert(ctx, 1234, "UAH", "UAH", date(2000, 1, 1))
+			So(err, ShouldBeNil)
+			So(amount, ShouldEqual, 1234)
+			So(provider.calls, ShouldEqual, 0)
+		})
+
+		Convey("It should convert using direct rate", func() {
+			amount, err := converter.Convert(ctx, 1001, "EUR", "UAH", date(2018, 1, 10))
+			So(err, ShouldBeNil)
+			So(amount, ShouldEqual, 32533)
+		})
+
+		Convey("It should convert using reverse rate", func() {
+			amount, err := converter.Convert(ctx, 2800, "UAH", "USD", date(2018, 2, 10))
+			So(err, ShouldBeNil)
+			So(amount, ShouldEqual, 100)
+		})
+
+		Convey("It should cache rates per day", func() {
+			_, err := converter.Convert(ctx, 100, "USD", "UAH", time.Date(2018, 1, 10, 1, 0, 0, 0, time.UTC))
+			So(err, ShouldBeNil)
+			_, err = converter.Convert(ctx, 200, "USD", "UAH", time.Date(2018, 1, 10, 15, 0, 0, 0, time.UTC))
+			So(err, ShouldBeNil)
+			So(provider.calls, ShouldEqual, 1)
+		})
+
+		Convey("It should fail if rate is not found", func() {
+			_, err := converter.Convert(ctx, 100, "GBP", "UAH", date(2018, 1, 10))
+			So(err, ShouldEqual, ErrRateNotFound)
+		})
+	})
+}
+
+func TestDBRateProvider(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given db rate provider", t, func() {
+		So(DB.Exec("DELETE FROM exchange_rates WHERE from_currency = 'XTS'").Error, ShouldBeNil)
+		for _, rate := range []Rate{
+			Rate{From: "XTS", To: "UAH", Date: date(2018, 1, 1), Rate: 10},
+			Rate{From: "XTS", To: "UAH", Date: date(2018, 2, 1), Rate: 11},
+		} {
+			So(DB.Exec(`
+				INSERT INTO exchange_rates(from_currency, to_currency, date, rate)
+				VALUES(?,?,?,?)
+				`, rate.From, rate.To, rate.Date, rate.Rate).Error, ShouldBeNil)
+		}
+		provider := CreateDBRateProvider(DB)
+
+		Convey("It should return the most recent rate effective on given date", func() {
+			rate, err := provider.GetRate(ctx, "XTS", "UAH", date(2018, 1, 31))
+			So(err, ShouldBeNil)
+			So(rate, ShouldEqual, 10)
+
+			rate, err = provider.GetRate(ctx, "XTS", "UAH", date(2018, 3, 1))
+			So(err, ShouldBeNil)
+			So(rate, ShouldEqual, 11)
+		})
+
+		Convey("It should return not found if there is no rate", func() {
+			_, err := provider.GetRate(ctx, "XTS", "UAH", date(2017, 1, 1))
+			So(err, ShouldEqual, ErrRateNotFound)
+		})
+	})
+}
@@ -0,0 +1,166 @@
+package seed
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/users"
+)
+
+var rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// Options - seed options
+type Options struct {
+	// Subject is an auth0 subject of a user seeded ledgers are shared with.
+	// A new random user is created if empty
+	Subject string
+
+	// Ledgers is a number of ledgers to seed
+	Ledgers int
+
+	// Transactions is a number of transactions to seed per ledger
+	Transactions int
+}
+
+// Result - seeded data
+type Result struct {
+	User      *users.User
+	LedgerIDs []string
+}
+
+// setupUser returns a user identified by given subject creating a new identity if required
+func setupUser(db *gorm.DB, subject string) (*users.User, error) {
+	if subject == "" {
+		return ldtesting.SetupUser(db)
+	}
+	user := users.User{Subject: subject}
+	err := db.Table("user_identities").
+		Select("user_id").
+		Where("subject = ?", subject).
+		Row().Scan(&user.ID)
+	if err == nil {
+		return &user, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err := db.Table("user_identities").
+		Select("COALESCE(MAX(user_id), 0) + 1").
+		Row().Scan(&user.ID); err != nil {
+		return nil, err
+	}
+	if err := db.Exec(
+		"INSERT INTO user_identities(subject, user_id) VALUES(?, ?)", user.Subject, user.ID,
+	).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// seedTransactions creates random transactions within the last year
+// and updates balances of accounts accordingly
+func seedTransactions(db *gorm.DB, md ldtesting.LedgerData, count int) error {
+	dateMax := time.Now()
+	dateMin := dateMax.AddDate(-1, 0, 0)
+	trxs := make([]ldtesting.Transaction, count)
+	for i := 0; i < count; i++ {
+		setup := []ldtesting.TransactionSetup{
+			ldtesting.TrxRndTag(md.TagIDs),
+			ldtesting.TrxRndAcc(md.AccountIDs),
+			ldtesting.TrxRndDate(dateMin, dateMax),
+			ldtesting.TrxAmount(100 + rnd.Intn(100000)),
+		}
+		switch n := rnd.Intn(10); {
+		case n < 2:
+			setup = append(setup, ldtesting.TrxIncome)
+		case n < 3:
+			setup = append(setup, ldtesting.TrxRefund)
+		}
+		trxs[i] = *ldtesting.NewTransaction(setup...)
+	}
+	if err := ldtesting.SetupTransactions(db, trxs); err != nil {
+		return err
+	}
+	return db.Exec(`
+		UPDATE projections_accounts acc SET balance = COALESCE((
+			SELECT SUM(CASE trx.type_id WHEN 2 THEN -trx.amount ELSE trx.amount END)
+			FROM projections_transactions trx
+			WHERE trx.account_id = acc.aggregate_id
+		), 0)
+		WHERE acc.ledger_id = ?
+		`, md.LedgerID).Error
+}
+
+// seedCategories creates a few categories and spreads accounts of the ledger between them
+func seedCategories(db *gorm.DB, md ldtesting.LedgerData) error {
+	names := []string{"Cash", "Banks", "Deposits"}
+	for i, name := range names {
+		if err := ldtesting.SetupCategory(db, md.LedgerID, i+1, name, i); err != nil {
+			return err
+		}
+	}
+	for i, accountID := range md.AccountIDs {
+		if err := db.Exec(
+			"UPDATE projections_accounts SET category_id = ? WHERE aggregate_id = ?", i%len(names)+1, accountID,
+		).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run seeds ledgers with tags, account categories, accounts and transactions
+// shared with a user. Changes are applied within a single db transaction
+func Run(ctx context.Context, db *gorm.DB, opts Options) (*Result, error) {
+	if opts.Ledgers <= 0 {
+		return nil, errors.New("Please provide a positive number of ledgers")
+	}
+	if opts.Transactions < 0 {
+		return nil, errors.New("Number of transactions should not be negative")
+	}
+	logger := logging.FromContext(ctx)
+
+	tx := db.Begin()
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+	result, err := run(logger, tx, opts)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func run(logger logging.Logger, db *gorm.DB, opts Options) (*Result, error) {
+	user, err := setupUser(db, opts.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to setup user: %v", err)
+	}
+	result := Result{User: user, LedgerIDs: make([]string, 0, opts.Ledgers)}
+	for i := 0; i < opts.Ledgers; i++ {
+		md, err := ldtesting.SetupLedgerData(db, user)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to setup ledger: %v", err)
+		}
+		logger.Infof("Seeding ledger %v. Transactions: %v", md.LedgerID, opts.Transactions)
+		if err := seedCategories(db, md); err != nil {
+			return nil, fmt.Errorf("Failed to setup categories: %v", err)
+		}
+		if err := seedTransactions(db, md, opts.Transactions); err != nil {
+			return nil, fmt.Errorf("Failed to setup transactions: %v", err)
+		}
+		result.LedgerIDs = append(result.LedgerIDs, md.LedgerID)
+	}
+	return &result, nil
+}
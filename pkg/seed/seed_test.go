@@ -0,0 +1,64 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/icrowley/fake"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/logging"
+)
+
+func TestRun(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given seed options", t, func() {
+		opts := Options{Ledgers: 2, Transactions: 20}
+
+		Convey("It should reject invalid options", func() {
+			_, err := Run(ctx, DB, Options{Ledgers: 0})
+			So(err, ShouldNotBeNil)
+			_, err = Run(ctx, DB, Options{Ledgers: 1, Transactions: -1})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When seeding for a new user", func() {
+			result, err := Run(ctx, DB, opts)
+			So(err, ShouldBeNil)
+
+			Convey("It should seed ledgers shared with the user", func() {
+				So(result.User, ShouldNotBeNil)
+				So(result.LedgerIDs, ShouldHaveLength, 2)
+				var count int
+				So(DB.Table("projections_ledgers").
+					Where("aggregate_id IN (?) AND authorized_user_ids LIKE ?", result.LedgerIDs, fmt.Sprintf("%%{%v}%%", result.User.ID)).
+					Count(&count).Error, ShouldBeNil)
+				So(count, ShouldEqual, 2)
+			})
+
+			Convey("It should seed transactions of each ledger", func() {
+				for _, ledgerID := range result.LedgerIDs {
+					var count int
+					So(DB.Table("projections_transactions trx").
+						Joins("JOIN projections_accounts acc ON acc.aggregate_id = trx.account_id").
+						Where("acc.ledger_id = ?", ledgerID).
+						Count(&count).Error, ShouldBeNil)
+					So(count, ShouldEqual, opts.Transactions)
+				}
+			})
+		})
+
+		Convey("When seeding for an existing subject", func() {
+			opts.Subject = "auth0|" + fake.CharactersN(24)
+			first, err := Run(ctx, DB, opts)
+			So(err, ShouldBeNil)
+
+			Convey("It should reuse user identity", func() {
+				second, err := Run(ctx, DB, opts)
+				So(err, ShouldBeNil)
+				So(second.User, ShouldResemble, first.User)
+			})
+		})
+	})
+}
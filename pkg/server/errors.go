@@ -31,6 +31,58 @@ func InternalServerError() *HTTPError {
 	}
 }
 
+// NotFoundError - return 404 error object
+func NotFoundError() *HTTPError {
+	return &HTTPError{
+		Status: http.StatusNotFound,
+		Errors: []*jsonapi.ErrorObject{
+			{
+				Status: strconv.Itoa(http.StatusNotFound),
+				Title:  http.StatusText(http.StatusNotFound),
+			},
+		},
+	}
+}
+
+// detailedError - return error object with given status and details
+func detailedError(status int, detail string) *HTTPError {
+	return &HTTPError{
+		Status: status,
+		Errors: []*jsonapi.ErrorObject{
+			{
+				Status: strconv.Itoa(status),
+				Title:  http.StatusText(status),
+				Detail: detail,
+			},
+		},
+	}
+}
+
+// BadRequestError - return 400 error object with given details
+func BadRequestError(detail string) *HTTPError {
+	return detailedError(http.StatusBadRequest, detail)
+}
+
+// ForbiddenError - return 403 error object with given details
+func ForbiddenError(detail string) *HTTPError {
+	return detailedError(http.StatusForbidden, detail)
+}
+
+// ConflictError - return 409 error object with given details
+func ConflictError(detail string) *HTTPError {
+	return detailedError(http.StatusConflict, detail)
+}
+
+// GoneError - return 410 error object with given details
+func GoneError(detail string) *HTTPError {
+	return detailedError(http.StatusGone, detail)
+}
+
+// UnprocessableEntityError - return 422 error object with given details
+func UnprocessableEntityError(detail string) *HTTPError {
+	return detailedError(http.StatusUnprocessableEntity, detail)
+}
+
 const (
 	validationErrDetailsMsg = "Field '%s' validation failed on '%s' tag"
 )
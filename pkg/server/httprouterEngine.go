@@ -2,7 +2,9 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 	"ledger.api/pkg/logging"
@@ -12,6 +14,15 @@ type contextKey string
 
 const requestParamsKey contextKey = "requestParams"
 
+var methodNotAllowedErrorBody = []byte(fmt.Sprintf(
+	routingErrFmt,
+	http.StatusMethodNotAllowed,
+	http.StatusText(http.StatusMethodNotAllowed),
+))
+
+// supportedMethods is a list of methods the engine may route, in order they're reported
+var supportedMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
 type httpRouterEngine struct {
 	router *httprouter.Router
 }
@@ -25,15 +36,58 @@ func (engine *httpRouterEngine) Handle(method string, path string, handler http.
 	})
 }
 
+// AllowedMethods returns methods that have routes registered for a given path.
+// OPTIONS is always allowed for known paths since it's handled automatically
+func (engine *httpRouterEngine) AllowedMethods(path string) []string {
+	allowed := []string{}
+	for _, method := range supportedMethods {
+		if handle, _, _ := engine.router.Lookup(method, path); handle != nil {
+			allowed = append(allowed, method)
+		}
+	}
+	if len(allowed) > 0 {
+		if handle, _, _ := engine.router.Lookup("OPTIONS", path); handle == nil {
+			allowed = append(allowed, "OPTIONS")
+		}
+	}
+	return allowed
+}
+
+func (engine *httpRouterEngine) serveOptions(w http.ResponseWriter, req *http.Request) {
+	allowed := engine.AllowedMethods(req.URL.Path)
+	if len(allowed) == 0 {
+		engine.router.NotFound.ServeHTTP(w, req)
+		return
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	w.WriteHeader(http.StatusOK)
+}
+
 func (engine *httpRouterEngine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "OPTIONS" {
+		if handle, _, _ := engine.router.Lookup("OPTIONS", req.URL.Path); handle == nil {
+			engine.serveOptions(w, req)
+			return
+		}
+	}
 	engine.router.ServeHTTP(w, req)
 }
 
 func createHTTPRouterEngine(logger logging.Logger) HTTPEngine {
 	router := httprouter.New()
+	engine := &httpRouterEngine{router: router}
+	router.HandleOPTIONS = false
+	router.HandleMethodNotAllowed = true
 	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
 		w.Write(noRouteErrorBody)
 	})
-	return &httpRouterEngine{router: router}
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Allow", strings.Join(engine.AllowedMethods(req.URL.Path), ", "))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write(methodNotAllowedErrorBody)
+	})
+	return engine
 }
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"ledger.api/pkg/logging"
+)
+
+// LifecycleConfig - http server timeouts and a time to wait for in-flight requests on shutdown
+type LifecycleConfig struct {
+	Addr            string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	Logger          logging.Logger
+}
+
+type shutdownHook struct {
+	name string
+	run  func() error
+}
+
+// Lifecycle - serves http requests until ctx is done and then shuts the server down gracefully:
+// stops accepting connections, waits for in-flight requests and runs shutdown hooks (e.g closes db)
+type Lifecycle struct {
+	cfg    LifecycleConfig
+	server *http.Server
+	hooks  []shutdownHook
+}
+
+// CreateLifecycle creates a lifecycle of http server that serves given handler
+func CreateLifecycle(handler http.Handler, cfg LifecycleConfig) *Lifecycle {
+	if cfg.Logger == nil {
+		cfg.Logger = logging.NewLogger("")
+	}
+	return &Lifecycle{
+		cfg: cfg,
+		server: &http.Server{
+			Addr:         cfg.Addr,
+			Handler:      handler,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			IdleTimeout:  cfg.IdleTimeout,
+		},
+	}
+}
+
+// OnShutdown registers a hook that runs after the server has been shut down.
+// Hooks run in reverse order of registration
+func (lc *Lifecycle) OnShutdown(name string, hook func() error) *Lifecycle {
+	lc.hooks = append(lc.hooks, shutdownHook{name: name, run: hook})
+	return lc
+}
+
+// ListenAndServe listens on configured address and serves requests until ctx is done
+func (lc *Lifecycle) ListenAndServe(ctx context.Context) error {
+	listener, err := net.Listen("tcp", lc.cfg.Addr)
+	if err != nil {
+		lc.runHooks()
+		return err
+	}
+	return lc.Serve(ctx, listener)
+}
+
+// Serve serves requests accepted by the listener until ctx is done
+func (lc *Lifecycle) Serve(ctx context.Context, listener net.Listener) error {
+	logger := lc.cfg.Logger
+	logger.Infof("Starting server on: %v", listener.Addr())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- lc.server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		logger.WithError(err).Error("Server failed")
+		lc.runHooks()
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Infof("Shutting down server. Waiting up to %v for in-flight requests", lc.cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), lc.cfg.ShutdownTimeout)
+	defer cancel()
+	err := lc.server.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.WithError(err).Warn("In-flight requests did not finish in time. Closing connections")
+		lc.server.Close()
+	}
+	<-serveErr
+	lc.runHooks()
+	logger.Info("Server stopped")
+	return err
+}
+
+func (lc *Lifecycle) runHooks() {
+	for i := len(lc.hooks) - 1; i >= 0; i-- {
+		hook := lc.hooks[i]
+		lc.cfg.Logger.Debugf("Running shutdown hook: %v", hook.name)
+		if err := hook.run(); err != nil {
+			lc.cfg.Logger.WithError(err).Errorf("Shutdown hook %v failed", hook.name)
+		}
+	}
+}
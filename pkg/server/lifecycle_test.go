@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/logging"
+)
+
+func TestLifecycle(t *testing.T) {
+	Convey("Given a running lifecycle", t, func() {
+		requestStarted := make(chan bool, 1)
+		releaseRequest := make(chan bool)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requestStarted <- true
+			<-releaseRequest
+			w.Write([]byte("done"))
+		})
+
+		hooks := []string{}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		lifecycle := CreateLifecycle(handler, LifecycleConfig{
+			ReadTimeout:     time.Second,
+			WriteTimeout:    time.Second,
+			IdleTimeout:     time.Second,
+			ShutdownTimeout: 2 * time.Second,
+			Logger:          logging.NewTestLogger(),
+		}).
+			OnShutdown("first", func() error { hooks = append(hooks, "first"); return nil }).
+			OnShutdown("second", func() error { hooks = append(hooks, "second"); return nil })
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stopped := make(chan error, 1)
+		go func() { stopped <- lifecycle.Serve(ctx, listener) }()
+
+		type result struct {
+			body string
+			err  error
+		}
+		responded := make(chan result, 1)
+		go func() {
+			res, err := http.Get("http://" + listener.Addr().String())
+			if err != nil {
+				responded <- result{err: err}
+				return
+			}
+			defer res.Body.Close()
+			body, err := ioutil.ReadAll(res.Body)
+			responded <- result{body: string(body), err: err}
+		}()
+		<-requestStarted
+
+		Convey("It should finish in-flight requests and run hooks on shutdown", func() {
+			cancel()
+			time.Sleep(50 * time.Millisecond)
+
+			_, err := net.Dial("tcp", listener.Addr().String())
+			So(err, ShouldNotBeNil)
+			So(hooks, ShouldBeEmpty)
+
+			close(releaseRequest)
+			res := <-responded
+			So(res.err, ShouldBeNil)
+			So(res.body, ShouldEqual, "done")
+			So(<-stopped, ShouldBeNil)
+			So(hooks, ShouldResemble, []string{"second", "first"})
+		})
+
+		Convey("It should close connections if requests do not finish in time", func() {
+			lifecycle.cfg.ShutdownTimeout = 50 * time.Millisecond
+			cancel()
+			So(<-stopped, ShouldNotBeNil)
+			So(hooks, ShouldResemble, []string{"second", "first"})
+			close(releaseRequest)
+			So((<-responded).err, ShouldNotBeNil)
+		})
+	})
+}
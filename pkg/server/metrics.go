@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// unmatchedRoute is a route label of requests that matched no route.
+// Raw paths are never used as labels to keep the number of series bounded
+const unmatchedRoute = "unmatched"
+
+// CreateMetricsMiddlewareFunc creates middleware that records count and duration
+// of requests labelled by route pattern, method and status
+func CreateMetricsMiddlewareFunc(registerer prometheus.Registerer) RouterMiddlewareFunc {
+	labels := []string{"route", "method", "status"}
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "The total number of served http requests.",
+	}, labels)
+	durations := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Duration of http requests.",
+		Buckets: prometheus.DefBuckets,
+	}, labels)
+	registerer.MustRegister(requests, durations)
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			wrappedWriter := loggingMiddlewareResponseWrapper{target: w}
+			req = req.WithContext(ContextWithRoutePattern(req.Context()))
+
+			// Requests are recorded even if downstream handlers panic. The middleware is
+			// installed after recovery middleware so panics are reported as 500 and rethrown
+			defer func() {
+				recovered := recover()
+				route := RoutePattern(req.Context())
+				if route == "" {
+					route = unmatchedRoute
+				}
+				status := wrappedWriter.status
+				if recovered != nil {
+					status = http.StatusInternalServerError
+				} else if status == 0 {
+					status = http.StatusOK
+				}
+				values := []string{route, req.Method, strconv.Itoa(status)}
+				requests.WithLabelValues(values...).Inc()
+				durations.WithLabelValues(values...).Observe(time.Since(start).Seconds())
+				if recovered != nil {
+					panic(recovered)
+				}
+			}()
+			next(&wrappedWriter, req)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	Convey("Given an app with metrics middleware", t, func() {
+		registry := prometheus.NewRegistry()
+		app := CreateHTTPApp(HTTPAppConfig{Env: "test"}).
+			Use(CreateMetricsMiddlewareFunc(registry)).
+			RegisterRoutes(func(r *Router) {
+				r.GET("/v1/resources/:resourceID", func(req *http.Request, h *HandlerToolkit) (*Response, error) {
+					return h.Response(JSON{"id": h.Params.ByName("resourceID")}), nil
+				})
+				r.GET("/v1/panic", func(req *http.Request, h *HandlerToolkit) (*Response, error) {
+					panic("handler failed")
+				})
+				r.Handler("GET", "/v1/plain", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					w.Write([]byte("plain"))
+				}))
+			})
+		handler := app.CreateHandler()
+		serve := func(method string, path string) {
+			req, _ := http.NewRequest(method, path, nil)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		requestsTotal := func(route string, method string, status string) float64 {
+			metrics, err := registry.Gather()
+			So(err, ShouldBeNil)
+			for _, family := range metrics {
+				if family.GetName() != "http_requests_total" {
+					continue
+				}
+				for _, metric := range family.GetMetric() {
+					labels := map[string]string{}
+					for _, label := range metric.GetLabel() {
+						labels[label.GetName()] = label.GetValue()
+					}
+					if labels["route"] == route && labels["method"] == method && labels["status"] == status {
+						return metric.GetCounter().GetValue()
+					}
+				}
+			}
+			return 0
+		}
+
+		Convey("It should label requests with route pattern", func() {
+			serve("GET", "/v1/resources/1")
+			serve("GET", "/v1/resources/2")
+			serve("HEAD", "/v1/resources/3")
+			serve("GET", "/v1/plain")
+			So(requestsTotal("/v1/resources/:resourceID", "GET", "200"), ShouldEqual, 2)
+			So(requestsTotal("/v1/resources/:resourceID", "HEAD", "200"), ShouldEqual, 1)
+			So(requestsTotal("/v1/plain", "GET", "200"), ShouldEqual, 1)
+		})
+
+		Convey("It should label requests that matched no route as unmatched", func() {
+			serve("GET", "/v1/unknown/1")
+			serve("GET", "/v1/unknown/2")
+			So(requestsTotal("unmatched", "GET", "404"), ShouldEqual, 2)
+		})
+
+		Convey("It should record requests that panicked as 500", func() {
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/v1/panic", nil)
+			handler.ServeHTTP(recorder, req)
+			So(recorder.Code, ShouldEqual, 500)
+			So(requestsTotal("/v1/panic", "GET", "500"), ShouldEqual, 1)
+		})
+
+		Convey("It should record request durations", func() {
+			serve("GET", "/v1/resources/1")
+			metrics, err := registry.Gather()
+			So(err, ShouldBeNil)
+			names := []string{}
+			for _, family := range metrics {
+				names = append(names, family.GetName())
+			}
+			So(names, ShouldContain, "http_request_duration_seconds")
+		})
+	})
+}
@@ -5,16 +5,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 
 	"github.com/google/jsonapi"
 	validator "gopkg.in/go-playground/validator.v9"
+	"ledger.api/pkg/auth"
 	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
 )
 
-const noRouteErrFmt = `{ "errors": [ { "status": "%v", "title": "%v" } ] }`
+const routingErrFmt = `{ "errors": [ { "status": "%v", "title": "%v" } ] }`
 
-var noRouteErrorBody = []byte(fmt.Sprintf(noRouteErrFmt, http.StatusNotFound, http.StatusText(http.StatusNotFound)))
+var noRouteErrorBody = []byte(fmt.Sprintf(routingErrFmt, http.StatusNotFound, http.StatusText(http.StatusNotFound)))
 
 // RequestParams provides unified access for request params
 type RequestParams interface {
@@ -26,9 +29,10 @@ type JSON map[string]interface{}
 
 // HandlerToolkit - Collection of various tools to help processing request and build a response
 type HandlerToolkit struct {
-	validate *validator.Validate
-	Logger   logging.Logger
-	Params   RequestParams
+	validate    *validator.Validate
+	scopePolicy *auth.ScopePolicy
+	Logger      logging.Logger
+	Params      RequestParams
 }
 
 // Response - Returns Response response object with status 200
@@ -65,12 +69,104 @@ type Routes func(router *Router)
 // HandlerFunc - generic route handler function
 type HandlerFunc func(req *http.Request, h *HandlerToolkit) (*Response, error)
 
+// HandlerMiddlewareFunc - route handler middleware that wraps a handler of a route
+type HandlerMiddlewareFunc func(next HandlerFunc) HandlerFunc
+
+// GroupOption - configures routes group
+type GroupOption func(group *Router)
+
+// WithScopes - routes of the group will require all given scopes
+func WithScopes(scopes ...string) GroupOption {
+	return WithScopeRequirement(auth.AllScopes(scopes...))
+}
+
+// WithAnyScope - routes of the group will require at least one of given scopes
+func WithAnyScope(scopes ...string) GroupOption {
+	return WithScopeRequirement(auth.AnyScope(scopes...))
+}
+
+// WithScopeRequirement - routes of the group will require scopes
+// in addition to scopes required by parent groups
+func WithScopeRequirement(requirement auth.ScopeRequirement) GroupOption {
+	return func(group *Router) {
+		group.scopeRequirement = group.scopeRequirement.And(requirement)
+		group.handlerMiddleware = append(group.handlerMiddleware, func(next HandlerFunc) HandlerFunc {
+			return RequireScopeRequirement(next, requirement)
+		})
+	}
+}
+
+// WithMiddleware - routes of the group will be wrapped with given middleware.
+// First middleware is the outermost one
+func WithMiddleware(middleware ...HandlerMiddlewareFunc) GroupOption {
+	return func(group *Router) {
+		group.handlerMiddleware = append(group.handlerMiddleware, middleware...)
+	}
+}
+
+// RouteInfo - describes a registered route
+type RouteInfo struct {
+	Method string
+	Path   string
+
+	// Scopes required by the route via groups it's registered with.
+	// Scopes any of which is required are joined with |
+	Scopes []string
+}
+
 // Router - http router structure
 type Router struct {
-	engine     HTTPEngine
-	logger     logging.Logger
-	validate   *validator.Validate
-	middleware list.List
+	engine      HTTPEngine
+	logger      logging.Logger
+	validate    *validator.Validate
+	scopePolicy *auth.ScopePolicy
+	middleware  list.List
+
+	// registered keeps track of registered "METHOD path" pairs
+	registered map[string]bool
+
+	// routes keeps all routes registered with the router and its groups
+	routes *[]RouteInfo
+
+	// getHandlers keeps GET handlers to serve HEAD requests for paths
+	// that have no explicit HEAD route. Body is not written for HEAD requests
+	getHandlers map[string]http.HandlerFunc
+
+	// prefix is prepended to paths of routes registered with this router
+	prefix string
+
+	// handlerMiddleware wraps handlers of routes registered with this router,
+	// outermost first
+	handlerMiddleware []HandlerMiddlewareFunc
+
+	// scopeRequirement are scopes required by routes registered with this router
+	scopeRequirement auth.ScopeRequirement
+}
+
+// Group - returns a sub-router that registers routes prefixed with a given prefix.
+// Routes of the group are wrapped with scopes and middleware of the parent
+// groups first and then with scopes and middleware provided via options
+// in order they're provided
+func (r *Router) Group(prefix string, opts ...GroupOption) *Router {
+	group := &Router{
+		engine:      r.engine,
+		logger:      r.logger,
+		validate:    r.validate,
+		scopePolicy: r.scopePolicy,
+		registered:  r.registered,
+		routes:      r.routes,
+		getHandlers: r.getHandlers,
+		prefix:      r.prefix + prefix,
+		handlerMiddleware: append(
+			make([]HandlerMiddlewareFunc, 0, len(r.handlerMiddleware)),
+			r.handlerMiddleware...,
+		),
+		scopeRequirement: r.scopeRequirement,
+	}
+	for _, opt := range opts {
+		opt(group)
+	}
+	return group
 }
 
 // GET - register get route
@@ -83,36 +179,118 @@ func (r *Router) POST(relativePath string, handler HandlerFunc) *Router {
 	return r.handle("POST", relativePath, handler)
 }
 
-func (r *Router) handle(method string, path string, handler HandlerFunc) *Router {
-	r.logger.Debugf("Registering route: %v %v", method, path)
-	r.engine.Handle(method, path, func(w http.ResponseWriter, req *http.Request) {
+// PUT - register put route
+func (r *Router) PUT(relativePath string, handler HandlerFunc) *Router {
+	return r.handle("PUT", relativePath, handler)
+}
+
+// PATCH - register patch route
+func (r *Router) PATCH(relativePath string, handler HandlerFunc) *Router {
+	return r.handle("PATCH", relativePath, handler)
+}
+
+// DELETE - register delete route
+func (r *Router) DELETE(relativePath string, handler HandlerFunc) *Router {
+	return r.handle("DELETE", relativePath, handler)
+}
+
+// HEAD - register head route. GET routes are served for HEAD requests automatically
+// so it's required only if HEAD has to be handled differently
+func (r *Router) HEAD(relativePath string, handler HandlerFunc) *Router {
+	return r.handle("HEAD", relativePath, handler)
+}
+
+// OPTIONS - register options route. OPTIONS requests (including CORS preflights)
+// are responded automatically with methods allowed for the path
+func (r *Router) OPTIONS(relativePath string, handler HandlerFunc) *Router {
+	return r.handle("OPTIONS", relativePath, handler)
+}
+
+// Handler - register a plain http handler, e.g to serve non JSON responses.
+// Group middleware and scopes are not applied to plain handlers
+func (r *Router) Handler(method string, relativePath string, handler http.Handler) *Router {
+	r.register(method, r.prefix+relativePath, nil, handler.ServeHTTP)
+	return r
+}
+
+func (r *Router) handle(method string, relativePath string, handler HandlerFunc) *Router {
+	path := r.prefix + relativePath
+	for i := len(r.handlerMiddleware) - 1; i >= 0; i-- {
+		handler = r.handlerMiddleware[i](handler)
+	}
+	engineHandler := func(w http.ResponseWriter, req *http.Request) {
 		params := req.Context().Value(requestParamsKey).(RequestParams)
 		toolkit := HandlerToolkit{
-			validate: r.validate,
-			Logger:   logging.FromContext(req.Context()),
-			Params:   params,
+			validate:    r.validate,
+			scopePolicy: r.scopePolicy,
+			Logger:      logging.FromContext(req.Context()),
+			Params:      params,
 		}
 		res, err := handler(req, &toolkit)
 		if err != nil {
 			toolkit.Logger.WithError(err).Error("Failed to process request")
 			respondWithError(w, err)
 		} else {
+			var buffer []byte
+			if req.Method != "HEAD" && res.status != http.StatusNoContent {
+				// Marshalling before headers are sent so failures can still be responded with 500
+				if buffer, err = json.Marshal(res.data); err != nil {
+					toolkit.Logger.WithError(err).Error("Failed to marshal json")
+					panic(err)
+				}
+			}
 			w.Header().Set("content-type", "application/json")
 			w.WriteHeader(res.status)
-			buffer, err := json.Marshal(res.data)
-			if err != nil {
-				toolkit.Logger.WithError(err).Error("Failed to marshal json")
-				panic(err)
+			if buffer == nil {
+				return
 			}
 			if _, err := w.Write(buffer); err != nil {
 				toolkit.Logger.WithError(err).Error("Failed write buffer")
 				panic(err)
 			}
 		}
-	})
+	}
+	r.register(method, path, r.scopeRequirement.Describe(), engineHandler)
 	return r
 }
 
+// register adds the handler to the engine and records the route
+func (r *Router) register(method string, path string, scopes []string, handler http.HandlerFunc) {
+	r.logger.Debugf("Registering route: %v %v", method, path)
+	engineHandler := func(w http.ResponseWriter, req *http.Request) {
+		if holder, ok := req.Context().Value(routePatternKey).(*routePatternHolder); ok {
+			holder.pattern = path
+			holder.params, _ = req.Context().Value(requestParamsKey).(RequestParams)
+		}
+		ctx, span := tracing.StartSpan(req.Context(), "handler "+method+" "+path)
+		defer span.End()
+		handler(w, req.WithContext(ctx))
+	}
+	r.engine.Handle(method, path, engineHandler)
+	r.registered[method+" "+path] = true
+	*r.routes = append(*r.routes, RouteInfo{
+		Method: method,
+		Path:   path,
+		Scopes: append(make([]string, 0, len(scopes)), scopes...),
+	})
+	if method == "GET" {
+		r.getHandlers[path] = engineHandler
+	}
+}
+
+// registerImplicitHeadRoutes registers HEAD routes for GET routes
+// that have no explicit HEAD route
+func (r *Router) registerImplicitHeadRoutes() {
+	for path, getHandler := range r.getHandlers {
+		if r.registered["HEAD "+path] {
+			continue
+		}
+		r.logger.Debugf("Registering implicit route: HEAD %v", path)
+		r.engine.Handle("HEAD", path, getHandler)
+		r.registered["HEAD "+path] = true
+	}
+}
+
 func respondWithErrorStatus(w http.ResponseWriter, status int) {
 	respondWithError(w, HTTPError{
 		Status: status,
@@ -145,18 +323,28 @@ func respondWithError(w http.ResponseWriter, err error) {
 type HTTPEngine interface {
 	Handle(method string, path string, handler http.HandlerFunc)
 	ServeHTTP(w http.ResponseWriter, req *http.Request)
+
+	// AllowedMethods returns methods routes are registered for a given path
+	AllowedMethods(path string) []string
 }
 
 // HTTPApp app structure to register routes and start listening
 type HTTPApp struct {
 	router *Router
 	logger logging.Logger
+	tracer *tracing.Tracer
 }
 
 // HTTPAppConfig - config structure for HTTPApp instance
 type HTTPAppConfig struct {
 	Env    string
 	Logger logging.Logger
+
+	// Tracer is optional. Requests are not traced if not provided
+	Tracer *tracing.Tracer
+
+	// ScopePolicy decides which scopes callers have. Default policy is used if not provided
+	ScopePolicy *auth.ScopePolicy
 }
 
 // RegisterRoutes - register app routes
@@ -170,6 +358,37 @@ func (app *HTTPApp) RegisterRoutes(routes Routes) *HTTPApp {
 // 	app.router.middleware(w, reqWithLogger)
 // }
 
+// AllowedMethods returns methods that have routes registered for a given path
+func (app *HTTPApp) AllowedMethods(path string) []string {
+	return app.router.engine.AllowedMethods(path)
+}
+
+// Routes returns routes registered so far ordered by path and method.
+// GET routes that have no explicit HEAD route are served for HEAD requests as well
+// so implicit HEAD routes are included
+func (app *HTTPApp) Routes() []RouteInfo {
+	explicitHeads := make(map[string]bool)
+	for _, route := range *app.router.routes {
+		if route.Method == "HEAD" {
+			explicitHeads[route.Path] = true
+		}
+	}
+	routes := make([]RouteInfo, 0, len(*app.router.routes))
+	for _, route := range *app.router.routes {
+		routes = append(routes, route)
+		if route.Method == "GET" && !explicitHeads[route.Path] {
+			routes = append(routes, RouteInfo{Method: "HEAD", Path: route.Path, Scopes: route.Scopes})
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	return routes
+}
+
 // Use - Insert another middleware into a call chain
 func (app *HTTPApp) Use(middleware RouterMiddlewareFunc) *HTTPApp {
 	app.router.middleware.PushBack(middleware)
@@ -180,8 +399,13 @@ func (app *HTTPApp) Use(middleware RouterMiddlewareFunc) *HTTPApp {
 func (app *HTTPApp) UseDefaultMiddleware() *HTTPApp {
 	app.
 		Use(CreateInitLoggerMiddlewareFunc(app.logger)).
-		Use(NewRequestIDMiddleware).
-		Use(NewLoggingMiddleware)
+		Use(NewRequestIDMiddleware)
+	if app.tracer != nil {
+		app.Use(CreateTracingMiddlewareFunc(app.tracer))
+	}
+	app.
+		Use(NewLoggingMiddleware).
+		Use(NewRecoveryMiddleware)
 	return app
 }
 
@@ -196,6 +420,7 @@ func (handler *httpHandler) ServeHTTP(w http.ResponseWriter, req *http.Request)
 // CreateHandler - creates http.Handler instance that can serve requests
 // defined by this app
 func (app *HTTPApp) CreateHandler() http.Handler {
+	app.router.registerImplicitHeadRoutes()
 	target := app.router.engine.ServeHTTP
 	for e := app.router.middleware.Back(); e != nil; e = e.Prev() {
 		target = e.Value.(RouterMiddlewareFunc)(target)
@@ -214,16 +439,25 @@ func CreateHTTPApp(cfg HTTPAppConfig) *HTTPApp {
 	logger.Debug("Initializing app router")
 
 	engine := createHTTPRouterEngine(logger)
+	scopePolicy := cfg.ScopePolicy
+	if scopePolicy == nil {
+		scopePolicy = auth.DefaultScopePolicy()
+	}
 
 	router := Router{
-		engine:   engine,
-		logger:   logger,
-		validate: validator.New(),
+		engine:      engine,
+		logger:      logger,
+		validate:    validator.New(),
+		scopePolicy: scopePolicy,
+		registered:  make(map[string]bool),
+		routes:      &[]RouteInfo{},
+		getHandlers: make(map[string]http.HandlerFunc),
 	}
 
 	httpApp := HTTPApp{
 		logger: logger,
 		router: &router,
+		tracer: cfg.Tracer,
 	}
 
 	return httpApp.UseDefaultMiddleware()
@@ -2,21 +2,24 @@ package server
 
 import (
 	"context"
-	"fmt"
 	"net/http"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"time"
 
 	auth0 "github.com/auth0-community/go-auth0"
 	"github.com/google/jsonapi"
 	uuid "github.com/satori/go.uuid"
 	"ledger.api/pkg/auth"
 	"ledger.api/pkg/logging"
+	"ledger.api/pkg/users"
 )
 
 type contextKeys string
 
 const requestIDKey contextKeys = "requestID"
+const routePatternKey contextKeys = "routePattern"
 
 // RouterMiddlewareFunc - Generic router middleware interface
 type RouterMiddlewareFunc func(next http.HandlerFunc) http.HandlerFunc
@@ -46,6 +49,39 @@ func RequestIDVAlue(ctx context.Context) string {
 	return ctx.Value(requestIDKey).(string)
 }
 
+// routePatternHolder is filled with a pattern and params of the route that matched the request
+type routePatternHolder struct {
+	pattern string
+	params  RequestParams
+}
+
+// ContextWithRoutePattern - create context that will hold a pattern of the matched route
+// (e.g /v2/ledgers/:ledgerID). The pattern is available via RoutePattern once the request is served
+func ContextWithRoutePattern(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(routePatternKey).(*routePatternHolder); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, routePatternKey, &routePatternHolder{})
+}
+
+// RoutePattern - returns a pattern of the route that served the request.
+// Empty if no route matched or context was not created with ContextWithRoutePattern
+func RoutePattern(ctx context.Context) string {
+	if holder, ok := ctx.Value(routePatternKey).(*routePatternHolder); ok {
+		return holder.pattern
+	}
+	return ""
+}
+
+// RouteParams - returns params of the route that served the request (e.g ledgerID).
+// Nil if no route matched or context was not created with ContextWithRoutePattern
+func RouteParams(ctx context.Context) RequestParams {
+	if holder, ok := ctx.Value(routePatternKey).(*routePatternHolder); ok {
+		return holder.params
+	}
+	return nil
+}
+
 type loggingMiddlewareResponseWrapper struct {
 	target http.ResponseWriter
 	status int
@@ -92,27 +128,84 @@ func NewLoggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		wrappedWriter := loggingMiddlewareResponseWrapper{
 			target: w,
 		}
-		// start := time.Now()
+		start := time.Now()
 		next(&wrappedWriter, req)
-		// end := time.Now()
-		// duration := end.Sub(start)
+		duration := time.Since(start)
 		logger.
 			// TODO: Optionally response headers
 			WithFields(logging.Fields{
 				"StatusCode": wrappedWriter.status,
-				// "Duration":   duration,
+				"Duration":   duration.String(),
 			}).
 			Infof("END REQ: %s %s", method, path)
 	}
 }
 
-// CreateCorsMiddlewareFunc - creates a middleware to handle CORS preflights
-func CreateCorsMiddlewareFunc() RouterMiddlewareFunc {
+type recoveryResponseWrapper struct {
+	target      http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rrw *recoveryResponseWrapper) Header() http.Header {
+	return rrw.target.Header()
+}
+
+func (rrw *recoveryResponseWrapper) Write(b []byte) (int, error) {
+	rrw.wroteHeader = true
+	return rrw.target.Write(b)
+}
+
+func (rrw *recoveryResponseWrapper) WriteHeader(status int) {
+	rrw.wroteHeader = true
+	rrw.target.WriteHeader(status)
+}
+
+// NewRecoveryMiddleware - recovers from panics of downstream handlers.
+// The panic is logged with a stack and responded with 500 unless headers have already been sent
+func NewRecoveryMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		wrappedWriter := recoveryResponseWrapper{target: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				// Aborting a response is an intentional panic that http server handles
+				panic(recovered)
+			}
+			logger := logging.FromContext(req.Context()).WithField("Stack", string(debug.Stack()))
+			if wrappedWriter.wroteHeader {
+				logger.Errorf("Recovered from panic after headers were sent: %v", recovered)
+				return
+			}
+			logger.Errorf("Recovered from panic: %v", recovered)
+			httpErr := InternalServerError()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(httpErr.Status)
+			if err := httpErr.MarshalErrors(w); err != nil {
+				logger.WithError(err).Error("Failed to write error response")
+			}
+		}()
+		next(&wrappedWriter, req)
+	}
+}
+
+// CreateCorsMiddlewareFunc - creates a middleware to handle CORS preflights.
+// Preflights are responded with methods of routes registered for the path
+// and with 404 if there are no routes for the path
+func CreateCorsMiddlewareFunc(allowedMethods func(path string) []string) RouterMiddlewareFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, req *http.Request) {
 			w.Header().Add("Access-Control-Allow-Origin", "*")
 			w.Header().Add("Access-Control-Allow-Headers", "X-Request-ID,Authorization")
-			if req.Method == "OPTIONS" {
+			if req.Method == "OPTIONS" && req.Header.Get("Access-Control-Request-Method") != "" {
+				allowed := allowedMethods(req.URL.Path)
+				if len(allowed) == 0 {
+					respondWithErrorStatus(w, http.StatusNotFound)
+					return
+				}
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
 				w.WriteHeader(200)
 			} else {
 				next(w, req)
@@ -176,45 +269,70 @@ func CreateAuthMiddlewareFunc(params AuthMiddlewareParams) RouterMiddlewareFunc
 	}
 }
 
+// CreateUserMiddlewareFunc returns middleware func that will resolve a user
+// identified by the subject claim and set it to the request context.
+// Should be used after the auth middleware
+func CreateUserMiddlewareFunc(svc users.QueryService) RouterMiddlewareFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			logger := logging.FromContext(req.Context())
+			claims := auth.ClaimsFromContext(req.Context())
+			if claims == nil || claims.Claims == nil || claims.Subject == "" {
+				next(w, req)
+				return
+			}
+
+			user, err := svc.GetUserBySubject(req.Context(), claims.Subject)
+			if err == users.ErrUserNotFound {
+				logger.Infof("No user mapped to subject %v", claims.Subject)
+				next(w, req)
+				return
+			}
+			if err != nil {
+				logger.WithError(err).Error("Failed to resolve user")
+				respondWithErrorStatus(w, http.StatusInternalServerError)
+				return
+			}
+
+			nextContext := users.ContextWithUser(req.Context(), user)
+			next(w, req.WithContext(nextContext))
+		}
+	}
+}
+
 // RequireScopes action handler middleware wrapper that will
 // verify if scope claim of a token includes scopes provided
 func RequireScopes(handler HandlerFunc, scopes ...string) HandlerFunc {
+	return RequireScopeRequirement(handler, auth.AllScopes(scopes...))
+}
+
+// RequireScopeRequirement action handler middleware wrapper that will
+// verify if scopes granted by the token satisfy the requirement. Scopes
+// are granted according to the scope policy of the app. Missing scopes are
+// reported in meta of the 403 error
+func RequireScopeRequirement(handler HandlerFunc, requirement auth.ScopeRequirement) HandlerFunc {
 	return HandlerFunc(func(req *http.Request, h *HandlerToolkit) (*Response, error) {
 		claims := auth.ClaimsFromContext(req.Context())
 		if claims == nil {
 			h.Logger.Info("Request has not been initialized with claims, responding with 404")
-			return nil, HTTPError{
-				Status: http.StatusNotFound,
-				Errors: []*jsonapi.ErrorObject{
-					{
-						Status: strconv.Itoa(http.StatusNotFound),
-						Title:  http.StatusText(http.StatusNotFound),
-					},
-				},
-			}
+			return nil, *NotFoundError()
 		}
 
-		authorizedScopes := make(map[string]bool)
-		for _, authorizedScope := range strings.Split(claims.Scope, " ") {
-			authorizedScopes[authorizedScope] = true
+		policy := h.scopePolicy
+		if policy == nil {
+			policy = auth.DefaultScopePolicy()
 		}
-
-		var missingScopes []string
-		for _, requiredScope := range scopes {
-			if !authorizedScopes[requiredScope] {
-				missingScopes = append(missingScopes, requiredScope)
-			}
-		}
-
-		if len(missingScopes) > 0 {
-			h.Logger.Info("Failed to authorize request. Missing scopes: %v", missingScopes)
+		missing := policy.Authorize(claims.Scopes(), requirement)
+		if missing != nil {
+			h.Logger.Infof("Failed to authorize request. Missing scopes: %v", missing)
 			return nil, HTTPError{
 				Status: http.StatusForbidden,
 				Errors: []*jsonapi.ErrorObject{
 					{
 						Status: strconv.Itoa(http.StatusForbidden),
 						Title:  http.StatusText(http.StatusForbidden),
-						Detail: fmt.Sprintf("Missing scopes: %v", missingScopes),
+						Detail: "Token is missing required scopes",
+						Meta:   &map[string]interface{}{"missingScopes": missing},
 					},
 				},
 			}
@@ -223,3 +341,41 @@ func RequireScopes(handler HandlerFunc, scopes ...string) HandlerFunc {
 		return handler(req, h)
 	})
 }
+
+// LedgerAccessChecker verifies if a user is a member of a given ledger
+type LedgerAccessChecker interface {
+	HasLedgerAccess(ctx context.Context, user *users.User, ledgerID string) (bool, error)
+}
+
+// RequireLedgerAccess action handler middleware wrapper that will
+// verify if a user from the context has access to a ledger identified
+// by the ledgerID param. Responds with 404 if the ledger is not accessible
+func RequireLedgerAccess(handler HandlerFunc, checker LedgerAccessChecker) HandlerFunc {
+	return HandlerFunc(func(req *http.Request, h *HandlerToolkit) (*Response, error) {
+		user := users.FromContext(req.Context())
+		if user == nil {
+			h.Logger.Info("Request has not been initialized with user, responding with 404")
+			return nil, *NotFoundError()
+		}
+
+		ledgerID := h.Params.ByName("ledgerID")
+		hasAccess, err := checker.HasLedgerAccess(req.Context(), user, ledgerID)
+		if err != nil {
+			return nil, err
+		}
+		if !hasAccess {
+			h.Logger.Infof("User %v has no access to ledger %v, responding with 404", user.ID, ledgerID)
+			return nil, *NotFoundError()
+		}
+
+		return handler(req, h)
+	})
+}
+
+// CreateLedgerAccessMiddlewareFunc returns handler middleware func that will
+// verify ledger access the same way RequireLedgerAccess does. Intended to be used with route groups
+func CreateLedgerAccessMiddlewareFunc(checker LedgerAccessChecker) HandlerMiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return RequireLedgerAccess(next, checker)
+	}
+}
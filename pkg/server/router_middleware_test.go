@@ -1,9 +1,12 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -13,11 +16,13 @@ import (
 
 	"github.com/google/jsonapi"
 	"github.com/icrowley/fake"
+	"github.com/julienschmidt/httprouter"
 	. "github.com/smartystreets/goconvey/convey"
 	jose "gopkg.in/square/go-jose.v2"
 	"gopkg.in/square/go-jose.v2/jwt"
 	"ledger.api/pkg/auth"
 	"ledger.api/pkg/logging"
+	"ledger.api/pkg/users"
 )
 
 func TestRouteMiddleware(t *testing.T) {
@@ -173,6 +178,98 @@ func TestNewRequestIDMiddleware(t *testing.T) {
 	})
 }
 
+func TestCorsMiddleware(t *testing.T) {
+	Convey("Given CorsMiddleware", t, func() {
+		recorder := httptest.NewRecorder()
+		allowedMethods := func(path string) []string {
+			if path == "/v1/some-resource" {
+				return []string{"GET", "HEAD", "POST", "OPTIONS"}
+			}
+			return []string{}
+		}
+		middleware := CreateCorsMiddlewareFunc(allowedMethods)
+		nextCalled := false
+		next := func(w http.ResponseWriter, req *http.Request) {
+			nextCalled = true
+		}
+
+		Convey("When request is a preflight", func() {
+			Convey("It should respond with methods allowed for the path", func() {
+				req, _ := http.NewRequest("OPTIONS", "/v1/some-resource", nil)
+				req.Header.Set("Access-Control-Request-Method", "POST")
+				middleware(next)(recorder, req)
+				So(nextCalled, ShouldBeFalse)
+				So(recorder.Code, ShouldEqual, 200)
+				So(recorder.Header().Get("Access-Control-Allow-Methods"), ShouldEqual, "GET, HEAD, POST, OPTIONS")
+				So(recorder.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "*")
+			})
+
+			Convey("It should respond with 404 if path has no routes", func() {
+				req, _ := http.NewRequest("OPTIONS", "/v1/unknown-resource", nil)
+				req.Header.Set("Access-Control-Request-Method", "POST")
+				middleware(next)(recorder, req)
+				So(nextCalled, ShouldBeFalse)
+				So(recorder.Code, ShouldEqual, 404)
+			})
+		})
+
+		Convey("When request is not a preflight", func() {
+			Convey("It should add CORS headers and call next", func() {
+				req, _ := http.NewRequest("GET", "/v1/some-resource", nil)
+				middleware(next)(recorder, req)
+				So(nextCalled, ShouldBeTrue)
+				So(recorder.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "*")
+				So(recorder.Header().Get("Access-Control-Allow-Headers"), ShouldEqual, "X-Request-ID,Authorization")
+			})
+		})
+	})
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	Convey("Given RecoveryMiddleware", t, func() {
+		recorder := httptest.NewRecorder()
+		ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+		req, _ := http.NewRequest("GET", "/v1/some-resource", nil)
+		req = req.WithContext(ctx)
+
+		Convey("It should respond with 500 if next panics", func() {
+			NewRecoveryMiddleware(func(w http.ResponseWriter, req *http.Request) {
+				panic("boom")
+			})(recorder, req)
+			So(recorder.Code, ShouldEqual, 500)
+			So(recorder.Header().Get("Content-Type"), ShouldEqual, "application/json")
+			expected := bytes.Buffer{}
+			InternalServerError().MarshalErrors(&expected)
+			So(recorder.Body.String(), ShouldEqual, expected.String())
+		})
+
+		Convey("It should keep the response if headers have already been sent", func() {
+			NewRecoveryMiddleware(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(200)
+				w.Write([]byte("partial"))
+				panic("boom")
+			})(recorder, req)
+			So(recorder.Code, ShouldEqual, 200)
+			So(recorder.Body.String(), ShouldEqual, "partial")
+		})
+
+		Convey("It should not interfere if next does not panic", func() {
+			NewRecoveryMiddleware(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(201)
+			})(recorder, req)
+			So(recorder.Code, ShouldEqual, 201)
+		})
+
+		Convey("It should propagate http.ErrAbortHandler", func() {
+			So(func() {
+				NewRecoveryMiddleware(func(w http.ResponseWriter, req *http.Request) {
+					panic(http.ErrAbortHandler)
+				})(recorder, req)
+			}, ShouldPanicWith, http.ErrAbortHandler)
+		})
+	})
+}
+
 type jwtTokenSetup struct {
 	pwd      string
 	iss      string
@@ -381,10 +478,37 @@ func TestRequireScopes(t *testing.T) {
 						{
 							Status: strconv.Itoa(http.StatusForbidden),
 							Title:  http.StatusText(http.StatusForbidden),
-							Detail: fmt.Sprintf("Missing scopes: [%v %v %v]", missingScope1, missingScope2, missingScope3),
+							Detail: "Token is missing required scopes",
+							Meta: &map[string]interface{}{
+								"missingScopes": &auth.MissingScopes{
+									AllOf: []string{missingScope1, missingScope2, missingScope3},
+								},
+							},
 						},
 					})
 				})
+
+				Convey("It should report any of groups none of scopes of which are present", func() {
+					mw := RequireScopeRequirement(next, auth.AnyScope("missing:first", "missing:second").
+						And(auth.AnyScope(strings.Split(tokenSetup.claims.Scope, " ")[0], "missing:third")))
+					_, err := mw(req, &toolkit)
+					httpErr := err.(HTTPError)
+					So(httpErr.Status, ShouldEqual, http.StatusForbidden)
+					So((*httpErr.Errors[0].Meta)["missingScopes"], ShouldResemble, &auth.MissingScopes{
+						AnyOf: [][]string{{"missing:first", "missing:second"}},
+					})
+				})
+
+				Convey("It should grant scopes implied by the policy", func() {
+					policy, err := auth.CreateScopePolicy(auth.ScopePolicyConfig{
+						Implications: map[string][]string{strings.Split(tokenSetup.claims.Scope, " ")[0]: {"implied:scope"}},
+					})
+					So(err, ShouldBeNil)
+					toolkit.scopePolicy = policy
+					res, err := RequireScopes(next, "implied:scope")(req, &toolkit)
+					So(err, ShouldBeNil)
+					So(res.data, ShouldEqual, nextRes)
+				})
 			})
 
 			Convey("It should respond with 404 if no claims found with the context", func() {
@@ -403,3 +527,158 @@ func TestRequireScopes(t *testing.T) {
 		})
 	})
 }
+
+type mockUsersQueryService struct {
+	usersBySubject map[string]*users.User
+	err            error
+}
+
+func (svc *mockUsersQueryService) GetUserBySubject(ctx context.Context, subject string) (*users.User, error) {
+	if svc.err != nil {
+		return nil, svc.err
+	}
+	user, ok := svc.usersBySubject[subject]
+	if !ok {
+		return nil, users.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func TestUserMiddleware(t *testing.T) {
+	Convey("Given UserMiddleware", t, func() {
+		subject := fmt.Sprintf("auth0|%v", fake.Characters())
+		user := &users.User{ID: rand.Int(), Subject: subject}
+		svc := &mockUsersQueryService{usersBySubject: map[string]*users.User{subject: user}}
+		initLogger := CreateInitLoggerMiddlewareFunc(logging.NewTestLogger())
+		userMw := CreateUserMiddlewareFunc(svc)
+		middlewareFunc := func(next http.HandlerFunc) http.HandlerFunc {
+			return initLogger(userMw(next))
+		}
+		req, err := http.NewRequest("GET", "/v1/something", nil)
+		if err != nil {
+			panic(err)
+		}
+		withSubject := func(req *http.Request, subject string) *http.Request {
+			return req.WithContext(auth.ContextWithClaims(req.Context(), &auth.LedgerClaims{
+				Claims: &jwt.Claims{Subject: subject},
+			}))
+		}
+
+		Convey("When subject is mapped to a user", func() {
+			Convey("It should set the user to context", func() {
+				recorder := httptest.NewRecorder()
+				var actualUser *users.User
+				middlewareFunc(func(w http.ResponseWriter, req *http.Request) {
+					actualUser = users.FromContext(req.Context())
+				})(recorder, withSubject(req, subject))
+				So(actualUser, ShouldEqual, user)
+			})
+		})
+
+		Convey("When subject is not mapped to a user", func() {
+			Convey("It should call next without user", func() {
+				recorder := httptest.NewRecorder()
+				nextCalled := false
+				middlewareFunc(func(w http.ResponseWriter, req *http.Request) {
+					So(users.FromContext(req.Context()), ShouldBeNil)
+					nextCalled = true
+				})(recorder, withSubject(req, fake.Characters()))
+				So(nextCalled, ShouldBeTrue)
+			})
+		})
+
+		Convey("When request has no claims", func() {
+			Convey("It should call next without user", func() {
+				recorder := httptest.NewRecorder()
+				nextCalled := false
+				middlewareFunc(func(w http.ResponseWriter, req *http.Request) {
+					So(users.FromContext(req.Context()), ShouldBeNil)
+					nextCalled = true
+				})(recorder, req)
+				So(nextCalled, ShouldBeTrue)
+			})
+		})
+
+		Convey("When user lookup fails", func() {
+			Convey("It should respond with 500", func() {
+				svc.err = errors.New(fake.Sentence())
+				recorder := httptest.NewRecorder()
+				nextCalled := false
+				middlewareFunc(func(w http.ResponseWriter, req *http.Request) {
+					nextCalled = true
+				})(recorder, withSubject(req, subject))
+				So(nextCalled, ShouldBeFalse)
+				So(recorder.Code, ShouldEqual, 500)
+			})
+		})
+	})
+}
+
+type mockLedgerAccessChecker struct {
+	accessibleLedgers map[string]bool
+	err               error
+}
+
+func (checker *mockLedgerAccessChecker) HasLedgerAccess(ctx context.Context, user *users.User, ledgerID string) (bool, error) {
+	if checker.err != nil {
+		return false, checker.err
+	}
+	return checker.accessibleLedgers[ledgerID], nil
+}
+
+func TestRequireLedgerAccess(t *testing.T) {
+	Convey("Given RequireLedgerAccess handler middleware", t, func() {
+		req, err := http.NewRequest("GET", "/v1/something", nil)
+		if err != nil {
+			panic(err)
+		}
+		ledgerID := fake.Characters()
+		toolkit := HandlerToolkit{
+			Logger: logging.NewTestLogger(),
+			Params: httprouter.Params{{Key: "ledgerID", Value: ledgerID}},
+		}
+
+		nextCalled := false
+		nextRes := JSON{"fake": fake.Characters()}
+		next := func(handlerReq *http.Request, h *HandlerToolkit) (*Response, error) {
+			nextCalled = true
+			return h.Response(nextRes), nil
+		}
+		checker := &mockLedgerAccessChecker{accessibleLedgers: map[string]bool{ledgerID: true}}
+		mw := RequireLedgerAccess(next, checker)
+
+		Convey("When request context has user", func() {
+			req = req.WithContext(users.ContextWithUser(req.Context(), &users.User{ID: rand.Int()}))
+
+			Convey("It should call next if ledger is accessible", func() {
+				res, err := mw(req, &toolkit)
+				So(err, ShouldBeNil)
+				So(nextCalled, ShouldBeTrue)
+				So(res.data, ShouldEqual, nextRes)
+			})
+
+			Convey("It should respond with 404 if ledger is not accessible", func() {
+				toolkit.Params = httprouter.Params{{Key: "ledgerID", Value: fake.Characters()}}
+				res, err := mw(req, &toolkit)
+				So(res, ShouldBeNil)
+				So(nextCalled, ShouldBeFalse)
+				So(err, ShouldResemble, *NotFoundError())
+			})
+
+			Convey("It should return error if check fails", func() {
+				checker.err = errors.New(fake.Sentence())
+				res, err := mw(req, &toolkit)
+				So(res, ShouldBeNil)
+				So(nextCalled, ShouldBeFalse)
+				So(err, ShouldEqual, checker.err)
+			})
+		})
+
+		Convey("It should respond with 404 if no user found with the context", func() {
+			res, err := mw(req, &toolkit)
+			So(res, ShouldBeNil)
+			So(nextCalled, ShouldBeFalse)
+			So(err, ShouldResemble, *NotFoundError())
+		})
+	})
+}
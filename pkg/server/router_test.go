@@ -1,6 +1,7 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,6 +14,8 @@ import (
 	"github.com/google/jsonapi"
 	"github.com/icrowley/fake"
 	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"ledger.api/pkg/auth"
 )
 
 func TestRoute(t *testing.T) {
@@ -42,6 +45,21 @@ func TestRoute(t *testing.T) {
 				So(recorder.Header().Get("content-type"), ShouldEqual, "application/json")
 			})
 
+			Convey("It should respond with 500 if result can not be marshalled", func() {
+				router.RegisterRoutes(func(r *Router) {
+					r.GET("/v1/bad-dto", func(req *http.Request, h *HandlerToolkit) (*Response, error) {
+						return h.Response(JSON{"fn": func() {}}), nil
+					})
+				})
+				req, _ := http.NewRequest("GET", "/v1/bad-dto", nil)
+				router.CreateHandler().ServeHTTP(recorder, req)
+
+				So(recorder.Code, ShouldEqual, 500)
+				expectedBody := bytes.Buffer{}
+				InternalServerError().MarshalErrors(&expectedBody)
+				So(recorder.Body.String(), ShouldEqual, expectedBody.String())
+			})
+
 			Convey("It set custom status code", func() {
 				req, _ := http.NewRequest("GET", "/v1/some-resource/503", nil)
 				handler.ServeHTTP(recorder, req)
@@ -52,6 +70,259 @@ func TestRoute(t *testing.T) {
 			})
 		})
 
+		Convey("When registering routes for various methods", func() {
+			router.RegisterRoutes(func(r *Router) {
+				handler := func(req *http.Request, h *HandlerToolkit) (*Response, error) {
+					return h.Response(JSON{"method": req.Method}), nil
+				}
+				r.POST("/v1/some-resource", handler)
+				r.PUT("/v1/some-resource", handler)
+				r.PATCH("/v1/some-resource", handler)
+				r.DELETE("/v1/some-resource", handler)
+			})
+			handler := router.CreateHandler()
+
+			Convey("It should route requests by method", func() {
+				for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+					recorder := httptest.NewRecorder()
+					req, _ := http.NewRequest(method, "/v1/some-resource", nil)
+					handler.ServeHTTP(recorder, req)
+
+					So(recorder.Code, ShouldEqual, 200)
+					expectedMessage, _ := json.Marshal(JSON{"method": method})
+					So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+				}
+			})
+		})
+
+		Convey("When method is not registered for a path", func() {
+			router.RegisterRoutes(func(r *Router) {
+				handler := func(req *http.Request, h *HandlerToolkit) (*Response, error) {
+					return h.Response(JSON{"method": req.Method}), nil
+				}
+				r.GET("/v1/some-resource", handler)
+				r.POST("/v1/some-resource", handler)
+			})
+			req, _ := http.NewRequest("DELETE", "/v1/some-resource", nil)
+			router.CreateHandler().ServeHTTP(recorder, req)
+
+			Convey("It should respond with 405 status", func() {
+				So(recorder.Code, ShouldEqual, 405)
+			})
+
+			Convey("It should set Allow header with registered methods", func() {
+				So(recorder.Header().Get("Allow"), ShouldEqual, "GET, HEAD, POST, OPTIONS")
+			})
+
+			Convey("It should respond with consistent error body", func() {
+				expectedMessage := map[string]interface{}{
+					"errors": []interface{}{
+						map[string]interface{}{
+							"status": strconv.Itoa(http.StatusMethodNotAllowed),
+							"title":  http.StatusText(http.StatusMethodNotAllowed),
+						},
+					},
+				}
+				var actualMessage map[string]interface{}
+				if err := json.Unmarshal(recorder.Body.Bytes(), &actualMessage); err != nil {
+					panic(err)
+				}
+				So(actualMessage, ShouldResemble, expectedMessage)
+			})
+		})
+
+		Convey("When HEAD request is sent to GET route", func() {
+			router.RegisterRoutes(func(r *Router) {
+				r.GET("/v1/some-resource", func(req *http.Request, h *HandlerToolkit) (*Response, error) {
+					return h.Response(JSON{"fake": "string"}).Status(201), nil
+				})
+				r.GET("/v1/other-resource", func(req *http.Request, h *HandlerToolkit) (*Response, error) {
+					return h.Response(JSON{"fake": "string"}), nil
+				})
+				r.HEAD("/v1/other-resource", func(req *http.Request, h *HandlerToolkit) (*Response, error) {
+					return h.Response(nil).Status(204), nil
+				})
+			})
+			handler := router.CreateHandler()
+
+			Convey("It should serve it with GET handler without body", func() {
+				req, _ := http.NewRequest("HEAD", "/v1/some-resource", nil)
+				handler.ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 201)
+				So(recorder.Header().Get("content-type"), ShouldEqual, "application/json")
+				So(recorder.Body.Len(), ShouldEqual, 0)
+			})
+
+			Convey("It should use explicit HEAD route if registered", func() {
+				req, _ := http.NewRequest("HEAD", "/v1/other-resource", nil)
+				handler.ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 204)
+			})
+		})
+
+		Convey("When OPTIONS request is sent", func() {
+			router.RegisterRoutes(func(r *Router) {
+				handler := func(req *http.Request, h *HandlerToolkit) (*Response, error) {
+					return h.Response(JSON{"method": req.Method}), nil
+				}
+				r.GET("/v1/some-resource/:id", handler)
+				r.PUT("/v1/some-resource/:id", handler)
+				r.OPTIONS("/v1/custom-options", handler)
+			})
+			handler := router.CreateHandler()
+
+			Convey("It should respond with methods registered for the path", func() {
+				req, _ := http.NewRequest("OPTIONS", "/v1/some-resource/10", nil)
+				handler.ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 200)
+				So(recorder.Header().Get("Allow"), ShouldEqual, "GET, HEAD, PUT, OPTIONS")
+			})
+
+			Convey("It should respond with 404 for unknown path", func() {
+				req, _ := http.NewRequest("OPTIONS", "/v1/unknown-resource", nil)
+				handler.ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 404)
+			})
+
+			Convey("It should use explicit OPTIONS route if registered", func() {
+				req, _ := http.NewRequest("OPTIONS", "/v1/custom-options", nil)
+				handler.ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 200)
+				expectedMessage, _ := json.Marshal(JSON{"method": "OPTIONS"})
+				So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+			})
+		})
+
+		Convey("When registering routes within groups", func() {
+			var calls []string
+			tracingMiddleware := func(name string) HandlerMiddlewareFunc {
+				return func(next HandlerFunc) HandlerFunc {
+					return func(req *http.Request, h *HandlerToolkit) (*Response, error) {
+						calls = append(calls, name)
+						return next(req, h)
+					}
+				}
+			}
+			router.RegisterRoutes(func(r *Router) {
+				handler := func(req *http.Request, h *HandlerToolkit) (*Response, error) {
+					calls = append(calls, "handler")
+					return h.Response(JSON{"param1": h.Params.ByName("param1")}), nil
+				}
+				v1 := r.Group("/v1", WithMiddleware(tracingMiddleware("v1")))
+				v1.GET("/some-resource", handler)
+				resources := v1.Group(
+					"/resources/:param1",
+					WithMiddleware(tracingMiddleware("resources-1"), tracingMiddleware("resources-2")),
+				)
+				resources.GET("", handler)
+				resources.PUT("/sub-resource", handler)
+				protected := v1.Group("/protected", WithScopes("read:protected"))
+				protected.GET("/resource", handler)
+				protected.Group("/any", WithAnyScope("read:first", "read:second")).GET("", handler)
+			})
+			handler := router.CreateHandler()
+
+			Convey("It should register routes with group prefix", func() {
+				req, _ := http.NewRequest("GET", "/v1/some-resource", nil)
+				handler.ServeHTTP(recorder, req)
+
+				So(recorder.Code, ShouldEqual, 200)
+				So(calls, ShouldResemble, []string{"v1", "handler"})
+			})
+
+			Convey("It should combine prefixes and middleware of nested groups", func() {
+				param1 := fake.Word()
+				req, _ := http.NewRequest("PUT", fmt.Sprintf("/v1/resources/%v/sub-resource", param1), nil)
+				handler.ServeHTTP(recorder, req)
+
+				So(recorder.Code, ShouldEqual, 200)
+				expectedMessage, _ := json.Marshal(JSON{"param1": param1})
+				So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+				So(calls, ShouldResemble, []string{"v1", "resources-1", "resources-2", "handler"})
+			})
+
+			Convey("It should register group root path", func() {
+				req, _ := http.NewRequest("GET", "/v1/resources/"+fake.Word(), nil)
+				handler.ServeHTTP(recorder, req)
+
+				So(recorder.Code, ShouldEqual, 200)
+				So(calls, ShouldResemble, []string{"v1", "resources-1", "resources-2", "handler"})
+			})
+
+			Convey("It should not apply group middleware to parent routes", func() {
+				So(router.AllowedMethods("/v1/resources/"+fake.Word()), ShouldResemble, []string{"GET", "HEAD", "OPTIONS"})
+				req, _ := http.NewRequest("GET", "/v1/some-resource", nil)
+				handler.ServeHTTP(recorder, req)
+				So(calls, ShouldResemble, []string{"v1", "handler"})
+			})
+
+			Convey("It should require group scopes", func() {
+				req, _ := http.NewRequest("GET", "/v1/protected/resource", nil)
+				req = req.WithContext(auth.ContextWithClaims(req.Context(), &auth.LedgerClaims{
+					Claims: &jwt.Claims{},
+					Scope:  "read:other",
+				}))
+				handler.ServeHTTP(recorder, req)
+
+				So(recorder.Code, ShouldEqual, 403)
+				So(calls, ShouldResemble, []string{"v1"})
+			})
+
+			Convey("It should invoke handler if group scopes are granted", func() {
+				req, _ := http.NewRequest("GET", "/v1/protected/resource", nil)
+				req = req.WithContext(auth.ContextWithClaims(req.Context(), &auth.LedgerClaims{
+					Claims: &jwt.Claims{},
+					Scope:  "read:other read:protected",
+				}))
+				handler.ServeHTTP(recorder, req)
+
+				So(recorder.Code, ShouldEqual, 200)
+				So(calls, ShouldResemble, []string{"v1", "handler"})
+			})
+
+			Convey("It should grant scopes matching wildcards", func() {
+				req, _ := http.NewRequest("GET", "/v1/protected/resource", nil)
+				req = req.WithContext(auth.ContextWithClaims(req.Context(), &auth.LedgerClaims{
+					Claims: &jwt.Claims{},
+					Scope:  "read:*",
+				}))
+				handler.ServeHTTP(recorder, req)
+
+				So(recorder.Code, ShouldEqual, 200)
+			})
+
+			Convey("It should require any scope of nested group along with parent scopes", func() {
+				serve := func(scope string) int {
+					recorder := httptest.NewRecorder()
+					req, _ := http.NewRequest("GET", "/v1/protected/any", nil)
+					req = req.WithContext(auth.ContextWithClaims(req.Context(), &auth.LedgerClaims{
+						Claims: &jwt.Claims{},
+						Scope:  scope,
+					}))
+					handler.ServeHTTP(recorder, req)
+					return recorder.Code
+				}
+				So(serve("read:protected read:second"), ShouldEqual, 200)
+				So(serve("read:*"), ShouldEqual, 200)
+				So(serve("read:protected"), ShouldEqual, 403)
+				So(serve("read:second"), ShouldEqual, 403)
+			})
+
+			Convey("It should list registered routes with their scopes", func() {
+				So(router.Routes(), ShouldResemble, []RouteInfo{
+					RouteInfo{Method: "GET", Path: "/v1/protected/any", Scopes: []string{"read:protected", "read:first|read:second"}},
+					RouteInfo{Method: "HEAD", Path: "/v1/protected/any", Scopes: []string{"read:protected", "read:first|read:second"}},
+					RouteInfo{Method: "GET", Path: "/v1/protected/resource", Scopes: []string{"read:protected"}},
+					RouteInfo{Method: "HEAD", Path: "/v1/protected/resource", Scopes: []string{"read:protected"}},
+					RouteInfo{Method: "GET", Path: "/v1/resources/:param1", Scopes: []string{}},
+					RouteInfo{Method: "HEAD", Path: "/v1/resources/:param1", Scopes: []string{}},
+					RouteInfo{Method: "PUT", Path: "/v1/resources/:param1/sub-resource", Scopes: []string{}},
+					RouteInfo{Method: "GET", Path: "/v1/some-resource", Scopes: []string{}},
+					RouteInfo{Method: "HEAD", Path: "/v1/some-resource", Scopes: []string{}},
+				})
+			})
+		})
+
 		Convey("When registering routes with params", func() {
 			router.RegisterRoutes(func(r *Router) {
 				r.GET("/v1/:param1/some-resource/:param2", func(req *http.Request, h *HandlerToolkit) (*Response, error) {
@@ -139,7 +410,7 @@ func TestRoute(t *testing.T) {
 
 			Convey("Given http error", func() {
 				httpErr := HTTPError{
-					Status: rand.Intn(600),
+					Status: 400 + rand.Intn(200),
 					Errors: []*jsonapi.ErrorObject{
 						{
 							Status: strconv.Itoa(rand.Intn(500)),
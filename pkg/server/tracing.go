@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
+)
+
+// CreateTracingMiddlewareFunc creates middleware that starts a server span of the request.
+// The span continues a trace of W3C traceparent header if provided and valid.
+// Trace and span ids are added to the logger fields
+func CreateTracingMiddlewareFunc(tracer *tracing.Tracer) RouterMiddlewareFunc {
+	propagator := propagation.TraceContext{}
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+			logger := logging.FromContext(ctx)
+			if traceparent := req.Header.Get("traceparent"); traceparent != "" {
+				ctx = propagator.Extract(ctx, propagation.HeaderCarrier(req.Header))
+				if !trace.SpanContextFromContext(ctx).IsValid() {
+					logger.WithField("traceparent", traceparent).Warn("Ignoring malformed traceparent header")
+				}
+			}
+			ctx, span := tracer.StartSpan(ctx, "HTTP "+req.Method, trace.WithSpanKind(trace.SpanKindServer))
+			defer span.End()
+			spanContext := span.SpanContext()
+			ctx = logging.CreateContext(ctx, logger.WithFields(logging.Fields{
+				"TraceID": spanContext.TraceID().String(),
+				"SpanID":  spanContext.SpanID().String(),
+			}))
+			ctx = ContextWithRoutePattern(ctx)
+			span.SetAttributes(
+				attribute.String("http.method", req.Method),
+				attribute.String("http.target", req.URL.Path),
+			)
+			if requestID, ok := ctx.Value(requestIDKey).(string); ok {
+				span.SetAttributes(attribute.String("request.id", requestID))
+			}
+
+			wrappedWriter := loggingMiddlewareResponseWrapper{target: w}
+			next(&wrappedWriter, req.WithContext(ctx))
+
+			if route := RoutePattern(ctx); route != "" {
+				span.SetName(req.Method + " " + route)
+				span.SetAttributes(attribute.String("http.route", route))
+			}
+			status := wrappedWriter.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttributes(attribute.Int("http.status_code", status))
+			if status >= 500 {
+				tracing.SetError(span, errorStatus(status))
+			}
+		}
+	}
+}
+
+// errorStatus - an error of a span that ended with 5xx status
+type errorStatus int
+
+func (status errorStatus) Error() string {
+	return strconv.Itoa(int(status)) + " " + http.StatusText(int(status))
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"ledger.api/pkg/tracing"
+)
+
+// spanAttributes returns attributes of the span as a map
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	result := make(map[attribute.Key]attribute.Value)
+	for _, attr := range span.Attributes {
+		result[attr.Key] = attr.Value
+	}
+	return result
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	Convey("Given an app with tracer", t, func() {
+		exporter := tracetest.NewInMemoryExporter()
+		tracer := tracing.CreateTracer("ledger-api-test", exporter)
+		app := CreateHTTPApp(HTTPAppConfig{Env: "test", Tracer: tracer}).
+			RegisterRoutes(func(r *Router) {
+				r.GET("/v1/resources/:resourceID", func(req *http.Request, h *HandlerToolkit) (*Response, error) {
+					return h.Response(JSON{"id": h.Params.ByName("resourceID")}), nil
+				})
+				r.GET("/v1/failing", func(req *http.Request, h *HandlerToolkit) (*Response, error) {
+					return nil, errors.New("failed")
+				})
+			})
+		handler := app.CreateHandler()
+		serve := func(path string, traceparent string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("GET", path, nil)
+			if traceparent != "" {
+				req.Header.Set("traceparent", traceparent)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			return recorder
+		}
+		exportedSpans := func() tracetest.SpanStubs {
+			So(tracer.ForceFlush(), ShouldBeNil)
+			return exporter.GetSpans()
+		}
+		serverSpan := func() tracetest.SpanStub {
+			for _, span := range exportedSpans() {
+				if span.SpanKind == trace.SpanKindServer {
+					return span
+				}
+			}
+			return tracetest.SpanStub{}
+		}
+
+		Convey("It should name server span after the route pattern", func() {
+			serve("/v1/resources/10", "")
+			span := serverSpan()
+			attributes := spanAttributes(span)
+			So(span.Name, ShouldEqual, "GET /v1/resources/:resourceID")
+			So(attributes["http.route"].AsString(), ShouldEqual, "/v1/resources/:resourceID")
+			So(attributes["http.target"].AsString(), ShouldEqual, "/v1/resources/10")
+			So(attributes["http.status_code"].AsInt64(), ShouldEqual, 200)
+			So(attributes["request.id"].AsString(), ShouldNotBeEmpty)
+			So(span.Status.Code, ShouldEqual, codes.Unset)
+		})
+
+		Convey("It should trace the handler as a child span", func() {
+			serve("/v1/resources/10", "")
+			spans := exportedSpans()
+			So(spans, ShouldHaveLength, 2)
+			So(spans[0].Name, ShouldEqual, "handler GET /v1/resources/:resourceID")
+			So(spans[0].Parent.SpanID(), ShouldEqual, spans[1].SpanContext.SpanID())
+			So(spans[0].SpanContext.TraceID(), ShouldEqual, spans[1].SpanContext.TraceID())
+		})
+
+		Convey("It should continue trace of traceparent header", func() {
+			serve("/v1/resources/10", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			span := serverSpan()
+			So(span.SpanContext.TraceID().String(), ShouldEqual, "4bf92f3577b34da6a3ce929d0e0e4736")
+			So(span.Parent.SpanID().String(), ShouldEqual, "00f067aa0ba902b7")
+		})
+
+		Convey("It should ignore malformed traceparent header", func() {
+			serve("/v1/resources/10", "malformed")
+			span := serverSpan()
+			So(span.SpanContext.TraceID().IsValid(), ShouldBeTrue)
+			So(span.Parent.IsValid(), ShouldBeFalse)
+		})
+
+		Convey("It should mark failed requests", func() {
+			serve("/v1/failing", "")
+			span := serverSpan()
+			So(spanAttributes(span)["http.status_code"].AsInt64(), ShouldEqual, 500)
+			So(span.Status.Code, ShouldEqual, codes.Error)
+			So(span.Status.Description, ShouldEqual, "500 Internal Server Error")
+		})
+	})
+}
@@ -0,0 +1,423 @@
+package tags
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/eventstore"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/users"
+)
+
+var (
+	errTagNotFound     = errors.New("Tag not found")
+	errTagNameTaken    = errors.New("Tag with the same name already exists")
+	errMergeIntoItself = errors.New("Tag can not be merged into itself")
+)
+
+// Events below are emitted by v1 ledger aggregate. Stream id is a ledger id.
+
+type tagCreated struct {
+	AggregateID string `json:"aggregate_id"`
+	TagID       int    `json:"tag_id"`
+	Name        string `json:"name"`
+}
+
+func (tagCreated) EventType() string { return "Domain::Events::TagCreated" }
+
+type tagRenamed struct {
+	AggregateID string `json:"aggregate_id"`
+	TagID       int    `json:"tag_id"`
+	Name        string `json:"name"`
+}
+
+func (tagRenamed) EventType() string { return "Domain::Events::TagRenamed" }
+
+type tagRemoved struct {
+	AggregateID string `json:"aggregate_id"`
+	TagID       int    `json:"tag_id"`
+}
+
+func (tagRemoved) EventType() string { return "Domain::Events::TagRemoved" }
+
+// Events below are emitted by v1 account aggregate. Stream id is an account id.
+
+type transactionTagged struct {
+	AggregateID   string `json:"aggregate_id"`
+	TransactionID string `json:"transaction_id"`
+	TagID         int    `json:"tag_id"`
+}
+
+func (transactionTagged) EventType() string { return "Domain::Events::TransactionTagged" }
+
+type transactionUntagged struct {
+	AggregateID   string `json:"aggregate_id"`
+	TransactionID string `json:"transaction_id"`
+	TagID         int    `json:"tag_id"`
+}
+
+func (transactionUntagged) EventType() string { return "Domain::Events::TransactionUntagged" }
+
+type tagRef struct {
+	ID int `jsonapi:"primary,tags" validate:"required"`
+}
+
+// tagPayload is a JSON API representation of the tag
+// submitted by clients to create or rename tags
+type tagPayload struct {
+	ID   int    `jsonapi:"primary,tags"`
+	Name string `jsonapi:"attr,name" validate:"required,max=255"`
+}
+
+type createTagCommand struct {
+	ledgerID string
+	user     *users.User
+	name     string
+}
+
+type renameTagCommand struct {
+	ledgerID string
+	tagID    int
+	user     *users.User
+	name     string
+}
+
+type removeTagCommand struct {
+	ledgerID string
+	tagID    int
+	user     *users.User
+}
+
+type mergeTagCommand struct {
+	ledgerID    string
+	sourceTagID int
+	targetTagID int
+	user        *users.User
+}
+
+// CommandService is a service to process commands that change tags
+type CommandService interface {
+	processCreateTagCommand(ctx context.Context, cmd *createTagCommand) (int, error)
+	processRenameTagCommand(ctx context.Context, cmd *renameTagCommand) error
+	processRemoveTagCommand(ctx context.Context, cmd *removeTagCommand) error
+	processMergeTagCommand(ctx context.Context, cmd *mergeTagCommand) (int, error)
+}
+
+type dbCommandService struct {
+	db    *gorm.DB
+	store eventstore.Store
+}
+
+func commandHeaders(user *users.User) eventstore.Headers {
+	return eventstore.Headers{"user_id": user.ID}
+}
+
+func validateCommandParams(ledgerID string, user *users.User) error {
+	if ledgerID == "" {
+		return errors.New("Please provide ledgerID")
+	}
+	if user == nil {
+		return errors.New("Please provide user")
+	}
+	return nil
+}
+
+type existingTag struct {
+	tagID int
+	name  string
+}
+
+// tagEventData includes fields of all events the tags state is built from
+type tagEventData struct {
+	TagID int    `json:"tag_id"`
+	Name  string `json:"name"`
+}
+
+// loadTags builds tags of the ledger from events of the ledger stream. The stream is
+// locked so ids and names can not be taken concurrently. Returns existing tags and
+// a max id of all tags ever created so ids of removed tags are not reused
+func loadTags(tx eventstore.Tx, ledgerID string) ([]existingTag, int, error) {
+	events, err := tx.ReadEvents(ledgerID, "Domain::Events::Tag")
+	if err != nil {
+		return nil, 0, err
+	}
+	result := []existingTag{}
+	maxTagID := 0
+	for _, evt := range events {
+		var data tagEventData
+		switch evt.Type {
+		case tagCreated{}.EventType(), tagRenamed{}.EventType(), tagRemoved{}.EventType():
+			if err := evt.Decode(&data); err != nil {
+				return nil, 0, err
+			}
+		default:
+			continue
+		}
+		switch evt.Type {
+		case tagCreated{}.EventType():
+			result = append(result, existingTag{tagID: data.TagID, name: data.Name})
+			if data.TagID > maxTagID {
+				maxTagID = data.TagID
+			}
+		case tagRenamed{}.EventType():
+			for i := range result {
+				if result[i].tagID == data.TagID {
+					result[i].name = data.Name
+				}
+			}
+		case tagRemoved{}.EventType():
+			remaining := []existingTag{}
+			for _, tag := range result {
+				if tag.tagID != data.TagID {
+					remaining = append(remaining, tag)
+				}
+			}
+			result = remaining
+		}
+	}
+	return result, maxTagID, nil
+}
+
+func findTag(tags []existingTag, tagID int) (*existingTag, error) {
+	for i := range tags {
+		if tags[i].tagID == tagID {
+			return &tags[i], nil
+		}
+	}
+	return nil, errTagNotFound
+}
+
+// validateTagName checks that other tag of the ledger has no the same name ignoring case
+func validateTagName(tags []existingTag, tagID int, name string) error {
+	for _, tag := range tags {
+		if tag.tagID != tagID && strings.EqualFold(tag.name, name) {
+			return errTagNameTaken
+		}
+	}
+	return nil
+}
+
+func (svc *dbCommandService) processCreateTagCommand(ctx context.Context, cmd *createTagCommand) (int, error) {
+	if err := validateCommandParams(cmd.ledgerID, cmd.user); err != nil {
+		return 0, err
+	}
+	logger := logging.FromContext(ctx)
+
+	var tagID int
+	if err := svc.store.Transaction(ctx, commandHeaders(cmd.user), func(tx eventstore.Tx) error {
+		tags, maxTagID, err := loadTags(tx, cmd.ledgerID)
+		if err != nil {
+			return err
+		}
+		if err := validateTagName(tags, 0, cmd.name); err != nil {
+			return err
+		}
+		tagID = maxTagID + 1
+
+		logger.Debugf("Creating tag %v. Ledger: %v", tagID, cmd.ledgerID)
+		return tx.Append(cmd.ledgerID, &tagCreated{AggregateID: cmd.ledgerID, TagID: tagID, Name: cmd.name})
+	}); err != nil {
+		return 0, err
+	}
+	return tagID, nil
+}
+
+func (svc *dbCommandService) processRenameTagCommand(ctx context.Context, cmd *renameTagCommand) error {
+	if err := validateCommandParams(cmd.ledgerID, cmd.user); err != nil {
+		return err
+	}
+	logger := logging.FromContext(ctx)
+
+	return svc.store.Transaction(ctx, commandHeaders(cmd.user), func(tx eventstore.Tx) error {
+		tags, _, err := loadTags(tx, cmd.ledgerID)
+		if err != nil {
+			return err
+		}
+		tag, err := findTag(tags, cmd.tagID)
+		if err != nil {
+			return err
+		}
+		if tag.name == cmd.name {
+			logger.Debugf("Tag %v has not been changed", cmd.tagID)
+			return nil
+		}
+		if err := validateTagName(tags, cmd.tagID, cmd.name); err != nil {
+			return err
+		}
+
+		logger.Debugf("Renaming tag %v. Ledger: %v", cmd.tagID, cmd.ledgerID)
+		return tx.Append(cmd.ledgerID, &tagRenamed{AggregateID: cmd.ledgerID, TagID: cmd.tagID, Name: cmd.name})
+	})
+}
+
+func (svc *dbCommandService) processRemoveTagCommand(ctx context.Context, cmd *removeTagCommand) error {
+	if err := validateCommandParams(cmd.ledgerID, cmd.user); err != nil {
+		return err
+	}
+	logger := logging.FromContext(ctx)
+
+	return svc.store.Transaction(ctx, commandHeaders(cmd.user), func(tx eventstore.Tx) error {
+		tags, _, err := loadTags(tx, cmd.ledgerID)
+		if err != nil {
+			return err
+		}
+		if _, err := findTag(tags, cmd.tagID); err != nil {
+			return err
+		}
+
+		logger.Debugf("Removing tag %v. Ledger: %v", cmd.tagID, cmd.ledgerID)
+		return tx.Append(cmd.ledgerID, &tagRemoved{AggregateID: cmd.ledgerID, TagID: cmd.tagID})
+	})
+}
+
+// transactionEventData includes fields of account events that change tags of the transaction
+type transactionEventData struct {
+	TransactionID string `json:"transaction_id"`
+	TagIDs        []int  `json:"tag_ids"`
+	TagID         int    `json:"tag_id"`
+}
+
+// transactionTags - tag ids of the transaction built from events of its account stream
+type transactionTags struct {
+	transactionID string
+	tagIDs        []int
+}
+
+// buildTransactionTags builds tag ids of transactions from events of the account stream.
+// Transactions are returned in order they have been reported. Removed transactions are skipped
+func buildTransactionTags(events []eventstore.RecordedEvent) ([]transactionTags, error) {
+	tagIDsByTransaction := make(map[string][]int)
+	transactionIDs := []string{}
+	for _, evt := range events {
+		var data transactionEventData
+		switch evt.Type {
+		case "Domain::Events::TransactionReported", "Domain::Events::TransferSent", "Domain::Events::TransferReceived",
+			"Domain::Events::TransactionRemoved", transactionTagged{}.EventType(), transactionUntagged{}.EventType():
+			if err := evt.Decode(&data); err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+		tagIDs, reported := tagIDsByTransaction[data.TransactionID]
+		switch evt.Type {
+		case "Domain::Events::TransactionReported", "Domain::Events::TransferSent", "Domain::Events::TransferReceived":
+			if !reported {
+				transactionIDs = append(transactionIDs, data.TransactionID)
+			}
+			tagIDsByTransaction[data.TransactionID] = append([]int{}, data.TagIDs...)
+		case "Domain::Events::TransactionRemoved":
+			delete(tagIDsByTransaction, data.TransactionID)
+		case transactionTagged{}.EventType():
+			if reported {
+				tagIDsByTransaction[data.TransactionID] = append(tagIDs, data.TagID)
+			}
+		case transactionUntagged{}.EventType():
+			if reported {
+				remaining := []int{}
+				for _, tagID := range tagIDs {
+					if tagID != data.TagID {
+						remaining = append(remaining, tagID)
+					}
+				}
+				tagIDsByTransaction[data.TransactionID] = remaining
+			}
+		}
+	}
+	result := []transactionTags{}
+	for _, transactionID := range transactionIDs {
+		if tagIDs, ok := tagIDsByTransaction[transactionID]; ok {
+			result = append(result, transactionTags{transactionID: transactionID, tagIDs: tagIDs})
+		}
+	}
+	return result, nil
+}
+
+func containsTagID(tagIDs []int, tagID int) bool {
+	for _, id := range tagIDs {
+		if id == tagID {
+			return true
+		}
+	}
+	return false
+}
+
+// processMergeTagCommand retags transactions of the ledger so source tag is replaced
+// with target tag and removes source tag. Transactions are untagged and tagged within
+// their account streams and the tag is removed within the ledger stream atomically.
+// Tags of transactions are built from account streams of the ledger while they are locked
+// so transactions tagged recently are retagged as well even if not projected yet.
+// Returns a number of transactions that have been retagged
+func (svc *dbCommandService) processMergeTagCommand(ctx context.Context, cmd *mergeTagCommand) (int, error) {
+	if err := validateCommandParams(cmd.ledgerID, cmd.user); err != nil {
+		return 0, err
+	}
+	if cmd.sourceTagID == cmd.targetTagID {
+		return 0, errMergeIntoItself
+	}
+	logger := logging.FromContext(ctx)
+
+	updated := 0
+	if err := svc.store.Transaction(ctx, commandHeaders(cmd.user), func(tx eventstore.Tx) error {
+		tags, _, err := loadTags(tx, cmd.ledgerID)
+		if err != nil {
+			return err
+		}
+		for _, tagID := range []int{cmd.sourceTagID, cmd.targetTagID} {
+			if _, err := findTag(tags, tagID); err != nil {
+				return err
+			}
+		}
+
+		var accountIDs []string
+		if err := tx.DB().Table("projections_accounts").
+			Where("ledger_id = ?", cmd.ledgerID).
+			Order("aggregate_id").
+			Pluck("aggregate_id", &accountIDs).Error; err != nil {
+			return err
+		}
+
+		for _, accountID := range accountIDs {
+			events, err := tx.ReadEvents(accountID, "")
+			if err != nil {
+				return err
+			}
+			transactions, err := buildTransactionTags(events)
+			if err != nil {
+				return err
+			}
+			for _, trx := range transactions {
+				if !containsTagID(trx.tagIDs, cmd.sourceTagID) {
+					continue
+				}
+				retagEvents := []eventstore.Event{}
+				if !containsTagID(trx.tagIDs, cmd.targetTagID) {
+					retagEvents = append(retagEvents, &transactionTagged{
+						AggregateID: accountID, TransactionID: trx.transactionID, TagID: cmd.targetTagID,
+					})
+				}
+				retagEvents = append(retagEvents, &transactionUntagged{
+					AggregateID: accountID, TransactionID: trx.transactionID, TagID: cmd.sourceTagID,
+				})
+				if err := tx.Append(accountID, retagEvents...); err != nil {
+					return err
+				}
+				updated++
+			}
+		}
+
+		logger.Debugf("Merging tag %v into %v. Ledger: %v, transactions: %v", cmd.sourceTagID, cmd.targetTagID, cmd.ledgerID, updated)
+		return tx.Append(cmd.ledgerID, &tagRemoved{AggregateID: cmd.ledgerID, TagID: cmd.sourceTagID})
+	}); err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// CreateCommandService initializes a new instance of the command service
+func CreateCommandService(db *gorm.DB, store eventstore.Store) CommandService {
+	svc := dbCommandService{db: db, store: store}
+	return &svc
+}
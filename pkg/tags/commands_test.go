@@ -0,0 +1,295 @@
+package tags
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/icrowley/fake"
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/eventstore"
+	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/logging"
+)
+
+// transactionReported is emitted by v1 account aggregate when transaction is reported
+type transactionReported struct {
+	AggregateID   string `json:"aggregate_id"`
+	TransactionID string `json:"transaction_id"`
+	TagIDs        []int  `json:"tag_ids"`
+}
+
+func (transactionReported) EventType() string { return "Domain::Events::TransactionReported" }
+
+// seedTags appends created events of tags of the ledger to the ledger stream
+func seedTags(store *ldtesting.EventStore, md ldtesting.LedgerData) {
+	for _, tagID := range md.TagIDs {
+		store.Seed(md.LedgerID, &tagCreated{AggregateID: md.LedgerID, TagID: tagID, Name: md.TagsByID[tagID]})
+	}
+}
+
+// seedTransactions sets up transactions and appends reported events to their account streams
+func seedTransactions(store *ldtesting.EventStore, trxs ...*ldtesting.Transaction) {
+	for _, trx := range trxs {
+		if err := ldtesting.SetupTransactions(DB, []ldtesting.Transaction{*trx}); err != nil {
+			panic(err)
+		}
+		store.Seed(trx.AccountID, &transactionReported{
+			AggregateID:   trx.AccountID,
+			TransactionID: trx.TransactionID,
+			TagIDs:        GetTagIDsFromString(trx.TagIDs),
+		})
+	}
+}
+
+func TestBuildTransactionTags(t *testing.T) {
+	Convey("Given events of the account stream", t, func() {
+		event := func(eventType string, data string) eventstore.RecordedEvent {
+			return eventstore.RecordedEvent{Type: eventType, Data: json.RawMessage(data)}
+		}
+		events := []eventstore.RecordedEvent{
+			event("Domain::Events::AccountCreated", `{"aggregate_id":"a1","name":"Cash"}`),
+			event("Domain::Events::TransactionReported", `{"aggregate_id":"a1","transaction_id":"t1","tag_ids":[1,2]}`),
+			event("Domain::Events::TransferReceived", `{"aggregate_id":"a1","transaction_id":"t2","tag_ids":[]}`),
+			event("Domain::Events::TransactionReported", `{"aggregate_id":"a1","transaction_id":"t3","tag_ids":[1]}`),
+			event("Domain::Events::TransactionUntagged", `{"aggregate_id":"a1","transaction_id":"t1","tag_id":1}`),
+			event("Domain::Events::TransactionTagged", `{"aggregate_id":"a1","transaction_id":"t2","tag_id":3}`),
+			event("Domain::Events::TransactionRemoved", `{"aggregate_id":"a1","transaction_id":"t3"}`),
+			event("Domain::Events::TransactionTagged", `{"aggregate_id":"a1","transaction_id":"t4","tag_id":1}`),
+		}
+
+		Convey("It should build tags of reported transactions in order they have been reported", func() {
+			transactions, err := buildTransactionTags(events)
+			So(err, ShouldBeNil)
+			So(transactions, ShouldResemble, []transactionTags{
+				{transactionID: "t1", tagIDs: []int{2}},
+				{transactionID: "t2", tagIDs: []int{3}},
+			})
+		})
+	})
+}
+
+func TestTagCommands(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given tag commands", t, func() {
+		store := ldtesting.NewEventStore(DB)
+		svc := CreateCommandService(DB, store)
+		user := ldtesting.NewUser()
+		md, err := ldtesting.SetupLedgerData(DB, user)
+		So(err, ShouldBeNil)
+		seedTags(store, md)
+		maxTagID := md.TagIDs[len(md.TagIDs)-1]
+
+		Convey("When creating tag", func() {
+			Convey("It should append created event with next tag id", func() {
+				name := fake.Word()
+				tagID, err := svc.processCreateTagCommand(ctx, &createTagCommand{ledgerID: md.LedgerID, user: user, name: name})
+				So(err, ShouldBeNil)
+				So(tagID, ShouldEqual, maxTagID+1)
+				So(store.Commits, ShouldHaveLength, 1)
+				So(store.Commits[0].StreamID, ShouldEqual, md.LedgerID)
+				So(store.Commits[0].Headers, ShouldResemble, eventstore.Headers{"user_id": user.ID})
+				So(store.Commits[0].Events, ShouldResemble, []eventstore.Event{
+					&tagCreated{AggregateID: md.LedgerID, TagID: tagID, Name: name},
+				})
+			})
+
+			Convey("It should not reuse ids of removed tags", func() {
+				store.Seed(md.LedgerID, &tagRemoved{AggregateID: md.LedgerID, TagID: maxTagID})
+				tagID, err := svc.processCreateTagCommand(ctx, &createTagCommand{ledgerID: md.LedgerID, user: user, name: fake.Word()})
+				So(err, ShouldBeNil)
+				So(tagID, ShouldEqual, maxTagID+1)
+			})
+
+			Convey("It should fail if name is taken ignoring case", func() {
+				_, err := svc.processCreateTagCommand(ctx, &createTagCommand{
+					ledgerID: md.LedgerID,
+					user:     user,
+					name:     strings.ToUpper(md.TagsByID[md.TagIDs[0]]),
+				})
+				So(err, ShouldEqual, errTagNameTaken)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should fail if name is taken", func() {
+				_, err := svc.processCreateTagCommand(ctx, &createTagCommand{
+					ledgerID: md.LedgerID,
+					user:     user,
+					name:     md.TagsByID[md.TagIDs[0]],
+				})
+				So(err, ShouldEqual, errTagNameTaken)
+				So(store.Commits, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When renaming tag", func() {
+			Convey("It should append renamed event", func() {
+				name := fake.Word()
+				err := svc.processRenameTagCommand(ctx, &renameTagCommand{ledgerID: md.LedgerID, tagID: md.TagIDs[0], user: user, name: name})
+				So(err, ShouldBeNil)
+				So(store.Commits, ShouldHaveLength, 1)
+				So(store.Commits[0].Events, ShouldResemble, []eventstore.Event{
+					&tagRenamed{AggregateID: md.LedgerID, TagID: md.TagIDs[0], Name: name},
+				})
+			})
+
+			Convey("It should fail if name is taken by other tag", func() {
+				err := svc.processRenameTagCommand(ctx, &renameTagCommand{
+					ledgerID: md.LedgerID,
+					tagID:    md.TagIDs[0],
+					user:     user,
+					name:     md.TagsByID[md.TagIDs[1]],
+				})
+				So(err, ShouldEqual, errTagNameTaken)
+			})
+
+			Convey("It should fail if tag is from other ledger", func() {
+				err := svc.processRenameTagCommand(ctx, &renameTagCommand{
+					ledgerID: uuid.NewV4().String(),
+					tagID:    md.TagIDs[0],
+					user:     user,
+					name:     fake.Word(),
+				})
+				So(err, ShouldEqual, errTagNotFound)
+			})
+		})
+
+		Convey("When removing tag", func() {
+			Convey("It should append removed event", func() {
+				err := svc.processRemoveTagCommand(ctx, &removeTagCommand{ledgerID: md.LedgerID, tagID: md.TagIDs[0], user: user})
+				So(err, ShouldBeNil)
+				So(store.Commits, ShouldHaveLength, 1)
+				So(store.Commits[0].Events, ShouldResemble, []eventstore.Event{
+					&tagRemoved{AggregateID: md.LedgerID, TagID: md.TagIDs[0]},
+				})
+			})
+
+			Convey("It should fail if tag has already been removed", func() {
+				store.Seed(md.LedgerID, &tagRemoved{AggregateID: md.LedgerID, TagID: md.TagIDs[0]})
+				err := svc.processRemoveTagCommand(ctx, &removeTagCommand{ledgerID: md.LedgerID, tagID: md.TagIDs[0], user: user})
+				So(err, ShouldEqual, errTagNotFound)
+				So(store.Commits, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When merging tags", func() {
+			source := md.TagIDs[0]
+			target := md.TagIDs[1]
+			other := md.TagIDs[2]
+			withSource := ldtesting.NewTransaction(ldtesting.TrxRndAcc(md.AccountIDs))
+			withSource.TagIDs = FormatTagIDs([]int{other, source})
+			withBoth := ldtesting.NewTransaction(ldtesting.TrxRndAcc(md.AccountIDs))
+			withBoth.TagIDs = FormatTagIDs([]int{source, target})
+			withOther := ldtesting.NewTransaction(ldtesting.TrxRndAcc(md.AccountIDs))
+			withOther.TagIDs = FormatTagIDs([]int{other})
+			seedTransactions(store, withSource, withBoth, withOther)
+
+			otherLedger, err := ldtesting.SetupLedgerData(DB, user)
+			So(err, ShouldBeNil)
+			otherLedgerTrx := ldtesting.NewTransaction(ldtesting.TrxRndAcc(otherLedger.AccountIDs))
+			otherLedgerTrx.TagIDs = FormatTagIDs([]int{source})
+			seedTransactions(store, otherLedgerTrx)
+
+			Convey("It should retag transactions of the ledger and remove source tag", func() {
+				updated, err := svc.processMergeTagCommand(ctx, &mergeTagCommand{
+					ledgerID:    md.LedgerID,
+					sourceTagID: source,
+					targetTagID: target,
+					user:        user,
+				})
+				So(err, ShouldBeNil)
+				So(updated, ShouldEqual, 2)
+				So(store.Commits, ShouldHaveLength, 3)
+				eventsByStream := make(map[string][]eventstore.Event)
+				for _, commit := range store.Commits[:2] {
+					So(commit.Headers, ShouldResemble, eventstore.Headers{"user_id": user.ID})
+					eventsByStream[commit.StreamID] = append(eventsByStream[commit.StreamID], commit.Events...)
+				}
+				So(eventsByStream[withSource.AccountID], ShouldContain, &transactionTagged{
+					AggregateID: withSource.AccountID, TransactionID: withSource.TransactionID, TagID: target,
+				})
+				So(eventsByStream[withSource.AccountID], ShouldContain, &transactionUntagged{
+					AggregateID: withSource.AccountID, TransactionID: withSource.TransactionID, TagID: source,
+				})
+				So(eventsByStream[withBoth.AccountID], ShouldContain, &transactionUntagged{
+					AggregateID: withBoth.AccountID, TransactionID: withBoth.TransactionID, TagID: source,
+				})
+				So(eventsByStream[withBoth.AccountID], ShouldNotContain, &transactionTagged{
+					AggregateID: withBoth.AccountID, TransactionID: withBoth.TransactionID, TagID: target,
+				})
+				So(store.Commits[2].StreamID, ShouldEqual, md.LedgerID)
+				So(store.Commits[2].Events, ShouldResemble, []eventstore.Event{
+					&tagRemoved{AggregateID: md.LedgerID, TagID: source},
+				})
+			})
+
+			Convey("It should skip transactions untagged within account streams", func() {
+				store.Seed(withSource.AccountID, &transactionUntagged{
+					AggregateID: withSource.AccountID, TransactionID: withSource.TransactionID, TagID: source,
+				})
+				updated, err := svc.processMergeTagCommand(ctx, &mergeTagCommand{
+					ledgerID:    md.LedgerID,
+					sourceTagID: source,
+					targetTagID: target,
+					user:        user,
+				})
+				So(err, ShouldBeNil)
+				So(updated, ShouldEqual, 1)
+				So(store.Commits, ShouldHaveLength, 2)
+				So(store.Commits[0].Events, ShouldResemble, []eventstore.Event{
+					&transactionUntagged{AggregateID: withBoth.AccountID, TransactionID: withBoth.TransactionID, TagID: source},
+				})
+			})
+
+			Convey("It should retag transactions that are not projected yet", func() {
+				accountID := md.AccountIDs[0]
+				transactionID := uuid.NewV4().String()
+				store.Seed(accountID, &transactionReported{AggregateID: accountID, TransactionID: transactionID, TagIDs: []int{source}})
+				updated, err := svc.processMergeTagCommand(ctx, &mergeTagCommand{
+					ledgerID:    md.LedgerID,
+					sourceTagID: source,
+					targetTagID: target,
+					user:        user,
+				})
+				So(err, ShouldBeNil)
+				So(updated, ShouldEqual, 3)
+				accountEvents := []eventstore.Event{}
+				for _, commit := range store.Commits {
+					if commit.StreamID == accountID {
+						accountEvents = append(accountEvents, commit.Events...)
+					}
+				}
+				So(accountEvents, ShouldContain, &transactionTagged{
+					AggregateID: accountID, TransactionID: transactionID, TagID: target,
+				})
+				So(accountEvents, ShouldContain, &transactionUntagged{
+					AggregateID: accountID, TransactionID: transactionID, TagID: source,
+				})
+			})
+
+			Convey("It should fail if target tag does not exist", func() {
+				_, err := svc.processMergeTagCommand(ctx, &mergeTagCommand{
+					ledgerID:    md.LedgerID,
+					sourceTagID: source,
+					targetTagID: maxTagID + 1,
+					user:        user,
+				})
+				So(err, ShouldEqual, errTagNotFound)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should fail if merging into itself", func() {
+				_, err := svc.processMergeTagCommand(ctx, &mergeTagCommand{
+					ledgerID:    md.LedgerID,
+					sourceTagID: source,
+					targetTagID: source,
+					user:        user,
+				})
+				So(err, ShouldEqual, errMergeIntoItself)
+			})
+		})
+	})
+}
@@ -1,8 +1,15 @@
 package tags
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
 )
 
 // GetTagIDsFromString will parse string that contains tagIDs
@@ -22,3 +29,55 @@ func GetTagIDsFromString(tagIDs string) []int {
 	}
 	return result
 }
+
+// FormatTagIDs will format tagIDs the way GetTagIDsFromString
+// can parse them, e.g: {1},{2},{4}
+func FormatTagIDs(tagIDs []int) string {
+	parts := make([]string, len(tagIDs))
+	for i, tagID := range tagIDs {
+		parts[i] = fmt.Sprintf("{%v}", tagID)
+	}
+	return strings.Join(parts, ",")
+}
+
+type tagDTO struct {
+	TagID int    `json:"tagID"`
+	Name  string `json:"name"`
+}
+
+type ledgerTagsQuery struct {
+	ledgerID string
+}
+
+// QueryService is a service to do various queries against tags
+type QueryService interface {
+	processLedgerTagsQuery(ctx context.Context, query *ledgerTagsQuery) ([]tagDTO, error)
+}
+
+type dbQueryService struct {
+	db *gorm.DB
+}
+
+func (svc *dbQueryService) processLedgerTagsQuery(ctx context.Context, query *ledgerTagsQuery) ([]tagDTO, error) {
+	if query.ledgerID == "" {
+		return nil, errors.New("Please provide ledgerID")
+	}
+	logger := logging.FromContext(ctx)
+	logger.Debugf("Processing ledger tags query. LedgerID: %v", query.ledgerID)
+
+	result := []tagDTO{}
+	if err := tracing.DB(ctx, svc.db).Table("projections_tags tg").
+		Select("tg.tag_id, tg.name").
+		Where("tg.ledger_id = ?", query.ledgerID).
+		Order("tg.name, tg.tag_id").
+		Find(&result).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CreateQueryService initializes a new instance of the query service
+func CreateQueryService(db *gorm.DB) QueryService {
+	svc := dbQueryService{db: db}
+	return &svc
+}
@@ -38,3 +38,20 @@ func TestGetTagIDsFromString(t *testing.T) {
 		})
 	})
 }
+
+func TestFormatTagIDs(t *testing.T) {
+	Convey("Given tagIDs", t, func() {
+		Convey("It should format empty slice as empty string", func() {
+			So(FormatTagIDs([]int{}), ShouldEqual, "")
+		})
+
+		Convey("It should enclose each tagID with braces and separate with comma", func() {
+			So(FormatTagIDs([]int{1, 22, 4}), ShouldEqual, "{1},{22},{4}")
+		})
+
+		Convey("It should produce a string that can be parsed back", func() {
+			tagIDs := []int{rand.Intn(1000), rand.Intn(1000)}
+			So(GetTagIDsFromString(FormatTagIDs(tagIDs)), ShouldResemble, tagIDs)
+		})
+	})
+}
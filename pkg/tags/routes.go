@@ -0,0 +1,158 @@
+package tags
+
+import (
+	"net/http"
+	"strconv"
+
+	"ledger.api/pkg/server"
+	"ledger.api/pkg/users"
+)
+
+// CreateRoutes - Register tags related routes
+func CreateRoutes(svc QueryService, ledgerAccess server.LedgerAccessChecker) server.Routes {
+	return func(router *server.Router) {
+		router.
+			Group(
+				"/v2/ledgers/:ledgerID/tags",
+				server.WithScopes("read:tags"),
+				server.WithMiddleware(server.CreateLedgerAccessMiddlewareFunc(ledgerAccess)),
+			).
+			GET("", createLedgerTagsQueryHandler(svc))
+	}
+}
+
+// CreateCommandRoutes - Register routes that change tags
+func CreateCommandRoutes(svc CommandService, ledgerAccess server.LedgerAccessChecker) server.Routes {
+	return func(router *server.Router) {
+		tags := router.Group(
+			"/v2/ledgers/:ledgerID/tags",
+			server.WithScopes("write:tags"),
+			server.WithMiddleware(server.CreateLedgerAccessMiddlewareFunc(ledgerAccess)),
+		)
+		tags.POST("", createCreateTagHandler(svc))
+		tags.PATCH("/:tagID", createRenameTagHandler(svc))
+		tags.DELETE("/:tagID", createRemoveTagHandler(svc))
+
+		// Merges tag identified by tagID into a tag provided in payload
+		tags.POST("/:tagID/merge", createMergeTagHandler(svc))
+	}
+}
+
+func createLedgerTagsQueryHandler(svc QueryService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		result, err := svc.processLedgerTagsQuery(req.Context(), &ledgerTagsQuery{
+			ledgerID: h.Params.ByName("ledgerID"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return h.Response(result), nil
+	}
+}
+
+// commandHTTPError maps command errors to http errors
+func commandHTTPError(err error) error {
+	switch err {
+	case errTagNotFound:
+		return *server.NotFoundError()
+	case errMergeIntoItself:
+		return *server.BadRequestError(err.Error())
+	case errTagNameTaken:
+		return *server.ConflictError(err.Error())
+	}
+	return err
+}
+
+func parseTagID(h *server.HandlerToolkit) (int, error) {
+	tagID, err := strconv.Atoi(h.Params.ByName("tagID"))
+	if err != nil {
+		return 0, *server.NotFoundError()
+	}
+	return tagID, nil
+}
+
+func createCreateTagHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		var payload tagPayload
+		if err := h.Bind(req, &payload); err != nil {
+			return nil, err
+		}
+		tagID, err := svc.processCreateTagCommand(req.Context(), &createTagCommand{
+			ledgerID: h.Params.ByName("ledgerID"),
+			user:     users.FromContext(req.Context()),
+			name:     payload.Name,
+		})
+		if err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(server.JSON{"tagID": tagID}).Status(http.StatusAccepted), nil
+	}
+}
+
+func createRenameTagHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		tagID, err := parseTagID(h)
+		if err != nil {
+			return nil, err
+		}
+		var payload tagPayload
+		if err := h.Bind(req, &payload); err != nil {
+			return nil, err
+		}
+		if payload.ID != 0 && payload.ID != tagID {
+			return nil, *server.BadRequestError("Payload id does not match tagID")
+		}
+		if err := svc.processRenameTagCommand(req.Context(), &renameTagCommand{
+			ledgerID: h.Params.ByName("ledgerID"),
+			tagID:    tagID,
+			user:     users.FromContext(req.Context()),
+			name:     payload.Name,
+		}); err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(server.JSON{"tagID": tagID}).Status(http.StatusAccepted), nil
+	}
+}
+
+func createRemoveTagHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		tagID, err := parseTagID(h)
+		if err != nil {
+			return nil, err
+		}
+		if err := svc.processRemoveTagCommand(req.Context(), &removeTagCommand{
+			ledgerID: h.Params.ByName("ledgerID"),
+			tagID:    tagID,
+			user:     users.FromContext(req.Context()),
+		}); err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(server.JSON{"tagID": tagID}).Status(http.StatusAccepted), nil
+	}
+}
+
+func createMergeTagHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		tagID, err := parseTagID(h)
+		if err != nil {
+			return nil, err
+		}
+		var target tagRef
+		if err := h.Bind(req, &target); err != nil {
+			return nil, err
+		}
+		updated, err := svc.processMergeTagCommand(req.Context(), &mergeTagCommand{
+			ledgerID:    h.Params.ByName("ledgerID"),
+			sourceTagID: tagID,
+			targetTagID: target.ID,
+			user:        users.FromContext(req.Context()),
+		})
+		if err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(server.JSON{
+			"tagID":               target.ID,
+			"updatedTransactions": updated,
+		}).Status(http.StatusAccepted), nil
+	}
+}
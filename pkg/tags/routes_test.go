@@ -0,0 +1,224 @@
+package tags
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/jsonapi"
+	"github.com/icrowley/fake"
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/server"
+	"ledger.api/pkg/users"
+)
+
+var rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+type methodCall struct {
+	input  interface{}
+	result interface{}
+}
+
+type mockQueryService struct {
+	calls []methodCall
+}
+
+func (svc *mockQueryService) processLedgerTagsQuery(ctx context.Context, query *ledgerTagsQuery) ([]tagDTO, error) {
+	result := []tagDTO{
+		tagDTO{TagID: rnd.Intn(1000), Name: fake.Word()},
+		tagDTO{TagID: rnd.Intn(1000), Name: fake.Word()},
+	}
+	svc.calls = append(svc.calls, methodCall{input: query, result: result})
+	return result, nil
+}
+
+type mockCommandService struct {
+	calls []methodCall
+	err   error
+}
+
+func (svc *mockCommandService) processCreateTagCommand(ctx context.Context, cmd *createTagCommand) (int, error) {
+	tagID := 1 + rnd.Intn(1000)
+	svc.calls = append(svc.calls, methodCall{input: cmd, result: tagID})
+	return tagID, svc.err
+}
+
+func (svc *mockCommandService) processRenameTagCommand(ctx context.Context, cmd *renameTagCommand) error {
+	svc.calls = append(svc.calls, methodCall{input: cmd})
+	return svc.err
+}
+
+func (svc *mockCommandService) processRemoveTagCommand(ctx context.Context, cmd *removeTagCommand) error {
+	svc.calls = append(svc.calls, methodCall{input: cmd})
+	return svc.err
+}
+
+func (svc *mockCommandService) processMergeTagCommand(ctx context.Context, cmd *mergeTagCommand) (int, error) {
+	updated := rnd.Intn(100)
+	svc.calls = append(svc.calls, methodCall{input: cmd, result: updated})
+	return updated, svc.err
+}
+
+type mockLedgerAccessChecker struct {
+	accessibleLedgers map[string]bool
+}
+
+func (checker *mockLedgerAccessChecker) HasLedgerAccess(ctx context.Context, user *users.User, ledgerID string) (bool, error) {
+	return checker.accessibleLedgers[ledgerID], nil
+}
+
+func TestTagsRoutes(t *testing.T) {
+	Convey("Given tags routes", t, func() {
+		ledgerID := uuid.NewV4().String()
+		checker := mockLedgerAccessChecker{accessibleLedgers: map[string]bool{ledgerID: true}}
+		querySvc := &mockQueryService{}
+		cmdSvc := &mockCommandService{}
+		router := server.
+			CreateHTTPApp(server.HTTPAppConfig{Env: "test"}).
+			RegisterRoutes(CreateRoutes(querySvc, &checker)).
+			RegisterRoutes(CreateCommandRoutes(cmdSvc, &checker))
+		recorder := httptest.NewRecorder()
+		user := ldtesting.NewUser()
+		path := fmt.Sprintf("/v2/ledgers/%v/tags", ledgerID)
+		tagID := 1 + rnd.Intn(1000)
+		tagPath := fmt.Sprintf("%v/%v", path, tagID)
+		newRequest := func(method string, path string, payload interface{}, scope string) *http.Request {
+			body := bytes.NewBuffer(nil)
+			if payload != nil {
+				if err := jsonapi.MarshalPayload(body, payload); err != nil {
+					panic(err)
+				}
+			}
+			req := ldtesting.NewRequest(method, path, ldtesting.WithScopeClaim(scope), ldtesting.WithUser(user))
+			req.Body = ioutil.NopCloser(body)
+			return req
+		}
+
+		Convey("When route is GET ledger tags", func() {
+			Convey("It should process query and return tags", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("GET", path, nil, "read:tags"))
+				So(recorder.Code, ShouldEqual, 200)
+				So(querySvc.calls, ShouldHaveLength, 1)
+				So(querySvc.calls[0].input, ShouldResemble, &ledgerTagsQuery{ledgerID: ledgerID})
+				expectedMessage, _ := json.Marshal(querySvc.calls[0].result)
+				So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+			})
+
+			Convey("It should reject with 403 if no read scope", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("GET", path, nil, "write:tags"))
+				So(recorder.Code, ShouldEqual, 403)
+			})
+
+			Convey("It should reject with 404 if ledger is not accessible", func() {
+				otherPath := fmt.Sprintf("/v2/ledgers/%v/tags", uuid.NewV4().String())
+				router.CreateHandler().ServeHTTP(recorder, newRequest("GET", otherPath, nil, "read:tags"))
+				So(recorder.Code, ShouldEqual, 404)
+				So(querySvc.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When route is create tag", func() {
+			payload := tagPayload{Name: fake.Word()}
+
+			Convey("It should process command and respond with tag id", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &payload, "write:tags"))
+				So(recorder.Code, ShouldEqual, 202)
+				So(cmdSvc.calls, ShouldHaveLength, 1)
+				So(cmdSvc.calls[0].input, ShouldResemble, &createTagCommand{ledgerID: ledgerID, user: user, name: payload.Name})
+				expectedMessage, _ := json.Marshal(server.JSON{"tagID": cmdSvc.calls[0].result})
+				So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+			})
+
+			Convey("It should respond with 400 if name is missing", func() {
+				payload.Name = ""
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &payload, "write:tags"))
+				So(recorder.Code, ShouldEqual, 400)
+				So(cmdSvc.calls, ShouldBeEmpty)
+			})
+
+			Convey("It should respond with 409 if name is taken", func() {
+				cmdSvc.err = errTagNameTaken
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &payload, "write:tags"))
+				So(recorder.Code, ShouldEqual, 409)
+			})
+
+			Convey("It should reject with 403 if no write scope", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &payload, "read:tags"))
+				So(recorder.Code, ShouldEqual, 403)
+				So(cmdSvc.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When route is rename tag", func() {
+			payload := tagPayload{ID: tagID, Name: fake.Word()}
+
+			Convey("It should process command", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("PATCH", tagPath, &payload, "write:tags"))
+				So(recorder.Code, ShouldEqual, 202)
+				So(cmdSvc.calls, ShouldHaveLength, 1)
+				So(cmdSvc.calls[0].input, ShouldResemble, &renameTagCommand{ledgerID: ledgerID, tagID: tagID, user: user, name: payload.Name})
+			})
+
+			Convey("It should respond with 400 if payload id is different", func() {
+				payload.ID = tagID + 1
+				router.CreateHandler().ServeHTTP(recorder, newRequest("PATCH", tagPath, &payload, "write:tags"))
+				So(recorder.Code, ShouldEqual, 400)
+				So(cmdSvc.calls, ShouldBeEmpty)
+			})
+
+			Convey("It should respond with 404 if tag is not found", func() {
+				cmdSvc.err = errTagNotFound
+				router.CreateHandler().ServeHTTP(recorder, newRequest("PATCH", tagPath, &payload, "write:tags"))
+				So(recorder.Code, ShouldEqual, 404)
+			})
+		})
+
+		Convey("When route is remove tag", func() {
+			Convey("It should process command", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("DELETE", tagPath, nil, "write:tags"))
+				So(recorder.Code, ShouldEqual, 202)
+				So(cmdSvc.calls, ShouldHaveLength, 1)
+				So(cmdSvc.calls[0].input, ShouldResemble, &removeTagCommand{ledgerID: ledgerID, tagID: tagID, user: user})
+			})
+
+			Convey("It should respond with 404 if tag id is not a number", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("DELETE", path+"/"+fake.Word(), nil, "write:tags"))
+				So(recorder.Code, ShouldEqual, 404)
+				So(cmdSvc.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When route is merge tag", func() {
+			target := tagRef{ID: tagID + 1}
+
+			Convey("It should process command and respond with number of updated transactions", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", tagPath+"/merge", &target, "write:tags"))
+				So(recorder.Code, ShouldEqual, 202)
+				So(cmdSvc.calls, ShouldHaveLength, 1)
+				So(cmdSvc.calls[0].input, ShouldResemble, &mergeTagCommand{
+					ledgerID:    ledgerID,
+					sourceTagID: tagID,
+					targetTagID: target.ID,
+					user:        user,
+				})
+				expectedMessage, _ := json.Marshal(server.JSON{"tagID": target.ID, "updatedTransactions": cmdSvc.calls[0].result})
+				So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+			})
+
+			Convey("It should respond with 400 if merging into itself", func() {
+				cmdSvc.err = errMergeIntoItself
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", tagPath+"/merge", &target, "write:tags"))
+				So(recorder.Code, ShouldEqual, 400)
+			})
+		})
+	})
+}
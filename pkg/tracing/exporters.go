@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"ledger.api/pkg/logging"
+)
+
+// logExporter - writes spans to the log
+type logExporter struct {
+	logger logging.Logger
+}
+
+// CreateLogExporter creates an exporter that writes spans to the log at debug level
+func CreateLogExporter(logger logging.Logger) sdktrace.SpanExporter {
+	return &logExporter{logger: logger}
+}
+
+func (exporter *logExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	for _, span := range spans {
+		fields := logging.Fields{
+			"TraceID":  span.SpanContext().TraceID().String(),
+			"SpanID":   span.SpanContext().SpanID().String(),
+			"Duration": span.EndTime().Sub(span.StartTime()).String(),
+		}
+		if span.Parent().IsValid() {
+			fields["ParentSpanID"] = span.Parent().SpanID().String()
+		}
+		for _, attr := range span.Attributes() {
+			fields[string(attr.Key)] = attr.Value.Emit()
+		}
+		if span.Status().Code == codes.Error {
+			fields["SpanError"] = span.Status().Description
+		}
+		exporter.logger.WithFields(fields).Debugf("SPAN: %v", span.Name())
+	}
+	return nil
+}
+
+func (exporter *logExporter) Shutdown(ctx context.Context) error { return nil }
+
+// CreateOTLPExporter creates an exporter that sends spans to OTLP/HTTP traces
+// endpoint of a collector, e.g http://localhost:4318/v1/traces
+func CreateOTLPExporter(endpoint string) (sdktrace.SpanExporter, error) {
+	return otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+}
@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	Convey("Given OTLP exporter", t, func() {
+		requests := make(chan *coltracepb.ExportTraceServiceRequest, 10)
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := ioutil.ReadAll(req.Body)
+			var payload coltracepb.ExportTraceServiceRequest
+			if req.URL.Path == "/v1/traces" && proto.Unmarshal(body, &payload) == nil {
+				requests <- &payload
+			}
+			w.Header().Set("Content-Type", "application/x-protobuf")
+		}))
+		defer collector.Close()
+
+		exporter, err := CreateOTLPExporter(collector.URL + "/v1/traces")
+		So(err, ShouldBeNil)
+		tracer := CreateTracer("ledger-api-test", exporter)
+
+		Convey("It should send spans to the collector on shutdown", func() {
+			ctx, root := tracer.StartSpan(context.Background(), "root")
+			_, child := StartSpan(ctx, "child")
+			child.End()
+			root.End()
+			So(tracer.Shutdown(), ShouldBeNil)
+
+			var payload *coltracepb.ExportTraceServiceRequest
+			select {
+			case payload = <-requests:
+			case <-time.After(5 * time.Second):
+			}
+			So(payload, ShouldNotBeNil)
+			resourceSpans := payload.GetResourceSpans()[0]
+			So(resourceSpans.GetResource().GetAttributes()[0].GetValue().GetStringValue(), ShouldEqual, "ledger-api-test")
+			spans := resourceSpans.GetScopeSpans()[0].GetSpans()
+			So(spans, ShouldHaveLength, 2)
+			So(spans[0].GetName(), ShouldEqual, "child")
+			So(spans[0].GetParentSpanId(), ShouldResemble, spans[1].GetSpanId())
+		})
+	})
+}
@@ -0,0 +1,97 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	gormParentKey = "tracing:parent"
+	gormSpanKey   = "tracing:span"
+)
+
+// DB returns db that traces its queries as children of the span in ctx.
+// gorm does not support context so it has to be attached explicitly
+func DB(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return db
+	}
+	return db.Set(gormParentKey, ctx)
+}
+
+// Exec runs the statement and traces it as a child of the span attached to db via DB.
+// gorm does not run callbacks for statements that run with Exec so they are traced here
+func Exec(db *gorm.DB, sql string, values ...interface{}) *gorm.DB {
+	_, span, ok := startDBSpan(db, "exec")
+	if !ok {
+		return db.Exec(sql, values...)
+	}
+	defer span.End()
+	result := db.Exec(sql, values...)
+	span.SetAttributes(attribute.String("db.statement", sql))
+	SetError(span, result.Error)
+	return result
+}
+
+// RegisterGormCallbacks registers callbacks that trace create, query, update, delete
+// and row queries of the db. Queries of db without a span attached via DB are not traced
+func RegisterGormCallbacks(db *gorm.DB) {
+	callbacks := db.Callback()
+	callbacks.Create().Before("gorm:create").Register("tracing:before_create", startGormSpan("create"))
+	callbacks.Create().After("gorm:create").Register("tracing:after_create", endGormSpan)
+	callbacks.Query().Before("gorm:query").Register("tracing:before_query", startGormSpan("query"))
+	callbacks.Query().After("gorm:query").Register("tracing:after_query", endGormSpan)
+	callbacks.Update().Before("gorm:update").Register("tracing:before_update", startGormSpan("update"))
+	callbacks.Update().After("gorm:update").Register("tracing:after_update", endGormSpan)
+	callbacks.Delete().Before("gorm:delete").Register("tracing:before_delete", startGormSpan("delete"))
+	callbacks.Delete().After("gorm:delete").Register("tracing:after_delete", endGormSpan)
+	callbacks.RowQuery().Before("gorm:row_query").Register("tracing:before_row_query", startGormSpan("row_query"))
+	callbacks.RowQuery().After("gorm:row_query").Register("tracing:after_row_query", endGormSpan)
+}
+
+// startDBSpan starts a client span of the db operation if db has a span attached
+func startDBSpan(db *gorm.DB, operation string) (context.Context, trace.Span, bool) {
+	value, ok := db.Get(gormParentKey)
+	if !ok {
+		return nil, nil, false
+	}
+	parent, ok := value.(context.Context)
+	if !ok {
+		return nil, nil, false
+	}
+	ctx, span := StartSpan(parent, "gorm "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", operation),
+		),
+	)
+	return ctx, span, true
+}
+
+func startGormSpan(operation string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		if _, span, ok := startDBSpan(scope.DB(), operation); ok {
+			scope.InstanceSet(gormSpanKey, span)
+		}
+	}
+}
+
+func endGormSpan(scope *gorm.Scope) {
+	value, ok := scope.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	span.SetAttributes(attribute.String("db.statement", scope.SQL))
+	if table := scope.TableName(); table != "" {
+		span.SetAttributes(attribute.String("db.sql.table", table))
+	}
+	if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		SetError(span, err)
+	}
+	span.End()
+}
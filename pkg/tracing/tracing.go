@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is a name of the instrumentation scope spans are reported with
+const instrumentationName = "ledger.api"
+
+// Tracer - starts spans and passes ended ones to the exporter in batches
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// CreateTracer creates a tracer of given service. Spans are still created and propagated
+// if exporter is nil so trace ids are available in logs but spans are not exported.
+// Spans of traces that are not sampled by the remote parent are not exported
+func CreateTracer(serviceName string, exporter sdktrace.SpanExporter) *Tracer {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	provider := sdktrace.NewTracerProvider(opts...)
+	return &Tracer{provider: provider, tracer: provider.Tracer(instrumentationName)}
+}
+
+// StartSpan starts a span that is a child of the span or remote parent found in ctx.
+// A new trace is started if there's no parent
+func (tracer *Tracer) StartSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracer.tracer.Start(ctx, name, opts...)
+}
+
+// ForceFlush exports ended spans that are still pending in the batch
+func (tracer *Tracer) ForceFlush() error {
+	return tracer.provider.ForceFlush(context.Background())
+}
+
+// Shutdown flushes and stops the exporter
+func (tracer *Tracer) Shutdown() error {
+	return tracer.provider.Shutdown(context.Background())
+}
+
+// StartSpan starts a child span using a tracer of the current span.
+// Returns a non recording span (that is safe to use) if ctx is not traced
+func StartSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// SetError marks the span as failed
+func SetError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
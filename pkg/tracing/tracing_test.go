@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func remoteParent(flags trace.TraceFlags) trace.SpanContext {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: flags,
+		Remote:     true,
+	})
+}
+
+func TestTracer(t *testing.T) {
+	Convey("Given a tracer", t, func() {
+		exporter := tracetest.NewInMemoryExporter()
+		tracer := CreateTracer("ledger-api-test", exporter)
+		exportedSpans := func() tracetest.SpanStubs {
+			So(tracer.ForceFlush(), ShouldBeNil)
+			return exporter.GetSpans()
+		}
+
+		Convey("It should start a new trace without parent", func() {
+			_, span := tracer.StartSpan(context.Background(), "root")
+			span.SetAttributes(attribute.String("key", "value"))
+			span.End()
+
+			spans := exportedSpans()
+			So(spans, ShouldHaveLength, 1)
+			So(spans[0].Name, ShouldEqual, "root")
+			So(spans[0].SpanContext.TraceID().IsValid(), ShouldBeTrue)
+			So(spans[0].Parent.IsValid(), ShouldBeFalse)
+			So(spans[0].Attributes, ShouldResemble, []attribute.KeyValue{attribute.String("key", "value")})
+			So(spans[0].Resource.Attributes(), ShouldContain, attribute.String("service.name", "ledger-api-test"))
+		})
+
+		Convey("It should start child spans within the trace", func() {
+			ctx, root := tracer.StartSpan(context.Background(), "root")
+			_, child := StartSpan(ctx, "child")
+			SetError(child, errors.New("failed"))
+			child.End()
+			root.End()
+
+			spans := exportedSpans()
+			So(spans, ShouldHaveLength, 2)
+			So(spans[0].SpanContext.TraceID(), ShouldEqual, root.SpanContext().TraceID())
+			So(spans[0].Parent.SpanID(), ShouldEqual, root.SpanContext().SpanID())
+			So(spans[0].Status.Code, ShouldEqual, codes.Error)
+			So(spans[0].Status.Description, ShouldEqual, "failed")
+		})
+
+		Convey("It should continue remote trace", func() {
+			parent := remoteParent(trace.FlagsSampled)
+			_, span := tracer.StartSpan(trace.ContextWithRemoteSpanContext(context.Background(), parent), "server")
+			span.End()
+			So(span.SpanContext().TraceID(), ShouldEqual, parent.TraceID())
+			So(exportedSpans()[0].Parent.SpanID(), ShouldEqual, parent.SpanID())
+		})
+
+		Convey("It should not export spans of not sampled traces", func() {
+			parent := remoteParent(0)
+			ctx, span := tracer.StartSpan(trace.ContextWithRemoteSpanContext(context.Background(), parent), "server")
+			_, child := StartSpan(ctx, "child")
+			child.End()
+			span.End()
+			So(exportedSpans(), ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			tracer.Shutdown()
+		})
+	})
+
+	Convey("It should not trace context without tracer", t, func() {
+		ctx, span := StartSpan(context.Background(), "orphan")
+		So(span.IsRecording(), ShouldBeFalse)
+		So(trace.SpanFromContext(ctx).SpanContext().IsValid(), ShouldBeFalse)
+		span.SetAttributes(attribute.String("key", "value"))
+		span.End()
+	})
+}
@@ -0,0 +1,481 @@
+package transactions
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+	"ledger.api/pkg/eventstore"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
+	"ledger.api/pkg/users"
+)
+
+var (
+	errAccountNotFound         = errors.New("Account not found")
+	errTransactionNotFound     = errors.New("Transaction not found")
+	errTransactionExists       = errors.New("Transaction already exists")
+	errAccountChangeNotAllowed = errors.New("Moving transaction to other account is not supported")
+	errTypeChangeNotAllowed    = errors.New("Changing transaction type is not supported")
+)
+
+// Events below are emitted by v1 account aggregate. Stream id is an account id.
+
+type transactionReported struct {
+	AggregateID   string    `json:"aggregate_id"`
+	TransactionID string    `json:"transaction_id"`
+	TypeID        int       `json:"type_id"`
+	Amount        int       `json:"amount"`
+	Date          time.Time `json:"date"`
+	TagIDs        []int     `json:"tag_ids"`
+	Comment       string    `json:"comment"`
+}
+
+func (transactionReported) EventType() string { return "Domain::Events::TransactionReported" }
+
+type transactionAmountAdjusted struct {
+	AggregateID   string `json:"aggregate_id"`
+	TransactionID string `json:"transaction_id"`
+	Amount        int    `json:"amount"`
+}
+
+func (transactionAmountAdjusted) EventType() string {
+	return "Domain::Events::TransactionAmountAdjusted"
+}
+
+type transactionCommentAdjusted struct {
+	AggregateID   string `json:"aggregate_id"`
+	TransactionID string `json:"transaction_id"`
+	Comment       string `json:"comment"`
+}
+
+func (transactionCommentAdjusted) EventType() string {
+	return "Domain::Events::TransactionCommentAdjusted"
+}
+
+type transactionDateAdjusted struct {
+	AggregateID   string    `json:"aggregate_id"`
+	TransactionID string    `json:"transaction_id"`
+	Date          time.Time `json:"date"`
+}
+
+func (transactionDateAdjusted) EventType() string { return "Domain::Events::TransactionDateAdjusted" }
+
+type transactionTagged struct {
+	AggregateID   string `json:"aggregate_id"`
+	TransactionID string `json:"transaction_id"`
+	TagID         int    `json:"tag_id"`
+}
+
+func (transactionTagged) EventType() string { return "Domain::Events::TransactionTagged" }
+
+type transactionUntagged struct {
+	AggregateID   string `json:"aggregate_id"`
+	TransactionID string `json:"transaction_id"`
+	TagID         int    `json:"tag_id"`
+}
+
+func (transactionUntagged) EventType() string { return "Domain::Events::TransactionUntagged" }
+
+type transactionRemoved struct {
+	AggregateID   string `json:"aggregate_id"`
+	TransactionID string `json:"transaction_id"`
+}
+
+func (transactionRemoved) EventType() string { return "Domain::Events::TransactionRemoved" }
+
+type accountBalanceChanged struct {
+	AggregateID   string `json:"aggregate_id"`
+	TransactionID string `json:"transaction_id"`
+	Balance       int    `json:"balance"`
+}
+
+func (accountBalanceChanged) EventType() string { return "Domain::Events::AccountBalanceChanged" }
+
+type accountRef struct {
+	ID string `jsonapi:"primary,accounts" validate:"required"`
+}
+
+type tagRef struct {
+	ID int `jsonapi:"primary,tags" validate:"required"`
+}
+
+// transactionPayload is a JSON API representation of the transaction
+// submitted by clients to report or adjust transactions
+type transactionPayload struct {
+	ID      string      `jsonapi:"primary,transactions" validate:"omitempty,uuid"`
+	Type    string      `jsonapi:"attr,type" validate:"required,oneof=income expense refund"`
+	Amount  int         `jsonapi:"attr,amount" validate:"gt=0"`
+	Comment string      `jsonapi:"attr,comment" validate:"max=1000"`
+	Date    time.Time   `jsonapi:"attr,date,iso8601" validate:"required"`
+	Account *accountRef `jsonapi:"relation,account" validate:"required"`
+	Tags    []*tagRef   `jsonapi:"relation,tags" validate:"dive,required"`
+}
+
+func (payload *transactionPayload) tagIDs() []int {
+	result := make([]int, len(payload.Tags))
+	for i, tag := range payload.Tags {
+		result[i] = tag.ID
+	}
+	return result
+}
+
+type reportTransactionCommand struct {
+	ledgerID string
+	user     *users.User
+	payload  *transactionPayload
+}
+
+type adjustTransactionCommand struct {
+	ledgerID      string
+	transactionID string
+	user          *users.User
+	payload       *transactionPayload
+}
+
+type removeTransactionCommand struct {
+	ledgerID      string
+	transactionID string
+	user          *users.User
+}
+
+// CommandService is a service to process commands that change transactions
+type CommandService interface {
+	processReportTransactionCommand(ctx context.Context, cmd *reportTransactionCommand) (string, error)
+	processAdjustTransactionCommand(ctx context.Context, cmd *adjustTransactionCommand) error
+	processRemoveTransactionCommand(ctx context.Context, cmd *removeTransactionCommand) error
+}
+
+type dbCommandService struct {
+	db    *gorm.DB
+	store eventstore.Store
+}
+
+// balanceDelta returns how given transaction changes account balance
+func balanceDelta(typeID int, amount int) int {
+	if typeID == TypeIDByName["expense"] {
+		return -amount
+	}
+	return amount
+}
+
+func commandHeaders(user *users.User) eventstore.Headers {
+	return eventstore.Headers{"user_id": user.ID}
+}
+
+// transactionKey is a key claimed by the report so transaction ids are unique across accounts
+func transactionKey(transactionID string) string {
+	return "transaction:" + transactionID
+}
+
+// checkAccountAccess checks that the account belongs to the ledger. Accounts the user
+// is not authorized on are not found
+func (svc *dbCommandService) checkAccountAccess(ctx context.Context, ledgerID string, accountID string, user *users.User) error {
+	var count int
+	if err := users.WithAccessibleAccounts(tracing.DB(ctx, svc.db).Table("projections_accounts acc"), user).
+		Where("acc.ledger_id = ? AND acc.aggregate_id = ?", ledgerID, accountID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errAccountNotFound
+	}
+	return nil
+}
+
+// findTransactionAccount returns an id of the account the transaction belongs to.
+// Transactions of accounts the user is not authorized on are not found
+func (svc *dbCommandService) findTransactionAccount(ctx context.Context, ledgerID string, transactionID string, user *users.User) (string, error) {
+	var accountID string
+	err := users.WithAccessibleAccounts(tracing.DB(ctx, svc.db).Table("projections_transactions trx"), user).
+		Select("trx.account_id").
+		Joins("JOIN projections_accounts acc ON acc.aggregate_id = trx.account_id").
+		Where("acc.ledger_id = ? AND trx.transaction_id = ?", ledgerID, transactionID).
+		Row().Scan(&accountID)
+	if err == sql.ErrNoRows {
+		return "", errTransactionNotFound
+	}
+	return accountID, err
+}
+
+// loadAccountBalance returns balance of the account as of the last commit of its stream
+func loadAccountBalance(tx eventstore.Tx, accountID string) (int, error) {
+	evt, err := tx.LastEvent(accountID, accountBalanceChanged{}.EventType())
+	if err != nil || evt == nil {
+		return 0, err
+	}
+	var balanceChanged accountBalanceChanged
+	if err := evt.Decode(&balanceChanged); err != nil {
+		return 0, err
+	}
+	return balanceChanged.Balance, nil
+}
+
+type existingTransaction struct {
+	typeID  int
+	amount  int
+	tagIDs  []int
+	comment string
+	date    time.Time
+}
+
+// transactionEventData includes fields of all events the transaction state is built from
+type transactionEventData struct {
+	TransactionID string    `json:"transaction_id"`
+	TypeID        int       `json:"type_id"`
+	Amount        int       `json:"amount"`
+	Date          time.Time `json:"date"`
+	TagIDs        []int     `json:"tag_ids"`
+	TagID         int       `json:"tag_id"`
+	Comment       string    `json:"comment"`
+}
+
+// loadTransaction builds the transaction state from events of the account stream
+func loadTransaction(tx eventstore.Tx, accountID string, transactionID string) (*existingTransaction, error) {
+	events, err := tx.ReadEvents(accountID, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	var trx *existingTransaction
+	for _, evt := range events {
+		var data transactionEventData
+		if err := evt.Decode(&data); err != nil {
+			return nil, err
+		}
+		if data.TransactionID != transactionID {
+			continue
+		}
+		switch evt.Type {
+		case "Domain::Events::TransactionReported":
+			trx = &existingTransaction{typeID: data.TypeID, amount: data.Amount, tagIDs: data.TagIDs, comment: data.Comment, date: data.Date}
+		case "Domain::Events::TransferSent":
+			trx = &existingTransaction{typeID: TypeIDByName["expense"], amount: data.Amount, tagIDs: data.TagIDs, comment: data.Comment, date: data.Date}
+		case "Domain::Events::TransferReceived":
+			trx = &existingTransaction{typeID: TypeIDByName["income"], amount: data.Amount, tagIDs: data.TagIDs, comment: data.Comment, date: data.Date}
+		case "Domain::Events::TransactionRemoved":
+			trx = nil
+		}
+		if trx == nil {
+			continue
+		}
+		switch evt.Type {
+		case "Domain::Events::TransactionAmountAdjusted":
+			trx.amount = data.Amount
+		case "Domain::Events::TransactionCommentAdjusted":
+			trx.comment = data.Comment
+		case "Domain::Events::TransactionDateAdjusted":
+			trx.date = data.Date
+		case "Domain::Events::TransactionTagged":
+			trx.tagIDs = append(trx.tagIDs, data.TagID)
+		case "Domain::Events::TransactionUntagged":
+			tagIDs := []int{}
+			for _, tagID := range trx.tagIDs {
+				if tagID != data.TagID {
+					tagIDs = append(tagIDs, tagID)
+				}
+			}
+			trx.tagIDs = tagIDs
+		}
+	}
+	if trx == nil {
+		return nil, errTransactionNotFound
+	}
+	return trx, nil
+}
+
+func (svc *dbCommandService) processReportTransactionCommand(ctx context.Context, cmd *reportTransactionCommand) (string, error) {
+	if cmd.ledgerID == "" {
+		return "", errors.New("Please provide ledgerID")
+	}
+	if cmd.user == nil {
+		return "", errors.New("Please provide user")
+	}
+	payload := cmd.payload
+	logger := logging.FromContext(ctx)
+
+	transactionID := payload.ID
+	if transactionID == "" {
+		transactionID = uuid.NewV4().String()
+	} else {
+		// Transactions reported by v1 app have no keys claimed so ids are also checked in projections
+		var count int
+		if err := tracing.DB(ctx, svc.db).Table("projections_transactions").
+			Where("transaction_id = ?", transactionID).
+			Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count > 0 {
+			return "", errTransactionExists
+		}
+	}
+
+	accountID := payload.Account.ID
+	if err := svc.checkAccountAccess(ctx, cmd.ledgerID, accountID, cmd.user); err != nil {
+		return "", err
+	}
+
+	typeID := TypeIDByName[payload.Type]
+	logger.Debugf("Reporting transaction %v. Account: %v, type: %v", transactionID, accountID, payload.Type)
+	if err := svc.store.Transaction(ctx, commandHeaders(cmd.user), func(tx eventstore.Tx) error {
+		if err := tx.ClaimKey(accountID, transactionKey(transactionID)); err != nil {
+			if err == eventstore.ErrKeyClaimed {
+				return errTransactionExists
+			}
+			return err
+		}
+		balance, err := loadAccountBalance(tx, accountID)
+		if err != nil {
+			return err
+		}
+		return tx.Append(accountID,
+			&transactionReported{
+				AggregateID:   accountID,
+				TransactionID: transactionID,
+				TypeID:        typeID,
+				Amount:        payload.Amount,
+				Date:          payload.Date,
+				TagIDs:        payload.tagIDs(),
+				Comment:       payload.Comment,
+			},
+			&accountBalanceChanged{
+				AggregateID:   accountID,
+				TransactionID: transactionID,
+				Balance:       balance + balanceDelta(typeID, payload.Amount),
+			},
+		)
+	}); err != nil {
+		return "", err
+	}
+	return transactionID, nil
+}
+
+func (svc *dbCommandService) processAdjustTransactionCommand(ctx context.Context, cmd *adjustTransactionCommand) error {
+	if cmd.ledgerID == "" {
+		return errors.New("Please provide ledgerID")
+	}
+	if cmd.transactionID == "" {
+		return errors.New("Please provide transactionID")
+	}
+	if cmd.user == nil {
+		return errors.New("Please provide user")
+	}
+	payload := cmd.payload
+	logger := logging.FromContext(ctx)
+
+	accountID, err := svc.findTransactionAccount(ctx, cmd.ledgerID, cmd.transactionID, cmd.user)
+	if err != nil {
+		return err
+	}
+	if payload.Account.ID != accountID {
+		return errAccountChangeNotAllowed
+	}
+
+	return svc.store.Transaction(ctx, commandHeaders(cmd.user), func(tx eventstore.Tx) error {
+		trx, err := loadTransaction(tx, accountID, cmd.transactionID)
+		if err != nil {
+			return err
+		}
+		if TypeIDByName[payload.Type] != trx.typeID {
+			return errTypeChangeNotAllowed
+		}
+
+		events := []eventstore.Event{}
+		if payload.Amount != trx.amount {
+			balance, err := loadAccountBalance(tx, accountID)
+			if err != nil {
+				return err
+			}
+			events = append(events,
+				&transactionAmountAdjusted{AggregateID: accountID, TransactionID: cmd.transactionID, Amount: payload.Amount},
+				&accountBalanceChanged{
+					AggregateID:   accountID,
+					TransactionID: cmd.transactionID,
+					Balance:       balance - balanceDelta(trx.typeID, trx.amount) + balanceDelta(trx.typeID, payload.Amount),
+				},
+			)
+		}
+		if payload.Comment != trx.comment {
+			events = append(events,
+				&transactionCommentAdjusted{AggregateID: accountID, TransactionID: cmd.transactionID, Comment: payload.Comment},
+			)
+		}
+		if !payload.Date.Equal(trx.date) {
+			events = append(events,
+				&transactionDateAdjusted{AggregateID: accountID, TransactionID: cmd.transactionID, Date: payload.Date},
+			)
+		}
+
+		existingTags := make(map[int]bool)
+		for _, tagID := range trx.tagIDs {
+			existingTags[tagID] = true
+		}
+		newTags := make(map[int]bool)
+		for _, tagID := range payload.tagIDs() {
+			newTags[tagID] = true
+			if !existingTags[tagID] {
+				events = append(events, &transactionTagged{AggregateID: accountID, TransactionID: cmd.transactionID, TagID: tagID})
+			}
+		}
+		for _, tagID := range trx.tagIDs {
+			if !newTags[tagID] {
+				events = append(events, &transactionUntagged{AggregateID: accountID, TransactionID: cmd.transactionID, TagID: tagID})
+			}
+		}
+
+		if len(events) == 0 {
+			logger.Debugf("Transaction %v has not been changed", cmd.transactionID)
+			return nil
+		}
+
+		logger.Debugf("Adjusting transaction %v. Events: %v", cmd.transactionID, len(events))
+		return tx.Append(accountID, events...)
+	})
+}
+
+func (svc *dbCommandService) processRemoveTransactionCommand(ctx context.Context, cmd *removeTransactionCommand) error {
+	if cmd.ledgerID == "" {
+		return errors.New("Please provide ledgerID")
+	}
+	if cmd.transactionID == "" {
+		return errors.New("Please provide transactionID")
+	}
+	if cmd.user == nil {
+		return errors.New("Please provide user")
+	}
+	logger := logging.FromContext(ctx)
+
+	accountID, err := svc.findTransactionAccount(ctx, cmd.ledgerID, cmd.transactionID, cmd.user)
+	if err != nil {
+		return err
+	}
+
+	return svc.store.Transaction(ctx, commandHeaders(cmd.user), func(tx eventstore.Tx) error {
+		trx, err := loadTransaction(tx, accountID, cmd.transactionID)
+		if err != nil {
+			return err
+		}
+		balance, err := loadAccountBalance(tx, accountID)
+		if err != nil {
+			return err
+		}
+
+		logger.Debugf("Removing transaction %v", cmd.transactionID)
+		return tx.Append(accountID,
+			&transactionRemoved{AggregateID: accountID, TransactionID: cmd.transactionID},
+			&accountBalanceChanged{
+				AggregateID:   accountID,
+				TransactionID: cmd.transactionID,
+				Balance:       balance - balanceDelta(trx.typeID, trx.amount),
+			},
+		)
+	})
+}
+
+// CreateCommandService initializes a new instance of the command service
+func CreateCommandService(db *gorm.DB, store eventstore.Store) CommandService {
+	svc := dbCommandService{db: db, store: store}
+	return &svc
+}
@@ -0,0 +1,290 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/icrowley/fake"
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/eventstore"
+	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tags"
+)
+
+func TestTransactionCommands(t *testing.T) {
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given transaction commands", t, func() {
+		store := ldtesting.NewEventStore(DB)
+		svc := CreateCommandService(DB, store)
+		user := ldtesting.NewUser()
+		md, err := ldtesting.SetupLedgerData(DB, user)
+		So(err, ShouldBeNil)
+		accountID := md.AccountIDs[0]
+
+		Convey("When reporting transaction", func() {
+			payload := &transactionPayload{
+				Type:    "expense",
+				Amount:  1000 + rnd.Intn(10000),
+				Comment: fake.Sentence(),
+				Date:    time.Now().UTC(),
+				Account: &accountRef{ID: accountID},
+				Tags:    []*tagRef{{ID: md.TagIDs[0]}, {ID: md.TagIDs[1]}},
+			}
+
+			Convey("It should append reported and balance changed events", func() {
+				transactionID, err := svc.processReportTransactionCommand(ctx, &reportTransactionCommand{
+					ledgerID: md.LedgerID,
+					user:     user,
+					payload:  payload,
+				})
+				So(err, ShouldBeNil)
+				So(transactionID, ShouldNotBeEmpty)
+				So(store.Commits, ShouldHaveLength, 1)
+				So(store.Commits[0].StreamID, ShouldEqual, accountID)
+				So(store.Commits[0].Headers, ShouldResemble, eventstore.Headers{"user_id": user.ID})
+				So(store.Commits[0].Events, ShouldResemble, []eventstore.Event{
+					&transactionReported{
+						AggregateID:   accountID,
+						TransactionID: transactionID,
+						TypeID:        TypeIDByName["expense"],
+						Amount:        payload.Amount,
+						Date:          payload.Date,
+						TagIDs:        []int{md.TagIDs[0], md.TagIDs[1]},
+						Comment:       payload.Comment,
+					},
+					&accountBalanceChanged{
+						AggregateID:   accountID,
+						TransactionID: transactionID,
+						Balance:       -payload.Amount,
+					},
+				})
+			})
+
+			Convey("It should calculate balance from the account stream", func() {
+				store.Seed(accountID, &accountBalanceChanged{AggregateID: accountID, Balance: 500})
+				transactionID, err := svc.processReportTransactionCommand(ctx, &reportTransactionCommand{
+					ledgerID: md.LedgerID,
+					user:     user,
+					payload:  payload,
+				})
+				So(err, ShouldBeNil)
+				So(store.Commits, ShouldHaveLength, 1)
+				So(store.Commits[0].Events[1], ShouldResemble, &accountBalanceChanged{
+					AggregateID:   accountID,
+					TransactionID: transactionID,
+					Balance:       500 - payload.Amount,
+				})
+			})
+
+			Convey("It should use client provided id", func() {
+				payload.ID = uuid.NewV4().String()
+				transactionID, err := svc.processReportTransactionCommand(ctx, &reportTransactionCommand{
+					ledgerID: md.LedgerID,
+					user:     user,
+					payload:  payload,
+				})
+				So(err, ShouldBeNil)
+				So(transactionID, ShouldEqual, payload.ID)
+			})
+
+			Convey("It should fail if transaction already exists", func() {
+				trx := ldtesting.NewTransaction(ldtesting.TrxRndTag(md.TagIDs), ldtesting.TrxRndAcc(md.AccountIDs))
+				So(ldtesting.SetupTransactions(DB, []ldtesting.Transaction{*trx}), ShouldBeNil)
+				payload.ID = trx.TransactionID
+				_, err := svc.processReportTransactionCommand(ctx, &reportTransactionCommand{
+					ledgerID: md.LedgerID,
+					user:     user,
+					payload:  payload,
+				})
+				So(err, ShouldEqual, errTransactionExists)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should fail if transaction id has been claimed by other ledger", func() {
+				payload.ID = uuid.NewV4().String()
+				store.SeedKey(transactionKey(payload.ID))
+				_, err := svc.processReportTransactionCommand(ctx, &reportTransactionCommand{
+					ledgerID: md.LedgerID,
+					user:     user,
+					payload:  payload,
+				})
+				So(err, ShouldEqual, errTransactionExists)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should fail if account belongs to other ledger", func() {
+				otherMd, err := ldtesting.SetupLedgerData(DB, user)
+				So(err, ShouldBeNil)
+				payload.Account.ID = otherMd.AccountIDs[0]
+				_, err = svc.processReportTransactionCommand(ctx, &reportTransactionCommand{
+					ledgerID: md.LedgerID,
+					user:     user,
+					payload:  payload,
+				})
+				So(err, ShouldEqual, errAccountNotFound)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should fail if user is not authorized on the account", func() {
+				hiddenAcc, err := ldtesting.SetupAccount(DB, md.LedgerID)
+				So(err, ShouldBeNil)
+				payload.Account.ID = hiddenAcc.AccountID
+				_, err = svc.processReportTransactionCommand(ctx, &reportTransactionCommand{
+					ledgerID: md.LedgerID,
+					user:     user,
+					payload:  payload,
+				})
+				So(err, ShouldEqual, errAccountNotFound)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should return error if no ledger provided", func() {
+				_, err := svc.processReportTransactionCommand(ctx, &reportTransactionCommand{user: user, payload: payload})
+				So(err, ShouldResemble, errors.New("Please provide ledgerID"))
+			})
+		})
+
+		Convey("When transaction exists", func() {
+			trx := ldtesting.NewTransaction(
+				ldtesting.TrxRndTag(md.TagIDs),
+				ldtesting.TrxRndAcc([]string{accountID}),
+				ldtesting.TrxDate(time.Date(2019, 1, 2, 10, 0, 0, 0, time.UTC)),
+			)
+			So(ldtesting.SetupTransactions(DB, []ldtesting.Transaction{*trx}), ShouldBeNil)
+			store.Seed(accountID,
+				&transactionReported{
+					AggregateID:   accountID,
+					TransactionID: trx.TransactionID,
+					TypeID:        trx.TypeID(),
+					Amount:        trx.Amount,
+					Date:          trx.Date,
+					TagIDs:        tags.GetTagIDsFromString(trx.TagIDs),
+				},
+				&accountBalanceChanged{AggregateID: accountID, TransactionID: trx.TransactionID, Balance: -trx.Amount},
+			)
+			existingTagID := tags.GetTagIDsFromString(trx.TagIDs)[0]
+			newTagID := md.TagIDs[0]
+			if newTagID == existingTagID {
+				newTagID = md.TagIDs[1]
+			}
+
+			Convey("It should append only changed attributes on adjust", func() {
+				newDate := trx.Date.AddDate(0, 0, 1)
+				payload := &transactionPayload{
+					Type:    "expense",
+					Amount:  trx.Amount + 100,
+					Comment: fake.Sentence(),
+					Date:    newDate,
+					Account: &accountRef{ID: accountID},
+					Tags:    []*tagRef{{ID: newTagID}},
+				}
+				err := svc.processAdjustTransactionCommand(ctx, &adjustTransactionCommand{
+					ledgerID:      md.LedgerID,
+					transactionID: trx.TransactionID,
+					user:          user,
+					payload:       payload,
+				})
+				So(err, ShouldBeNil)
+				So(store.Commits, ShouldHaveLength, 1)
+				So(store.Commits[0].StreamID, ShouldEqual, accountID)
+				So(store.Commits[0].Events, ShouldResemble, []eventstore.Event{
+					&transactionAmountAdjusted{AggregateID: accountID, TransactionID: trx.TransactionID, Amount: payload.Amount},
+					&accountBalanceChanged{AggregateID: accountID, TransactionID: trx.TransactionID, Balance: -trx.Amount - 100},
+					&transactionCommentAdjusted{AggregateID: accountID, TransactionID: trx.TransactionID, Comment: payload.Comment},
+					&transactionDateAdjusted{AggregateID: accountID, TransactionID: trx.TransactionID, Date: newDate},
+					&transactionTagged{AggregateID: accountID, TransactionID: trx.TransactionID, TagID: newTagID},
+					&transactionUntagged{AggregateID: accountID, TransactionID: trx.TransactionID, TagID: existingTagID},
+				})
+			})
+
+			Convey("It should adjust the state built from the account stream", func() {
+				store.Seed(accountID,
+					&transactionAmountAdjusted{AggregateID: accountID, TransactionID: trx.TransactionID, Amount: trx.Amount + 100},
+					&accountBalanceChanged{AggregateID: accountID, TransactionID: trx.TransactionID, Balance: -trx.Amount - 100},
+				)
+				err := svc.processRemoveTransactionCommand(ctx, &removeTransactionCommand{
+					ledgerID:      md.LedgerID,
+					transactionID: trx.TransactionID,
+					user:          user,
+				})
+				So(err, ShouldBeNil)
+				So(store.Commits, ShouldHaveLength, 1)
+				So(store.Commits[0].Events[1], ShouldResemble,
+					&accountBalanceChanged{AggregateID: accountID, TransactionID: trx.TransactionID, Balance: 0},
+				)
+			})
+
+			Convey("It should return not found if transaction has been removed", func() {
+				store.Seed(accountID, &transactionRemoved{AggregateID: accountID, TransactionID: trx.TransactionID})
+				err := svc.processRemoveTransactionCommand(ctx, &removeTransactionCommand{
+					ledgerID:      md.LedgerID,
+					transactionID: trx.TransactionID,
+					user:          user,
+				})
+				So(err, ShouldEqual, errTransactionNotFound)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should not allow moving transaction to other account on adjust", func() {
+				err := svc.processAdjustTransactionCommand(ctx, &adjustTransactionCommand{
+					ledgerID:      md.LedgerID,
+					transactionID: trx.TransactionID,
+					user:          user,
+					payload: &transactionPayload{
+						Type:    "expense",
+						Amount:  trx.Amount,
+						Date:    trx.Date,
+						Account: &accountRef{ID: md.AccountIDs[1]},
+					},
+				})
+				So(err, ShouldEqual, errAccountChangeNotAllowed)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should append removed and balance changed events on remove", func() {
+				err := svc.processRemoveTransactionCommand(ctx, &removeTransactionCommand{
+					ledgerID:      md.LedgerID,
+					transactionID: trx.TransactionID,
+					user:          user,
+				})
+				So(err, ShouldBeNil)
+				So(store.Commits, ShouldHaveLength, 1)
+				So(store.Commits[0].Events, ShouldResemble, []eventstore.Event{
+					&transactionRemoved{AggregateID: accountID, TransactionID: trx.TransactionID},
+					&accountBalanceChanged{AggregateID: accountID, TransactionID: trx.TransactionID, Balance: 0},
+				})
+			})
+
+			Convey("It should return not found if transaction is from other ledger", func() {
+				otherMd, err := ldtesting.SetupLedgerData(DB, user)
+				So(err, ShouldBeNil)
+				err = svc.processRemoveTransactionCommand(ctx, &removeTransactionCommand{
+					ledgerID:      otherMd.LedgerID,
+					transactionID: trx.TransactionID,
+					user:          user,
+				})
+				So(err, ShouldEqual, errTransactionNotFound)
+				So(store.Commits, ShouldBeEmpty)
+			})
+
+			Convey("It should return not found if user is not authorized on the account", func() {
+				hiddenAcc, err := ldtesting.SetupAccount(DB, md.LedgerID)
+				So(err, ShouldBeNil)
+				hiddenTrx := ldtesting.NewTransaction(ldtesting.TrxRndTag(md.TagIDs), ldtesting.TrxRndAcc([]string{hiddenAcc.AccountID}))
+				So(ldtesting.SetupTransactions(DB, []ldtesting.Transaction{*hiddenTrx}), ShouldBeNil)
+				err = svc.processRemoveTransactionCommand(ctx, &removeTransactionCommand{
+					ledgerID:      md.LedgerID,
+					transactionID: hiddenTrx.TransactionID,
+					user:          user,
+				})
+				So(err, ShouldEqual, errTransactionNotFound)
+				So(store.Commits, ShouldBeEmpty)
+			})
+		})
+	})
+}
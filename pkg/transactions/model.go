@@ -2,10 +2,19 @@ package transactions
 
 import (
 	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
 	"time"
 
 	"ledger.api/pkg/logging"
+	"ledger.api/pkg/rates"
+	"ledger.api/pkg/tags"
+	"ledger.api/pkg/tracing"
+	"ledger.api/pkg/users"
 
 	"github.com/jinzhu/gorm"
 )
@@ -25,10 +34,14 @@ type summaryDTO struct {
 
 type summaryQuery struct {
 	ledgerID      string
+	user          *users.User
 	typ           string
 	from          *time.Time
 	to            *time.Time
 	excludeTagIDs []string
+
+	// currency amounts should be converted to. Ledger currency is used if empty
+	currency string
 }
 
 type summaryQueryOpt func(*summaryQuery)
@@ -59,28 +72,131 @@ func newSummaryQuery(ledgerID string, typ string, queryInit ...func(*summaryQuer
 	return query
 }
 
+// Default and max number of transactions returned within a single page
+const (
+	defaultTransactionsLimit = 50
+	maxTransactionsLimit     = 500
+)
+
+type transactionDTO struct {
+	TransactionID string    `json:"transactionID"`
+	AccountID     string    `json:"accountID"`
+	TypeID        int       `json:"typeID"`
+	Amount        int       `json:"amount"`
+	TagIDs        []int     `json:"tagIDs"`
+	Comment       string    `json:"comment"`
+	Date          time.Time `json:"date"`
+	IsTransfer    bool      `json:"isTransfer"`
+}
+
+type transactionsPageDTO struct {
+	Data       []transactionDTO `json:"data"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+	PrevCursor string           `json:"prevCursor,omitempty"`
+}
+
+// transactionsCursor points to a transaction the page should start after
+// (or end before if backward). Transactions are ordered by date and id desc
+type transactionsCursor struct {
+	Date          time.Time `json:"d"`
+	TransactionID string    `json:"id"`
+	Backward      bool      `json:"b,omitempty"`
+}
+
+func (c *transactionsCursor) encode() string {
+	buffer, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer)
+}
+
+func decodeTransactionsCursor(value string) (*transactionsCursor, error) {
+	buffer, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor transactionsCursor
+	if err := json.Unmarshal(buffer, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.TransactionID == "" {
+		return nil, errors.New("Cursor is missing transaction id")
+	}
+	return &cursor, nil
+}
+
+type transactionsQuery struct {
+	ledgerID   string
+	user       *users.User
+	from       *time.Time
+	to         *time.Time
+	accountIDs []string
+	tagIDs     []int
+	typ        string
+	amountFrom *int
+	amountTo   *int
+	isTransfer *bool
+	cursor     *transactionsCursor
+	limit      int
+}
+
+func newTransactionsQuery(ledgerID string, queryInit ...func(*transactionsQuery)) *transactionsQuery {
+	query := &transactionsQuery{
+		ledgerID: ledgerID,
+		limit:    defaultTransactionsLimit,
+	}
+	for _, initFn := range queryInit {
+		initFn(query)
+	}
+	return query
+}
+
 // QueryService is a service to do various gueries against transactions
 type QueryService interface {
 	processSummaryQuery(ctx context.Context, query *summaryQuery) ([]summaryDTO, error)
+	processTransactionsQuery(ctx context.Context, query *transactionsQuery) (*transactionsPageDTO, error)
+	processSeriesQuery(ctx context.Context, query *seriesQuery) (*seriesDTO, error)
 }
 
 type dbQueryService struct {
-	db *gorm.DB
+	db           *gorm.DB
+	rateProvider rates.RateProvider
 }
 
-func (svc *dbQueryService) processSummaryQuery(ctx context.Context, query *summaryQuery) ([]summaryDTO, error) {
-	if query.ledgerID == "" {
-		return nil, errors.New("Please provide ledgerID")
+// errLedgerNotFound - ledger of the query does not exist
+var errLedgerNotFound = errors.New("Ledger not found")
+
+// targetCurrency returns currency of the query or ledger currency if not provided
+func (svc *dbQueryService) targetCurrency(ctx context.Context, query *summaryQuery) (string, error) {
+	if query.currency != "" {
+		return query.currency, nil
 	}
-	if query.typ == "" {
-		return nil, errors.New("Please provide type")
+	var currencyCode string
+	err := tracing.DB(ctx, svc.db).Table("projections_ledgers").
+		Select("currency_code").
+		Where("aggregate_id = ?", query.ledgerID).
+		Row().Scan(&currencyCode)
+	if err == sql.ErrNoRows {
+		return "", errLedgerNotFound
 	}
+	return currencyCode, err
+}
 
-	typeID := TypeIDByName[query.typ]
-	logger := logging.FromContext(ctx)
-	logger.Debugf("Processing summary query. LedgerID: %v, type: %v (%v)", query.ledgerID, query.typ, typeID)
-	result := []summaryDTO{}
+// sortSummary orders summary by amount desc and by tag id if amounts are equal
+func sortSummary(summary []summaryDTO) {
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Amount == summary[j].Amount {
+			return summary[i].TagID < summary[j].TagID
+		}
+		return summary[i].Amount > summary[j].Amount
+	})
+}
 
+// summaryScope returns transactions of the ledger joined with their tags
+// filtered by summary query. Transactions of accounts the user is not authorized on
+// are excluded. Refunds are included so they can be subtracted
+func (svc *dbQueryService) summaryScope(ctx context.Context, query *summaryQuery) *gorm.DB {
 	from := query.from
 	if from == nil {
 		from = &time.Time{}
@@ -91,21 +207,46 @@ func (svc *dbQueryService) processSummaryQuery(ctx context.Context, query *summa
 		to = &now
 	}
 
-	dbQuery := svc.db.Table("projections_transactions trx").
-		Select("tg.tag_id tagID, tg.name tagName, SUM(CASE trx.type_id WHEN 3 THEN -trx.amount ELSE trx.amount END) amount").
+	dbQuery := tracing.DB(ctx, svc.db).Table("projections_transactions trx").
 		Joins("JOIN projections_accounts acc ON acc.aggregate_id = trx.account_id").
 		Joins("JOIN projections_tags tg ON tg.ledger_id = acc.ledger_id AND trx.tag_ids LIKE '%{'||tg.tag_id||'}%'").
 		Where("acc.ledger_id = ?", query.ledgerID).
 		Where("trx.date >= ? AND trx.date <= ?", from, to).
-		Where("trx.type_id = ? or trx.type_id = 3", typeID) // We have to subtract refunds
+		Where("trx.type_id = ? or trx.type_id = 3", TypeIDByName[query.typ]) // We have to subtract refunds
+	dbQuery = users.WithAccessibleAccounts(dbQuery, query.user)
 
 	if query.excludeTagIDs != nil {
 		dbQuery = dbQuery.Where("tg.tag_id NOT IN (?)", query.excludeTagIDs)
 	}
+	return dbQuery
+}
 
-	dbQuery = dbQuery.
-		Group("tg.tag_id, tg.name").
-		Order("amount DESC")
+func (svc *dbQueryService) processSummaryQuery(ctx context.Context, query *summaryQuery) ([]summaryDTO, error) {
+	if query.ledgerID == "" {
+		return nil, errors.New("Please provide ledgerID")
+	}
+	if query.typ == "" {
+		return nil, errors.New("Please provide type")
+	}
+	if query.user == nil {
+		return nil, errors.New("Please provide user")
+	}
+
+	typeID := TypeIDByName[query.typ]
+	logger := logging.FromContext(ctx)
+	logger.Debugf("Processing summary query. LedgerID: %v, type: %v (%v)", query.ledgerID, query.typ, typeID)
+
+	currency, err := svc.targetCurrency(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Amounts are grouped by currency and date so each group can be converted
+	// using exchange rate effective on the transaction date
+	dbQuery := svc.summaryScope(ctx, query).
+		Select(`tg.tag_id tagID, tg.name tagName, acc.currency_code, DATE(trx.date),
+			SUM(CASE trx.type_id WHEN 3 THEN -trx.amount ELSE trx.amount END) amount`).
+		Group("1, 2, 3, 4")
 
 	logger.WithField("query", dbQuery.QueryExpr()).Debugf("Executing transactions summary query")
 
@@ -115,19 +256,175 @@ func (svc *dbQueryService) processSummaryQuery(ctx context.Context, query *summa
 		return nil, err
 	}
 	defer rows.Close()
+
+	converter := rates.NewConverter(svc.rateProvider)
+	result := []summaryDTO{}
+	indexByTagID := make(map[int]int)
 	for rows.Next() {
 		var tagID, amount int
-		var tagName string
-		if err = rows.Scan(&tagID, &tagName, &amount); err != nil {
+		var tagName, currencyCode string
+		var date time.Time
+		if err = rows.Scan(&tagID, &tagName, &currencyCode, &date, &amount); err != nil {
+			return nil, err
+		}
+		if amount, err = converter.Convert(ctx, amount, currencyCode, currency, date); err != nil {
 			return nil, err
 		}
-		result = append(result, summaryDTO{TagID: tagID, TagName: tagName, Amount: amount})
+		index, ok := indexByTagID[tagID]
+		if !ok {
+			index = len(result)
+			indexByTagID[tagID] = index
+			result = append(result, summaryDTO{TagID: tagID, TagName: tagName})
+		}
+		result[index].Amount += amount
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortSummary(result)
 	return result, nil
 }
 
+func (svc *dbQueryService) processTransactionsQuery(ctx context.Context, query *transactionsQuery) (*transactionsPageDTO, error) {
+	if query.ledgerID == "" {
+		return nil, errors.New("Please provide ledgerID")
+	}
+	if query.user == nil {
+		return nil, errors.New("Please provide user")
+	}
+	limit := query.limit
+	if limit <= 0 || limit > maxTransactionsLimit {
+		return nil, fmt.Errorf("Limit should be between 1 and %v", maxTransactionsLimit)
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.Debugf("Processing transactions query. LedgerID: %v", query.ledgerID)
+
+	dbQuery := tracing.DB(ctx, svc.db).Table("projections_transactions trx").
+		Select("trx.transaction_id, trx.account_id, trx.type_id, trx.amount, trx.tag_ids, trx.comment, trx.date, trx.is_transfer").
+		Joins("JOIN projections_accounts acc ON acc.aggregate_id = trx.account_id").
+		Where("acc.ledger_id = ?", query.ledgerID)
+	dbQuery = users.WithAccessibleAccounts(dbQuery, query.user)
+
+	if query.from != nil {
+		dbQuery = dbQuery.Where("trx.date >= ?", query.from)
+	}
+	if query.to != nil {
+		dbQuery = dbQuery.Where("trx.date <= ?", query.to)
+	}
+	if len(query.accountIDs) > 0 {
+		dbQuery = dbQuery.Where("trx.account_id IN (?)", query.accountIDs)
+	}
+	if len(query.tagIDs) > 0 {
+		tagsExpr := ""
+		tagsArgs := make([]interface{}, len(query.tagIDs))
+		for i, tagID := range query.tagIDs {
+			if i > 0 {
+				tagsExpr += " OR "
+			}
+			tagsExpr += "trx.tag_ids LIKE ?"
+			tagsArgs[i] = fmt.Sprintf("%%{%v}%%", tagID)
+		}
+		dbQuery = dbQuery.Where(tagsExpr, tagsArgs...)
+	}
+	if query.typ != "" {
+		typeID, ok := TypeIDByName[query.typ]
+		if !ok {
+			return nil, fmt.Errorf("Unknown type: %v", query.typ)
+		}
+		dbQuery = dbQuery.Where("trx.type_id = ?", typeID)
+	}
+	if query.amountFrom != nil {
+		dbQuery = dbQuery.Where("trx.amount >= ?", *query.amountFrom)
+	}
+	if query.amountTo != nil {
+		dbQuery = dbQuery.Where("trx.amount <= ?", *query.amountTo)
+	}
+	if query.isTransfer != nil {
+		dbQuery = dbQuery.Where("trx.is_transfer = ?", *query.isTransfer)
+	}
+
+	backward := query.cursor != nil && query.cursor.Backward
+	if query.cursor != nil {
+		if backward {
+			dbQuery = dbQuery.Where("(trx.date, trx.transaction_id) > (?, ?)", query.cursor.Date, query.cursor.TransactionID)
+		} else {
+			dbQuery = dbQuery.Where("(trx.date, trx.transaction_id) < (?, ?)", query.cursor.Date, query.cursor.TransactionID)
+		}
+	}
+	if backward {
+		dbQuery = dbQuery.Order("trx.date ASC, trx.transaction_id ASC")
+	} else {
+		dbQuery = dbQuery.Order("trx.date DESC, trx.transaction_id DESC")
+	}
+
+	// Fetching one more to know if there are more transactions to page through
+	dbQuery = dbQuery.Limit(limit + 1)
+
+	logger.WithField("query", dbQuery.QueryExpr()).Debugf("Executing transactions query")
+
+	rows, err := dbQuery.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	data := []transactionDTO{}
+	for rows.Next() {
+		var trx transactionDTO
+		var tagIDs string
+		if err = rows.Scan(
+			&trx.TransactionID,
+			&trx.AccountID,
+			&trx.TypeID,
+			&trx.Amount,
+			&tagIDs,
+			&trx.Comment,
+			&trx.Date,
+			&trx.IsTransfer,
+		); err != nil {
+			return nil, err
+		}
+		trx.TagIDs = tags.GetTagIDsFromString(tagIDs)
+		data = append(data, trx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	hasMore := len(data) > limit
+	if hasMore {
+		data = data[:limit]
+	}
+	if backward {
+		for l, r := 0, len(data)-1; l < r; l, r = l+1, r-1 {
+			data[l], data[r] = data[r], data[l]
+		}
+	}
+
+	page := transactionsPageDTO{Data: data}
+	if len(data) == 0 {
+		return &page, nil
+	}
+	first := data[0]
+	last := data[len(data)-1]
+	if (backward && hasMore) || (!backward && query.cursor != nil) {
+		page.PrevCursor = (&transactionsCursor{
+			Date:          first.Date,
+			TransactionID: first.TransactionID,
+			Backward:      true,
+		}).encode()
+	}
+	if backward || hasMore {
+		page.NextCursor = (&transactionsCursor{
+			Date:          last.Date,
+			TransactionID: last.TransactionID,
+		}).encode()
+	}
+	return &page, nil
+}
+
 // CreateQueryService initializes a new instance of the query service
-func CreateQueryService(db *gorm.DB) QueryService {
-	svc := dbQueryService{db: db}
+func CreateQueryService(db *gorm.DB, rateProvider rates.RateProvider) QueryService {
+	svc := dbQueryService{db: db, rateProvider: rateProvider}
 	return &svc
 }
@@ -15,9 +15,14 @@ import (
 
 	. "github.com/smartystreets/goconvey/convey"
 	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/rates"
 	"ledger.api/pkg/tags"
 )
 
+var testRates = rates.CreateStaticRateProvider([]rates.Rate{
+	rates.Rate{From: "USD", To: "UAH", Date: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), Rate: 27.5},
+})
+
 func TestNewSummaryQuery(t *testing.T) {
 	Convey("It should create a new instance of the query with defaults", t, func() {
 		typ := fake.Word()
@@ -35,11 +40,12 @@ func TestNewSummaryQuery(t *testing.T) {
 }
 
 func TestProcessSummaryQuery(t *testing.T) {
-	svc := CreateQueryService(DB)
+	svc := CreateQueryService(DB, testRates)
 	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
 
 	Convey("Given summaryQuery", t, func() {
-		md, err := ldtesting.SetupLedgerData(DB)
+		user := ldtesting.NewUser()
+		md, err := ldtesting.SetupLedgerData(DB, user)
 		So(err, ShouldBeNil)
 
 		Convey("When required parameters are missing", func() {
@@ -52,6 +58,11 @@ func TestProcessSummaryQuery(t *testing.T) {
 				_, err := svc.processSummaryQuery(ctx, &summaryQuery{ledgerID: "nil-ledger"})
 				So(err, ShouldResemble, errors.New("Please provide type"))
 			})
+
+			Convey("It should return error if no user provided", func() {
+				_, err := svc.processSummaryQuery(ctx, &summaryQuery{ledgerID: md.LedgerID, typ: "expense"})
+				So(err, ShouldResemble, errors.New("Please provide user"))
+			})
 		})
 
 		Convey("When type is expense", func() {
@@ -67,7 +78,7 @@ func TestProcessSummaryQuery(t *testing.T) {
 			}
 			err := ldtesting.SetupTransactions(DB, trxs[:])
 			So(err, ShouldBeNil)
-			query := summaryQuery{ledgerID: md.LedgerID, typ: "expense"}
+			query := summaryQuery{ledgerID: md.LedgerID, user: user, typ: "expense"}
 
 			Convey("It should calculate summary grouped by tag", func() {
 				expectedByTagID := make(map[int]*summaryDTO)
@@ -301,8 +312,329 @@ func TestProcessSummaryQuery(t *testing.T) {
 		})
 
 		Convey("When account currency is other than ledger default", func() {
+			usdAcc, err := ldtesting.SetupAccount(DB, md.LedgerID, ldtesting.AccCurrency("USD"), ldtesting.AccAuthorizedUsers(user))
+			So(err, ShouldBeNil)
+			tagID := md.TagIDs[0]
+			withTag := ldtesting.TrxRndTag([]int{tagID})
+			So(ldtesting.SetupTransactions(DB, []ldtesting.Transaction{
+				*ldtesting.NewTransaction(withTag, ldtesting.TrxAmount(1000), ldtesting.TrxRndAcc(md.AccountIDs)),
+				*ldtesting.NewTransaction(withTag, ldtesting.TrxAmount(100), ldtesting.TrxRndAcc([]string{usdAcc.AccountID})),
+			}), ShouldBeNil)
+
 			Convey("It should convert the amount to default currency prior to calculation", func() {
+				result, err := svc.processSummaryQuery(ctx, &summaryQuery{ledgerID: md.LedgerID, user: user, typ: "expense"})
+				So(err, ShouldBeNil)
+				So(result, ShouldResemble, []summaryDTO{
+					summaryDTO{TagID: tagID, TagName: md.TagsByID[tagID], Amount: 1000 + 2750},
+				})
+			})
+
+			Convey("It should convert the amount to requested currency", func() {
+				result, err := svc.processSummaryQuery(ctx, &summaryQuery{ledgerID: md.LedgerID, user: user, typ: "expense", currency: "USD"})
+				So(err, ShouldBeNil)
+				So(result, ShouldResemble, []summaryDTO{
+					summaryDTO{TagID: tagID, TagName: md.TagsByID[tagID], Amount: 36 + 100},
+				})
+			})
+
+			Convey("It should fail if there is no exchange rate", func() {
+				_, err := svc.processSummaryQuery(ctx, &summaryQuery{ledgerID: md.LedgerID, user: user, typ: "expense", currency: "EUR"})
+				So(err, ShouldEqual, rates.ErrRateNotFound)
+			})
+		})
+
+		Convey("When user is not authorized on some accounts of the ledger", func() {
+			otherUser := ldtesting.NewUser()
+			hiddenAcc, err := ldtesting.SetupAccount(DB, md.LedgerID, ldtesting.AccAuthorizedUsers(otherUser))
+			So(err, ShouldBeNil)
+			tagID := md.TagIDs[0]
+			withTag := ldtesting.TrxRndTag([]int{tagID})
+			So(ldtesting.SetupTransactions(DB, []ldtesting.Transaction{
+				*ldtesting.NewTransaction(withTag, ldtesting.TrxAmount(1000), ldtesting.TrxRndAcc(md.AccountIDs)),
+				*ldtesting.NewTransaction(withTag, ldtesting.TrxAmount(300), ldtesting.TrxRndAcc([]string{hiddenAcc.AccountID})),
+			}), ShouldBeNil)
+
+			Convey("It should include transactions of authorized accounts only", func() {
+				result, err := svc.processSummaryQuery(ctx, &summaryQuery{ledgerID: md.LedgerID, user: user, typ: "expense"})
+				So(err, ShouldBeNil)
+				So(result, ShouldResemble, []summaryDTO{
+					summaryDTO{TagID: tagID, TagName: md.TagsByID[tagID], Amount: 1000},
+				})
+			})
+
+			Convey("It should include transactions of accounts the other user is authorized on", func() {
+				result, err := svc.processSummaryQuery(ctx, &summaryQuery{ledgerID: md.LedgerID, user: otherUser, typ: "expense"})
+				So(err, ShouldBeNil)
+				So(result, ShouldResemble, []summaryDTO{
+					summaryDTO{TagID: tagID, TagName: md.TagsByID[tagID], Amount: 300},
+				})
+			})
+		})
+	})
+}
+
+func TestProcessTransactionsQuery(t *testing.T) {
+	svc := CreateQueryService(DB, testRates)
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
 
+	Convey("Given transactionsQuery", t, func() {
+		user := ldtesting.NewUser()
+		md, err := ldtesting.SetupLedgerData(DB, user)
+		So(err, ShouldBeNil)
+		otherMd, err := ldtesting.SetupLedgerData(DB, user)
+		So(err, ShouldBeNil)
+
+		dateMax := time.Now()
+		dateMin := dateMax.AddDate(0, -1, 0)
+		trxs := make([]ldtesting.Transaction, 30)
+		for i := 0; i < len(trxs); i++ {
+			setup := []ldtesting.TransactionSetup{
+				ldtesting.TrxRndTag(md.TagIDs),
+				ldtesting.TrxRndDate(dateMin, dateMax),
+				ldtesting.TrxRndAcc(md.AccountIDs),
+			}
+			switch i % 3 {
+			case 1:
+				setup = append(setup, ldtesting.TrxIncome)
+			case 2:
+				setup = append(setup, ldtesting.TrxRefund, ldtesting.TrxTransfer)
+			}
+			trxs[i] = *ldtesting.NewTransaction(setup...)
+		}
+		So(ldtesting.SetupTransactions(DB, trxs), ShouldBeNil)
+		So(ldtesting.SetupTransactions(DB, []ldtesting.Transaction{
+			*ldtesting.NewTransaction(ldtesting.TrxRndTag(otherMd.TagIDs), ldtesting.TrxRndAcc(otherMd.AccountIDs)),
+			*ldtesting.NewTransaction(ldtesting.TrxRndTag(otherMd.TagIDs), ldtesting.TrxRndAcc(otherMd.AccountIDs)),
+		}), ShouldBeNil)
+
+		expectTransactions := func(actual []transactionDTO, filter func(trx ldtesting.Transaction) bool) {
+			expectedIDs := []string{}
+			for _, trx := range trxs {
+				if filter(trx) {
+					expectedIDs = append(expectedIDs, trx.TransactionID)
+				}
+			}
+			actualIDs := make([]string, len(actual))
+			for i, trx := range actual {
+				actualIDs[i] = trx.TransactionID
+				if i > 0 {
+					So(trx.Date.Unix(), ShouldBeLessThanOrEqualTo, actual[i-1].Date.Unix())
+				}
+			}
+			sort.Strings(expectedIDs)
+			sort.Strings(actualIDs)
+			So(actualIDs, ShouldResemble, expectedIDs)
+		}
+
+		Convey("When ledgerID is missing", func() {
+			Convey("It should return error", func() {
+				_, err := svc.processTransactionsQuery(ctx, &transactionsQuery{limit: 10})
+				So(err, ShouldResemble, errors.New("Please provide ledgerID"))
+			})
+		})
+
+		Convey("When user is missing", func() {
+			Convey("It should return error", func() {
+				_, err := svc.processTransactionsQuery(ctx, &transactionsQuery{ledgerID: md.LedgerID, limit: 10})
+				So(err, ShouldResemble, errors.New("Please provide user"))
+			})
+		})
+
+		Convey("When default query is used", func() {
+			query := newTransactionsQuery(md.LedgerID, func(q *transactionsQuery) {
+				q.user = user
+				q.limit = len(trxs)
+			})
+
+			Convey("It should return all transactions of the ledger ordered by date", func() {
+				page, err := svc.processTransactionsQuery(ctx, query)
+				So(err, ShouldBeNil)
+				expectTransactions(page.Data, func(trx ldtesting.Transaction) bool { return true })
+				So(page.NextCursor, ShouldBeEmpty)
+				So(page.PrevCursor, ShouldBeEmpty)
+			})
+
+			Convey("It should map transaction fields", func() {
+				page, err := svc.processTransactionsQuery(ctx, query)
+				So(err, ShouldBeNil)
+				trxByID := make(map[string]ldtesting.Transaction)
+				for _, trx := range trxs {
+					trxByID[trx.TransactionID] = trx
+				}
+				for _, dto := range page.Data {
+					trx := trxByID[dto.TransactionID]
+					So(dto.AccountID, ShouldEqual, trx.AccountID)
+					So(dto.TypeID, ShouldEqual, trx.TypeID())
+					So(dto.Amount, ShouldEqual, trx.Amount)
+					So(dto.TagIDs, ShouldResemble, tags.GetTagIDsFromString(trx.TagIDs))
+					So(dto.Date.Unix(), ShouldEqual, trx.Date.Unix())
+					So(dto.IsTransfer, ShouldEqual, trx.IsTransfer())
+				}
+			})
+		})
+
+		Convey("When filters are used", func() {
+			query := newTransactionsQuery(md.LedgerID, func(q *transactionsQuery) {
+				q.user = user
+				q.limit = len(trxs)
+			})
+
+			Convey("It should filter by date range", func() {
+				from := dateMin.AddDate(0, 0, 10)
+				to := dateMax.AddDate(0, 0, -10)
+				query.from = &from
+				query.to = &to
+				page, err := svc.processTransactionsQuery(ctx, query)
+				So(err, ShouldBeNil)
+				expectTransactions(page.Data, func(trx ldtesting.Transaction) bool {
+					return !trx.Date.Before(from) && !trx.Date.After(to)
+				})
+			})
+
+			Convey("It should filter by accounts", func() {
+				query.accountIDs = []string{md.AccountIDs[0], md.AccountIDs[1]}
+				page, err := svc.processTransactionsQuery(ctx, query)
+				So(err, ShouldBeNil)
+				expectTransactions(page.Data, func(trx ldtesting.Transaction) bool {
+					return trx.AccountID == md.AccountIDs[0] || trx.AccountID == md.AccountIDs[1]
+				})
+			})
+
+			Convey("It should filter by tags", func() {
+				query.tagIDs = []int{md.TagIDs[0], md.TagIDs[1]}
+				page, err := svc.processTransactionsQuery(ctx, query)
+				So(err, ShouldBeNil)
+				expectTransactions(page.Data, func(trx ldtesting.Transaction) bool {
+					tagID := tags.GetTagIDsFromString(trx.TagIDs)[0]
+					return tagID == md.TagIDs[0] || tagID == md.TagIDs[1]
+				})
+			})
+
+			Convey("It should filter by type", func() {
+				query.typ = "income"
+				page, err := svc.processTransactionsQuery(ctx, query)
+				So(err, ShouldBeNil)
+				expectTransactions(page.Data, func(trx ldtesting.Transaction) bool {
+					return trx.TypeID() == TypeIDByName["income"]
+				})
+			})
+
+			Convey("It should return error if type is unknown", func() {
+				query.typ = fake.Word()
+				_, err := svc.processTransactionsQuery(ctx, query)
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("It should filter by amount range", func() {
+				amountFrom := 20000
+				amountTo := 70000
+				query.amountFrom = &amountFrom
+				query.amountTo = &amountTo
+				page, err := svc.processTransactionsQuery(ctx, query)
+				So(err, ShouldBeNil)
+				expectTransactions(page.Data, func(trx ldtesting.Transaction) bool {
+					return trx.Amount >= amountFrom && trx.Amount <= amountTo
+				})
+			})
+
+			Convey("It should filter by transfer flag", func() {
+				isTransfer := true
+				query.isTransfer = &isTransfer
+				page, err := svc.processTransactionsQuery(ctx, query)
+				So(err, ShouldBeNil)
+				expectTransactions(page.Data, func(trx ldtesting.Transaction) bool {
+					return trx.IsTransfer()
+				})
+
+				isTransfer = false
+				page, err = svc.processTransactionsQuery(ctx, query)
+				So(err, ShouldBeNil)
+				expectTransactions(page.Data, func(trx ldtesting.Transaction) bool {
+					return !trx.IsTransfer()
+				})
+			})
+		})
+
+		Convey("When user is not authorized on some accounts of the ledger", func() {
+			otherUser := ldtesting.NewUser()
+			hiddenAcc, err := ldtesting.SetupAccount(DB, md.LedgerID, ldtesting.AccAuthorizedUsers(otherUser))
+			So(err, ShouldBeNil)
+			hiddenTrx := ldtesting.NewTransaction(
+				ldtesting.TrxRndTag(md.TagIDs),
+				ldtesting.TrxRndDate(dateMin, dateMax),
+				ldtesting.TrxRndAcc([]string{hiddenAcc.AccountID}),
+			)
+			So(ldtesting.SetupTransactions(DB, []ldtesting.Transaction{*hiddenTrx}), ShouldBeNil)
+
+			Convey("It should not return transactions of unauthorized accounts", func() {
+				page, err := svc.processTransactionsQuery(ctx, newTransactionsQuery(md.LedgerID, func(q *transactionsQuery) {
+					q.user = user
+					q.limit = len(trxs) + 1
+				}))
+				So(err, ShouldBeNil)
+				expectTransactions(page.Data, func(trx ldtesting.Transaction) bool { return true })
+			})
+
+			Convey("It should not return transactions of unauthorized accounts filtered explicitly", func() {
+				page, err := svc.processTransactionsQuery(ctx, newTransactionsQuery(md.LedgerID, func(q *transactionsQuery) {
+					q.user = user
+					q.accountIDs = []string{hiddenAcc.AccountID}
+				}))
+				So(err, ShouldBeNil)
+				So(page.Data, ShouldBeEmpty)
+			})
+
+			Convey("It should return transactions of accounts the other user is authorized on", func() {
+				page, err := svc.processTransactionsQuery(ctx, newTransactionsQuery(md.LedgerID, func(q *transactionsQuery) {
+					q.user = otherUser
+				}))
+				So(err, ShouldBeNil)
+				So(page.Data, ShouldHaveLength, 1)
+				So(page.Data[0].TransactionID, ShouldEqual, hiddenTrx.TransactionID)
+			})
+		})
+
+		Convey("When paginating", func() {
+			limit := 7
+			query := newTransactionsQuery(md.LedgerID, func(q *transactionsQuery) {
+				q.user = user
+				q.limit = limit
+			})
+
+			Convey("It should page forward through all transactions", func() {
+				all := []transactionDTO{}
+				page, err := svc.processTransactionsQuery(ctx, query)
+				So(err, ShouldBeNil)
+				So(page.PrevCursor, ShouldBeEmpty)
+				all = append(all, page.Data...)
+				for page.NextCursor != "" {
+					So(page.Data, ShouldHaveLength, limit)
+					query.cursor, err = decodeTransactionsCursor(page.NextCursor)
+					So(err, ShouldBeNil)
+					page, err = svc.processTransactionsQuery(ctx, query)
+					So(err, ShouldBeNil)
+					So(page.PrevCursor, ShouldNotBeEmpty)
+					all = append(all, page.Data...)
+				}
+				expectTransactions(all, func(trx ldtesting.Transaction) bool { return true })
+			})
+
+			Convey("It should page back using prev cursor", func() {
+				firstPage, err := svc.processTransactionsQuery(ctx, query)
+				So(err, ShouldBeNil)
+				query.cursor, err = decodeTransactionsCursor(firstPage.NextCursor)
+				So(err, ShouldBeNil)
+				secondPage, err := svc.processTransactionsQuery(ctx, query)
+				So(err, ShouldBeNil)
+
+				query.cursor, err = decodeTransactionsCursor(secondPage.PrevCursor)
+				So(err, ShouldBeNil)
+				So(query.cursor.Backward, ShouldBeTrue)
+				prevPage, err := svc.processTransactionsQuery(ctx, query)
+				So(err, ShouldBeNil)
+				So(prevPage.Data, ShouldResemble, firstPage.Data)
+				So(prevPage.PrevCursor, ShouldBeEmpty)
+				So(prevPage.NextCursor, ShouldEqual, firstPage.NextCursor)
 			})
 		})
 	})
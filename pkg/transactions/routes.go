@@ -1,21 +1,48 @@
 package transactions
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"ledger.api/pkg/rates"
 	"ledger.api/pkg/server"
+	"ledger.api/pkg/users"
 )
 
 // CreateRoutes - Register transactions related routes
-func CreateRoutes(svc QueryService) server.Routes {
+func CreateRoutes(svc QueryService, ledgerAccess server.LedgerAccessChecker) server.Routes {
 	return func(router *server.Router) {
-		router.GET(
-			// from=:from&to=:to&excludeTags=:excludeTagIDs
-			"/v2/ledgers/:ledgerID/transactions/:type/summary",
-			server.RequireScopes(createSummaryQueryHandler(svc), "read:transactions"),
+		transactions := router.Group(
+			"/v2/ledgers/:ledgerID/transactions",
+			server.WithScopes("read:transactions"),
+			server.WithMiddleware(server.CreateLedgerAccessMiddlewareFunc(ledgerAccess)),
 		)
+		// from=:from&to=:to&excludeTags=:excludeTagIDs&currency=:currency
+		transactions.GET("/:type/summary", createSummaryQueryHandler(svc))
+		// from=:from&to=:to&excludeTags=:excludeTagIDs&timeZone=:timeZone&currency=:currency
+		// period is one of day, week, month, quarter, year
+		transactions.GET("/:type/summary/:period", createSeriesQueryHandler(svc))
+		// from=:from&to=:to&accountIDs=:accountIDs&tagIDs=:tagIDs&type=:type
+		// &amountFrom=:amountFrom&amountTo=:amountTo&isTransfer=:isTransfer
+		// &cursor=:cursor&limit=:limit
+		transactions.GET("", createTransactionsQueryHandler(svc))
+	}
+}
+
+// CreateCommandRoutes - Register routes that change transactions
+func CreateCommandRoutes(svc CommandService, ledgerAccess server.LedgerAccessChecker) server.Routes {
+	return func(router *server.Router) {
+		transactions := router.Group(
+			"/v2/ledgers/:ledgerID/transactions",
+			server.WithScopes("write:transactions"),
+			server.WithMiddleware(server.CreateLedgerAccessMiddlewareFunc(ledgerAccess)),
+		)
+		transactions.POST("", createReportTransactionHandler(svc))
+		transactions.PUT("/:transactionID", createAdjustTransactionHandler(svc))
+		transactions.DELETE("/:transactionID", createRemoveTransactionHandler(svc))
 	}
 }
 
@@ -30,6 +57,25 @@ func parseQueryTime(req *http.Request, key string) (*time.Time, error) {
 	return nil, nil
 }
 
+func parseQueryCurrency(req *http.Request) (string, error) {
+	currency := req.URL.Query().Get("currency")
+	if currency != "" && !rates.IsCurrencyCode(currency) {
+		return "", *server.BadRequestError("Parameter 'currency' should be ISO 4217 currency code")
+	}
+	return currency, nil
+}
+
+// summaryHTTPError maps summary query errors to http errors
+func summaryHTTPError(err error) error {
+	switch err {
+	case errLedgerNotFound:
+		return *server.NotFoundError()
+	case rates.ErrRateNotFound:
+		return *server.UnprocessableEntityError(err.Error())
+	}
+	return err
+}
+
 func createSummaryQueryHandler(svc QueryService) server.HandlerFunc {
 	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
 		ledgerID := h.Params.ByName("ledgerID")
@@ -43,13 +89,217 @@ func createSummaryQueryHandler(svc QueryService) server.HandlerFunc {
 			return nil, err
 		}
 		query := newSummaryQuery(ledgerID, typ, optionalDates(from, to))
+		query.user = users.FromContext(req.Context())
 		if val := req.URL.Query().Get("excludeTagIDs"); val != "" {
 			query.excludeTagIDs = strings.Split(val, ",")
 		}
+		if query.currency, err = parseQueryCurrency(req); err != nil {
+			return nil, err
+		}
 		result, err := svc.processSummaryQuery(req.Context(), query)
+		if err != nil {
+			return nil, summaryHTTPError(err)
+		}
+		return h.Response(result), nil
+	}
+}
+
+func createSeriesQueryHandler(svc QueryService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		period := h.Params.ByName("period")
+		if !seriesPeriods[period] {
+			return nil, *server.BadRequestError(fmt.Sprintf("Unknown period: %v", period))
+		}
+		from, err := parseQueryTime(req, "from")
+		if err != nil {
+			return nil, *server.BadRequestError("Parameter 'from' should be RFC3339 date")
+		}
+		to, err := parseQueryTime(req, "to")
+		if err != nil {
+			return nil, *server.BadRequestError("Parameter 'to' should be RFC3339 date")
+		}
+		query := newSeriesQuery(h.Params.ByName("ledgerID"), h.Params.ByName("type"), period)
+		query.user = users.FromContext(req.Context())
+		optionalDates(from, to)(&query.summaryQuery)
+		if val := req.URL.Query().Get("excludeTagIDs"); val != "" {
+			query.excludeTagIDs = strings.Split(val, ",")
+		}
+		if val := req.URL.Query().Get("timeZone"); val != "" {
+			location, err := time.LoadLocation(val)
+			if err != nil {
+				return nil, *server.BadRequestError(fmt.Sprintf("Unknown time zone: %v", val))
+			}
+			query.location = location
+		}
+		if query.from.After(*query.to) {
+			return nil, *server.BadRequestError("Parameter 'from' should be before 'to'")
+		}
+		if query.currency, err = parseQueryCurrency(req); err != nil {
+			return nil, err
+		}
+		result, err := svc.processSeriesQuery(req.Context(), query)
+		if err != nil {
+			return nil, summaryHTTPError(err)
+		}
+		return h.Response(result), nil
+	}
+}
+
+func parseQueryInt(req *http.Request, key string) (*int, error) {
+	if intStr := req.URL.Query().Get(key); intStr != "" {
+		val, err := strconv.Atoi(intStr)
+		if err != nil {
+			return nil, *server.BadRequestError(fmt.Sprintf("Parameter '%v' should be an integer", key))
+		}
+		return &val, nil
+	}
+	return nil, nil
+}
+
+func parseQueryBool(req *http.Request, key string) (*bool, error) {
+	if boolStr := req.URL.Query().Get(key); boolStr != "" {
+		val, err := strconv.ParseBool(boolStr)
+		if err != nil {
+			return nil, *server.BadRequestError(fmt.Sprintf("Parameter '%v' should be a boolean", key))
+		}
+		return &val, nil
+	}
+	return nil, nil
+}
+
+func parseTransactionsQuery(req *http.Request, query *transactionsQuery) error {
+	var err error
+	if query.from, err = parseQueryTime(req, "from"); err != nil {
+		return *server.BadRequestError("Parameter 'from' should be RFC3339 date")
+	}
+	if query.to, err = parseQueryTime(req, "to"); err != nil {
+		return *server.BadRequestError("Parameter 'to' should be RFC3339 date")
+	}
+	if val := req.URL.Query().Get("accountIDs"); val != "" {
+		query.accountIDs = strings.Split(val, ",")
+	}
+	if val := req.URL.Query().Get("tagIDs"); val != "" {
+		for _, tagIDStr := range strings.Split(val, ",") {
+			tagID, err := strconv.Atoi(tagIDStr)
+			if err != nil {
+				return *server.BadRequestError("Parameter 'tagIDs' should be comma separated integers")
+			}
+			query.tagIDs = append(query.tagIDs, tagID)
+		}
+	}
+	if val := req.URL.Query().Get("type"); val != "" {
+		if _, ok := TypeIDByName[val]; !ok {
+			return *server.BadRequestError(fmt.Sprintf("Unknown type: %v", val))
+		}
+		query.typ = val
+	}
+	if query.amountFrom, err = parseQueryInt(req, "amountFrom"); err != nil {
+		return err
+	}
+	if query.amountTo, err = parseQueryInt(req, "amountTo"); err != nil {
+		return err
+	}
+	if query.isTransfer, err = parseQueryBool(req, "isTransfer"); err != nil {
+		return err
+	}
+	if val := req.URL.Query().Get("cursor"); val != "" {
+		if query.cursor, err = decodeTransactionsCursor(val); err != nil {
+			return *server.BadRequestError("Parameter 'cursor' is malformed")
+		}
+	}
+	limit, err := parseQueryInt(req, "limit")
+	if err != nil {
+		return err
+	}
+	if limit != nil {
+		if *limit <= 0 || *limit > maxTransactionsLimit {
+			return *server.BadRequestError(
+				fmt.Sprintf("Parameter 'limit' should be between 1 and %v", maxTransactionsLimit),
+			)
+		}
+		query.limit = *limit
+	}
+	return nil
+}
+
+func createTransactionsQueryHandler(svc QueryService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		query := newTransactionsQuery(h.Params.ByName("ledgerID"))
+		query.user = users.FromContext(req.Context())
+		if err := parseTransactionsQuery(req, query); err != nil {
+			return nil, err
+		}
+		result, err := svc.processTransactionsQuery(req.Context(), query)
 		if err != nil {
 			return nil, err
 		}
 		return h.Response(result), nil
 	}
 }
+
+// commandHTTPError maps command errors to http errors
+func commandHTTPError(err error) error {
+	switch err {
+	case errTransactionNotFound:
+		return *server.NotFoundError()
+	case errAccountNotFound, errAccountChangeNotAllowed, errTypeChangeNotAllowed:
+		return *server.BadRequestError(err.Error())
+	case errTransactionExists:
+		return *server.ConflictError(err.Error())
+	}
+	return err
+}
+
+func createReportTransactionHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		var payload transactionPayload
+		if err := h.Bind(req, &payload); err != nil {
+			return nil, err
+		}
+		transactionID, err := svc.processReportTransactionCommand(req.Context(), &reportTransactionCommand{
+			ledgerID: h.Params.ByName("ledgerID"),
+			user:     users.FromContext(req.Context()),
+			payload:  &payload,
+		})
+		if err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(server.JSON{"transactionID": transactionID}).Status(http.StatusAccepted), nil
+	}
+}
+
+func createAdjustTransactionHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		var payload transactionPayload
+		if err := h.Bind(req, &payload); err != nil {
+			return nil, err
+		}
+		transactionID := h.Params.ByName("transactionID")
+		if payload.ID != "" && payload.ID != transactionID {
+			return nil, *server.BadRequestError("Payload id does not match transactionID")
+		}
+		if err := svc.processAdjustTransactionCommand(req.Context(), &adjustTransactionCommand{
+			ledgerID:      h.Params.ByName("ledgerID"),
+			transactionID: transactionID,
+			user:          users.FromContext(req.Context()),
+			payload:       &payload,
+		}); err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(server.JSON{"transactionID": transactionID}).Status(http.StatusAccepted), nil
+	}
+}
+
+func createRemoveTransactionHandler(svc CommandService) server.HandlerFunc {
+	return func(req *http.Request, h *server.HandlerToolkit) (*server.Response, error) {
+		transactionID := h.Params.ByName("transactionID")
+		if err := svc.processRemoveTransactionCommand(req.Context(), &removeTransactionCommand{
+			ledgerID:      h.Params.ByName("ledgerID"),
+			transactionID: transactionID,
+			user:          users.FromContext(req.Context()),
+		}); err != nil {
+			return nil, commandHTTPError(err)
+		}
+		return h.Response(server.JSON{"transactionID": transactionID}).Status(http.StatusAccepted), nil
+	}
+}
@@ -1,24 +1,32 @@
 package transactions
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/satori/go.uuid"
 
+	"github.com/google/jsonapi"
 	"github.com/icrowley/fake"
 
 	. "github.com/smartystreets/goconvey/convey"
 	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/ledgers"
+	"ledger.api/pkg/rates"
 	"ledger.api/pkg/server"
+	"ledger.api/pkg/users"
 )
 
 var rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -29,7 +37,9 @@ type methodCall struct {
 }
 
 type mockQueryService struct {
-	processSummaryQueryCalls []methodCall
+	processSummaryQueryCalls      []methodCall
+	processTransactionsQueryCalls []methodCall
+	processSeriesQueryCalls       []methodCall
 }
 
 type ctxKey string
@@ -53,30 +63,88 @@ func (svc *mockQueryService) processSummaryQuery(ctx context.Context, query *sum
 	return result, nil
 }
 
-func setupRouter() (*mockQueryService, *server.HTTPApp) {
-	svc := mockQueryService{processSummaryQueryCalls: []methodCall{}}
+type mockLedgerAccessChecker struct {
+	accessibleLedgers map[string]bool
+}
+
+func (checker *mockLedgerAccessChecker) HasLedgerAccess(ctx context.Context, user *users.User, ledgerID string) (bool, error) {
+	return checker.accessibleLedgers[ledgerID], nil
+}
+
+func (svc *mockQueryService) processTransactionsQuery(ctx context.Context, query *transactionsQuery) (*transactionsPageDTO, error) {
+	result := &transactionsPageDTO{
+		Data: []transactionDTO{
+			transactionDTO{TransactionID: uuid.NewV4().String(), Amount: rnd.Int(), TagIDs: []int{rnd.Int()}},
+			transactionDTO{TransactionID: uuid.NewV4().String(), Amount: rnd.Int(), TagIDs: []int{rnd.Int()}},
+		},
+		NextCursor: fake.Characters(),
+		PrevCursor: fake.Characters(),
+	}
+	svc.processTransactionsQueryCalls = append(svc.processTransactionsQueryCalls, methodCall{
+		input:  []interface{}{query},
+		result: result,
+	})
+	failHandler := ctx.Value(errorFnKey)
+	if failHandler != nil {
+		return nil, failHandler.(func() error)()
+	}
+	return result, nil
+}
+
+func (svc *mockQueryService) processSeriesQuery(ctx context.Context, query *seriesQuery) (*seriesDTO, error) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	result := &seriesDTO{
+		Period:   query.period,
+		TimeZone: query.location.String(),
+		Buckets: []seriesBucketDTO{
+			seriesBucketDTO{
+				Start: start,
+				End:   start.AddDate(0, 1, 0),
+				Tags:  []summaryDTO{summaryDTO{TagID: rnd.Int(), TagName: fake.Word(), Amount: rnd.Int()}},
+			},
+		},
+	}
+	svc.processSeriesQueryCalls = append(svc.processSeriesQueryCalls, methodCall{
+		input:  []interface{}{query},
+		result: result,
+	})
+	return result, nil
+}
+
+func setupRouter(accessibleLedgerIDs ...string) (*mockQueryService, *server.HTTPApp) {
+	svc := mockQueryService{
+		processSummaryQueryCalls:      []methodCall{},
+		processTransactionsQueryCalls: []methodCall{},
+		processSeriesQueryCalls:       []methodCall{},
+	}
+	checker := mockLedgerAccessChecker{accessibleLedgers: make(map[string]bool)}
+	for _, ledgerID := range accessibleLedgerIDs {
+		checker.accessibleLedgers[ledgerID] = true
+	}
 	return &svc, server.
 		CreateHTTPApp(server.HTTPAppConfig{Env: "test"}).
-		RegisterRoutes(CreateRoutes(&svc))
+		RegisterRoutes(CreateRoutes(&svc, &checker))
 }
 
 func TestTransactionsRoutes(t *testing.T) {
 	Convey("Given transactions routes", t, func() {
-		svc, router := setupRouter()
-		recorder := httptest.NewRecorder()
 		ledgerID := uuid.NewV4().String()
+		svc, router := setupRouter(ledgerID)
+		recorder := httptest.NewRecorder()
+		user := ldtesting.NewUser()
 		typ := fake.Word()
 		Convey("When route is processSummaryQuery", func() {
 			path := fmt.Sprintf("/v2/ledgers/%v/transactions/%v/summary", ledgerID, typ)
 
 			Convey("And user is authorized", func() {
-				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("read:transactions"))
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("read:transactions"), ldtesting.WithUser(user))
 				Convey("It should process query and return summary data", func() {
 					router.CreateHandler().ServeHTTP(recorder, req)
 					So(recorder.Code, ShouldEqual, 200)
 					So(len(svc.processSummaryQueryCalls), ShouldEqual, 1)
 					queryCall := svc.processSummaryQueryCalls[0]
 					defaultQuery := newSummaryQuery(ledgerID, typ)
+					defaultQuery.user = user
 
 					actualQuery := queryCall.input.([]interface{})[0].(*summaryQuery)
 					So(actualQuery.from.Unix(), ShouldAlmostEqual, defaultQuery.from.Unix())
@@ -101,7 +169,7 @@ func TestTransactionsRoutes(t *testing.T) {
 					qs.Add("excludeTagIDs", strings.Join(excludeTagIDs, ","))
 
 					url := fmt.Sprintf("/v2/ledgers/%v/transactions/%v/summary?%v", ledgerID, typ, qs.Encode())
-					req := ldtesting.NewRequest("GET", url, ldtesting.WithScopeClaim("read:transactions"))
+					req := ldtesting.NewRequest("GET", url, ldtesting.WithScopeClaim("read:transactions"), ldtesting.WithUser(user))
 					router.CreateHandler().ServeHTTP(recorder, req)
 					So(recorder.Code, ShouldEqual, 200)
 					So(len(svc.processSummaryQueryCalls), ShouldEqual, 1)
@@ -116,6 +184,32 @@ func TestTransactionsRoutes(t *testing.T) {
 					So(inputQuery.excludeTagIDs, ShouldResemble, excludeTagIDs)
 				})
 
+				Convey("It should use currency param", func() {
+					url := fmt.Sprintf("/v2/ledgers/%v/transactions/%v/summary?currency=USD", ledgerID, typ)
+					req := ldtesting.NewRequest("GET", url, ldtesting.WithScopeClaim("read:transactions"), ldtesting.WithUser(user))
+					router.CreateHandler().ServeHTTP(recorder, req)
+					So(recorder.Code, ShouldEqual, 200)
+					So(len(svc.processSummaryQueryCalls), ShouldEqual, 1)
+					inputQuery := svc.processSummaryQueryCalls[0].input.([]interface{})[0].(*summaryQuery)
+					So(inputQuery.currency, ShouldEqual, "USD")
+				})
+
+				Convey("It should respond with 400 if currency is malformed", func() {
+					url := fmt.Sprintf("/v2/ledgers/%v/transactions/%v/summary?currency=usd", ledgerID, typ)
+					req := ldtesting.NewRequest("GET", url, ldtesting.WithScopeClaim("read:transactions"), ldtesting.WithUser(user))
+					router.CreateHandler().ServeHTTP(recorder, req)
+					So(recorder.Code, ShouldEqual, 400)
+					So(len(svc.processSummaryQueryCalls), ShouldEqual, 0)
+				})
+
+				Convey("It should respond with 422 if exchange rate is not found", func() {
+					failCtx := context.WithValue(req.Context(), errorFnKey, func() error {
+						return rates.ErrRateNotFound
+					})
+					router.CreateHandler().ServeHTTP(recorder, req.WithContext(failCtx))
+					So(recorder.Code, ShouldEqual, 422)
+				})
+
 				Convey("It should respond with error if query fails", func() {
 					failCtx := context.WithValue(req.Context(), errorFnKey, func() error {
 						return errors.New(fake.Sentence())
@@ -126,13 +220,442 @@ func TestTransactionsRoutes(t *testing.T) {
 				})
 			})
 
+			Convey("And ledger is not accessible by the user", func() {
+				otherPath := fmt.Sprintf("/v2/ledgers/%v/transactions/%v/summary", uuid.NewV4().String(), typ)
+				req := ldtesting.NewRequest("GET", otherPath, ldtesting.WithScopeClaim("read:transactions"), ldtesting.WithUser(user))
+				Convey("It should reject with 404", func() {
+					router.CreateHandler().ServeHTTP(recorder, req)
+					So(recorder.Code, ShouldEqual, 404)
+					So(len(svc.processSummaryQueryCalls), ShouldEqual, 0)
+				})
+			})
+
+			Convey("And user is not resolved", func() {
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("read:transactions"))
+				Convey("It should reject with 404", func() {
+					router.CreateHandler().ServeHTTP(recorder, req)
+					So(recorder.Code, ShouldEqual, 404)
+					So(len(svc.processSummaryQueryCalls), ShouldEqual, 0)
+				})
+			})
+
 			Convey("And user is not authorized", func() {
-				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("none"))
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("none"), ldtesting.WithUser(user))
 				Convey("It should reject with 403", func() {
 					router.CreateHandler().ServeHTTP(recorder, req)
 					So(recorder.Code, ShouldEqual, 403)
 				})
 			})
 		})
+
+		Convey("When route is processSeriesQuery", func() {
+			path := fmt.Sprintf("/v2/ledgers/%v/transactions/%v/summary/month", ledgerID, typ)
+			newSeriesRequest := func(qs url.Values) *http.Request {
+				return ldtesting.NewRequest(
+					"GET",
+					path+"?"+qs.Encode(),
+					ldtesting.WithScopeClaim("read:transactions"),
+					ldtesting.WithUser(user),
+				)
+			}
+
+			Convey("It should process query with defaults", func() {
+				router.CreateHandler().ServeHTTP(recorder, newSeriesRequest(url.Values{}))
+				So(recorder.Code, ShouldEqual, 200)
+				So(svc.processSeriesQueryCalls, ShouldHaveLength, 1)
+				queryCall := svc.processSeriesQueryCalls[0]
+				actualQuery := queryCall.input.([]interface{})[0].(*seriesQuery)
+				defaultQuery := newSeriesQuery(ledgerID, typ, "month")
+				defaultQuery.user = user
+				So(actualQuery.from.Unix(), ShouldAlmostEqual, defaultQuery.from.Unix())
+				So(actualQuery.to.Unix(), ShouldAlmostEqual, defaultQuery.to.Unix())
+				actualQuery.from = defaultQuery.from
+				actualQuery.to = defaultQuery.to
+				So(actualQuery, ShouldResemble, defaultQuery)
+
+				expectedMessage, _ := json.Marshal(queryCall.result)
+				So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+			})
+
+			Convey("It should use query string params", func() {
+				from := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+				to := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+				qs := url.Values{}
+				qs.Add("from", from.Format(time.RFC3339))
+				qs.Add("to", to.Format(time.RFC3339))
+				qs.Add("excludeTagIDs", "1,2")
+				qs.Add("timeZone", "Europe/Kiev")
+				router.CreateHandler().ServeHTTP(recorder, newSeriesRequest(qs))
+				So(recorder.Code, ShouldEqual, 200)
+				actualQuery := svc.processSeriesQueryCalls[0].input.([]interface{})[0].(*seriesQuery)
+				So(actualQuery.from.Equal(from), ShouldBeTrue)
+				So(actualQuery.to.Equal(to), ShouldBeTrue)
+				So(actualQuery.excludeTagIDs, ShouldResemble, []string{"1", "2"})
+				So(actualQuery.location.String(), ShouldEqual, "Europe/Kiev")
+			})
+
+			Convey("It should use currency param", func() {
+				router.CreateHandler().ServeHTTP(recorder, newSeriesRequest(url.Values{"currency": []string{"EUR"}}))
+				So(recorder.Code, ShouldEqual, 200)
+				actualQuery := svc.processSeriesQueryCalls[0].input.([]interface{})[0].(*seriesQuery)
+				So(actualQuery.currency, ShouldEqual, "EUR")
+			})
+
+			Convey("It should respond with 400 if currency is malformed", func() {
+				router.CreateHandler().ServeHTTP(recorder, newSeriesRequest(url.Values{"currency": []string{"EURO"}}))
+				So(recorder.Code, ShouldEqual, 400)
+				So(svc.processSeriesQueryCalls, ShouldBeEmpty)
+			})
+
+			Convey("It should respond with 400 if period is unknown", func() {
+				req := ldtesting.NewRequest(
+					"GET",
+					fmt.Sprintf("/v2/ledgers/%v/transactions/%v/summary/decade", ledgerID, typ),
+					ldtesting.WithScopeClaim("read:transactions"),
+					ldtesting.WithUser(user),
+				)
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 400)
+				So(svc.processSeriesQueryCalls, ShouldBeEmpty)
+			})
+
+			Convey("It should respond with 400 if time zone is unknown", func() {
+				router.CreateHandler().ServeHTTP(recorder, newSeriesRequest(url.Values{"timeZone": []string{"Mars/Olympus"}}))
+				So(recorder.Code, ShouldEqual, 400)
+				So(svc.processSeriesQueryCalls, ShouldBeEmpty)
+			})
+
+			Convey("It should respond with 400 if from is after to", func() {
+				qs := url.Values{}
+				qs.Add("from", time.Now().Format(time.RFC3339))
+				qs.Add("to", time.Now().AddDate(0, -1, 0).Format(time.RFC3339))
+				router.CreateHandler().ServeHTTP(recorder, newSeriesRequest(qs))
+				So(recorder.Code, ShouldEqual, 400)
+				So(svc.processSeriesQueryCalls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When route is processTransactionsQuery", func() {
+			path := fmt.Sprintf("/v2/ledgers/%v/transactions", ledgerID)
+
+			Convey("And user is authorized", func() {
+				Convey("It should process default query and return transactions page", func() {
+					req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("read:transactions"), ldtesting.WithUser(user))
+					router.CreateHandler().ServeHTTP(recorder, req)
+					So(recorder.Code, ShouldEqual, 200)
+					So(len(svc.processTransactionsQueryCalls), ShouldEqual, 1)
+					queryCall := svc.processTransactionsQueryCalls[0]
+					actualQuery := queryCall.input.([]interface{})[0].(*transactionsQuery)
+					So(actualQuery, ShouldResemble, newTransactionsQuery(ledgerID, func(q *transactionsQuery) {
+						q.user = user
+					}))
+
+					expectedMessage, _ := json.Marshal(queryCall.result)
+					So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+				})
+
+				Convey("It should use query string params", func() {
+					from := ldtesting.RandomDate()
+					to := ldtesting.RandomDate()
+					accountIDs := []string{uuid.NewV4().String(), uuid.NewV4().String()}
+					tagIDs := []int{rnd.Intn(1000), rnd.Intn(1000)}
+					amountFrom := rnd.Intn(1000)
+					amountTo := amountFrom + rnd.Intn(1000)
+					cursor := transactionsCursor{
+						Date:          to.UTC(),
+						TransactionID: uuid.NewV4().String(),
+						Backward:      true,
+					}
+					limit := 1 + rnd.Intn(maxTransactionsLimit)
+					qs := url.Values{}
+					qs.Add("from", from.Format(time.RFC3339))
+					qs.Add("to", to.Format(time.RFC3339))
+					qs.Add("accountIDs", strings.Join(accountIDs, ","))
+					qs.Add("tagIDs", fmt.Sprintf("%v,%v", tagIDs[0], tagIDs[1]))
+					qs.Add("type", "refund")
+					qs.Add("amountFrom", strconv.Itoa(amountFrom))
+					qs.Add("amountTo", strconv.Itoa(amountTo))
+					qs.Add("isTransfer", "true")
+					qs.Add("cursor", cursor.encode())
+					qs.Add("limit", strconv.Itoa(limit))
+
+					req := ldtesting.NewRequest("GET", path+"?"+qs.Encode(), ldtesting.WithScopeClaim("read:transactions"), ldtesting.WithUser(user))
+					router.CreateHandler().ServeHTTP(recorder, req)
+					So(recorder.Code, ShouldEqual, 200)
+					So(len(svc.processTransactionsQueryCalls), ShouldEqual, 1)
+					inputQuery := svc.processTransactionsQueryCalls[0].input.([]interface{})[0].(*transactionsQuery)
+					So(inputQuery.from.Format(time.RFC3339), ShouldEqual, from.Format(time.RFC3339))
+					So(inputQuery.to.Format(time.RFC3339), ShouldEqual, to.Format(time.RFC3339))
+					So(inputQuery.accountIDs, ShouldResemble, accountIDs)
+					So(inputQuery.tagIDs, ShouldResemble, tagIDs)
+					So(inputQuery.typ, ShouldEqual, "refund")
+					So(*inputQuery.amountFrom, ShouldEqual, amountFrom)
+					So(*inputQuery.amountTo, ShouldEqual, amountTo)
+					So(*inputQuery.isTransfer, ShouldBeTrue)
+					So(inputQuery.cursor, ShouldResemble, &cursor)
+					So(inputQuery.limit, ShouldEqual, limit)
+				})
+
+				Convey("It should respond with 400 if params are invalid", func() {
+					invalidParams := []string{
+						"from=" + fake.Word(),
+						"tagIDs=" + fake.Word(),
+						"type=" + fake.Word(),
+						"amountFrom=" + fake.Word(),
+						"isTransfer=" + fake.Word(),
+						"cursor=" + fake.Word(),
+						"limit=0",
+						fmt.Sprintf("limit=%v", maxTransactionsLimit+1),
+					}
+					for _, invalidParam := range invalidParams {
+						recorder := httptest.NewRecorder()
+						req := ldtesting.NewRequest("GET", path+"?"+invalidParam, ldtesting.WithScopeClaim("read:transactions"), ldtesting.WithUser(user))
+						router.CreateHandler().ServeHTTP(recorder, req)
+						So(recorder.Code, ShouldEqual, 400)
+					}
+					So(len(svc.processTransactionsQueryCalls), ShouldEqual, 0)
+				})
+			})
+
+			Convey("And ledger is not accessible by the user", func() {
+				otherPath := fmt.Sprintf("/v2/ledgers/%v/transactions", uuid.NewV4().String())
+				req := ldtesting.NewRequest("GET", otherPath, ldtesting.WithScopeClaim("read:transactions"), ldtesting.WithUser(user))
+				Convey("It should reject with 404", func() {
+					router.CreateHandler().ServeHTTP(recorder, req)
+					So(recorder.Code, ShouldEqual, 404)
+					So(len(svc.processTransactionsQueryCalls), ShouldEqual, 0)
+				})
+			})
+
+			Convey("And user is not authorized", func() {
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("none"), ldtesting.WithUser(user))
+				Convey("It should reject with 403", func() {
+					router.CreateHandler().ServeHTTP(recorder, req)
+					So(recorder.Code, ShouldEqual, 403)
+				})
+			})
+		})
+	})
+}
+
+type mockCommandService struct {
+	calls []methodCall
+	err   error
+}
+
+func (svc *mockCommandService) processReportTransactionCommand(ctx context.Context, cmd *reportTransactionCommand) (string, error) {
+	transactionID := uuid.NewV4().String()
+	svc.calls = append(svc.calls, methodCall{input: cmd, result: transactionID})
+	return transactionID, svc.err
+}
+
+func (svc *mockCommandService) processAdjustTransactionCommand(ctx context.Context, cmd *adjustTransactionCommand) error {
+	svc.calls = append(svc.calls, methodCall{input: cmd})
+	return svc.err
+}
+
+func (svc *mockCommandService) processRemoveTransactionCommand(ctx context.Context, cmd *removeTransactionCommand) error {
+	svc.calls = append(svc.calls, methodCall{input: cmd})
+	return svc.err
+}
+
+func TestTransactionsCommandRoutes(t *testing.T) {
+	Convey("Given transactions command routes", t, func() {
+		ledgerID := uuid.NewV4().String()
+		checker := mockLedgerAccessChecker{accessibleLedgers: map[string]bool{ledgerID: true}}
+		svc := &mockCommandService{}
+		router := server.
+			CreateHTTPApp(server.HTTPAppConfig{Env: "test"}).
+			RegisterRoutes(CreateCommandRoutes(svc, &checker))
+		recorder := httptest.NewRecorder()
+		user := ldtesting.NewUser()
+		payload := transactionPayload{
+			Type:    "income",
+			Amount:  1 + rnd.Intn(10000),
+			Comment: fake.Sentence(),
+			Date:    time.Now().UTC().Truncate(time.Second),
+			Account: &accountRef{ID: uuid.NewV4().String()},
+			Tags:    []*tagRef{{ID: 1 + rnd.Intn(1000)}},
+		}
+		newRequest := func(method string, path string, payload *transactionPayload, scope string) *http.Request {
+			body := bytes.NewBuffer(nil)
+			if payload != nil {
+				if err := jsonapi.MarshalPayload(body, payload); err != nil {
+					panic(err)
+				}
+			}
+			req := ldtesting.NewRequest(method, path, ldtesting.WithScopeClaim(scope), ldtesting.WithUser(user))
+			req.Body = ioutil.NopCloser(body)
+			return req
+		}
+
+		Convey("When route is report transaction", func() {
+			path := fmt.Sprintf("/v2/ledgers/%v/transactions", ledgerID)
+
+			Convey("It should process command and respond with transaction id", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &payload, "write:transactions"))
+				So(recorder.Code, ShouldEqual, 202)
+				So(svc.calls, ShouldHaveLength, 1)
+				cmd := svc.calls[0].input.(*reportTransactionCommand)
+				So(cmd.ledgerID, ShouldEqual, ledgerID)
+				So(cmd.user, ShouldEqual, user)
+				So(cmd.payload, ShouldResemble, &payload)
+				expectedMessage, _ := json.Marshal(server.JSON{"transactionID": svc.calls[0].result})
+				So(recorder.Body.String(), ShouldEqual, string(expectedMessage))
+			})
+
+			Convey("It should respond with 400 if payload is invalid", func() {
+				payload.Amount = 0
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &payload, "write:transactions"))
+				So(recorder.Code, ShouldEqual, 400)
+				So(svc.calls, ShouldBeEmpty)
+			})
+
+			Convey("It should respond with 400 if account is not found", func() {
+				svc.err = errAccountNotFound
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &payload, "write:transactions"))
+				So(recorder.Code, ShouldEqual, 400)
+			})
+
+			Convey("It should respond with 409 if transaction exists", func() {
+				svc.err = errTransactionExists
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &payload, "write:transactions"))
+				So(recorder.Code, ShouldEqual, 409)
+			})
+
+			Convey("It should reject with 403 if no write scope", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", path, &payload, "read:transactions"))
+				So(recorder.Code, ShouldEqual, 403)
+				So(svc.calls, ShouldBeEmpty)
+			})
+
+			Convey("It should reject with 404 if ledger is not accessible", func() {
+				otherPath := fmt.Sprintf("/v2/ledgers/%v/transactions", uuid.NewV4().String())
+				router.CreateHandler().ServeHTTP(recorder, newRequest("POST", otherPath, &payload, "write:transactions"))
+				So(recorder.Code, ShouldEqual, 404)
+				So(svc.calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When route is adjust transaction", func() {
+			transactionID := uuid.NewV4().String()
+			path := fmt.Sprintf("/v2/ledgers/%v/transactions/%v", ledgerID, transactionID)
+
+			Convey("It should process command", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("PUT", path, &payload, "write:transactions"))
+				So(recorder.Code, ShouldEqual, 202)
+				So(svc.calls, ShouldHaveLength, 1)
+				cmd := svc.calls[0].input.(*adjustTransactionCommand)
+				So(cmd.ledgerID, ShouldEqual, ledgerID)
+				So(cmd.transactionID, ShouldEqual, transactionID)
+				So(cmd.user, ShouldEqual, user)
+				So(cmd.payload, ShouldResemble, &payload)
+			})
+
+			Convey("It should respond with 400 if payload id is different", func() {
+				payload.ID = uuid.NewV4().String()
+				router.CreateHandler().ServeHTTP(recorder, newRequest("PUT", path, &payload, "write:transactions"))
+				So(recorder.Code, ShouldEqual, 400)
+				So(svc.calls, ShouldBeEmpty)
+			})
+
+			Convey("It should respond with 404 if transaction is not found", func() {
+				svc.err = errTransactionNotFound
+				router.CreateHandler().ServeHTTP(recorder, newRequest("PUT", path, &payload, "write:transactions"))
+				So(recorder.Code, ShouldEqual, 404)
+			})
+		})
+
+		Convey("When route is remove transaction", func() {
+			transactionID := uuid.NewV4().String()
+			path := fmt.Sprintf("/v2/ledgers/%v/transactions/%v", ledgerID, transactionID)
+
+			Convey("It should process command", func() {
+				router.CreateHandler().ServeHTTP(recorder, newRequest("DELETE", path, nil, "write:transactions"))
+				So(recorder.Code, ShouldEqual, 202)
+				So(svc.calls, ShouldHaveLength, 1)
+				So(svc.calls[0].input, ShouldResemble, &removeTransactionCommand{
+					ledgerID:      ledgerID,
+					transactionID: transactionID,
+					user:          user,
+				})
+			})
+		})
+	})
+}
+
+func TestTransactionsRoutesAccess(t *testing.T) {
+	Convey("Given transactions routes backed by the db", t, func() {
+		router := server.
+			CreateHTTPApp(server.HTTPAppConfig{Env: "test"}).
+			RegisterRoutes(CreateRoutes(CreateQueryService(DB, testRates), ledgers.CreateLedgerAccessChecker(DB)))
+		recorder := httptest.NewRecorder()
+		member := ldtesting.NewUser()
+		outsider := ldtesting.NewUser()
+		md, err := ldtesting.SetupLedgerData(DB, member)
+		So(err, ShouldBeNil)
+		hiddenAcc, err := ldtesting.SetupAccount(DB, md.LedgerID)
+		So(err, ShouldBeNil)
+		visibleTrx := ldtesting.NewTransaction(ldtesting.TrxRndTag(md.TagIDs), ldtesting.TrxRndAcc(md.AccountIDs))
+		hiddenTrx := ldtesting.NewTransaction(ldtesting.TrxRndTag(md.TagIDs), ldtesting.TrxRndAcc([]string{hiddenAcc.AccountID}))
+		So(ldtesting.SetupTransactions(DB, []ldtesting.Transaction{*visibleTrx, *hiddenTrx}), ShouldBeNil)
+		path := fmt.Sprintf("/v2/ledgers/%v/transactions", md.LedgerID)
+
+		Convey("When user is authorized on some accounts of the ledger", func() {
+			Convey("It should respond with transactions of authorized accounts only", func() {
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("read:transactions"), ldtesting.WithUser(member))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 200)
+				var page transactionsPageDTO
+				So(json.Unmarshal(recorder.Body.Bytes(), &page), ShouldBeNil)
+				So(page.Data, ShouldHaveLength, 1)
+				So(page.Data[0].TransactionID, ShouldEqual, visibleTrx.TransactionID)
+			})
+
+			Convey("It should not respond with transactions of unauthorized accounts requested explicitly", func() {
+				req := ldtesting.NewRequest("GET", path+"?accountIDs="+hiddenAcc.AccountID,
+					ldtesting.WithScopeClaim("read:transactions"), ldtesting.WithUser(member))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 200)
+				var page transactionsPageDTO
+				So(json.Unmarshal(recorder.Body.Bytes(), &page), ShouldBeNil)
+				So(page.Data, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When user is authorized on a tag of the ledger only", func() {
+			So(ldtesting.SetupAuthorizedTag(
+				DB, md.LedgerID, md.TagIDs[len(md.TagIDs)-1]+1, fake.Word(), ldtesting.AuthorizedUserIDs(outsider),
+			), ShouldBeNil)
+
+			Convey("It should respond without transactions of accounts the user is not authorized on", func() {
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("read:transactions"), ldtesting.WithUser(outsider))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 200)
+				var page transactionsPageDTO
+				So(json.Unmarshal(recorder.Body.Bytes(), &page), ShouldBeNil)
+				So(page.Data, ShouldBeEmpty)
+			})
+
+			Convey("It should respond with summary that does not include amounts of hidden accounts", func() {
+				req := ldtesting.NewRequest("GET", path+"/expense/summary",
+					ldtesting.WithScopeClaim("read:transactions"), ldtesting.WithUser(outsider))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 200)
+				var summary []summaryDTO
+				So(json.Unmarshal(recorder.Body.Bytes(), &summary), ShouldBeNil)
+				for _, item := range summary {
+					So(item.Amount, ShouldEqual, 0)
+				}
+			})
+		})
+
+		Convey("When user is not authorized on the ledger", func() {
+			Convey("It should respond with 404", func() {
+				req := ldtesting.NewRequest("GET", path, ldtesting.WithScopeClaim("read:transactions"), ldtesting.WithUser(outsider))
+				router.CreateHandler().ServeHTTP(recorder, req)
+				So(recorder.Code, ShouldEqual, 404)
+			})
+		})
 	})
 }
@@ -0,0 +1,217 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/rates"
+)
+
+// maxSeriesBuckets limits a number of buckets a single series query may produce
+const maxSeriesBuckets = 1000
+
+// seriesPeriods is a list of supported series periods. Values are postgres date_trunc fields
+var seriesPeriods = map[string]bool{
+	"day":     true,
+	"week":    true,
+	"month":   true,
+	"quarter": true,
+	"year":    true,
+}
+
+type seriesBucketDTO struct {
+	Start time.Time    `json:"start"`
+	End   time.Time    `json:"end"`
+	Tags  []summaryDTO `json:"tags"`
+}
+
+type seriesDTO struct {
+	Period   string            `json:"period"`
+	TimeZone string            `json:"timeZone"`
+	Currency string            `json:"currency"`
+	Buckets  []seriesBucketDTO `json:"buckets"`
+}
+
+type seriesQuery struct {
+	summaryQuery
+	period   string
+	location *time.Location
+}
+
+func newSeriesQuery(ledgerID string, typ string, period string, queryInit ...func(*seriesQuery)) *seriesQuery {
+	now := time.Now()
+	from := now.AddDate(-1, 0, 0)
+	query := &seriesQuery{
+		summaryQuery: summaryQuery{
+			ledgerID: ledgerID,
+			typ:      typ,
+			from:     &from,
+			to:       &now,
+		},
+		period:   period,
+		location: time.UTC,
+	}
+	for _, initFn := range queryInit {
+		initFn(query)
+	}
+	return query
+}
+
+// truncateToPeriod returns start of the period given time belongs to.
+// Weeks start on Monday the same way postgres date_trunc does
+func truncateToPeriod(t time.Time, period string) time.Time {
+	year, month, day := t.Date()
+	switch period {
+	case "week":
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-daysSinceMonday, 0, 0, 0, 0, t.Location())
+	case "month":
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	case "quarter":
+		return time.Date(year, ((month-1)/3)*3+1, 1, 0, 0, 0, 0, t.Location())
+	case "year":
+		return time.Date(year, 1, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// nextPeriod returns start of the period that follows the period started at given time
+func nextPeriod(start time.Time, period string) time.Time {
+	switch period {
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	case "quarter":
+		return start.AddDate(0, 3, 0)
+	case "year":
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// bucketKey identifies a bucket by its start date. Periods are at least a day long
+// so the date is enough and is not affected by DST shifts
+func bucketKey(start time.Time) string {
+	return start.Format("2006-01-02")
+}
+
+func (svc *dbQueryService) processSeriesQuery(ctx context.Context, query *seriesQuery) (*seriesDTO, error) {
+	if query.ledgerID == "" {
+		return nil, errors.New("Please provide ledgerID")
+	}
+	if query.typ == "" {
+		return nil, errors.New("Please provide type")
+	}
+	if query.user == nil {
+		return nil, errors.New("Please provide user")
+	}
+	if !seriesPeriods[query.period] {
+		return nil, fmt.Errorf("Unknown period: %v", query.period)
+	}
+	if query.from == nil || query.to == nil {
+		return nil, errors.New("Please provide from and to")
+	}
+	location := query.location
+	if location == nil {
+		location = time.UTC
+	}
+	logger := logging.FromContext(ctx)
+	logger.Debugf(
+		"Processing series query. LedgerID: %v, type: %v, period: %v, time zone: %v",
+		query.ledgerID, query.typ, query.period, location,
+	)
+
+	currency, err := svc.targetCurrency(ctx, &query.summaryQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := []seriesBucketDTO{}
+	bucketIndexByKey := make(map[string]int)
+	for start := truncateToPeriod(query.from.In(location), query.period); !start.After(*query.to); {
+		if len(buckets) == maxSeriesBuckets {
+			return nil, fmt.Errorf("Series should not have more than %v buckets", maxSeriesBuckets)
+		}
+		end := nextPeriod(start, query.period)
+		bucketIndexByKey[bucketKey(start)] = len(buckets)
+		buckets = append(buckets, seriesBucketDTO{Start: start, End: end})
+		start = end
+	}
+
+	// v1 stores dates as UTC timestamps without time zone
+	dbQuery := svc.summaryScope(ctx, &query.summaryQuery).
+		Select(
+			`date_trunc(?, (trx.date AT TIME ZONE 'UTC') AT TIME ZONE ?) bucket, tg.tag_id tagID, tg.name tagName,
+			acc.currency_code, DATE(trx.date),
+			SUM(CASE trx.type_id WHEN 3 THEN -trx.amount ELSE trx.amount END) amount`,
+			query.period, location.String(),
+		).
+		Group("1, 2, 3, 4, 5")
+
+	logger.WithField("query", dbQuery.QueryExpr()).Debugf("Executing transactions series query")
+
+	rows, err := dbQuery.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type tagTotal struct {
+		summaryDTO
+		amounts map[int]int
+	}
+	converter := rates.NewConverter(svc.rateProvider)
+	totalsByTagID := make(map[int]*tagTotal)
+	for rows.Next() {
+		var bucket, date time.Time
+		var tagID, amount int
+		var tagName, currencyCode string
+		if err = rows.Scan(&bucket, &tagID, &tagName, &currencyCode, &date, &amount); err != nil {
+			return nil, err
+		}
+		if amount, err = converter.Convert(ctx, amount, currencyCode, currency, date); err != nil {
+			return nil, err
+		}
+		bucketIndex, ok := bucketIndexByKey[bucketKey(bucket)]
+		if !ok {
+			// Buckets cover the whole range so it's not expected unless time zone data differs
+			logger.Warnf("Unexpected series bucket: %v", bucket)
+			continue
+		}
+		total := totalsByTagID[tagID]
+		if total == nil {
+			total = &tagTotal{summaryDTO: summaryDTO{TagID: tagID, TagName: tagName}, amounts: make(map[int]int)}
+			totalsByTagID[tagID] = total
+		}
+		total.Amount += amount
+		total.amounts[bucketIndex] += amount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	totals := make([]*tagTotal, 0, len(totalsByTagID))
+	for _, total := range totalsByTagID {
+		totals = append(totals, total)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Amount == totals[j].Amount {
+			return totals[i].TagID < totals[j].TagID
+		}
+		return totals[i].Amount > totals[j].Amount
+	})
+
+	for i := range buckets {
+		buckets[i].Tags = make([]summaryDTO, len(totals))
+		for j, total := range totals {
+			buckets[i].Tags[j] = summaryDTO{TagID: total.TagID, TagName: total.TagName, Amount: total.amounts[i]}
+		}
+	}
+
+	return &seriesDTO{Period: query.period, TimeZone: location.String(), Currency: currency, Buckets: buckets}, nil
+}
@@ -0,0 +1,187 @@
+package transactions
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/internal/ldtesting"
+	"ledger.api/pkg/logging"
+)
+
+func TestTruncateToPeriod(t *testing.T) {
+	Convey("Given a time", t, func() {
+		kiev, err := time.LoadLocation("Europe/Kiev")
+		So(err, ShouldBeNil)
+		// Thursday
+		date := time.Date(2018, 8, 16, 15, 30, 0, 0, kiev)
+
+		Convey("It should truncate to start of the day", func() {
+			So(truncateToPeriod(date, "day"), ShouldResemble, time.Date(2018, 8, 16, 0, 0, 0, 0, kiev))
+		})
+
+		Convey("It should truncate to Monday of the week", func() {
+			So(truncateToPeriod(date, "week"), ShouldResemble, time.Date(2018, 8, 13, 0, 0, 0, 0, kiev))
+			sunday := time.Date(2018, 8, 19, 10, 0, 0, 0, kiev)
+			So(truncateToPeriod(sunday, "week"), ShouldResemble, time.Date(2018, 8, 13, 0, 0, 0, 0, kiev))
+		})
+
+		Convey("It should truncate to start of the month", func() {
+			So(truncateToPeriod(date, "month"), ShouldResemble, time.Date(2018, 8, 1, 0, 0, 0, 0, kiev))
+		})
+
+		Convey("It should truncate to start of the quarter", func() {
+			So(truncateToPeriod(date, "quarter"), ShouldResemble, time.Date(2018, 7, 1, 0, 0, 0, 0, kiev))
+		})
+
+		Convey("It should truncate to start of the year", func() {
+			So(truncateToPeriod(date, "year"), ShouldResemble, time.Date(2018, 1, 1, 0, 0, 0, 0, kiev))
+		})
+
+		Convey("It should return start of the next period", func() {
+			start := time.Date(2018, 1, 1, 0, 0, 0, 0, kiev)
+			So(nextPeriod(start, "day"), ShouldResemble, time.Date(2018, 1, 2, 0, 0, 0, 0, kiev))
+			So(nextPeriod(start, "week"), ShouldResemble, time.Date(2018, 1, 8, 0, 0, 0, 0, kiev))
+			So(nextPeriod(start, "month"), ShouldResemble, time.Date(2018, 2, 1, 0, 0, 0, 0, kiev))
+			So(nextPeriod(start, "quarter"), ShouldResemble, time.Date(2018, 4, 1, 0, 0, 0, 0, kiev))
+			So(nextPeriod(start, "year"), ShouldResemble, time.Date(2019, 1, 1, 0, 0, 0, 0, kiev))
+		})
+	})
+}
+
+func TestProcessSeriesQuery(t *testing.T) {
+	svc := CreateQueryService(DB, testRates)
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given series query", t, func() {
+		user := ldtesting.NewUser()
+		md, err := ldtesting.SetupLedgerData(DB, user)
+		So(err, ShouldBeNil)
+		kiev, err := time.LoadLocation("Europe/Kiev")
+		So(err, ShouldBeNil)
+		tag1 := md.TagIDs[0]
+		tag2 := md.TagIDs[1]
+		acc := ldtesting.TrxRndAcc(md.AccountIDs)
+		withTag := func(tagID int) ldtesting.TransactionSetup {
+			return ldtesting.TrxRndTag([]int{tagID})
+		}
+		trxs := []ldtesting.Transaction{
+			// 2018-01-31 23:30 in Kiev is 21:30 UTC, still January
+			*ldtesting.NewTransaction(acc, withTag(tag1), ldtesting.TrxAmount(100), ldtesting.TrxDate(time.Date(2018, 1, 31, 23, 30, 0, 0, kiev))),
+			// 2018-01-31 22:30 UTC is February 1st in Kiev
+			*ldtesting.NewTransaction(acc, withTag(tag1), ldtesting.TrxAmount(200), ldtesting.TrxDate(time.Date(2018, 1, 31, 22, 30, 0, 0, time.UTC))),
+			*ldtesting.NewTransaction(acc, withTag(tag2), ldtesting.TrxAmount(50), ldtesting.TrxDate(time.Date(2018, 1, 10, 12, 0, 0, 0, kiev))),
+			*ldtesting.NewTransaction(acc, withTag(tag1), ldtesting.TrxAmount(30), ldtesting.TrxRefund, ldtesting.TrxDate(time.Date(2018, 3, 5, 12, 0, 0, 0, kiev))),
+			*ldtesting.NewTransaction(acc, withTag(tag1), ldtesting.TrxAmount(1000), ldtesting.TrxIncome, ldtesting.TrxDate(time.Date(2018, 3, 5, 12, 0, 0, 0, kiev))),
+		}
+		for i := range trxs {
+			trxs[i].Date = trxs[i].Date.UTC()
+		}
+		So(ldtesting.SetupTransactions(DB, trxs), ShouldBeNil)
+		from := time.Date(2018, 1, 1, 0, 0, 0, 0, kiev)
+		to := time.Date(2018, 3, 31, 23, 59, 59, 0, kiev)
+
+		Convey("It should return per tag amounts for every month in user time zone", func() {
+			query := newSeriesQuery(md.LedgerID, "expense", "month", func(q *seriesQuery) {
+				q.user = user
+				q.from = &from
+				q.to = &to
+				q.location = kiev
+			})
+			result, err := svc.processSeriesQuery(ctx, query)
+			So(err, ShouldBeNil)
+			So(result.Period, ShouldEqual, "month")
+			So(result.TimeZone, ShouldEqual, "Europe/Kiev")
+			So(result.Currency, ShouldEqual, md.CurrencyCode)
+			So(result.Buckets, ShouldHaveLength, 3)
+			So(result.Buckets[0].Start, ShouldResemble, time.Date(2018, 1, 1, 0, 0, 0, 0, kiev))
+			So(result.Buckets[0].End, ShouldResemble, time.Date(2018, 2, 1, 0, 0, 0, 0, kiev))
+
+			tag1Name := md.TagsByID[tag1]
+			tag2Name := md.TagsByID[tag2]
+			So(result.Buckets[0].Tags, ShouldResemble, []summaryDTO{
+				summaryDTO{TagID: tag1, TagName: tag1Name, Amount: 100},
+				summaryDTO{TagID: tag2, TagName: tag2Name, Amount: 50},
+			})
+			So(result.Buckets[1].Tags, ShouldResemble, []summaryDTO{
+				summaryDTO{TagID: tag1, TagName: tag1Name, Amount: 200},
+				summaryDTO{TagID: tag2, TagName: tag2Name, Amount: 0},
+			})
+			So(result.Buckets[2].Tags, ShouldResemble, []summaryDTO{
+				summaryDTO{TagID: tag1, TagName: tag1Name, Amount: -30},
+				summaryDTO{TagID: tag2, TagName: tag2Name, Amount: 0},
+			})
+		})
+
+		Convey("It should exclude given tags", func() {
+			query := newSeriesQuery(md.LedgerID, "expense", "quarter", func(q *seriesQuery) {
+				q.user = user
+				q.from = &from
+				q.to = &to
+				q.location = kiev
+				q.excludeTagIDs = []string{fmt.Sprint(tag2)}
+			})
+			result, err := svc.processSeriesQuery(ctx, query)
+			So(err, ShouldBeNil)
+			So(result.Buckets, ShouldHaveLength, 1)
+			So(result.Buckets[0].Tags, ShouldResemble, []summaryDTO{
+				summaryDTO{TagID: tag1, TagName: md.TagsByID[tag1], Amount: 270},
+			})
+		})
+
+		Convey("It should exclude transactions of accounts the user is not authorized on", func() {
+			hiddenAcc, err := ldtesting.SetupAccount(DB, md.LedgerID, ldtesting.AccAuthorizedUsers(ldtesting.NewUser()))
+			So(err, ShouldBeNil)
+			hiddenTrx := ldtesting.NewTransaction(
+				ldtesting.TrxRndAcc([]string{hiddenAcc.AccountID}),
+				withTag(tag2),
+				ldtesting.TrxAmount(500),
+				ldtesting.TrxDate(time.Date(2018, 1, 10, 12, 0, 0, 0, time.UTC)),
+			)
+			So(ldtesting.SetupTransactions(DB, []ldtesting.Transaction{*hiddenTrx}), ShouldBeNil)
+			query := newSeriesQuery(md.LedgerID, "expense", "quarter", func(q *seriesQuery) {
+				q.user = user
+				q.from = &from
+				q.to = &to
+				q.location = kiev
+			})
+			result, err := svc.processSeriesQuery(ctx, query)
+			So(err, ShouldBeNil)
+			So(result.Buckets, ShouldHaveLength, 1)
+			So(result.Buckets[0].Tags, ShouldResemble, []summaryDTO{
+				summaryDTO{TagID: tag1, TagName: md.TagsByID[tag1], Amount: 270},
+				summaryDTO{TagID: tag2, TagName: md.TagsByID[tag2], Amount: 50},
+			})
+		})
+
+		Convey("It should zero fill buckets if there are no transactions", func() {
+			emptyFrom := time.Date(2017, 1, 1, 0, 0, 0, 0, kiev)
+			emptyTo := time.Date(2017, 1, 3, 0, 0, 0, 0, kiev)
+			query := newSeriesQuery(md.LedgerID, "expense", "day", func(q *seriesQuery) {
+				q.user = user
+				q.from = &emptyFrom
+				q.to = &emptyTo
+				q.location = kiev
+			})
+			result, err := svc.processSeriesQuery(ctx, query)
+			So(err, ShouldBeNil)
+			So(result.Buckets, ShouldHaveLength, 3)
+			for _, bucket := range result.Buckets {
+				So(bucket.Tags, ShouldBeEmpty)
+			}
+		})
+
+		Convey("It should fail if there are too many buckets", func() {
+			longFrom := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+			query := newSeriesQuery(md.LedgerID, "expense", "day", func(q *seriesQuery) {
+				q.user = user
+				q.from = &longFrom
+				q.to = &to
+			})
+			_, err := svc.processSeriesQuery(ctx, query)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
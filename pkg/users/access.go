@@ -0,0 +1,28 @@
+package users
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+// AccessibleAccountsCondition matches accounts (aliased as acc) the user owns or is authorized on.
+// Params are returned by AccessibleAccountsParams
+const AccessibleAccountsCondition = "(acc.owner_user_id = ? OR acc.authorized_user_ids LIKE ?)"
+
+// AuthorizedUserIDPattern returns a pattern that matches authorized_user_ids
+// of projections (e.g {100},{101}) that include the user
+func AuthorizedUserIDPattern(user *User) string {
+	return fmt.Sprintf("%%{%v}%%", user.ID)
+}
+
+// AccessibleAccountsParams returns params of AccessibleAccountsCondition
+func AccessibleAccountsParams(user *User) []interface{} {
+	return []interface{}{user.ID, AuthorizedUserIDPattern(user)}
+}
+
+// WithAccessibleAccounts restricts the statement to accounts the user owns or is authorized on.
+// Accounts projection should be aliased as acc, e.g joined to transactions
+func WithAccessibleAccounts(stmt *gorm.DB, user *User) *gorm.DB {
+	return stmt.Where(AccessibleAccountsCondition, AccessibleAccountsParams(user)...)
+}
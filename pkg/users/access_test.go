@@ -0,0 +1,43 @@
+package users_test
+
+import (
+	"fmt"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	. "github.com/smartystreets/goconvey/convey"
+	. "ledger.api/pkg/users"
+)
+
+func TestWithAccessibleAccounts(t *testing.T) {
+	Convey("Given an account shared with a member", t, func() {
+		owner := &User{ID: 1000 + rnd.Intn(100000)}
+		member := &User{ID: owner.ID + 1}
+		outsider := &User{ID: owner.ID + 2}
+		accountID := uuid.NewV4().String()
+		So(DB.Exec(`
+			INSERT INTO projections_accounts(
+				ledger_id, aggregate_id, sequential_number, owner_user_id, authorized_user_ids, currency_code, name
+			)
+			VALUES(?, ?, 1, ?, ?, 'UAH', 'Account 1')
+			`, uuid.NewV4().String(), accountID, owner.ID, fmt.Sprintf("{%v},{%v}", owner.ID, member.ID),
+		).Error, ShouldBeNil)
+
+		findAccessible := func(user *User) []string {
+			var ids []string
+			So(WithAccessibleAccounts(DB.Table("projections_accounts acc"), user).
+				Where("acc.aggregate_id = ?", accountID).
+				Pluck("acc.aggregate_id", &ids).Error, ShouldBeNil)
+			return ids
+		}
+
+		Convey("It should match accounts the user owns or is authorized on", func() {
+			So(findAccessible(owner), ShouldResemble, []string{accountID})
+			So(findAccessible(member), ShouldResemble, []string{accountID})
+		})
+
+		Convey("It should not match accounts of other users", func() {
+			So(findAccessible(outsider), ShouldBeEmpty)
+		})
+	})
+}
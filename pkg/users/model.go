@@ -1,6 +1,78 @@
 package users
 
+import (
+	"context"
+	"errors"
+
+	"github.com/jinzhu/gorm"
+	"ledger.api/pkg/logging"
+	"ledger.api/pkg/tracing"
+)
+
+// ErrUserNotFound is returned when no user is mapped to a given subject
+var ErrUserNotFound = errors.New("User not found")
+
 // User object
 type User struct {
-	ID string
+	// ID is a v1 user id. The same id is used in owner_user_id and
+	// authorized_user_ids columns of projections
+	ID int `gorm:"column:user_id"`
+
+	// Subject is an auth0 subject (sub claim) the user is identified by
+	Subject string `gorm:"column:subject"`
+}
+
+// QueryService is a service to resolve ledger users
+type QueryService interface {
+	// GetUserBySubject returns a user mapped to a given auth0 subject
+	// or ErrUserNotFound if there is no such mapping
+	GetUserBySubject(ctx context.Context, subject string) (*User, error)
+}
+
+type dbQueryService struct {
+	db *gorm.DB
+}
+
+func (svc *dbQueryService) GetUserBySubject(ctx context.Context, subject string) (*User, error) {
+	if subject == "" {
+		return nil, errors.New("Please provide subject")
+	}
+	logger := logging.FromContext(ctx)
+	logger.Debugf("Resolving user by subject: %v", subject)
+	user := User{}
+	err := tracing.DB(ctx, svc.db).Table("user_identities").
+		Select("user_id, subject").
+		Where("subject = ?", subject).
+		Take(&user).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CreateQueryService initializes a new instance of the query service
+func CreateQueryService(db *gorm.DB) QueryService {
+	svc := dbQueryService{db: db}
+	return &svc
+}
+
+type contextKey string
+
+const userKey contextKey = "user"
+
+// ContextWithUser creates a new context with the user initialized
+func ContextWithUser(parent context.Context, user *User) context.Context {
+	return context.WithValue(parent, userKey, user)
+}
+
+// FromContext returns an instance of the User from context
+func FromContext(ctx context.Context) *User {
+	user := ctx.Value(userKey)
+	if user == nil {
+		return nil
+	}
+	return user.(*User)
 }
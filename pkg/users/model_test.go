@@ -0,0 +1,81 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/icrowley/fake"
+	. "github.com/smartystreets/goconvey/convey"
+	"ledger.api/pkg/logging"
+	. "ledger.api/pkg/users"
+)
+
+var rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+func setupUserIdentity(subject string, userID int) error {
+	return DB.Exec(`
+		INSERT INTO user_identities(subject, user_id)
+		VALUES(?,?)
+		`, subject, userID).Error
+}
+
+func TestGetUserBySubject(t *testing.T) {
+	svc := CreateQueryService(DB)
+	ctx := logging.CreateContext(context.Background(), logging.NewTestLogger())
+
+	Convey("Given users query service", t, func() {
+		subject1 := fmt.Sprintf("auth0|%v", fake.CharactersN(24))
+		subject2 := fmt.Sprintf("google-oauth2|%v", fake.CharactersN(24))
+		userID1 := 1 + rnd.Intn(1000000)
+		userID2 := userID1 + 1
+		So(setupUserIdentity(subject1, userID1), ShouldBeNil)
+		So(setupUserIdentity(subject2, userID2), ShouldBeNil)
+
+		Convey("When subject is mapped", func() {
+			Convey("It should return v1 user of the first subject", func() {
+				user, err := svc.GetUserBySubject(ctx, subject1)
+				So(err, ShouldBeNil)
+				So(user, ShouldResemble, &User{ID: userID1, Subject: subject1})
+			})
+
+			Convey("It should return v1 user of the second subject", func() {
+				user, err := svc.GetUserBySubject(ctx, subject2)
+				So(err, ShouldBeNil)
+				So(user, ShouldResemble, &User{ID: userID2, Subject: subject2})
+			})
+		})
+
+		Convey("When subject is not mapped", func() {
+			Convey("It should return ErrUserNotFound", func() {
+				user, err := svc.GetUserBySubject(ctx, fmt.Sprintf("auth0|%v", fake.CharactersN(24)))
+				So(user, ShouldBeNil)
+				So(err, ShouldEqual, ErrUserNotFound)
+			})
+		})
+
+		Convey("When subject is empty", func() {
+			Convey("It should return error", func() {
+				_, err := svc.GetUserBySubject(ctx, "")
+				So(err, ShouldResemble, errors.New("Please provide subject"))
+			})
+		})
+	})
+}
+
+func TestUserContext(t *testing.T) {
+	Convey("Given user context", t, func() {
+		Convey("It should return user set to context", func() {
+			user := &User{ID: rnd.Int(), Subject: fake.Characters()}
+			ctx := ContextWithUser(context.Background(), user)
+			So(FromContext(ctx), ShouldEqual, user)
+		})
+
+		Convey("It should return nil if no user set", func() {
+			So(FromContext(context.Background()), ShouldBeNil)
+		})
+	})
+}